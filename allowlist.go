@@ -0,0 +1,124 @@
+package schema
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrNotAllowlisted is returned by Apply with the AllowlistEnforce policy
+// when a planned migration is missing from the allowlist, or its checksum
+// differs from the reviewed one
+var ErrNotAllowlisted = errors.New("migration is not in the allowlist")
+
+// AllowlistPolicy chooses what Apply does with planned migrations which
+// aren't in the Migrator's Allowlist
+type AllowlistPolicy int
+
+const (
+	// AllowlistOff ignores the allowlist
+	AllowlistOff AllowlistPolicy = iota
+	// AllowlistWarn logs migrations which aren't allowlisted and applies
+	// them anyway
+	AllowlistWarn
+	// AllowlistEnforce fails Apply with ErrNotAllowlisted before any
+	// migration runs
+	AllowlistEnforce
+)
+
+// Allowlist maps the IDs of reviewed migrations to the checksums of their
+// scripts, as recorded in the tracking table. Allowlisting checksums means
+// a migration changed after review is refused too.
+type Allowlist map[string]string
+
+// NewAllowlist creates an Allowlist of the migrations, to be reviewed and
+// committed alongside them
+func NewAllowlist(migrations []*Migration) Allowlist {
+	allowlist := make(Allowlist, len(migrations))
+	for _, migration := range migrations {
+		allowlist[migration.ID] = migration.checksum()
+	}
+	return allowlist
+}
+
+// ReadAllowlist reads an allowlist with a checksum and a migration ID on each
+// line, separated by whitespace, in the format written by WriteTo. Blank
+// lines and lines starting with # are ignored.
+func ReadAllowlist(r io.Reader) (Allowlist, error) {
+	allowlist := make(Allowlist)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		i := strings.IndexAny(text, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("allowlist line %d: expected a checksum and a migration ID", line)
+		}
+		allowlist[strings.TrimSpace(text[i:])] = text[:i]
+	}
+	return allowlist, scanner.Err()
+}
+
+// LoadAllowlist reads an allowlist file. See ReadAllowlist.
+func LoadAllowlist(path string) (Allowlist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadAllowlist(f)
+}
+
+// WriteTo writes the allowlist with one checksum and migration ID per line,
+// sorted by ID so that changes are easy to review
+func (a Allowlist) WriteTo(w io.Writer) (int64, error) {
+	ids := make([]string, 0, len(a))
+	for id := range a {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var written int64
+	for _, id := range ids {
+		n, err := fmt.Fprintf(w, "%s %s\n", a[id], id)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// checkAllowlist applies the Migrator's AllowlistPolicy to the planned
+// migrations
+func (m Migrator) checkAllowlist(plan []*Migration) error {
+	if m.AllowlistPolicy == AllowlistOff {
+		return nil
+	}
+	refused := make([]string, 0)
+	for _, migration := range plan {
+		checksum, exists := m.Allowlist[migration.ID]
+		switch {
+		case !exists:
+			refused = append(refused, fmt.Sprintf("'%s' is not allowlisted", migration.ID))
+		case checksum != migration.checksum():
+			refused = append(refused, fmt.Sprintf("'%s' has changed since it was allowlisted", migration.ID))
+		}
+	}
+	if len(refused) == 0 {
+		return nil
+	}
+	if m.AllowlistPolicy == AllowlistEnforce {
+		return fmt.Errorf("%w: %s", ErrNotAllowlisted, strings.Join(refused, ", "))
+	}
+	for _, reason := range refused {
+		m.log("Warning: Migration " + reason)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package schema
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAllowlistRoundTrip(t *testing.T) {
+	allowlist := NewAllowlist([]*Migration{
+		{ID: "2020-01-02 Second", Script: "SELECT 2"},
+		{ID: "2020-01-01 First", Script: "SELECT 1"},
+	})
+	var buf bytes.Buffer
+	if _, err := allowlist.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(strings.Split(buf.String(), "\n")[0], " 2020-01-01 First") {
+		t.Errorf("Expected the allowlist sorted by ID. Got:\n%s", buf.String())
+	}
+
+	read, err := ReadAllowlist(strings.NewReader("# reviewed by ops\n\n" + buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, allowlist) {
+		t.Errorf("Expected %v. Got %v", allowlist, read)
+	}
+
+	if _, err = ReadAllowlist(strings.NewReader("checksum-only\n")); err == nil {
+		t.Error("Expected an error for a line without an ID")
+	}
+}
+
+func TestCheckAllowlist(t *testing.T) {
+	reviewed := &Migration{ID: "2020-01-01 Reviewed", Script: "SELECT 1"}
+	allowlist := NewAllowlist([]*Migration{reviewed})
+	changed := &Migration{ID: "2020-01-01 Reviewed", Script: "SELECT 2"}
+	unknown := &Migration{ID: "2020-01-02 Unknown", Script: "SELECT 1"}
+
+	m := NewMigrator(WithAllowlist(allowlist, AllowlistEnforce))
+	if err := m.checkAllowlist([]*Migration{reviewed}); err != nil {
+		t.Error(err)
+	}
+	err := m.checkAllowlist([]*Migration{changed, unknown})
+	if !errors.Is(err, ErrNotAllowlisted) || !strings.Contains(err.Error(), "changed") || !strings.Contains(err.Error(), "2020-01-02 Unknown") {
+		t.Errorf("Expected both migrations to be refused. Got %v", err)
+	}
+
+	m = NewMigrator(WithAllowlist(allowlist, AllowlistWarn))
+	if err = m.checkAllowlist([]*Migration{unknown}); err != nil {
+		t.Errorf("Expected only a warning. Got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// AuditFindingKind names a kind of discrepancy found by Audit
+type AuditFindingKind string
+
+// The kinds of discrepancy found by Audit
+const (
+	// AuditMissingSource is an applied migration which is missing from the
+	// supplied migrations
+	AuditMissingSource AuditFindingKind = "missing-source"
+	// AuditDuplicateRow is a migration recorded more than once in the
+	// tracking table
+	AuditDuplicateRow AuditFindingKind = "duplicate-row"
+	// AuditChecksumDrift is an applied migration whose script has changed
+	// since it was applied
+	AuditChecksumDrift AuditFindingKind = "checksum-drift"
+	// AuditOutOfOrder is a migration which was applied, or is pending, out
+	// of ID order, such as one merged from a long-lived branch
+	AuditOutOfOrder AuditFindingKind = "out-of-order"
+	// AuditIncomplete is a batched migration which has started but not
+	// finished, or a migration which failed after some of its statements
+	// were committed
+	AuditIncomplete AuditFindingKind = "incomplete"
+)
+
+// AuditFinding is a single discrepancy between the tracking table and the
+// supplied migrations
+type AuditFinding struct {
+	Kind   AuditFindingKind `json:"kind"`
+	ID     string           `json:"id"`
+	Detail string           `json:"detail"`
+}
+
+// AuditReport lists every discrepancy between the tracking table and the
+// supplied migrations. Its JSON form is intended for compliance records.
+type AuditReport struct {
+	AuditedAt time.Time `json:"audited_at"`
+	// Applied is the number of rows in the tracking table
+	Applied int `json:"applied"`
+	// Sources is the number of supplied migrations
+	Sources  int             `json:"sources"`
+	Pending  []string        `json:"pending"`
+	Findings []*AuditFinding `json:"findings"`
+}
+
+// Clean returns whether the audit found no discrepancies. Pending
+// migrations are not discrepancies unless they are out of order.
+func (r *AuditReport) Clean() bool {
+	return len(r.Findings) == 0
+}
+
+// WriteJSON writes the report to w as indented JSON
+func (r *AuditReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// Audit cross-checks every row of the tracking table against the supplied
+// migrations without writing anything. See AuditContext.
+func (m Migrator) Audit(db *sql.DB, migrations []*Migration) (*AuditReport, error) {
+	return m.AuditContext(context.Background(), db, migrations)
+}
+
+// AuditContext cross-checks every row of the tracking table against the
+// supplied migrations, and reports applied migrations with no source,
+// duplicate rows, checksum drift, unfinished batches, and migrations
+// applied or pending out of ID order. An error is only returned when the
+// tracking table can't be read. Like VerifyContext, it reads in a
+// transaction begun with the Migrator's ReadTxOptions and takes no lock.
+func (m Migrator) AuditContext(ctx context.Context, db *sql.DB, migrations []*Migration) (*AuditReport, error) {
+	if db == nil {
+		return nil, ErrNilDB
+	}
+	var rows []*AppliedMigration
+	err := m.readTransaction(ctx, db, func(tx *sql.Tx) (err error) {
+		rows, err = m.appliedRows(contextQueryer{ctx: ctx, db: tx})
+		return err
+	})
+	if err != nil {
+		return nil, m.redactError(err)
+	}
+	return m.audit(rows, m.forDialect(migrations), time.Now()), nil
+}
+
+// audit builds the AuditReport for the rows of the tracking table
+func (m Migrator) audit(rows []*AppliedMigration, migrations []*Migration, now time.Time) *AuditReport {
+	report := &AuditReport{
+		AuditedAt: now.UTC(),
+		Applied:   len(rows),
+		Sources:   len(migrations),
+		Pending:   make([]string, 0),
+		Findings:  make([]*AuditFinding, 0),
+	}
+	add := func(kind AuditFindingKind, id, detail string, args ...interface{}) {
+		report.Findings = append(report.Findings, &AuditFinding{Kind: kind, ID: id, Detail: fmt.Sprintf(detail, args...)})
+	}
+
+	sources := make(map[string]*Migration, len(migrations))
+	for _, migration := range migrations {
+		sources[migration.ID] = migration
+	}
+
+	applied := make(map[string]*AppliedMigration, len(rows))
+	for _, row := range rows {
+		if _, exists := applied[row.ID]; exists {
+			add(AuditDuplicateRow, row.ID, "recorded again at %s", row.AppliedAt.UTC().Format(time.RFC3339))
+			continue
+		}
+		applied[row.ID] = row
+
+		source, exists := sources[row.ID]
+		_, inProgress := batchProgress(row)
+		committed, partial := row.Partial()
+		switch {
+		case !exists:
+			add(AuditMissingSource, row.ID, "applied at %s, but no migration has this ID", row.AppliedAt.UTC().Format(time.RFC3339))
+		case inProgress:
+			add(AuditIncomplete, row.ID, "batches have started, but not finished")
+		case partial:
+			add(AuditIncomplete, row.ID, "failed after committing %d statements", committed)
+		case !m.matches(row, source):
+			add(AuditChecksumDrift, row.ID, "applied with checksum %s, but the script's checksum is now %s", row.Checksum, m.checksum(source))
+		}
+	}
+
+	// Rows are applied in ID order, so a row applied after one which sorts
+	// later was out of order. Always migrations are rewritten on every run.
+	byTime := make([]*AppliedMigration, 0, len(applied))
+	for _, row := range applied {
+		if source, exists := sources[row.ID]; !exists || !source.Always {
+			byTime = append(byTime, row)
+		}
+	}
+	sort.SliceStable(byTime, func(i, j int) bool {
+		if byTime[i].AppliedAt.Equal(byTime[j].AppliedAt) {
+			return byTime[i].ID < byTime[j].ID
+		}
+		return byTime[i].AppliedAt.Before(byTime[j].AppliedAt)
+	})
+	var latest *AppliedMigration
+	for _, row := range byTime {
+		if latest != nil && row.ID < latest.ID {
+			add(AuditOutOfOrder, row.ID, "applied after '%s', which sorts later", latest.ID)
+			continue
+		}
+		latest = row
+	}
+
+	sorted := make([]*Migration, len(migrations))
+	copy(sorted, migrations)
+	SortMigrations(sorted)
+	for _, migration := range sorted {
+		if _, exists := applied[migration.ID]; exists {
+			continue
+		}
+		report.Pending = append(report.Pending, migration.ID)
+		if latest != nil && migration.ID < latest.ID {
+			add(AuditOutOfOrder, migration.ID, "pending, but sorts before applied migration '%s'", latest.ID)
+		}
+	}
+
+	return report
+}
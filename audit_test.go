@@ -0,0 +1,53 @@
+package schema
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAudit(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	migrations := []*Migration{
+		{ID: "2020-01-01 A", Script: "CREATE TABLE a (id INTEGER)"},
+		{ID: "2020-01-02 B", Script: "CREATE TABLE b (id TEXT)"},
+		{ID: "2020-01-03 C", Script: "CREATE TABLE c (id INTEGER)"},
+		{ID: "2020-01-04 D", Script: "CREATE TABLE d (id INTEGER)"},
+		{ID: "2020-01-05 E", Script: "CREATE TABLE e (id INTEGER)"},
+	}
+	rows := []*AppliedMigration{
+		{Migration: Migration{ID: "2020-01-01 A"}, Checksum: migrations[0].checksum(), AppliedAt: day(1)},
+		{Migration: Migration{ID: "2020-01-01 A"}, Checksum: migrations[0].checksum(), AppliedAt: day(2)},
+		{Migration: Migration{ID: "2020-01-02 B"}, Checksum: "changed", AppliedAt: day(2)},
+		{Migration: Migration{ID: "2020-01-03 C"}, Checksum: migrations[2].checksum(), AppliedAt: day(9)},
+		{Migration: Migration{ID: "2020-01-05 E"}, Checksum: migrations[4].checksum(), AppliedAt: day(5)},
+		{Migration: Migration{ID: "2020-01-06 Removed"}, Checksum: "x", AppliedAt: day(6)},
+	}
+
+	report := NewMigrator().audit(rows, migrations, day(10))
+	expected := []AuditFinding{
+		{Kind: AuditDuplicateRow, ID: "2020-01-01 A"},
+		{Kind: AuditChecksumDrift, ID: "2020-01-02 B"},
+		{Kind: AuditMissingSource, ID: "2020-01-06 Removed"},
+		{Kind: AuditOutOfOrder, ID: "2020-01-03 C"},
+		{Kind: AuditOutOfOrder, ID: "2020-01-04 D"},
+	}
+	if len(report.Findings) != len(expected) {
+		t.Fatalf("Expected %d findings. Got %d", len(expected), len(report.Findings))
+	}
+	for i, finding := range report.Findings {
+		if finding.Kind != expected[i].Kind || finding.ID != expected[i].ID {
+			t.Errorf("Expected finding %d to be %s for %s. Got %s for %s (%s)",
+				i, expected[i].Kind, expected[i].ID, finding.Kind, finding.ID, finding.Detail)
+		}
+	}
+	if report.Clean() || report.Applied != 6 || report.Sources != 5 {
+		t.Errorf("Unexpected report totals: %+v", report)
+	}
+	if len(report.Pending) != 1 || report.Pending[0] != "2020-01-04 D" {
+		t.Errorf("Expected D to be pending. Got %v", report.Pending)
+	}
+
+	if report = NewMigrator().audit(rows[:1], migrations[:1], day(10)); !report.Clean() {
+		t.Errorf("Expected a clean audit. Got %+v", report.Findings)
+	}
+}
@@ -0,0 +1,201 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBatchSize is the number of keys covered by each batch of a Batch
+// which doesn't set its Size
+const DefaultBatchSize = 1000
+
+// batchProgressPrefix marks the checksum of a migration whose batches are
+// still being executed. The rest of the checksum is the last key processed.
+const batchProgressPrefix = "batch:"
+
+// Batch describes a large data migration, such as a backfill, which runs in
+// keyed batches that are committed separately. Locks are only held for the
+// duration of one batch, and progress is recorded in the migration's row of
+// the tracking table after every batch, so an interrupted migration resumes
+// where it left off on the next Apply.
+//
+// Keys must be integers. The range of keys is read once when the migration
+// starts, so rows inserted afterwards aren't included. A migration with a
+// Batch commits its batches independently even on dialects with
+// transactional DDL, so it can't be rolled back as a whole, and it can't be
+// used with dialects which lock inside the migration transaction. Batches are
+// not included in the output of GenerateSQL.
+type Batch struct {
+	// Statement is executed once per batch with two parameters, the
+	// exclusive lower and inclusive upper key of the batch, written with
+	// the dialect's placeholders. For example:
+	//   UPDATE users SET active = true WHERE id > $1 AND id <= $2
+	Statement string
+
+	// KeyRange is a query returning the minimum and maximum keys, such as
+	// SELECT MIN(id), MAX(id) FROM users
+	KeyRange string
+
+	// Size is the number of keys covered by each batch. It defaults to
+	// DefaultBatchSize.
+	Size int64
+
+	// Sleep is how long to pause between batches, giving replication and
+	// other workloads a chance to catch up
+	Sleep time.Duration
+}
+
+// batchProgress returns the last key processed by the migration recorded in
+// the applied migration, and whether it is a batched migration in progress
+func batchProgress(applied *AppliedMigration) (int64, bool) {
+	if applied == nil || !strings.HasPrefix(applied.Checksum, batchProgressPrefix) {
+		return 0, false
+	}
+	key, err := strconv.ParseInt(strings.TrimPrefix(applied.Checksum, batchProgressPrefix), 10, 64)
+	return key, err == nil
+}
+
+// runBatchedMigration executes the migration's Script and then each of its
+// batches in separate transactions on the connection. When progress is
+// non-nil, the migration was interrupted and resumes after the last key it
+// recorded. It returns whether the migration was skipped because of its
+// OnlyIf condition or precondition.
+func (m Migrator) runBatchedMigration(ctx context.Context, conn *sql.Conn, migration *Migration, progress *AppliedMigration) (skip bool, err error) {
+	batch := migration.Batch
+	size := batch.Size
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	tableName := m.QuotedTableName()
+	updateSQL, err := m.updateSQL(tableName)
+	if err != nil {
+		return false, fmt.Errorf("Migration '%s' Failed:\n%w", migration.ID, err)
+	}
+	startedAt := time.Now()
+	record := func(tx *sql.Tx, recordSQL, checksum string) error {
+		_, err := m.exec(ctx, tx, recordSQL, migration.ID, checksum, time.Since(startedAt).Milliseconds(), startedAt.UTC())
+		return err
+	}
+
+	var lower, upper int64
+	err = m.transaction(ctx, conn, func(tx *sql.Tx) error {
+		err := m.setupTransaction(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		// Always migrations which have completed before are updated
+		recordSQL := m.Dialect.InsertSQL(tableName)
+		if progress != nil {
+			recordSQL = updateSQL
+		}
+
+		// Conditions are checked before the KeyRange query, which may
+		// depend on what they check for
+		key, inProgress := batchProgress(progress)
+		if !inProgress {
+			var reason string
+			skip, reason, err = m.checkConditions(ctx, tx, migration)
+			if err != nil {
+				return err
+			}
+			if skip {
+				m.log(fmt.Sprintf("Migration '%s' skipped because %s\n", migration.ID, reason))
+				err = record(tx, recordSQL, m.skippedChecksum(migration))
+				if err != nil {
+					return err
+				}
+				return m.recordBuild(ctx, tx, migration, startedAt)
+			}
+		}
+
+		var min, max sql.NullInt64
+		queriedAt := time.Now()
+		err = tx.QueryRowContext(ctx, batch.KeyRange).Scan(&min, &max)
+		m.logQuery(batch.KeyRange, nil, queriedAt, err)
+		if err != nil {
+			return fmt.Errorf("Migration '%s' KeyRange query failed:\n%w", migration.ID, err)
+		}
+		upper = max.Int64
+
+		if inProgress {
+			lower = key
+			return nil
+		}
+
+		if migration.Script != "" {
+			err = m.execScript(ctx, tx, migration)
+			if err != nil {
+				return err
+			}
+			err = m.commentObjects(ctx, tx, migration)
+			if err != nil {
+				return err
+			}
+		}
+		// An empty key range leaves nothing to process
+		lower = upper
+		if min.Valid {
+			lower = min.Int64 - 1
+		}
+		return record(tx, recordSQL, batchProgressPrefix+strconv.FormatInt(lower, 10))
+	})
+	if err != nil || skip {
+		return skip, err
+	}
+
+	for lower < upper {
+		next := lower + size
+		if next > upper {
+			next = upper
+		}
+		err = m.transaction(ctx, conn, func(tx *sql.Tx) error {
+			err := m.setupTransaction(ctx, tx)
+			if err != nil {
+				return err
+			}
+			_, err = m.exec(ctx, tx, batch.Statement, lower, next)
+			if err != nil {
+				return fmt.Errorf("Migration '%s' Failed in batch (%d, %d]:\n%w", migration.ID, lower, next, err)
+			}
+			return record(tx, updateSQL, batchProgressPrefix+strconv.FormatInt(next, 10))
+		})
+		if err != nil {
+			return false, err
+		}
+		lower = next
+		m.log(fmt.Sprintf("Migration '%s' processed keys up to %d of %d\n", migration.ID, lower, upper))
+
+		if batch.Sleep > 0 && lower < upper {
+			select {
+			case <-ctx.Done():
+				return false, ctx.Err()
+			case <-time.After(batch.Sleep):
+			}
+		}
+	}
+
+	return false, m.transaction(ctx, conn, func(tx *sql.Tx) error {
+		if migration.Verify != "" {
+			err := m.verifyMigration(ctx, tx, migration)
+			if err != nil {
+				return err
+			}
+		}
+		m.log(fmt.Sprintf("Migration '%s' applied in %s\n", migration.ID, time.Since(startedAt)))
+		m.checkSlow(migration, time.Since(startedAt))
+		err := record(tx, updateSQL, m.checksum(migration))
+		if err != nil {
+			return err
+		}
+		err = m.recordScript(ctx, tx, migration, startedAt)
+		if err != nil {
+			return err
+		}
+		return m.recordBuild(ctx, tx, migration, startedAt)
+	})
+}
@@ -0,0 +1,167 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// BlueGreen rolls out migrations on Postgres by applying them to a copy of
+// the live schema, verifying the copy, and then switching the search_path so
+// that new sessions use it. The live schema is untouched until the switch,
+// which keeps downtime close to zero and makes rolling back a matter of
+// switching the search_path back.
+//
+// Cloning copies the tables in the live schema, including their columns,
+// defaults, constraints and indexes, and the rows of the tracking table.
+// Views, functions, sequences and other objects are not cloned, and defaults
+// which use a sequence keep using the live schema's sequence. Foreign keys
+// between cloned tables aren't copied by Postgres.
+type BlueGreen struct {
+	// Migrator applies the migrations. Its SchemaName is the live schema,
+	// which defaults to "public", and its tracking table must be in it.
+	Migrator Migrator
+	DB       *sql.DB
+
+	// Target is the new schema which receives the clone. It must not exist.
+	Target string
+
+	// CopyData copies the rows of every table, rather than only those of
+	// the tracking table
+	CopyData bool
+
+	// Verify, when set, is called after the migrations have been applied
+	// to the target schema and before Prepare returns
+	Verify func(ctx context.Context, db *sql.DB, schema string) error
+
+	// Role, when set, has its search_path switched instead of the
+	// database's, which is useful when several applications share a
+	// database
+	Role string
+}
+
+// Live returns the name of the live schema
+func (b *BlueGreen) Live() string {
+	if b.Migrator.SchemaName == "" {
+		return "public"
+	}
+	return b.Migrator.SchemaName
+}
+
+// TargetMigrator returns a Migrator which applies migrations to the target
+// schema. Unqualified names in migration scripts resolve to the target
+// schema, since its search_path is set on the migration connection.
+func (b *BlueGreen) TargetMigrator() Migrator {
+	target := b.Migrator
+	target.SchemaName = b.Target
+	return WithSessionSetup(fmt.Sprintf("SET search_path TO %s", Postgres.quotedIdent(b.Target)))(target)
+}
+
+// Prepare clones the live schema into the target schema, applies the
+// migrations there, and verifies the result. The live schema isn't changed.
+func (b *BlueGreen) Prepare(ctx context.Context, migrations []*Migration) error {
+	if b.DB == nil {
+		return ErrNilDB
+	}
+	err := b.clone(ctx)
+	if err != nil {
+		return err
+	}
+
+	target := b.TargetMigrator()
+	err = target.ApplyContext(ctx, b.DB, migrations)
+	if err != nil {
+		return err
+	}
+	err = NewChecker(target, b.DB, migrations).Check(ctx)
+	if err != nil {
+		return err
+	}
+	if b.Verify != nil {
+		return b.Verify(ctx, b.DB, b.Target)
+	}
+	return nil
+}
+
+// Switch sets the search_path of the database (or Role) to the target
+// schema. Sessions which are already open keep their search_path, so
+// connection pools should be recycled afterwards.
+func (b *BlueGreen) Switch(ctx context.Context) error {
+	return b.setSearchPath(ctx, b.Target)
+}
+
+// Rollback sets the search_path of the database (or Role) back to the live
+// schema
+func (b *BlueGreen) Rollback(ctx context.Context) error {
+	return b.setSearchPath(ctx, b.Live())
+}
+
+func (b *BlueGreen) setSearchPath(ctx context.Context, schemaName string) error {
+	if b.DB == nil {
+		return ErrNilDB
+	}
+	target := "ROLE " + Postgres.quotedIdent(b.Role)
+	if b.Role == "" {
+		var database string
+		queriedAt := time.Now()
+		err := b.DB.QueryRowContext(ctx, "SELECT current_database()").Scan(&database)
+		b.Migrator.logQuery("SELECT current_database()", nil, queriedAt, err)
+		if err != nil {
+			return err
+		}
+		target = "DATABASE " + Postgres.quotedIdent(database)
+	}
+	_, err := b.Migrator.exec(ctx, b.DB, fmt.Sprintf("ALTER %s SET search_path TO %s", target, Postgres.quotedIdent(schemaName)))
+	return err
+}
+
+// clone creates the target schema with a copy of each table in the live
+// schema
+func (b *BlueGreen) clone(ctx context.Context) error {
+	live, target := Postgres.quotedIdent(b.Live()), Postgres.quotedIdent(b.Target)
+	return b.Migrator.transaction(ctx, b.DB, func(tx *sql.Tx) error {
+		_, err := b.Migrator.exec(ctx, tx, fmt.Sprintf("CREATE SCHEMA %s", target))
+		if err != nil {
+			return err
+		}
+
+		rows, err := b.Migrator.query(ctx, tx, `
+			SELECT table_name FROM information_schema.tables
+			WHERE table_schema = $1 AND table_type = 'BASE TABLE'
+			ORDER BY table_name`, b.Live())
+		if err != nil {
+			return err
+		}
+		tables := make([]string, 0)
+		for rows.Next() {
+			var table string
+			err = rows.Scan(&table)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			tables = append(tables, table)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		for _, table := range tables {
+			from := live + "." + Postgres.quotedIdent(table)
+			to := target + "." + Postgres.quotedIdent(table)
+			_, err = b.Migrator.exec(ctx, tx, fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING ALL)", to, from))
+			if err != nil {
+				return fmt.Errorf("Cloning table '%s' failed:\n%w", table, err)
+			}
+			if b.CopyData || table == b.Migrator.TableName {
+				_, err = b.Migrator.exec(ctx, tx, fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", to, from))
+				if err != nil {
+					return fmt.Errorf("Copying table '%s' failed:\n%w", table, err)
+				}
+			}
+		}
+		return nil
+	})
+}
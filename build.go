@@ -0,0 +1,105 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// BuildsTableSuffix is appended to the name of the tracking table to name
+// the table in which build metadata is recorded
+const BuildsTableSuffix = "_builds"
+
+// ErrBuildsNotSupported is returned by Apply when the Migrator has build
+// metadata to record, but its dialect doesn't implement BuildRecorder
+var ErrBuildsNotSupported = errors.New("dialect does not support recording build metadata")
+
+// AppliedBuild records the build which applied a migration. A migration
+// which runs more than once (see Migration.Always) has a record for each run.
+type AppliedBuild struct {
+	ID        string
+	Build     string
+	AppliedAt time.Time
+}
+
+// VCSRevision returns the version control revision the running binary was
+// built from, such as a git commit hash, followed by "-dirty" when the
+// working tree had uncommitted changes. It returns an empty string when the
+// binary wasn't built with VCS stamping.
+func VCSRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision != "" && modified {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// QuotedBuildsTableName returns the dialect-quoted fully-qualified name of
+// the table in which build metadata is recorded
+func (m Migrator) QuotedBuildsTableName() string {
+	return m.Dialect.QuotedTableName(m.SchemaName, m.TableName+BuildsTableSuffix)
+}
+
+// createBuildsTable creates the build metadata table when the Migrator has
+// build metadata to record
+func (m Migrator) createBuildsTable(ctx context.Context, tx *sql.Tx) error {
+	if m.BuildMetadata == "" {
+		return nil
+	}
+	recorder, ok := m.Dialect.(BuildRecorder)
+	if !ok {
+		return ErrBuildsNotSupported
+	}
+	_, err := m.exec(ctx, tx, recorder.CreateBuildsSQL(m.QuotedBuildsTableName()))
+	return err
+}
+
+// recordBuild records the Migrator's build metadata for the migration
+func (m Migrator) recordBuild(ctx context.Context, tx *sql.Tx, migration *Migration, appliedAt time.Time) error {
+	recorder, ok := m.Dialect.(BuildRecorder)
+	if m.BuildMetadata == "" || !ok {
+		return nil
+	}
+	_, err := m.exec(ctx, tx, recorder.InsertBuildSQL(m.QuotedBuildsTableName()), migration.ID, m.BuildMetadata, appliedAt.UTC())
+	return err
+}
+
+// AppliedBuilds retrieves the recorded build metadata in the order the
+// migrations were applied, so that a schema change can be traced back to
+// the deploy which introduced it
+func (m Migrator) AppliedBuilds(db Queryer) ([]*AppliedBuild, error) {
+	selectSQL := fmt.Sprintf(`SELECT id, build, applied_at FROM %s ORDER BY applied_at, id`, m.QuotedBuildsTableName())
+	startedAt := time.Now()
+	rows, err := db.Query(selectSQL)
+	m.logQuery(selectSQL, nil, startedAt, err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	builds := make([]*AppliedBuild, 0)
+	for rows.Next() {
+		build := &AppliedBuild{}
+		err = rows.Scan(&build.ID, &build.Build, timestamp(&build.AppliedAt))
+		if err != nil {
+			return nil, err
+		}
+		builds = append(builds, build)
+	}
+	return builds, rows.Err()
+}
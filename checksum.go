@@ -0,0 +1,90 @@
+package schema
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// ChecksumScope chooses what the checksum recorded for each migration
+// covers, and so which changes to an applied migration are reported as
+// drift. A non-default scope is recorded with the checksum, and each
+// applied migration is verified with the scope it was recorded with, so
+// changing the scope doesn't make earlier migrations appear to drift.
+type ChecksumScope string
+
+const (
+	// ChecksumScript covers the migration's Script, and the statement of
+	// its Batch. It is the default.
+	ChecksumScript ChecksumScope = ""
+
+	// ChecksumMetadata additionally covers the migration's ID and every
+	// other field which affects what Apply executes, as a signature does
+	// (see SignMigrations)
+	ChecksumMetadata ChecksumScope = "meta"
+
+	// ChecksumRendered covers the script as rendered by the migration's
+	// Engine, so a template rendered differently in another environment is
+	// reported as drift. It is rendered without the server version, which
+	// isn't known outside of Apply, so that it can be verified anywhere.
+	ChecksumRendered ChecksumScope = "rendered"
+)
+
+// checksumScopes are the scopes which are recorded with the checksum
+var checksumScopes = []ChecksumScope{ChecksumMetadata, ChecksumRendered}
+
+// checksum returns the checksum recorded for the migration when it runs
+func (m Migrator) checksum(migration *Migration) string {
+	return m.scopedChecksum(migration, m.ChecksumScope)
+}
+
+// skippedChecksum returns the checksum recorded when the migration is
+// skipped, truncated to fit the tracking table
+func (m Migrator) skippedChecksum(migration *Migration) string {
+	return skippedPrefix + m.checksum(migration)[:32-len(skippedPrefix)]
+}
+
+// scopedChecksum returns the checksum of the migration with the scope.
+// Except for ChecksumScript, it is prefixed with the scope and truncated to
+// fit the tracking table.
+func (m Migrator) scopedChecksum(migration *Migration, scope ChecksumScope) string {
+	var sum string
+	switch scope {
+	case ChecksumMetadata:
+		h := sha256.New()
+		writeSigned(h, migration)
+		sum = fmt.Sprintf("%x", h.Sum(nil))
+	case ChecksumRendered:
+		m.serverVersion = ""
+		script, err := m.renderScript(migration)
+		if err != nil {
+			script = migration.Script
+		}
+		rendered := *migration
+		rendered.Script = script
+		sum = rendered.checksum()
+	default:
+		return migration.checksum()
+	}
+	prefix := string(scope) + ":"
+	return prefix + sum[:32-len(prefix)]
+}
+
+// recordedScope returns the scope with which a recorded checksum was
+// calculated
+func recordedScope(checksum string) ChecksumScope {
+	checksum = strings.TrimPrefix(checksum, skippedPrefix)
+	for _, scope := range checksumScopes {
+		if strings.HasPrefix(checksum, string(scope)+":") {
+			return scope
+		}
+	}
+	return ChecksumScript
+}
+
+// matches returns whether the record's checksum is the migration's, whether
+// the migration ran or was skipped, using the scope the record was made with
+func (m Migrator) matches(record *AppliedMigration, migration *Migration) bool {
+	m.ChecksumScope = recordedScope(record.Checksum)
+	return record.Checksum == m.checksum(migration) || record.Checksum == m.skippedChecksum(migration)
+}
@@ -0,0 +1,51 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChecksumScope(t *testing.T) {
+	migration := &Migration{ID: "2020-01-01 Users", Script: "CREATE TABLE {{.Environment}}_users (id INTEGER)", Engine: TemplateEngine{}}
+	staging := NewMigrator(WithEnvironment("staging"))
+
+	for _, scope := range []ChecksumScope{ChecksumScript, ChecksumMetadata, ChecksumRendered} {
+		m := staging
+		m.ChecksumScope = scope
+		checksum := m.checksum(migration)
+		if len(checksum) != 32 || !strings.HasPrefix(checksum, string(scope)) {
+			t.Errorf("%q: Expected a 32 character checksum prefixed with the scope. Got %s", scope, checksum)
+		}
+		for _, recorded := range []string{checksum, m.skippedChecksum(migration)} {
+			record := &AppliedMigration{Checksum: recorded}
+			if recordedScope(recorded) != scope {
+				t.Errorf("%q: Expected the scope to be recorded in %s", scope, recorded)
+			}
+			if !NewMigrator(WithEnvironment("staging")).matches(record, migration) {
+				t.Errorf("%q: Expected %s to be verified with its own scope", scope, recorded)
+			}
+		}
+	}
+
+	cases := map[ChecksumScope]struct {
+		changed    *Migration
+		drifts     bool
+		production bool
+	}{
+		ChecksumScript:   {&Migration{ID: migration.ID, Script: migration.Script, Verify: "SELECT 1"}, false, false},
+		ChecksumMetadata: {&Migration{ID: migration.ID, Script: migration.Script, Verify: "SELECT 1"}, true, false},
+		ChecksumRendered: {migration, false, true},
+	}
+	for scope, c := range cases {
+		m := staging
+		m.ChecksumScope = scope
+		record := &AppliedMigration{Checksum: m.checksum(migration)}
+		if drifted := !m.matches(record, c.changed); drifted != c.drifts {
+			t.Errorf("%q: Expected drift to be %t after the change", scope, c.drifts)
+		}
+		production := NewMigrator(WithEnvironment("production"))
+		if drifted := !production.matches(record, migration); drifted != c.production {
+			t.Errorf("%q: Expected drift to be %t in another environment", scope, c.production)
+		}
+	}
+}
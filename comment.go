@@ -0,0 +1,167 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// createdObject is a table or index created by a migration's statement
+type createdObject struct {
+	index bool
+	name  string
+	table string
+}
+
+// createdObjects returns the tables and indexes which the statements of the
+// script create. Names are returned as they are written in the script.
+// Temporary tables, indexes which aren't named, and objects which the script
+// comments itself are left out.
+func createdObjects(script string) []createdObject {
+	statements := splitStatements(script)
+	commented := make(map[createdObject]bool)
+	for _, statement := range statements {
+		if object, ok := commentedObjectOf(statement); ok {
+			commented[object] = true
+		}
+	}
+	objects := make([]createdObject, 0)
+	for _, statement := range statements {
+		object, ok := createdObjectOf(statement)
+		if ok && !commented[createdObject{index: object.index, name: strings.ToLower(object.name)}] {
+			objects = append(objects, object)
+		}
+	}
+	return objects
+}
+
+// commentedObjectOf returns the table or index which the statement comments,
+// if it comments one: with COMMENT ON on Postgres, or with the COMMENT table
+// option of CREATE TABLE or ALTER TABLE on MySQL. The name is lower-cased,
+// and the table of an index is left out.
+func commentedObjectOf(statement string) (createdObject, bool) {
+	statement = stripLeadingComments(statement)
+	words := strings.Fields(statement)
+	if len(words) >= 5 && strings.EqualFold(words[0], "COMMENT") && strings.EqualFold(words[1], "ON") {
+		kind := strings.ToUpper(words[2])
+		if kind == "TABLE" || kind == "INDEX" {
+			return createdObject{index: kind == "INDEX", name: strings.ToLower(words[3])}, true
+		}
+		return createdObject{}, false
+	}
+
+	// A table option follows the column definitions of CREATE TABLE, while
+	// ALTER TABLE sets one with COMMENT = rather than a column's COMMENT
+	if created, ok := createdObjectOf(statement); ok && !created.index {
+		options := statement[strings.LastIndex(statement, ")")+1:]
+		for _, word := range strings.Fields(options) {
+			if strings.HasPrefix(strings.ToUpper(word), "COMMENT") {
+				return createdObject{name: strings.ToLower(created.name)}, true
+			}
+		}
+		return createdObject{}, false
+	}
+	if len(words) < 3 || !strings.EqualFold(words[0], "ALTER") || !strings.EqualFold(words[1], "TABLE") {
+		return createdObject{}, false
+	}
+	for i, word := range words {
+		upper := strings.ToUpper(word)
+		if strings.HasPrefix(upper, "COMMENT=") || (upper == "COMMENT" && i+1 < len(words) && strings.HasPrefix(words[i+1], "=")) {
+			return createdObject{name: strings.ToLower(words[2])}, true
+		}
+	}
+	return createdObject{}, false
+}
+
+// createdObjectOf returns the table or index which the statement creates,
+// if it creates one
+func createdObjectOf(statement string) (createdObject, bool) {
+	words := strings.Fields(stripLeadingComments(statement))
+	keyword := func(i int, expected ...string) bool {
+		if i >= len(words) {
+			return false
+		}
+		for _, e := range expected {
+			if strings.EqualFold(words[i], e) {
+				return true
+			}
+		}
+		return false
+	}
+	name := func(i int) string {
+		for keyword(i, "IF", "NOT", "EXISTS", "CONCURRENTLY") {
+			i++
+		}
+		if i >= len(words) || keyword(i, "ON") {
+			return ""
+		}
+		name := words[i]
+		if paren := strings.Index(name, "("); paren >= 0 {
+			name = name[:paren]
+		}
+		return strings.TrimRight(name, ";")
+	}
+
+	if !keyword(0, "CREATE") {
+		return createdObject{}, false
+	}
+	i := 1
+	if keyword(i, "UNLOGGED") {
+		i++
+	}
+	if keyword(i, "TABLE") {
+		object := createdObject{name: name(i + 1)}
+		return object, object.name != ""
+	}
+
+	if keyword(1, "UNIQUE") {
+		i = 2
+	}
+	if !keyword(i, "INDEX") {
+		return createdObject{}, false
+	}
+	object := createdObject{index: true, name: name(i + 1)}
+	for i < len(words) && !keyword(i, "ON") {
+		i++
+	}
+	for keyword(i+1, "ONLY") {
+		i++
+	}
+	if i+1 < len(words) {
+		object.table = words[i+1]
+		if paren := strings.Index(object.table, "("); paren >= 0 {
+			object.table = object.table[:paren]
+		}
+	}
+	return object, object.name != "" && object.table != ""
+}
+
+// commentObjects comments the tables and indexes which the migration created
+// with its ID, on dialects which implement ObjectCommenter, so that DBAs can
+// tell where an object came from when inspecting the schema directly
+func (m Migrator) commentObjects(ctx context.Context, tx *sql.Tx, migration *Migration) error {
+	commenter, ok := m.Dialect.(ObjectCommenter)
+	if !m.CommentObjects || !ok {
+		return nil
+	}
+	script, err := m.renderScript(migration)
+	if err != nil {
+		return err
+	}
+	comment := fmt.Sprintf("Created by migration '%s'", migration.ID)
+	for _, object := range createdObjects(script) {
+		commentSQL := commenter.CommentTableSQL(object.name, comment)
+		if object.index {
+			commentSQL = commenter.CommentIndexSQL(object.name, object.table, comment)
+		}
+		if commentSQL == "" {
+			continue
+		}
+		_, err = m.exec(ctx, tx, commentSQL)
+		if err != nil {
+			return fmt.Errorf("Commenting '%s' created by migration '%s' failed:\n%w", object.name, migration.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCreatedObjects(t *testing.T) {
+	script := `
+		CREATE TABLE users (id INTEGER);
+		CREATE UNLOGGED TABLE IF NOT EXISTS public.events(id INTEGER);
+		CREATE TEMPORARY TABLE scratch (id INTEGER);
+		-- lookups
+		CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS users_id ON ONLY users (id);
+		CREATE INDEX ON events (id);
+		CREATE INDEX events_id ON public.events(id);
+		UPDATE users SET id = 1;
+		CREATE TABLE accounts (id INTEGER);
+		COMMENT ON TABLE Accounts IS 'Accounts';
+		CREATE INDEX accounts_id ON accounts (id);
+		COMMENT ON INDEX accounts_id IS 'Lookups';
+		CREATE TABLE invoices (id INTEGER COMMENT 'Key') COMMENT = 'Invoices';
+		CREATE TABLE payments (id INTEGER COMMENT 'Key');
+		ALTER TABLE payments COMMENT = 'Payments';
+		CREATE TABLE refunds (id INTEGER COMMENT 'Key');
+		ALTER TABLE refunds MODIFY id INTEGER COMMENT 'Refund key';
+	`
+	expected := []createdObject{
+		{name: "users"},
+		{name: "public.events"},
+		{index: true, name: "users_id", table: "users"},
+		{index: true, name: "events_id", table: "public.events"},
+		{name: "refunds"},
+	}
+	if objects := createdObjects(script); !reflect.DeepEqual(objects, expected) {
+		t.Errorf("Expected %+v. Got %+v", expected, objects)
+	}
+}
+
+func TestCommentSQL(t *testing.T) {
+	comment := `Created by migration '2020-01-01 O'Brien\'`
+	cases := map[string]struct {
+		commenter ObjectCommenter
+		expected  [2]string
+	}{
+		"postgres": {Postgres, [2]string{
+			`COMMENT ON TABLE users IS 'Created by migration ''2020-01-01 O''Brien\'''`,
+			`COMMENT ON INDEX users_id IS 'Created by migration ''2020-01-01 O''Brien\'''`,
+		}},
+		"mysql": {MySQL, [2]string{
+			`ALTER TABLE users COMMENT = 'Created by migration ''2020-01-01 O''Brien\\'''`,
+			``,
+		}},
+	}
+	for name, c := range cases {
+		actual := [2]string{c.commenter.CommentTableSQL("users", comment), c.commenter.CommentIndexSQL("users_id", "users", comment)}
+		if actual != c.expected {
+			t.Errorf("%s: Expected %q. Got %q", name, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrConcurrentIndexNotSupported is returned by Apply when a migration
+// builds a ConcurrentIndex with a dialect which can't build one
+var ErrConcurrentIndexNotSupported = errors.New("dialect does not support building indexes concurrently")
+
+// ErrConcurrentIndexChanged is returned by Apply when the script of a
+// migration building a ConcurrentIndex no longer creates the index, such as
+// when the ConcurrentIndex was changed after Migration was called. The
+// script is what checksums, signatures and lint cover, so the index isn't
+// built from anything else.
+var ErrConcurrentIndexChanged = errors.New("script doesn't match its ConcurrentIndex")
+
+// DefaultIndexProgressInterval is how often the progress of a
+// ConcurrentIndex which doesn't set its ProgressInterval is logged
+const DefaultIndexProgressInterval = 10 * time.Second
+
+// ConcurrentIndex describes an index built without blocking writes to its
+// table, with CREATE INDEX CONCURRENTLY on Postgres. A concurrent build which
+// fails leaves an INVALID index behind, which must be dropped before the
+// build is attempted again. Migration wraps that procedure: an INVALID index
+// left by an earlier attempt is dropped, the build's progress is logged from
+// pg_stat_progress_create_index (on Postgres 12 and later), a build which
+// fails with a retryable error is cleaned up and retried, and the migration
+// is only recorded once the index is valid.
+type ConcurrentIndex struct {
+	// Name is the name of the index, which may be schema-qualified
+	Name string
+	// Table is the name of the indexed table
+	Table string
+	// Definition follows the table name in CREATE INDEX, such as
+	// "(email)" or "USING gin (tags)"
+	Definition string
+	// Unique builds a unique index
+	Unique bool
+	// Where optionally makes the index partial
+	Where string
+
+	// Retries is the number of times a build which fails with a retryable
+	// error (see IsRetryableError), such as a deadlock, is retried
+	Retries int
+	// ProgressInterval is how often the build's progress is logged. It
+	// defaults to DefaultIndexProgressInterval.
+	ProgressInterval time.Duration
+}
+
+// Migration returns a migration which builds the index. Its Script is the
+// CREATE INDEX CONCURRENTLY statement, which is what its checksum covers and
+// what GenerateSQL writes, and it has DisableTransaction set.
+// Usage: (&schema.ConcurrentIndex{Name: "users_email", Table: "users", Definition: "(email)"}).Migration("2021-03-01 Index Emails")
+func (i *ConcurrentIndex) Migration(id string) *Migration {
+	return &Migration{
+		ID:                 id,
+		Script:             i.createSQL(),
+		DisableTransaction: true,
+		ConcurrentIndex:    i,
+	}
+}
+
+// createSQL returns the CREATE INDEX CONCURRENTLY statement for the index
+func (i *ConcurrentIndex) createSQL() string {
+	unique := ""
+	if i.Unique {
+		unique = "UNIQUE "
+	}
+	statement := fmt.Sprintf("CREATE %sINDEX CONCURRENTLY %s ON %s %s", unique, i.Name, i.Table, i.Definition)
+	if i.Where != "" {
+		statement += " WHERE " + i.Where
+	}
+	return statement
+}
+
+// buildConcurrentIndex builds the migration's ConcurrentIndex on the
+// connection, which mustn't be in a transaction, reading its progress and
+// validity with the sql.DB
+func (m Migrator) buildConcurrentIndex(ctx context.Context, db *sql.DB, conn *sql.Conn, migration *Migration) error {
+	index := migration.ConcurrentIndex
+	builder, ok := m.Dialect.(ConcurrentIndexBuilder)
+	if !ok {
+		return fmt.Errorf("Migration '%s' Failed:\n%w", migration.ID, ErrConcurrentIndexNotSupported)
+	}
+	script, err := m.concurrentIndexScript(migration)
+	if err != nil {
+		return err
+	}
+	retryable := m.RetryableError
+	if retryable == nil {
+		retryable = IsRetryableError
+	}
+
+	for attempt := 0; ; attempt++ {
+		valid, exists, err := m.indexValidity(ctx, conn, builder, index)
+		if err != nil {
+			return fmt.Errorf("Migration '%s' Failed:\n%w", migration.ID, err)
+		}
+		if valid {
+			m.log(fmt.Sprintf("Index '%s' of migration '%s' is already built\n", index.Name, migration.ID))
+			return nil
+		}
+		if exists {
+			m.log(fmt.Sprintf("Dropping the invalid index '%s' left by an earlier build\n", index.Name))
+			_, err = m.exec(ctx, conn, builder.DropIndexConcurrentlySQL(index.Name))
+			if err != nil {
+				return fmt.Errorf("Migration '%s' Failed dropping the invalid index '%s':\n%w", migration.ID, index.Name, err)
+			}
+		}
+
+		err = m.createIndexWithProgress(ctx, db, conn, builder, index, script)
+		if err == nil {
+			return nil
+		}
+		if attempt >= index.Retries || !retryable(err) {
+			// The failed build leaves an invalid index, which is dropped
+			// now rather than by the next attempt
+			_, dropErr := m.exec(context.Background(), conn, builder.DropIndexConcurrentlySQL(index.Name))
+			if dropErr != nil {
+				m.log(fmt.Sprintf("Warning: the invalid index '%s' could not be dropped: %v\n", index.Name, dropErr))
+			}
+			return fmt.Errorf("Migration '%s' Failed building index '%s':\n%w", migration.ID, index.Name, err)
+		}
+		m.log(fmt.Sprintf("Warning: building index '%s' failed, retrying (attempt %d of %d): %v\n", index.Name, attempt+1, index.Retries, err))
+	}
+}
+
+// concurrentIndexScript returns the migration's rendered script, once it is
+// checked to be the statement which creates its ConcurrentIndex
+func (m Migrator) concurrentIndexScript(migration *Migration) (string, error) {
+	script, err := m.renderScript(migration)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(script), ";")) != migration.ConcurrentIndex.createSQL() {
+		return "", fmt.Errorf("Migration '%s' Failed:\n%w", migration.ID, ErrConcurrentIndexChanged)
+	}
+	return script, nil
+}
+
+// indexValidity returns whether the index exists, and whether it is valid
+func (m Migrator) indexValidity(ctx context.Context, conn *sql.Conn, builder ConcurrentIndexBuilder, index *ConcurrentIndex) (valid bool, exists bool, err error) {
+	queriedAt := time.Now()
+	err = conn.QueryRowContext(ctx, builder.IndexValiditySQL(), index.Name).Scan(&valid)
+	m.logQuery(builder.IndexValiditySQL(), []interface{}{index.Name}, queriedAt, err)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	return valid, err == nil, err
+}
+
+// createIndexWithProgress runs the script creating the index on the
+// connection, logging the progress of the build every ProgressInterval
+func (m Migrator) createIndexWithProgress(ctx context.Context, db *sql.DB, conn *sql.Conn, builder ConcurrentIndexBuilder, index *ConcurrentIndex, script string) error {
+	pid, _, err := m.queryFirstValue(ctx, conn, builder.SessionIDSQL())
+	if err != nil {
+		return err
+	}
+	interval := index.ProgressInterval
+	if interval <= 0 {
+		interval = DefaultIndexProgressInterval
+	}
+
+	progressCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-progressCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			// The view is missing before Postgres 12, so progress is
+			// only logged where it can be read
+			var phase string
+			var blocksDone, blocksTotal, tuplesDone, tuplesTotal int64
+			queriedAt := time.Now()
+			err := db.QueryRowContext(progressCtx, builder.IndexProgressSQL(), pid).Scan(&phase, &blocksDone, &blocksTotal, &tuplesDone, &tuplesTotal)
+			m.logQuery(builder.IndexProgressSQL(), []interface{}{pid}, queriedAt, err)
+			if progressCtx.Err() != nil {
+				return
+			}
+			if err != nil && err != sql.ErrNoRows {
+				return
+			}
+			if err == nil {
+				m.log(fmt.Sprintf("Building index '%s': %s, %d of %d blocks, %d of %d tuples\n", index.Name, phase, blocksDone, blocksTotal, tuplesDone, tuplesTotal))
+			}
+		}
+	}()
+
+	_, err = m.exec(ctx, conn, script)
+	cancel()
+	<-done
+	return err
+}
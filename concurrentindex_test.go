@@ -0,0 +1,40 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConcurrentIndexMigration(t *testing.T) {
+	index := &ConcurrentIndex{Name: "users_email", Table: "users", Definition: "(lower(email))", Unique: true, Where: "deleted_at IS NULL"}
+	migration := index.Migration("2021-03-01 Index Emails")
+	expected := "CREATE UNIQUE INDEX CONCURRENTLY users_email ON users (lower(email)) WHERE deleted_at IS NULL"
+	if migration.Script != expected {
+		t.Errorf("Expected script %q. Got %q", expected, migration.Script)
+	}
+	if !migration.DisableTransaction || migration.ConcurrentIndex != index || migration.ID != "2021-03-01 Index Emails" {
+		t.Errorf("Expected a migration building the index outside of a transaction. Got %+v", migration)
+	}
+	if Postgres.RequiresNoTransaction(migration.Script, "") != true {
+		t.Error("Expected the script to require no transaction")
+	}
+}
+
+func TestConcurrentIndexScript(t *testing.T) {
+	index := &ConcurrentIndex{Name: "users_email", Table: "users", Definition: "(email)"}
+	migration := index.Migration("2021-03-01 Index Emails")
+	migrator := NewMigrator()
+	if script, err := migrator.concurrentIndexScript(migration); err != nil || script != migration.Script {
+		t.Errorf("Expected the migration's script. Got %q (%v)", script, err)
+	}
+
+	index.Definition = "(lower(email))"
+	if _, err := migrator.concurrentIndexScript(migration); !errors.Is(err, ErrConcurrentIndexChanged) {
+		t.Errorf("Expected ErrConcurrentIndexChanged after the index changed. Got %v", err)
+	}
+	variant := *migration
+	variant.Script = "CREATE INDEX users_email ON users (email)"
+	if _, err := migrator.concurrentIndexScript(&variant); !errors.Is(err, ErrConcurrentIndexChanged) {
+		t.Errorf("Expected ErrConcurrentIndexChanged for a different script. Got %v", err)
+	}
+}
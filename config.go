@@ -0,0 +1,332 @@
+package schema
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnknownEnvironment is returned by LoadConfig when the configuration file
+// has no profile for the environment
+var ErrUnknownEnvironment = errors.New("configuration has no profile for the environment")
+
+// Config is a declarative Migrator configuration, which a service and the
+// tools which migrate its database can share instead of each wiring up the
+// same options. It is loaded from a JSON file with LoadConfig and from
+// environment variables with LoadEnv, and turned into a Migrator with
+// NewMigratorFromConfig or OpenConfig.
+type Config struct {
+	// Driver is the database/sql driver name, such as "postgres"
+	Driver string `json:"driver"`
+	// DSN is the data source name the database is opened with
+	DSN string `json:"dsn"`
+	// Dialect is the name of a registered dialect (see RegisterDialect). It
+	// defaults to the Driver's dialect.
+	Dialect string `json:"dialect"`
+
+	SchemaName string `json:"schema_name"`
+	TableName  string `json:"table_name"`
+
+	Environment     string `json:"environment"`
+	ApplicationName string `json:"application_name"`
+
+	// LockTimeout and StatementTimeout bound each migration on Postgres
+	// (see WithPostgresMigrationTimeouts). On SQLite, LockTimeout bounds
+	// the wait for the migration lock (see WithSQLiteLockTimeout). Files
+	// write them as durations such as "5s".
+	LockTimeout      time.Duration `json:"lock_timeout"`
+	StatementTimeout time.Duration `json:"statement_timeout"`
+
+	// LintPolicy is "off", "warn" or "block" (see LintPolicy)
+	LintPolicy    string        `json:"lint_policy"`
+	ChecksumScope ChecksumScope `json:"checksum_scope"`
+
+	StrictOrdering     bool     `json:"strict_ordering"`
+	OrphanCheck        bool     `json:"orphan_check"`
+	ReplicaCheck       bool     `json:"replica_check"`
+	MinServerVersion   string   `json:"min_server_version"`
+	RequiredExtensions []string `json:"required_extensions"`
+	Plugins            []string `json:"plugins"`
+}
+
+// lintPolicies are the names of the LintPolicy values in a Config
+var lintPolicies = map[string]LintPolicy{
+	"":      LintOff,
+	"off":   LintOff,
+	"warn":  LintWarn,
+	"block": LintBlock,
+}
+
+// UnmarshalJSON implements json.Unmarshaler, reading the timeouts as
+// durations such as "5s". Fields missing from the JSON are left unchanged,
+// so a profile can be read over the defaults.
+func (c *Config) UnmarshalJSON(data []byte) error {
+	type plain Config
+	file := struct {
+		*plain
+		LockTimeout      *string `json:"lock_timeout"`
+		StatementTimeout *string `json:"statement_timeout"`
+	}{plain: (*plain)(c)}
+	err := json.Unmarshal(data, &file)
+	if err != nil {
+		return err
+	}
+	if file.LockTimeout != nil {
+		c.LockTimeout, err = time.ParseDuration(*file.LockTimeout)
+		if err != nil {
+			return fmt.Errorf("lock_timeout: %w", err)
+		}
+	}
+	if file.StatementTimeout != nil {
+		c.StatementTimeout, err = time.ParseDuration(*file.StatementTimeout)
+		if err != nil {
+			return fmt.Errorf("statement_timeout: %w", err)
+		}
+	}
+	return nil
+}
+
+// LoadConfig reads a JSON configuration file. Settings at the top level are
+// shared by every environment, and those in the "environments" object
+// override them for the named environment, which also becomes the
+// Environment. An empty environment reads only the shared settings.
+//
+//	{
+//	  "driver": "postgres",
+//	  "table_name": "schema_migrations",
+//	  "environments": {
+//	    "production": {"lint_policy": "block", "lock_timeout": "5s"}
+//	  }
+//	}
+func LoadConfig(path, environment string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Environments map[string]json.RawMessage `json:"environments"`
+	}
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	c := &Config{}
+	err = json.Unmarshal(data, c)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if environment == "" {
+		return c, nil
+	}
+	profile, exists := file.Environments[environment]
+	if !exists {
+		return nil, fmt.Errorf("%w: %q in %s", ErrUnknownEnvironment, environment, path)
+	}
+	c.Environment = environment
+	err = json.Unmarshal(profile, c)
+	if err != nil {
+		return nil, fmt.Errorf("%s: environment %q: %w", path, environment, err)
+	}
+	return c, nil
+}
+
+// LoadEnv overrides the configuration with the environment variables which
+// are set, named with the prefix followed by an underscore and the
+// upper-cased JSON name of the setting, such as SCHEMA_DSN or
+// SCHEMA_LOCK_TIMEOUT. Lists are separated by commas.
+func (c *Config) LoadEnv(prefix string) error {
+	var err error
+	lookup := func(name string) (string, bool) {
+		return os.LookupEnv(prefix + "_" + name)
+	}
+	str := func(name string, value *string) {
+		if v, ok := lookup(name); ok {
+			*value = v
+		}
+	}
+	list := func(name string, value *[]string) {
+		if v, ok := lookup(name); ok {
+			*value = splitList(v)
+		}
+	}
+	boolean := func(name string, value *bool) {
+		if v, ok := lookup(name); ok && err == nil {
+			*value, err = strconv.ParseBool(v)
+			if err != nil {
+				err = fmt.Errorf("%s_%s: %w", prefix, name, err)
+			}
+		}
+	}
+	duration := func(name string, value *time.Duration) {
+		if v, ok := lookup(name); ok && err == nil {
+			*value, err = time.ParseDuration(v)
+			if err != nil {
+				err = fmt.Errorf("%s_%s: %w", prefix, name, err)
+			}
+		}
+	}
+
+	str("DRIVER", &c.Driver)
+	str("DSN", &c.DSN)
+	str("DIALECT", &c.Dialect)
+	str("SCHEMA_NAME", &c.SchemaName)
+	str("TABLE_NAME", &c.TableName)
+	str("ENVIRONMENT", &c.Environment)
+	str("APPLICATION_NAME", &c.ApplicationName)
+	duration("LOCK_TIMEOUT", &c.LockTimeout)
+	duration("STATEMENT_TIMEOUT", &c.StatementTimeout)
+	str("LINT_POLICY", &c.LintPolicy)
+	if v, ok := lookup("CHECKSUM_SCOPE"); ok {
+		c.ChecksumScope = ChecksumScope(v)
+	}
+	boolean("STRICT_ORDERING", &c.StrictOrdering)
+	boolean("ORPHAN_CHECK", &c.OrphanCheck)
+	boolean("REPLICA_CHECK", &c.ReplicaCheck)
+	str("MIN_SERVER_VERSION", &c.MinServerVersion)
+	list("REQUIRED_EXTENSIONS", &c.RequiredExtensions)
+	list("PLUGINS", &c.Plugins)
+	return err
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Options returns the Options which configure a Migrator as described,
+// checking names such as the dialect, lint policy and plugins so that a
+// mistake in the configuration is reported when it is loaded rather than
+// when Apply runs
+func (c *Config) Options() ([]Option, error) {
+	opts := make([]Option, 0)
+
+	dialect, err := c.dialect()
+	if err != nil {
+		return nil, err
+	}
+	if dialect != nil {
+		opts = append(opts, WithDialect(dialect))
+	}
+
+	if c.TableName != "" || c.SchemaName != "" {
+		tableName := c.TableName
+		if tableName == "" {
+			tableName = DefaultTableName
+		}
+		opts = append(opts, WithTableName(c.SchemaName, tableName))
+	}
+	if c.Environment != "" {
+		opts = append(opts, WithEnvironment(c.Environment))
+	}
+	if c.ApplicationName != "" {
+		opts = append(opts, WithApplicationName(c.ApplicationName))
+	}
+
+	policy, exists := lintPolicies[c.LintPolicy]
+	if !exists {
+		return nil, fmt.Errorf("unknown lint policy %q", c.LintPolicy)
+	}
+	opts = append(opts, WithLintPolicy(policy))
+
+	switch c.ChecksumScope {
+	case ChecksumScript, ChecksumMetadata, ChecksumRendered:
+		opts = append(opts, WithChecksumScope(c.ChecksumScope))
+	default:
+		return nil, fmt.Errorf("unknown checksum scope %q", c.ChecksumScope)
+	}
+
+	if c.StrictOrdering {
+		opts = append(opts, WithStrictOrdering())
+	}
+	if c.OrphanCheck {
+		opts = append(opts, WithOrphanCheck())
+	}
+	if c.ReplicaCheck {
+		opts = append(opts, WithReplicaCheck())
+	}
+	if c.MinServerVersion != "" {
+		opts = append(opts, WithMinServerVersion(c.MinServerVersion))
+	}
+	if len(c.RequiredExtensions) > 0 {
+		opts = append(opts, WithRequiredExtensions(c.RequiredExtensions...))
+	}
+
+	for _, name := range c.Plugins {
+		_, err = LookupPlugin(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(c.Plugins) > 0 {
+		opts = append(opts, WithPlugins(c.Plugins...))
+	}
+	return opts, nil
+}
+
+// dialect returns the configured dialect with the timeouts applied, or nil
+// when neither the Dialect nor the Driver is set
+func (c *Config) dialect() (Dialect, error) {
+	name := c.Dialect
+	if name == "" && c.Driver != "" {
+		dialect, err := DialectForDriver(c.Driver)
+		if err != nil {
+			return nil, err
+		}
+		named, _ := dialect.(NamedDialect)
+		if named == nil {
+			return dialect, nil
+		}
+		name = named.Name()
+	}
+	if name == "" {
+		if c.LockTimeout > 0 || c.StatementTimeout > 0 {
+			return nil, fmt.Errorf("timeouts require a dialect or driver")
+		}
+		return nil, nil
+	}
+
+	switch {
+	case name == "postgres" && (c.LockTimeout > 0 || c.StatementTimeout > 0):
+		return NewPostgres(WithPostgresMigrationTimeouts(c.LockTimeout, c.StatementTimeout)), nil
+	case name == "sqlite" && c.StatementTimeout == 0 && c.LockTimeout > 0:
+		return NewSQLite(WithSQLiteLockTimeout(c.LockTimeout)), nil
+	case c.LockTimeout > 0 || c.StatementTimeout > 0:
+		return nil, fmt.Errorf("the %s dialect doesn't support the configured timeouts", name)
+	}
+	return LookupDialect(name)
+}
+
+// NewMigratorFromConfig returns a Migrator configured as described, followed
+// by any other options, such as a Logger, which can't be described in
+// configuration
+// Usage: migrator, err := schema.NewMigratorFromConfig(config, schema.WithLogger(logger))
+func NewMigratorFromConfig(c *Config, opts ...Option) (Migrator, error) {
+	configured, err := c.Options()
+	if err != nil {
+		return Migrator{}, err
+	}
+	return NewMigrator(append(configured, opts...)...), nil
+}
+
+// OpenConfig opens the configured database with Open, and returns it with a
+// Migrator configured as described, followed by any other options
+// Usage: db, migrator, err := schema.OpenConfig(config)
+func OpenConfig(c *Config, opts ...Option) (*sql.DB, Migrator, error) {
+	configured, err := c.Options()
+	if err != nil {
+		return nil, Migrator{}, err
+	}
+	return Open(c.Driver, c.DSN, append(configured, opts...)...)
+}
@@ -0,0 +1,100 @@
+package schema
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schema-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "schema.json")
+	err = ioutil.WriteFile(path, []byte(`{
+		"driver": "postgres",
+		"table_name": "app_migrations",
+		"lock_timeout": "2s",
+		"environments": {
+			"production": {"lint_policy": "block", "lock_timeout": "5s", "required_extensions": ["pgcrypto"]}
+		}
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared, err := LoadConfig(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shared.TableName != "app_migrations" || shared.LockTimeout != 2*time.Second || shared.LintPolicy != "" {
+		t.Errorf("Expected only the shared settings. Got %+v", shared)
+	}
+
+	production, err := LoadConfig(path, "production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if production.TableName != "app_migrations" || production.LockTimeout != 5*time.Second || production.LintPolicy != "block" || production.Environment != "production" {
+		t.Errorf("Expected the production profile over the shared settings. Got %+v", production)
+	}
+
+	_, err = LoadConfig(path, "staging")
+	if !errors.Is(err, ErrUnknownEnvironment) {
+		t.Errorf("Expected ErrUnknownEnvironment. Got %v", err)
+	}
+
+	m, err := NewMigratorFromConfig(production)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.TableName != "app_migrations" || m.LintPolicy != LintBlock || m.Environment != "production" || len(m.RequiredExtensions) != 1 {
+		t.Errorf("Expected the Migrator to be configured. Got %+v", m)
+	}
+	if p, ok := m.Dialect.(postgresDialect); !ok || p.lockTimeout != 5*time.Second {
+		t.Errorf("Expected a Postgres dialect with the lock timeout. Got %#v", m.Dialect)
+	}
+}
+
+func TestConfigLoadEnv(t *testing.T) {
+	os.Setenv("SCHEMATEST_TABLE_NAME", "env_migrations")
+	os.Setenv("SCHEMATEST_STRICT_ORDERING", "true")
+	os.Setenv("SCHEMATEST_PLUGINS", "a, b,")
+	defer os.Unsetenv("SCHEMATEST_TABLE_NAME")
+	defer os.Unsetenv("SCHEMATEST_STRICT_ORDERING")
+	defer os.Unsetenv("SCHEMATEST_PLUGINS")
+
+	c := &Config{TableName: "file_migrations", Driver: "sqlite3"}
+	err := c.LoadEnv("SCHEMATEST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.TableName != "env_migrations" || !c.StrictOrdering || c.Driver != "sqlite3" || len(c.Plugins) != 2 || c.Plugins[1] != "b" {
+		t.Errorf("Expected the environment to override the configuration. Got %+v", c)
+	}
+
+	os.Setenv("SCHEMATEST_LOCK_TIMEOUT", "soon")
+	defer os.Unsetenv("SCHEMATEST_LOCK_TIMEOUT")
+	if err = c.LoadEnv("SCHEMATEST"); err == nil {
+		t.Error("Expected an error for an invalid duration")
+	}
+}
+
+func TestConfigOptionsErrors(t *testing.T) {
+	for _, c := range []*Config{
+		{LintPolicy: "strict"},
+		{ChecksumScope: "everything"},
+		{Dialect: "nosuchdb"},
+		{Driver: "mysql", LockTimeout: time.Second},
+		{Plugins: []string{"no-such-plugin"}},
+	} {
+		if _, err := NewMigratorFromConfig(c); err == nil {
+			t.Errorf("Expected an error for %+v", c)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ConflictError is returned by Apply when the supplied migrations conflict
+// with each other or with the applied migrations, as happens when branches
+// which each added migrations are merged
+type ConflictError struct {
+	// Duplicates lists IDs which are shared by more than one of the
+	// supplied migrations
+	Duplicates []string
+	// Interleaved lists the IDs of pending migrations which sort before
+	// LatestApplied, such as ones added on a branch which was merged after
+	// a later migration was applied. It is only checked with
+	// WithStrictOrdering.
+	Interleaved []string
+	// LatestApplied is the ID of the applied migration which sorts last
+	LatestApplied string
+	// Orphans lists the IDs of applied migrations which aren't among the
+	// supplied migrations, as happens when the wrong build is deployed or
+	// a migration file is missing. It is only checked with WithOrphanCheck.
+	Orphans []string
+}
+
+func (e *ConflictError) Error() string {
+	problems := make([]string, 0, 3)
+	if len(e.Duplicates) > 0 {
+		problems = append(problems, fmt.Sprintf(
+			"more than one migration has the ID %s; give each a unique ID",
+			quoteIDs(e.Duplicates)))
+	}
+	if len(e.Interleaved) > 0 {
+		problems = append(problems, fmt.Sprintf(
+			"pending migrations %s sort before the applied migration '%s'; renumber them to sort after it",
+			quoteIDs(e.Interleaved), e.LatestApplied))
+	}
+	if len(e.Orphans) > 0 {
+		problems = append(problems, fmt.Sprintf(
+			"applied migrations %s are not among the supplied migrations; check that the right build is deployed",
+			quoteIDs(e.Orphans)))
+	}
+	return "Conflicting migrations: " + strings.Join(problems, "; ")
+}
+
+// Conflicts returns a ConflictError describing the supplied migrations
+// which share IDs, and with strict ordering, the pending migrations which
+// sort before the latest applied migration. It returns nil when there are
+// no conflicts. Always migrations are never considered interleaved. With the
+// orphan check, it also describes the applied migrations which aren't
+// supplied.
+func (m Migrator) Conflicts(migrations []*Migration, applied map[string]*AppliedMigration) *ConflictError {
+	conflict := &ConflictError{}
+
+	seen := make(map[string]int, len(migrations))
+	for _, migration := range migrations {
+		seen[migration.ID]++
+		if seen[migration.ID] == 2 {
+			conflict.Duplicates = append(conflict.Duplicates, migration.ID)
+		}
+	}
+
+	if m.StrictOrdering {
+		for id := range applied {
+			if id > conflict.LatestApplied {
+				conflict.LatestApplied = id
+			}
+		}
+		sorted := make([]*Migration, len(migrations))
+		copy(sorted, migrations)
+		SortMigrations(sorted)
+		for _, migration := range sorted {
+			_, exists := applied[migration.ID]
+			if !exists && !migration.Always && migration.ID < conflict.LatestApplied {
+				conflict.Interleaved = append(conflict.Interleaved, migration.ID)
+			}
+		}
+	}
+
+	if m.RefuseOrphans {
+		for id := range applied {
+			if _, exists := seen[id]; !exists {
+				conflict.Orphans = append(conflict.Orphans, id)
+			}
+		}
+		sort.Strings(conflict.Orphans)
+	}
+
+	if len(conflict.Duplicates) == 0 && len(conflict.Interleaved) == 0 && len(conflict.Orphans) == 0 {
+		return nil
+	}
+	return conflict
+}
+
+// quoteIDs returns the IDs quoted and separated by commas
+func quoteIDs(ids []string) string {
+	quoted := make([]string, len(ids))
+	for i, id := range ids {
+		quoted[i] = "'" + id + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
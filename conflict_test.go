@@ -0,0 +1,49 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConflicts(t *testing.T) {
+	applied := map[string]*AppliedMigration{
+		"2020-01-01 A": {Migration: Migration{ID: "2020-01-01 A"}},
+		"2020-01-03 C": {Migration: Migration{ID: "2020-01-03 C"}},
+	}
+	migrations := []*Migration{
+		{ID: "2020-01-01 A"},
+		{ID: "2020-01-02 Branch"},
+		{ID: "2020-01-02 Refresh", Always: true},
+		{ID: "2020-01-03 C"},
+		{ID: "2020-01-04 D"},
+		{ID: "2020-01-04 D"},
+	}
+
+	conflict := NewMigrator().Conflicts(migrations, applied)
+	if conflict == nil || len(conflict.Duplicates) != 1 || len(conflict.Interleaved) != 0 {
+		t.Fatalf("Expected only the duplicate ID. Got %+v", conflict)
+	}
+
+	conflict = NewMigrator(WithStrictOrdering()).Conflicts(migrations, applied)
+	if conflict == nil || len(conflict.Interleaved) != 1 || conflict.Interleaved[0] != "2020-01-02 Branch" {
+		t.Fatalf("Expected the branch migration to be interleaved. Got %+v", conflict)
+	}
+	if conflict.LatestApplied != "2020-01-03 C" || !strings.Contains(conflict.Error(), "renumber") {
+		t.Errorf("Unexpected conflict: %v", conflict)
+	}
+
+	if conflict = NewMigrator(WithStrictOrdering()).Conflicts(migrations[3:5], applied); conflict != nil {
+		t.Errorf("Expected no conflicts. Got %v", conflict)
+	}
+
+	conflict = NewMigrator(WithOrphanCheck()).Conflicts(migrations[3:5], applied)
+	if conflict == nil || len(conflict.Orphans) != 1 || conflict.Orphans[0] != "2020-01-01 A" {
+		t.Fatalf("Expected the unsupplied applied migration to be an orphan. Got %+v", conflict)
+	}
+	if !strings.Contains(conflict.Error(), "right build") {
+		t.Errorf("Unexpected conflict: %v", conflict)
+	}
+	if conflict = NewMigrator(WithOrphanCheck()).Conflicts(migrations, applied); len(conflict.Orphans) != 0 {
+		t.Errorf("Expected no orphans. Got %v", conflict)
+	}
+}
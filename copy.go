@@ -0,0 +1,107 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrCopyNotSupported is returned when a migration with Copy data is applied
+// with a dialect which doesn't implement CopyInSQL
+var ErrCopyNotSupported = errors.New("dialect does not support COPY FROM STDIN")
+
+// CopyFrom describes rows bulk loaded into a table when a migration runs.
+// Loading with COPY is orders of magnitude faster than INSERT statements
+// for large seed or backfill datasets.
+type CopyFrom struct {
+	// Table is the table to load, optionally schema-qualified with a dot
+	Table   string
+	Columns []string
+	Source  CopySource
+}
+
+// CopySource supplies the rows loaded by a CopyFrom. Next returns io.EOF
+// when there are no more rows.
+type CopySource interface {
+	Next() ([]interface{}, error)
+}
+
+// CopyInSQL defines an interface for dialects which can bulk load rows
+// through a prepared COPY FROM STDIN statement. Rows are loaded by executing
+// the statement once per row and then once more without arguments.
+type CopyInSQL interface {
+	CopyInSQL(table string, columns []string) string
+}
+
+// CSVCopySource returns a CopySource which reads rows from CSV data. Every
+// value is supplied as a string, which COPY converts to the column's type.
+func CSVCopySource(r io.Reader) CopySource {
+	return csvCopySource{reader: csv.NewReader(r)}
+}
+
+type csvCopySource struct {
+	reader *csv.Reader
+}
+
+func (c csvCopySource) Next() ([]interface{}, error) {
+	record, err := c.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	row := make([]interface{}, len(record))
+	for i, value := range record {
+		row[i] = value
+	}
+	return row, nil
+}
+
+// copyIn loads the migration's Copy data within the migration transaction
+func (m Migrator) copyIn(ctx context.Context, tx *sql.Tx, migration *Migration) (err error) {
+	copier, ok := m.Dialect.(CopyInSQL)
+	if !ok {
+		return fmt.Errorf("Migration '%s' Failed:\n%w", migration.ID, ErrCopyNotSupported)
+	}
+
+	copySQL := copier.CopyInSQL(migration.Copy.Table, migration.Copy.Columns)
+	startedAt := time.Now()
+	defer func() {
+		m.logQuery(copySQL, nil, startedAt, err)
+	}()
+	stmt, err := tx.PrepareContext(ctx, copySQL)
+	if err != nil {
+		return fmt.Errorf("Migration '%s' COPY failed:\n%w", migration.ID, err)
+	}
+	defer func() {
+		closeErr := stmt.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	rows := 0
+	for {
+		row, err := migration.Copy.Source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Migration '%s' COPY failed reading row %d:\n%w", migration.ID, rows+1, err)
+		}
+		_, err = stmt.ExecContext(ctx, row...)
+		if err != nil {
+			return fmt.Errorf("Migration '%s' COPY failed at row %d:\n%w", migration.ID, rows+1, err)
+		}
+		rows++
+	}
+
+	_, err = stmt.ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("Migration '%s' COPY failed:\n%w", migration.ID, err)
+	}
+	m.log(fmt.Sprintf("Migration '%s' copied %d rows into %s\n", migration.ID, rows, migration.Copy.Table))
+	return nil
+}
@@ -0,0 +1,280 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DDLStatement is a statement built with the DDL builder, such as
+// CreateTable, which renders the SQL for a dialect
+type DDLStatement interface {
+	// SQL renders the statement for the named dialect (see NamedDialect).
+	// Unknown dialects, including the empty name, get the Postgres form.
+	SQL(dialect string) string
+}
+
+// ColumnType is a portable column type, rendered as the nearest type each
+// dialect supports
+type ColumnType struct {
+	name string
+	size int
+}
+
+// Portable column types. Serial types auto-increment.
+var (
+	Serial    = ColumnType{name: "serial"}
+	BigSerial = ColumnType{name: "bigserial"}
+	Integer   = ColumnType{name: "integer"}
+	BigInt    = ColumnType{name: "bigint"}
+	Text      = ColumnType{name: "text"}
+	Boolean   = ColumnType{name: "boolean"}
+	Timestamp = ColumnType{name: "timestamp"}
+	Bytes     = ColumnType{name: "bytes"}
+)
+
+// Varchar is a portable string type with a maximum length. SQLite doesn't
+// enforce the length.
+func Varchar(size int) ColumnType {
+	return ColumnType{name: "varchar", size: size}
+}
+
+// columnTypes maps the portable types to their SQL for each dialect, where
+// the Postgres form is the default
+var columnTypes = map[string]map[string]string{
+	"postgres": {
+		"serial": "SERIAL", "bigserial": "BIGSERIAL", "integer": "INTEGER", "bigint": "BIGINT",
+		"text": "TEXT", "boolean": "BOOLEAN", "timestamp": "TIMESTAMP WITH TIME ZONE", "bytes": "BYTEA",
+		"varchar": "VARCHAR(%d)",
+	},
+	"sqlite": {
+		"serial": "INTEGER", "bigserial": "INTEGER", "integer": "INTEGER", "bigint": "INTEGER",
+		"text": "TEXT", "boolean": "BOOLEAN", "timestamp": "DATETIME", "bytes": "BLOB",
+		"varchar": "VARCHAR(%d)",
+	},
+	"mysql": {
+		"serial": "INT AUTO_INCREMENT", "bigserial": "BIGINT AUTO_INCREMENT", "integer": "INT", "bigint": "BIGINT",
+		"text": "TEXT", "boolean": "BOOLEAN", "timestamp": "DATETIME(6)", "bytes": "LONGBLOB",
+		"varchar": "VARCHAR(%d)",
+	},
+	"oracle": {
+		"serial":    "NUMBER(10) GENERATED BY DEFAULT AS IDENTITY",
+		"bigserial": "NUMBER(19) GENERATED BY DEFAULT AS IDENTITY",
+		"integer":   "NUMBER(10)", "bigint": "NUMBER(19)",
+		"text": "CLOB", "boolean": "NUMBER(1)", "timestamp": "TIMESTAMP WITH TIME ZONE", "bytes": "BLOB",
+		"varchar": "VARCHAR2(%d)",
+	},
+}
+
+// sql renders the type for the dialect
+func (t ColumnType) sql(dialect string) string {
+	types, exists := columnTypes[dialect]
+	if !exists {
+		types = columnTypes["postgres"]
+	}
+	if t.name == "varchar" {
+		return fmt.Sprintf(types[t.name], t.size)
+	}
+	return types[t.name]
+}
+
+// serial returns whether the type auto-increments
+func (t ColumnType) serial() bool {
+	return t.name == "serial" || t.name == "bigserial"
+}
+
+// ColumnOption customizes a column added with TableBuilder.Column or
+// AddColumn
+type ColumnOption func(c *ddlColumn)
+
+// NotNull makes the column NOT NULL
+func NotNull() ColumnOption {
+	return func(c *ddlColumn) {
+		c.notNull = true
+	}
+}
+
+// Unique makes the column UNIQUE
+func Unique() ColumnOption {
+	return func(c *ddlColumn) {
+		c.unique = true
+	}
+}
+
+// Default sets the column's default to the SQL expression, such as "0" or
+// "'pending'", which is written as given for every dialect
+func Default(expression string) ColumnOption {
+	return func(c *ddlColumn) {
+		c.defaultExpr = expression
+	}
+}
+
+// ddlColumn is a column definition
+type ddlColumn struct {
+	name        string
+	columnType  ColumnType
+	notNull     bool
+	unique      bool
+	defaultExpr string
+}
+
+// sql renders the column definition for the dialect. SQLite only
+// auto-increments an INTEGER PRIMARY KEY, so a serial column which is the
+// table's primary key is declared as one inline.
+func (c *ddlColumn) sql(dialect string, inlinePrimaryKey bool) string {
+	parts := []string{c.name, c.columnType.sql(dialect)}
+	if inlinePrimaryKey {
+		parts = append(parts, "PRIMARY KEY AUTOINCREMENT")
+	}
+	if c.defaultExpr != "" {
+		parts = append(parts, "DEFAULT "+c.defaultExpr)
+	}
+	if c.notNull {
+		parts = append(parts, "NOT NULL")
+	}
+	if c.unique {
+		parts = append(parts, "UNIQUE")
+	}
+	return strings.Join(parts, " ")
+}
+
+// TableBuilder builds a CREATE TABLE statement. Create one with CreateTable.
+type TableBuilder struct {
+	name        string
+	columns     []*ddlColumn
+	primaryKey  []string
+	ifNotExists bool
+}
+
+// CreateTable starts building a CREATE TABLE statement for the table.
+// Usage: CreateTable("users").Column("id", BigSerial).Column("email", Text, NotNull()).PrimaryKey("id")
+func CreateTable(name string) *TableBuilder {
+	return &TableBuilder{name: name}
+}
+
+// Column adds a column to the table
+func (b *TableBuilder) Column(name string, columnType ColumnType, opts ...ColumnOption) *TableBuilder {
+	column := &ddlColumn{name: name, columnType: columnType}
+	for _, opt := range opts {
+		opt(column)
+	}
+	b.columns = append(b.columns, column)
+	return b
+}
+
+// PrimaryKey sets the columns of the table's primary key
+func (b *TableBuilder) PrimaryKey(columns ...string) *TableBuilder {
+	b.primaryKey = columns
+	return b
+}
+
+// IfNotExists only creates the table if it doesn't exist. Oracle doesn't
+// support IF NOT EXISTS, so the clause is left out for it.
+func (b *TableBuilder) IfNotExists() *TableBuilder {
+	b.ifNotExists = true
+	return b
+}
+
+// SQL renders the CREATE TABLE statement for the dialect
+func (b *TableBuilder) SQL(dialect string) string {
+	inlineKey := ""
+	if dialect == "sqlite" && len(b.primaryKey) == 1 {
+		for _, column := range b.columns {
+			if column.name == b.primaryKey[0] && column.columnType.serial() {
+				inlineKey = column.name
+			}
+		}
+	}
+
+	definitions := make([]string, 0, len(b.columns)+1)
+	for _, column := range b.columns {
+		definitions = append(definitions, column.sql(dialect, column.name == inlineKey))
+	}
+	if len(b.primaryKey) > 0 && inlineKey == "" {
+		definitions = append(definitions, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(b.primaryKey, ", ")))
+	}
+
+	create := "CREATE TABLE "
+	if b.ifNotExists && dialect != "oracle" {
+		create += "IF NOT EXISTS "
+	}
+	return fmt.Sprintf("%s%s (\n\t%s\n)", create, b.name, strings.Join(definitions, ",\n\t"))
+}
+
+// columnBuilder builds an ALTER TABLE statement which adds a column
+type columnBuilder struct {
+	table  string
+	column *ddlColumn
+}
+
+// AddColumn builds an ALTER TABLE statement which adds a column to the
+// table. Oracle's syntax omits the COLUMN keyword.
+// Usage: AddColumn("users", "active", Boolean, NotNull(), Default("true"))
+func AddColumn(table string, name string, columnType ColumnType, opts ...ColumnOption) DDLStatement {
+	column := &ddlColumn{name: name, columnType: columnType}
+	for _, opt := range opts {
+		opt(column)
+	}
+	return &columnBuilder{table: table, column: column}
+}
+
+// SQL renders the ALTER TABLE statement for the dialect
+func (b *columnBuilder) SQL(dialect string) string {
+	if dialect == "oracle" {
+		return fmt.Sprintf("ALTER TABLE %s ADD %s", b.table, b.column.sql(dialect, false))
+	}
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", b.table, b.column.sql(dialect, false))
+}
+
+// indexBuilder builds a CREATE INDEX statement
+type indexBuilder struct {
+	name    string
+	table   string
+	columns []string
+	unique  bool
+}
+
+// CreateIndex builds a CREATE INDEX statement for the columns of the table
+// Usage: CreateIndex("users_email", "users", "email")
+func CreateIndex(name string, table string, columns ...string) DDLStatement {
+	return &indexBuilder{name: name, table: table, columns: columns}
+}
+
+// CreateUniqueIndex builds a CREATE UNIQUE INDEX statement for the columns
+// of the table
+func CreateUniqueIndex(name string, table string, columns ...string) DDLStatement {
+	return &indexBuilder{name: name, table: table, columns: columns, unique: true}
+}
+
+// SQL renders the CREATE INDEX statement, which is the same for every
+// dialect
+func (b *indexBuilder) SQL(dialect string) string {
+	create := "CREATE INDEX"
+	if b.unique {
+		create = "CREATE UNIQUE INDEX"
+	}
+	return fmt.Sprintf("%s %s ON %s (%s)", create, b.name, b.table, strings.Join(b.columns, ", "))
+}
+
+// renderDDL renders the statements for the dialect as a script
+func renderDDL(statements []DDLStatement, dialect string) string {
+	rendered := make([]string, len(statements))
+	for i, statement := range statements {
+		rendered[i] = statement.SQL(dialect) + ";"
+	}
+	return strings.Join(rendered, "\n")
+}
+
+// DDLMigration creates a migration which runs the statements, rendered for
+// the Migrator's dialect when Apply runs it, so that projects targeting
+// several databases needn't maintain a script for each. Its Script is the
+// Postgres form, which the checksum covers.
+// Usage: DDLMigration("2021-01-01 Users", CreateTable("users").Column("id", BigSerial).PrimaryKey("id"))
+func DDLMigration(id string, statements ...DDLStatement) *Migration {
+	return &Migration{
+		ID:     id,
+		Script: renderDDL(statements, ""),
+		Engine: ScriptEngineFunc(func(source string, dialect string) (string, error) {
+			return renderDDL(statements, dialect), nil
+		}),
+	}
+}
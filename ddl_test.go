@@ -0,0 +1,55 @@
+package schema
+
+import "testing"
+
+func TestDDLBuilder(t *testing.T) {
+	users := CreateTable("users").
+		Column("id", BigSerial).
+		Column("email", Varchar(255), NotNull(), Unique()).
+		Column("created_at", Timestamp, NotNull()).
+		PrimaryKey("id")
+
+	expected := map[string]string{
+		"": `CREATE TABLE users (
+	id BIGSERIAL,
+	email VARCHAR(255) NOT NULL UNIQUE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	PRIMARY KEY (id)
+)`,
+		"sqlite": `CREATE TABLE users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	email VARCHAR(255) NOT NULL UNIQUE,
+	created_at DATETIME NOT NULL
+)`,
+		"mysql": `CREATE TABLE users (
+	id BIGINT AUTO_INCREMENT,
+	email VARCHAR(255) NOT NULL UNIQUE,
+	created_at DATETIME(6) NOT NULL,
+	PRIMARY KEY (id)
+)`,
+		"oracle": `CREATE TABLE users (
+	id NUMBER(19) GENERATED BY DEFAULT AS IDENTITY,
+	email VARCHAR2(255) NOT NULL UNIQUE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	PRIMARY KEY (id)
+)`,
+	}
+	for dialect, sql := range expected {
+		if rendered := users.SQL(dialect); rendered != sql {
+			t.Errorf("%q: Expected:\n%s\nGot:\n%s", dialect, sql, rendered)
+		}
+	}
+
+	statements := map[string]DDLStatement{
+		"ALTER TABLE users ADD COLUMN active BOOLEAN DEFAULT true NOT NULL": AddColumn("users", "active", Boolean, NotNull(), Default("true")),
+		"CREATE UNIQUE INDEX users_email ON users (email, created_at)":      CreateUniqueIndex("users_email", "users", "email", "created_at"),
+	}
+	for sql, statement := range statements {
+		if rendered := statement.SQL("postgres"); rendered != sql {
+			t.Errorf("Expected %q. Got %q", sql, rendered)
+		}
+	}
+	if rendered := AddColumn("users", "note", Text).SQL("oracle"); rendered != "ALTER TABLE users ADD note CLOB" {
+		t.Errorf("Unexpected Oracle column: %q", rendered)
+	}
+}
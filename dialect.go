@@ -1,6 +1,9 @@
 package schema
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+)
 
 // Dialect defines the interface for a database dialect.
 // All interface functions take the customized table name
@@ -14,10 +17,21 @@ type Dialect interface {
 	InsertSQL(tableName string) string
 }
 
+// Updater defines an interface for dialects which can refresh the record of
+// a migration which has run again, such as an Always migration or a Batch
+// migration recording its progress. The statement takes the InsertSQL
+// arguments in the same order. Apply fails with ErrUpdateNotSupported when
+// such migrations are applied with a dialect which doesn't implement it.
+type Updater interface {
+	UpdateSQL(tableName string) string
+}
+
 // Locking is achieved by implementing at least one of the
 // Locker interfaces. If the database natively supports
 // locking through SQL, the SQLLocker is simpler. If neither
-// interface is present a panic will occur.
+// interface is present a panic will occur. A dialect may
+// additionally implement TransactionLocker, which takes
+// precedence when it returns a non-empty statement.
 
 // Locker defines an interface that implements locking.
 type Locker interface {
@@ -25,9 +39,274 @@ type Locker interface {
 	Unlock(db *sql.DB) error
 }
 
+// ContextLocker defines an interface that implements locking
+// with a context, so that a cancelled Apply stops waiting for
+// the lock. It is used in preference to Locker, which its
+// implementations also implement with context.Background().
+type ContextLocker interface {
+	LockContext(ctx context.Context, db *sql.DB) error
+	UnlockContext(ctx context.Context, db *sql.DB) error
+}
+
 // SQLLocker defines an interface that implements locking
-// using a single SQL statement.
+// using a single SQL statement. The statements are given
+// the quoted, fully-qualified tracking table name so that
+// lock keys can be derived from it.
 type SQLLocker interface {
 	LockSQL(tableName string) string
 	UnlockSQL(tableName string) string
 }
+
+// TransactionLocker defines an interface that implements locking
+// using a single SQL statement executed at the start of the
+// migration transaction. The lock is released automatically when
+// the transaction commits or rolls back, or when the connection
+// dies. An empty statement means the dialect isn't configured to
+// lock this way, and one of the other Locker interfaces is used.
+type TransactionLocker interface {
+	TransactionLockSQL(tableName string) string
+}
+
+// SessionConfigurer defines an interface for dialects which
+// need SQL statements executed on the migration connection
+// before it is used, such as setting a busy timeout.
+type SessionConfigurer interface {
+	SessionSQL() []string
+}
+
+// Capabilities describes behavior of a database which affects the
+// guarantees the Migrator can provide.
+type Capabilities struct {
+	// TransactionalDDL is true when schema changes can be rolled
+	// back as part of a transaction. Without it, each migration is
+	// committed separately and a failed migration may be left
+	// partially applied.
+	TransactionalDDL bool
+
+	// AtomicDDL is true when each DDL statement either completes or
+	// is rolled back entirely, even if it can't be rolled back as
+	// part of a transaction, as in MySQL 8. Without it, a failed DDL
+	// statement may itself be left partially applied.
+	AtomicDDL bool
+
+	// LockStrategy describes how concurrent migrators are kept
+	// from running simultaneously.
+	LockStrategy LockStrategy
+}
+
+// LockStrategy names a way in which a dialect locks the database
+// while migrating.
+type LockStrategy string
+
+// The lock strategies used by the built-in dialects
+const (
+	LockStrategyAdvisory            LockStrategy = "advisory"
+	LockStrategyTransactionAdvisory LockStrategy = "transaction-advisory"
+	LockStrategyTable               LockStrategy = "table"
+	LockStrategyLockTable           LockStrategy = "lock-table"
+	LockStrategyWriteLock           LockStrategy = "write-lock"
+)
+
+// CapabilityReporter defines an interface for dialects which
+// report their Capabilities. Dialects which don't implement it
+// are assumed to support transactional DDL.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// CapabilityDetector defines an interface for dialects whose
+// Capabilities depend on the version of the server, as reported
+// by their VersionReporter. Apply uses the detected Capabilities
+// in preference to those the dialect reports statically.
+type CapabilityDetector interface {
+	DetectCapabilities(serverVersion string) Capabilities
+}
+
+// StatementSplitter defines an interface for dialects which
+// execute migration scripts one statement at a time, so that
+// failures can be reported against the statement which caused
+// them. A nil result means the dialect isn't configured to
+// split, and the script is executed as a whole.
+type StatementSplitter interface {
+	SplitStatements(script string) []string
+}
+
+// ImplicitCommitDetector defines an interface for dialects in
+// which some statements commit the current transaction as a side
+// effect (as DDL does in MySQL). Once such a statement has run,
+// a failure later in the same migration can't be rolled back.
+type ImplicitCommitDetector interface {
+	CommitsImplicitly(statement string) bool
+}
+
+// NamedDialect defines an interface for dialects which have a
+// name, such as "postgres". The name selects the dialect's
+// variant of a migration's script from Migration.DialectScripts.
+type NamedDialect interface {
+	Name() string
+}
+
+// ExternalExecutor defines an interface for dialects which can
+// execute a migration's script with an external tool, such as an
+// online schema change tool, rather than on the migration
+// connection. It is used for migrations marked External.
+type ExternalExecutor interface {
+	ExecuteExternally(ctx context.Context, script string) error
+}
+
+// TransactionConfigurer defines an interface for dialects which
+// execute SQL statements at the start of each migration's
+// transaction, such as SET LOCAL timeouts.
+type TransactionConfigurer interface {
+	TransactionSQL() []string
+}
+
+// ReplicaDetector defines an interface for dialects which can
+// tell whether the connected server is a read-only replica. The
+// query's first column is truthy on a replica.
+type ReplicaDetector interface {
+	ReplicaSQL() string
+}
+
+// VersionReporter defines an interface for dialects which can
+// report the version of the connected server, such as "11.5",
+// for migrations which require a minimum server version. The
+// query's first column holds the version.
+type VersionReporter interface {
+	VersionSQL() string
+}
+
+// BuildRecorder defines an interface for dialects which can
+// record build metadata (see WithBuildMetadata) alongside each
+// applied migration, in a table next to the tracking table. The
+// insert statement takes the migration ID, the metadata and the
+// time the migration was applied.
+type BuildRecorder interface {
+	CreateBuildsSQL(tableName string) string
+	InsertBuildSQL(tableName string) string
+}
+
+// ApplicationNamer defines an interface for dialects which can
+// tag the migration connection with an application name (see
+// WithApplicationName), so that DBAs can identify migration
+// sessions, such as in pg_stat_activity.
+type ApplicationNamer interface {
+	ApplicationNameSQL(name string) string
+}
+
+// Maintainer defines an interface for dialects which can refresh
+// a table's planner statistics and reclaim its space after
+// migrations change it (see WithMaintenance). An empty statement
+// means the dialect can't do that kind of maintenance.
+type Maintainer interface {
+	AnalyzeSQL(tableName string) string
+	VacuumSQL(tableName string) string
+}
+
+// ScriptRecorder defines an interface for dialects which can store
+// the compressed script of each applied migration, in a table next
+// to the tracking table (see WithScriptRecording). The insert
+// statement takes the migration ID, the compressed script and the
+// time the migration was applied.
+type ScriptRecorder interface {
+	CreateScriptsSQL(tableName string) string
+	InsertScriptSQL(tableName string) string
+}
+
+// SetRecorder defines an interface for dialects which can store
+// the checksum of the last migration set applied in full, in a
+// table next to the tracking table (see WithSetChecksum). The
+// insert statement takes the checksum, the number of migrations
+// in the set and the time it was applied.
+type SetRecorder interface {
+	CreateSetSQL(tableName string) string
+	InsertSetSQL(tableName string) string
+}
+
+// ObjectCommenter defines an interface for dialects which can
+// comment a table or an index (see WithObjectComments). An empty
+// statement means the dialect can't comment that kind of object.
+type ObjectCommenter interface {
+	CommentTableSQL(tableName, comment string) string
+	CommentIndexSQL(indexName, tableName, comment string) string
+}
+
+// HistoryPruner defines an interface for dialects which can delete
+// the rows of a migration from the tracking table or the tables
+// next to it (see PruneHistory). The statement takes the ID.
+type HistoryPruner interface {
+	DeleteSQL(tableName string) string
+}
+
+// Introspector defines an interface for dialects which can list
+// the structure of the database (see Introspect). The queries
+// cover every table in the schema, or the current schema when
+// the name is empty. TablesSQL returns the table names.
+// ColumnsSQL returns the table name, column name, type, whether
+// it is nullable and its default, in column order. IndexesSQL
+// returns the table name, index name, whether it is unique and
+// the column name, with a row for each indexed column in order.
+type Introspector interface {
+	TablesSQL(schemaName string) string
+	ColumnsSQL(schemaName string) string
+	IndexesSQL(schemaName string) string
+}
+
+// StatementValidator defines an interface for dialects which
+// reject statements the database can't run, such as foreign key
+// DDL under Vitess. Apply validates every statement of the
+// planned migrations before running any of them.
+type StatementValidator interface {
+	ValidateStatement(statement string) error
+}
+
+// DeferredSchemaChanger defines an interface for dialects whose
+// DDL may complete after the statement returns, such as Vitess's
+// online DDL. A statement for which DefersSchemaChange is true
+// returns the ID of the change as a single value, and Apply waits
+// for each change with WaitForSchemaChange before recording the
+// migration, so that it reports real completion.
+type DeferredSchemaChanger interface {
+	DefersSchemaChange(statement string) bool
+	WaitForSchemaChange(ctx context.Context, db QueryerContext, id string) error
+}
+
+// LockHolderReporter defines an interface for dialects which can
+// list the sessions holding the migration lock (see LockHolders).
+// The query returns the session's ID, its application name, its
+// client and when it connected, any of which but the ID may be
+// NULL.
+type LockHolderReporter interface {
+	LockHolderSQL(tableName string) string
+}
+
+// ExtensionCreator defines an interface for dialects which can
+// create database extensions (see WithRequiredExtensions). The
+// statement must do nothing when the extension already exists.
+type ExtensionCreator interface {
+	CreateExtensionSQL(name string) string
+}
+
+// NonTransactionalDetector defines an interface for dialects with
+// statements which can't run inside a transaction, such as
+// CREATE INDEX CONCURRENTLY on Postgres. Apply fails before running
+// any migration when a migration which runs in a transaction has
+// one, instead of failing part way through with a driver error.
+// The server version is empty when it isn't known.
+type NonTransactionalDetector interface {
+	RequiresNoTransaction(statement, serverVersion string) bool
+}
+
+// ConcurrentIndexBuilder defines an interface for dialects which
+// can build an index without blocking writes (see
+// ConcurrentIndex). IndexValiditySQL takes the index name and
+// returns whether the index is valid, with no rows when it doesn't
+// exist. SessionIDSQL returns the ID of the current session, which
+// IndexProgressSQL takes to return the phase of its build and the
+// blocks and tuples done and in total.
+type ConcurrentIndexBuilder interface {
+	IndexValiditySQL() string
+	SessionIDSQL() string
+	IndexProgressSQL() string
+	DropIndexConcurrentlySQL(indexName string) string
+}
@@ -0,0 +1,226 @@
+package schema
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SchemaDiff is the difference in structure between two databases: what
+// would have to change for the first to match the second
+type SchemaDiff struct {
+	// AddedTables are only in the second database
+	AddedTables []*Table
+
+	// DroppedTables are only in the first database
+	DroppedTables []*Table
+
+	// ChangedTables are in both databases, but differ
+	ChangedTables []*TableDiff
+}
+
+// TableDiff is the difference in a table which is in both databases
+type TableDiff struct {
+	Name           string
+	AddedColumns   []*Column
+	DroppedColumns []*Column
+	ChangedColumns []*ColumnChange
+	AddedIndexes   []*Index
+	DroppedIndexes []*Index
+}
+
+// ColumnChange is a column whose type, nullability or default differs
+type ColumnChange struct {
+	Name string
+	From *Column
+	To   *Column
+}
+
+// Diff compares the structure of two databases of the same kind, such as
+// staging and production before a release, detecting their dialect with
+// DetectDialect. Use Migrator.Diff to compare a schema other than the
+// current one.
+func Diff(a, b *sql.DB) (*SchemaDiff, error) {
+	dialect, err := DetectDialect(a)
+	if err != nil {
+		return nil, err
+	}
+	return NewMigrator(WithDialect(dialect)).Diff(a, b)
+}
+
+// Diff compares the structure of the Migrator's schema in two databases,
+// returning what would have to change for a to match b
+func (m Migrator) Diff(a, b Queryer) (*SchemaDiff, error) {
+	from, err := m.Introspect(a)
+	if err != nil {
+		return nil, err
+	}
+	to, err := m.Introspect(b)
+	if err != nil {
+		return nil, err
+	}
+	return diffTables(from, to), nil
+}
+
+// Empty returns whether the databases have the same structure
+func (d *SchemaDiff) Empty() bool {
+	return len(d.AddedTables) == 0 && len(d.DroppedTables) == 0 && len(d.ChangedTables) == 0
+}
+
+// SQL renders the difference as SQL which would make the first database
+// match the second, for review rather than execution: column types are as
+// the databases report them, and changed columns are described in comments
+// since altering them differs between dialects
+func (d *SchemaDiff) SQL() string {
+	statements := make([]string, 0)
+	for _, table := range d.AddedTables {
+		definitions := make([]string, len(table.Columns))
+		for i, column := range table.Columns {
+			definitions[i] = column.definition()
+		}
+		statements = append(statements, fmt.Sprintf("CREATE TABLE %s (\n\t%s\n);", table.Name, strings.Join(definitions, ",\n\t")))
+		for _, index := range table.Indexes {
+			statements = append(statements, index.createSQL(table.Name))
+		}
+	}
+	for _, table := range d.DroppedTables {
+		statements = append(statements, fmt.Sprintf("DROP TABLE %s;", table.Name))
+	}
+	for _, table := range d.ChangedTables {
+		for _, index := range table.DroppedIndexes {
+			statements = append(statements, fmt.Sprintf("DROP INDEX %s;", index.Name))
+		}
+		for _, column := range table.DroppedColumns {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", table.Name, column.Name))
+		}
+		for _, column := range table.AddedColumns {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;", table.Name, column.definition()))
+		}
+		for _, change := range table.ChangedColumns {
+			statements = append(statements, fmt.Sprintf("-- %s.%s changed from %s to %s", table.Name, change.Name, change.From.definition(), change.To.definition()))
+		}
+		for _, index := range table.AddedIndexes {
+			statements = append(statements, index.createSQL(table.Name))
+		}
+	}
+	return strings.Join(statements, "\n")
+}
+
+// definition renders the column as in a CREATE TABLE statement
+func (c *Column) definition() string {
+	definition := c.Name + " " + c.Type
+	if c.Default != "" {
+		definition += " DEFAULT " + c.Default
+	}
+	if !c.Nullable {
+		definition += " NOT NULL"
+	}
+	return definition
+}
+
+// createSQL renders the CREATE INDEX statement for the index on the table
+func (i *Index) createSQL(table string) string {
+	create := "CREATE INDEX"
+	if i.Unique {
+		create = "CREATE UNIQUE INDEX"
+	}
+	return fmt.Sprintf("%s %s ON %s (%s);", create, i.Name, table, strings.Join(i.Columns, ", "))
+}
+
+// diffTables compares two sets of tables, each sorted by name
+func diffTables(from, to []*Table) *SchemaDiff {
+	diff := &SchemaDiff{
+		AddedTables:   make([]*Table, 0),
+		DroppedTables: make([]*Table, 0),
+		ChangedTables: make([]*TableDiff, 0),
+	}
+	fromByName := make(map[string]*Table, len(from))
+	for _, table := range from {
+		fromByName[table.Name] = table
+	}
+	toByName := make(map[string]*Table, len(to))
+	for _, table := range to {
+		toByName[table.Name] = table
+		original, exists := fromByName[table.Name]
+		if !exists {
+			diff.AddedTables = append(diff.AddedTables, table)
+			continue
+		}
+		if tableDiff := diffTable(original, table); tableDiff != nil {
+			diff.ChangedTables = append(diff.ChangedTables, tableDiff)
+		}
+	}
+	for _, table := range from {
+		if _, exists := toByName[table.Name]; !exists {
+			diff.DroppedTables = append(diff.DroppedTables, table)
+		}
+	}
+	return diff
+}
+
+// diffTable compares the table in both databases, returning nil if it is
+// the same. An index whose columns changed is dropped and added again.
+func diffTable(from, to *Table) *TableDiff {
+	diff := &TableDiff{
+		Name:           to.Name,
+		AddedColumns:   make([]*Column, 0),
+		DroppedColumns: make([]*Column, 0),
+		ChangedColumns: make([]*ColumnChange, 0),
+		AddedIndexes:   make([]*Index, 0),
+		DroppedIndexes: make([]*Index, 0),
+	}
+
+	fromColumns := make(map[string]*Column, len(from.Columns))
+	for _, column := range from.Columns {
+		fromColumns[column.Name] = column
+	}
+	toColumns := make(map[string]bool, len(to.Columns))
+	for _, column := range to.Columns {
+		toColumns[column.Name] = true
+		original, exists := fromColumns[column.Name]
+		switch {
+		case !exists:
+			diff.AddedColumns = append(diff.AddedColumns, column)
+		case *original != *column:
+			diff.ChangedColumns = append(diff.ChangedColumns, &ColumnChange{Name: column.Name, From: original, To: column})
+		}
+	}
+	for _, column := range from.Columns {
+		if !toColumns[column.Name] {
+			diff.DroppedColumns = append(diff.DroppedColumns, column)
+		}
+	}
+
+	fromIndexes := make(map[string]*Index, len(from.Indexes))
+	for _, index := range from.Indexes {
+		fromIndexes[index.Name] = index
+	}
+	toIndexes := make(map[string]*Index, len(to.Indexes))
+	for _, index := range to.Indexes {
+		toIndexes[index.Name] = index
+		original, exists := fromIndexes[index.Name]
+		if exists && sameIndex(original, index) {
+			continue
+		}
+		if exists {
+			diff.DroppedIndexes = append(diff.DroppedIndexes, original)
+		}
+		diff.AddedIndexes = append(diff.AddedIndexes, index)
+	}
+	for _, index := range from.Indexes {
+		if _, exists := toIndexes[index.Name]; !exists {
+			diff.DroppedIndexes = append(diff.DroppedIndexes, index)
+		}
+	}
+
+	if len(diff.AddedColumns)+len(diff.DroppedColumns)+len(diff.ChangedColumns)+len(diff.AddedIndexes)+len(diff.DroppedIndexes) == 0 {
+		return nil
+	}
+	return diff
+}
+
+// sameIndex returns whether the indexes cover the same columns in the same
+// way
+func sameIndex(a, b *Index) bool {
+	return a.Unique == b.Unique && strings.Join(a.Columns, "\x00") == strings.Join(b.Columns, "\x00")
+}
@@ -0,0 +1,53 @@
+package schema
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffSQLite(t *testing.T) {
+	open := func(name string, script string) *sql.DB {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = db.Close() })
+		if _, err = db.Exec(script); err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+	production := open("production.db", `
+		CREATE TABLE users (id INTEGER NOT NULL, name TEXT, legacy TEXT);
+		CREATE INDEX users_name ON users (name);
+		CREATE TABLE retired (id INTEGER);
+	`)
+	staging := open("staging.db", `
+		CREATE TABLE users (id INTEGER NOT NULL, name TEXT NOT NULL, email TEXT DEFAULT '');
+		CREATE UNIQUE INDEX users_name ON users (name);
+		CREATE TABLE orders (id INTEGER NOT NULL);
+	`)
+
+	diff, err := Diff(production, staging)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `CREATE TABLE orders (
+	id INTEGER NOT NULL
+);
+DROP TABLE retired;
+DROP INDEX users_name;
+ALTER TABLE users DROP COLUMN legacy;
+ALTER TABLE users ADD COLUMN email TEXT DEFAULT '';
+-- users.name changed from name TEXT to name TEXT NOT NULL
+CREATE UNIQUE INDEX users_name ON users (name);`
+	if sql := diff.SQL(); sql != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, sql)
+	}
+
+	same, err := Diff(staging, staging)
+	if err != nil || !same.Empty() {
+		t.Errorf("Expected no difference. Got %+v (%v)", same, err)
+	}
+}
@@ -0,0 +1,58 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotDurable is returned by Apply when the Migrator is configured with
+// WithDurabilityCheck and migrations it committed can't be read back on a
+// new connection
+var ErrNotDurable = errors.New("committed migrations are not visible on a new connection")
+
+// checkDurable reads the tracking table on a new connection, returning an
+// error wrapping ErrNotDurable unless every migration the run committed is
+// recorded with its checksum. Apply discards the migration connection when
+// the check is enabled, so the pool can't hand it back here, and this
+// connection is discarded afterwards, so that it isn't reused for the next
+// check.
+func (m Migrator) checkDurable(ctx context.Context, db *sql.DB, run *applyRun) error {
+	if len(run.completed) == 0 {
+		return nil
+	}
+	conn, err := m.migrationConn(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer discardConn(conn)
+
+	var applied map[string]*AppliedMigration
+	err = m.readTransaction(ctx, conn, func(tx *sql.Tx) (err error) {
+		applied, err = m.GetAppliedMigrations(contextQueryer{ctx: ctx, db: tx})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	planned := make(map[string]*Migration, len(run.plan))
+	for _, migration := range run.plan {
+		planned[migration.ID] = migration
+	}
+	missing := make([]string, 0)
+	for _, completed := range run.completed {
+		record, exists := applied[completed.ID]
+		migration := planned[completed.ID]
+		if !exists || (migration != nil && !m.matches(record, migration)) {
+			missing = append(missing, completed.ID)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrNotDurable, strings.Join(missing, ", "))
+	}
+	m.log("Verified that the applied migrations are durable")
+	return nil
+}
@@ -0,0 +1,150 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// ScriptEngine renders the Script of a migration written in an embedded
+// scripting language into SQL when the migration runs, so that dynamic
+// migrations (such as loops generating DDL for every tenant) can live next
+// to SQL migrations. The dialect is the name of the Migrator's dialect (see
+// NamedDialect), or empty if it has none. The schemastarlark package
+// provides an engine for Starlark.
+type ScriptEngine interface {
+	Render(source string, dialect string) (string, error)
+}
+
+// ScriptEngineFunc adapts a function into a ScriptEngine, such as one which
+// executes a text/template
+type ScriptEngineFunc func(source string, dialect string) (string, error)
+
+// Render calls f(source, dialect)
+func (f ScriptEngineFunc) Render(source string, dialect string) (string, error) {
+	return f(source, dialect)
+}
+
+// ScriptVars describes the database and deploy a migration is applied to,
+// so that a single script can branch on what the server supports, such as
+// using IDENTITY columns where they exist and SERIAL elsewhere
+type ScriptVars struct {
+	// Dialect is the name of the Migrator's dialect (see NamedDialect), or
+	// empty if it has none
+	Dialect string
+
+	// ServerVersion is the version the server reports (see
+	// VersionReporter). It is only known while Apply is running, and is
+	// empty otherwise, such as when a plan is explained.
+	ServerVersion string
+
+	// Environment is the Migrator's Environment, such as "production".
+	// See WithEnvironment.
+	Environment string
+
+	// Flags are the Migrator's custom feature flags. See WithScriptFlags.
+	Flags map[string]bool
+}
+
+// VersionAtLeast returns whether the server is at least the version, such as
+// "10" or "8.0.13". It is false when the server version isn't known.
+func (v ScriptVars) VersionAtLeast(version string) bool {
+	if v.ServerVersion == "" {
+		return false
+	}
+	older, err := versionOlder(v.ServerVersion, version)
+	return err == nil && !older
+}
+
+// VarsEngine defines an interface for ScriptEngines which render with the
+// full ScriptVars rather than only the name of the dialect. RenderVars is
+// used in preference to Render.
+type VarsEngine interface {
+	RenderVars(source string, vars ScriptVars) (string, error)
+}
+
+// TemplateEngine is a ScriptEngine which executes the Script as a
+// text/template, with the ScriptVars as its data:
+//
+//	CREATE TABLE users (
+//	  {{if .VersionAtLeast "10"}}id INTEGER GENERATED ALWAYS AS IDENTITY{{else}}id SERIAL{{end}}
+//	  {{- if .Flags.audit}}, audited_at TIMESTAMP{{end}}
+//	)
+type TemplateEngine struct {
+	// Funcs are made available to the templates in addition to the
+	// text/template builtins
+	Funcs template.FuncMap
+}
+
+var _ VarsEngine = TemplateEngine{}
+
+// Render executes the template with only the Dialect known
+func (e TemplateEngine) Render(source string, dialect string) (string, error) {
+	return e.RenderVars(source, ScriptVars{Dialect: dialect})
+}
+
+// RenderVars executes the template with the vars
+func (e TemplateEngine) RenderVars(source string, vars ScriptVars) (string, error) {
+	tmpl, err := template.New("migration").Option("missingkey=zero").Funcs(e.Funcs).Parse(source)
+	if err != nil {
+		return "", err
+	}
+	var script strings.Builder
+	err = tmpl.Execute(&script, vars)
+	return script.String(), err
+}
+
+// scriptVars returns the ScriptVars with which migrations are rendered
+func (m Migrator) scriptVars() ScriptVars {
+	vars := ScriptVars{ServerVersion: m.serverVersion, Environment: m.Environment, Flags: m.ScriptFlags}
+	if named, ok := m.Dialect.(NamedDialect); ok {
+		vars.Dialect = named.Name()
+	}
+	return vars
+}
+
+// withServerVersion returns the Migrator with the server version recorded
+// for rendering and for checking statements which can't run in a
+// transaction, if there is a plan which needs it and the dialect can report
+// it
+func (m Migrator) withServerVersion(ctx context.Context, tx *sql.Tx, plan []*Migration) (Migrator, error) {
+	reporter, ok := m.Dialect.(VersionReporter)
+	if !ok || m.serverVersion != "" {
+		return m, nil
+	}
+	_, detects := m.Dialect.(NonTransactionalDetector)
+	for _, migration := range plan {
+		if _, ok := migration.Engine.(VarsEngine); !ok && !detects {
+			continue
+		}
+		value, _, err := m.queryFirstValue(ctx, tx, reporter.VersionSQL())
+		if err != nil {
+			return m, err
+		}
+		m.serverVersion = fmt.Sprintf("%s", value)
+		return m, nil
+	}
+	return m, nil
+}
+
+// renderScript returns the SQL which the migration's Script executes, which
+// is rendered by its Engine if it has one
+func (m Migrator) renderScript(migration *Migration) (string, error) {
+	if migration.Engine == nil {
+		return migration.Script, nil
+	}
+	vars := m.scriptVars()
+	var script string
+	var err error
+	if engine, ok := migration.Engine.(VarsEngine); ok {
+		script, err = engine.RenderVars(migration.Script, vars)
+	} else {
+		script, err = migration.Engine.Render(migration.Script, vars.Dialect)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Migration '%s' Failed to render:\n%w", migration.ID, err)
+	}
+	return script, nil
+}
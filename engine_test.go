@@ -0,0 +1,34 @@
+package schema
+
+import "testing"
+
+func TestTemplateEngine(t *testing.T) {
+	source := `CREATE TABLE users ({{if .VersionAtLeast "10"}}id INTEGER GENERATED ALWAYS AS IDENTITY{{else}}id SERIAL{{end}}{{if .Flags.audit}}, audited_at TIMESTAMP{{end}}) -- {{.Dialect}} {{.Environment}}`
+	cases := map[string]struct {
+		vars     ScriptVars
+		expected string
+	}{
+		"old server": {
+			ScriptVars{Dialect: "postgres", ServerVersion: "9.6.20", Environment: "staging"},
+			"CREATE TABLE users (id SERIAL) -- postgres staging",
+		},
+		"new server with flag": {
+			ScriptVars{Dialect: "postgres", ServerVersion: "11.5 (Debian 11.5-1)", Flags: map[string]bool{"audit": true}},
+			"CREATE TABLE users (id INTEGER GENERATED ALWAYS AS IDENTITY, audited_at TIMESTAMP) -- postgres ",
+		},
+		"unknown server": {
+			ScriptVars{Dialect: "postgres"},
+			"CREATE TABLE users (id SERIAL) -- postgres ",
+		},
+	}
+	for name, c := range cases {
+		script, err := TemplateEngine{}.RenderVars(source, c.vars)
+		if err != nil || script != c.expected {
+			t.Errorf("%s: Expected %q. Got %q (%v)", name, c.expected, script, err)
+		}
+	}
+
+	if _, err := (TemplateEngine{}).Render("{{if}}", "postgres"); err == nil {
+		t.Error("Expected a parse error")
+	}
+}
@@ -0,0 +1,102 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Explainer defines an interface for dialects which can estimate the cost
+// of a statement without executing it, using EXPLAIN
+type Explainer interface {
+	// ExplainSQL returns the statement which explains statement
+	ExplainSQL(statement string) string
+	// ParseExplain extracts the estimated cost and number of rows from the
+	// output of the ExplainSQL statement
+	ParseExplain(output string) (cost float64, rows float64, err error)
+}
+
+// Explanation is the estimated cost of a DML statement in a plan
+type Explanation struct {
+	Statement string  `json:"statement"`
+	Cost      float64 `json:"cost"`
+	Rows      float64 `json:"rows"`
+	// Error is set when the statement couldn't be explained, which happens
+	// when it uses objects created by an earlier pending migration
+	Error string `json:"error,omitempty"`
+}
+
+// Explain runs EXPLAIN on the DML statements (INSERT, UPDATE, DELETE and
+// MERGE) of each planned migration and records their estimated costs and row
+// counts in the plan, helping reviewers spot accidental full-table rewrites.
+// The statements aren't executed. It returns an error if the dialect doesn't
+// implement Explainer.
+func (m Migrator) Explain(ctx context.Context, db *sql.DB, plan *Plan) error {
+	explainer, ok := m.Dialect.(Explainer)
+	if !ok {
+		return fmt.Errorf("the dialect does not support EXPLAIN")
+	}
+	if db == nil {
+		return ErrNilDB
+	}
+
+	for _, migration := range plan.Migrations {
+		migration.Explanations = make([]*Explanation, 0)
+		for _, statement := range migration.Statements {
+			if !isDML(statement) {
+				continue
+			}
+			explanation := &Explanation{Statement: statement}
+			output, err := m.explain(ctx, db, explainer.ExplainSQL(statement))
+			if err == nil {
+				explanation.Cost, explanation.Rows, err = explainer.ParseExplain(output)
+			}
+			if err != nil {
+				explanation.Error = m.redact(err.Error())
+			}
+			explanation.Statement = m.redact(statement)
+			migration.Explanations = append(migration.Explanations, explanation)
+		}
+	}
+	return nil
+}
+
+// explain runs the EXPLAIN statement in a transaction which is always rolled
+// back, and returns its output
+func (m Migrator) explain(ctx context.Context, db *sql.DB, explainSQL string) (string, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := m.query(ctx, tx, explainSQL)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	lines := make([]string, 0)
+	for rows.Next() {
+		var line string
+		err = rows.Scan(&line)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), rows.Err()
+}
+
+// isDML returns whether the statement modifies data
+func isDML(statement string) bool {
+	words := strings.Fields(strings.ToUpper(stripLeadingComments(statement)))
+	if len(words) == 0 {
+		return false
+	}
+	switch words[0] {
+	case "INSERT", "UPDATE", "DELETE", "MERGE":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// insufficientPrivilegeSQLState is the SQLSTATE code of the error returned
+// when the role may not create an extension
+const insufficientPrivilegeSQLState = "42501"
+
+// createExtensions creates the RequiredExtensions which don't exist yet, on
+// dialects which implement ExtensionCreator, before the migrations of a run
+func (m Migrator) createExtensions(ctx context.Context, db ExecerContext, plan []*Migration) error {
+	creator, ok := m.Dialect.(ExtensionCreator)
+	if len(plan) == 0 || !ok {
+		return nil
+	}
+	for _, extension := range m.RequiredExtensions {
+		createSQL := creator.CreateExtensionSQL(extension)
+		_, err := m.exec(ctx, db, createSQL)
+		if isInsufficientPrivilege(err) {
+			return fmt.Errorf("Creating extension '%s' failed:\n%w\nThe migration role isn't allowed to create it. "+
+				"Have a superuser run '%s' once, or grant the role CREATE on the database if the extension is trusted.",
+				extension, err, createSQL)
+		}
+		if err != nil {
+			return fmt.Errorf("Creating extension '%s' failed:\n%w", extension, err)
+		}
+	}
+	return nil
+}
+
+// isInsufficientPrivilege returns whether the error is a privilege error, as
+// reported by drivers whose errors have a SQLState() method
+func isInsufficientPrivilege(err error) bool {
+	var stateful interface{ SQLState() string }
+	return errors.As(err, &stateful) && stateful.SQLState() == insufficientPrivilegeSQLState
+}
@@ -0,0 +1,43 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// failingExecer fails every statement with its error, recording them
+type failingExecer struct {
+	err        error
+	statements []string
+}
+
+func (e *failingExecer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	e.statements = append(e.statements, query)
+	return nil, e.err
+}
+
+func TestCreateExtensions(t *testing.T) {
+	plan := []*Migration{{ID: "2020-01-01 Pending"}}
+	m := NewMigrator(WithDialect(Postgres), WithRequiredExtensions("uuid-ossp"), WithRequiredExtensions("pgcrypto"))
+	db := &failingExecer{err: sqlStateError(insufficientPrivilegeSQLState)}
+	err := m.createExtensions(context.Background(), db, plan)
+	if !errors.Is(err, sqlStateError(insufficientPrivilegeSQLState)) || !strings.Contains(err.Error(), `Have a superuser run 'CREATE EXTENSION IF NOT EXISTS "uuid-ossp"'`) {
+		t.Errorf("Expected guidance on the privilege error. Got %v", err)
+	}
+
+	db = &failingExecer{}
+	err = m.createExtensions(context.Background(), db, plan)
+	if err != nil || len(db.statements) != 2 || db.statements[1] != `CREATE EXTENSION IF NOT EXISTS "pgcrypto"` {
+		t.Errorf("Expected each extension to be created. Got %v (%v)", db.statements, err)
+	}
+
+	db = &failingExecer{}
+	_ = m.createExtensions(context.Background(), db, nil)
+	_ = NewMigrator(WithDialect(MySQL), WithRequiredExtensions("pgcrypto")).createExtensions(context.Background(), db, plan)
+	if len(db.statements) != 0 {
+		t.Errorf("Expected no extensions without a plan or on MySQL. Got %v", db.statements)
+	}
+}
@@ -0,0 +1,140 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrFileLockTimeout is returned by FileLocker when another process held
+	// the lock file for longer than the lock timeout
+	ErrFileLockTimeout = errors.New("file: timeout requesting lock")
+
+	// ErrFileLockNotSupported is returned by FileLocker on platforms without
+	// flock
+	ErrFileLockNotSupported = errors.New("file: locking is not supported on this platform")
+)
+
+// FileLocker is a Locker which holds an exclusive flock on a file, for local
+// development with embedded databases such as SQLite, where several
+// processes on one machine may race to migrate. No lock table is needed, and
+// the operating system releases the lock if the process dies. Use it with
+// WithLocker.
+type FileLocker struct {
+	path         string
+	timeout      time.Duration
+	pollInterval time.Duration
+
+	// mutex is held from Lock until Unlock, so that goroutines sharing the
+	// locker queue for it in-process
+	mutex sync.Mutex
+	file  *os.File
+}
+
+var (
+	_ Locker        = (*FileLocker)(nil)
+	_ ContextLocker = (*FileLocker)(nil)
+)
+
+// NewFileLocker creates a FileLocker which locks the file at path, creating
+// it if necessary. A path next to the database file, such as "app.db.lock",
+// is typical. The lock timeout and poll interval are customized with the
+// WithFileLock... options.
+func NewFileLocker(path string, opts ...func(f *FileLocker)) *FileLocker {
+	f := &FileLocker{
+		path:         path,
+		pollInterval: 100 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// WithFileLockTimeout sets how long Lock waits to claim the lock before
+// giving up with ErrFileLockTimeout. By default it waits indefinitely.
+func WithFileLockTimeout(d time.Duration) func(f *FileLocker) {
+	return func(f *FileLocker) {
+		f.timeout = d
+	}
+}
+
+// WithFileLockPollInterval sets how long Lock sleeps between attempts to
+// claim a lock held by another process. The default is 100 milliseconds.
+func WithFileLockPollInterval(d time.Duration) func(f *FileLocker) {
+	return func(f *FileLocker) {
+		f.pollInterval = d
+	}
+}
+
+// Lock claims the lock file, waiting for up to the lock timeout while
+// another process holds it. The database is ignored.
+func (f *FileLocker) Lock(db *sql.DB) error {
+	return f.LockContext(context.Background(), db)
+}
+
+// LockContext is like Lock, but stops waiting for the lock when the context
+// is cancelled
+func (f *FileLocker) LockContext(ctx context.Context, db *sql.DB) error {
+	f.mutex.Lock()
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		f.mutex.Unlock()
+		return err
+	}
+	deadline := time.Now().Add(f.timeout)
+	for {
+		locked, err := tryLockFile(file)
+		if err == nil && locked {
+			break
+		}
+		if err == nil && f.timeout > 0 && time.Now().After(deadline) {
+			err = ErrFileLockTimeout
+		}
+		if err == nil {
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+			case <-time.After(f.pollInterval):
+			}
+		}
+		if err != nil {
+			_ = file.Close()
+			f.mutex.Unlock()
+			return err
+		}
+	}
+
+	f.file = file
+	return nil
+}
+
+// Unlock releases the lock file. The file is left in place, since removing
+// it would let another process lock a new file at the same path while one
+// is waiting on the old one.
+func (f *FileLocker) Unlock(db *sql.DB) error {
+	return f.UnlockContext(context.Background(), db)
+}
+
+// UnlockContext is the same as Unlock, since releasing the lock file doesn't
+// wait
+func (f *FileLocker) UnlockContext(ctx context.Context, db *sql.DB) error {
+	file := f.file
+	if file == nil {
+		return nil
+	}
+	defer f.mutex.Unlock()
+	f.file = nil
+
+	err := unlockFile(file)
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
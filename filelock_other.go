@@ -0,0 +1,16 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package schema
+
+import "os"
+
+// tryLockFile returns ErrFileLockNotSupported, since flock isn't available
+func tryLockFile(file *os.File) (bool, error) {
+	return false, ErrFileLockNotSupported
+}
+
+// unlockFile returns ErrFileLockNotSupported, since flock isn't available
+func unlockFile(file *os.File) error {
+	return ErrFileLockNotSupported
+}
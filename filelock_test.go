@@ -0,0 +1,40 @@
+package schema
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileLocker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.db.lock")
+	holder := NewFileLocker(path)
+	contender := NewFileLocker(path, WithFileLockTimeout(50*time.Millisecond), WithFileLockPollInterval(10*time.Millisecond))
+
+	err := holder.Lock(nil)
+	if err == ErrFileLockNotSupported {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = contender.Lock(nil); err != ErrFileLockTimeout {
+		t.Errorf("Expected ErrFileLockTimeout. Got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err = NewFileLocker(path).LockContext(ctx, nil); err != context.DeadlineExceeded {
+		t.Errorf("Expected the cancelled context's error. Got %v", err)
+	}
+	if err = holder.Unlock(nil); err != nil {
+		t.Error(err)
+	}
+
+	if err = contender.Lock(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = contender.Unlock(nil); err != nil {
+		t.Error(err)
+	}
+}
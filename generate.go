@@ -0,0 +1,137 @@
+package schema
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ScriptGenerator defines an interface for dialects whose scripts, as
+// written by GenerateSQL, differ from the default. BeginSQL returns the
+// statement which begins a transaction, or "" when transactions begin
+// implicitly, and CommitSQL the one which commits it. LiteralSQL quotes a
+// string as a literal, and TerminateSQL ends a statement so that the
+// database's command-line client runs it.
+type ScriptGenerator interface {
+	BeginSQL() string
+	CommitSQL() string
+	LiteralSQL(value string) string
+	TerminateSQL(statement string) string
+}
+
+// defaultScriptGenerator writes the BEGIN and COMMIT statements, literals and
+// semicolons which Postgres and SQLite accept
+type defaultScriptGenerator struct{}
+
+// BeginSQL returns BEGIN
+func (defaultScriptGenerator) BeginSQL() string {
+	return "BEGIN"
+}
+
+// CommitSQL returns COMMIT
+func (defaultScriptGenerator) CommitSQL() string {
+	return "COMMIT"
+}
+
+// LiteralSQL quotes the value as a literal
+func (defaultScriptGenerator) LiteralSQL(value string) string {
+	return quotedLiteral(value)
+}
+
+// TerminateSQL ends the statement with a semicolon
+func (defaultScriptGenerator) TerminateSQL(statement string) string {
+	return terminated(statement)
+}
+
+// GenerateSQL writes the complete SQL script a deploy of the supplied
+// migrations would run, including creation of the tracking table and the
+// tracking-table inserts, without connecting to a database. It is intended
+// for organizations where a DBA must review and execute changes manually.
+// Dialects which implement ScriptGenerator write the transactions, literals
+// and statement terminators in their own syntax.
+//
+// Because no database is consulted, every supplied migration is rendered as
+// if none had been applied yet. Callers who know the database state should
+// pass only the pending migrations. Verify queries, preconditions and
+// locking are not included in the output. The scripts of migrations with
+// DisableTransaction are written between transactions. Scripts with an Engine
+// are rendered as Apply would render them, except that no server version is
+// known to the engine.
+//
+// Only the scripts and the tracking table are written. The statements of a
+// Batch, the data of a Copy and the rows of a Seed are left out, with a
+// comment noting where they would run, and neither the builds, scripts and
+// set checksum tables nor object comments are written.
+func (m Migrator) GenerateSQL(w io.Writer, migrations []*Migration) error {
+	plan := m.forDialect(migrations)
+	SortMigrations(plan)
+
+	generator, ok := m.Dialect.(ScriptGenerator)
+	if !ok {
+		generator = defaultScriptGenerator{}
+	}
+	tableName := m.QuotedTableName()
+	statements := []string{
+		strings.TrimSpace(m.Dialect.CreateSQL(tableName)),
+		generator.BeginSQL(),
+	}
+	for _, migration := range plan {
+		script, err := m.renderScript(migration)
+		if err != nil {
+			return err
+		}
+		statements = append(statements, fmt.Sprintf("-- Migration: %s", migration.ID))
+		if migration.DisableTransaction {
+			statements = append(statements, generator.CommitSQL(), strings.TrimSpace(script), generator.BeginSQL())
+		} else {
+			statements = append(statements, strings.TrimSpace(script))
+		}
+		if migration.Batch != nil {
+			statements = append(statements, fmt.Sprintf("-- Batch: %s is not included", strings.Join(strings.Fields(migration.Batch.Statement), " ")))
+		}
+		if migration.Copy != nil {
+			statements = append(statements, fmt.Sprintf("-- Copy: the data copied into %s is not included", migration.Copy.Table))
+		}
+		if migration.Seed != nil {
+			statements = append(statements, fmt.Sprintf("-- Seed: %d rows into %s are not included", len(migration.Seed.Rows), migration.Seed.Table))
+		}
+		statements = append(statements,
+			fmt.Sprintf(
+				"INSERT INTO %s ( id, checksum, execution_time_in_millis, applied_at ) VALUES ( %s, %s, 0, CURRENT_TIMESTAMP )",
+				tableName,
+				generator.LiteralSQL(migration.ID),
+				generator.LiteralSQL(m.checksum(migration)),
+			),
+		)
+	}
+	statements = append(statements, generator.CommitSQL())
+
+	for _, statement := range statements {
+		if statement == "" {
+			continue
+		}
+		if !strings.HasPrefix(statement, "--") {
+			statement = generator.TerminateSQL(statement)
+		}
+		_, err := io.WriteString(w, statement+"\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// terminated returns the statement ending with a semicolon
+func terminated(statement string) string {
+	if strings.HasSuffix(statement, ";") {
+		return statement
+	}
+	return statement + ";"
+}
+
+// quotedLiteral renders a string as a single-quoted SQL literal. Backslashes
+// are left as they are, so literals for MySQL, which treats them as escape
+// characters by default, are rendered with mysqlLiteral instead.
+func quotedLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,137 @@
+package schema
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateSQL(t *testing.T) {
+	migrator := NewMigrator(WithTableName("offline_migrations"))
+	var buf bytes.Buffer
+	err := migrator.GenerateSQL(&buf, []*Migration{
+		{
+			ID:     "2020-01-02 Second",
+			Script: "CREATE TABLE second (id INTEGER);",
+		},
+		{
+			ID:     "2020-01-01 Jim's First",
+			Script: "CREATE TABLE first (id INTEGER)",
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `CREATE TABLE IF NOT EXISTS "offline_migrations"`) {
+		t.Errorf("Expected tracking table creation in output:\n%s", out)
+	}
+	if !strings.Contains(out, "'2020-01-01 Jim''s First'") {
+		t.Errorf("Expected escaped migration ID in output:\n%s", out)
+	}
+	first := strings.Index(out, "CREATE TABLE first (id INTEGER);")
+	second := strings.Index(out, "CREATE TABLE second (id INTEGER);")
+	if first < 0 || second < 0 || first > second {
+		t.Errorf("Expected both migrations in ID order:\n%s", out)
+	}
+	if !strings.HasSuffix(out, "COMMIT;\n") {
+		t.Errorf("Expected output to end with COMMIT:\n%s", out)
+	}
+}
+
+func TestGenerateSQLUsesDialectScripts(t *testing.T) {
+	migrations := []*Migration{
+		{
+			ID:     "2020-01-01 Users",
+			Script: "CREATE TABLE users (id SERIAL PRIMARY KEY)",
+			DialectScripts: map[string]string{
+				"sqlite": "CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT)",
+			},
+		},
+	}
+
+	var postgres, sqlite bytes.Buffer
+	if err := NewMigrator().GenerateSQL(&postgres, migrations); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewMigrator(WithDialect(NewSQLite())).GenerateSQL(&sqlite, migrations); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(postgres.String(), "SERIAL PRIMARY KEY") {
+		t.Errorf("Expected the default script for Postgres:\n%s", postgres.String())
+	}
+	if !strings.Contains(sqlite.String(), "AUTOINCREMENT") {
+		t.Errorf("Expected the SQLite variant for SQLite:\n%s", sqlite.String())
+	}
+	if migrations[0].Script != "CREATE TABLE users (id SERIAL PRIMARY KEY)" {
+		t.Error("Expected the supplied migration to be left unchanged")
+	}
+}
+
+func TestGenerateSQLWithDisableTransaction(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewMigrator().GenerateSQL(&buf, []*Migration{
+		{ID: "2020-01-01 Table", Script: "CREATE TABLE users (email TEXT)"},
+		{ID: "2020-01-02 Index", Script: "CREATE INDEX CONCURRENTLY users_email ON users (email)", DisableTransaction: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "COMMIT;\nCREATE INDEX CONCURRENTLY users_email ON users (email);\nBEGIN;\n") {
+		t.Errorf("Expected the index to be created between transactions:\n%s", buf.String())
+	}
+}
+
+func TestGenerateSQLRendersEngines(t *testing.T) {
+	migrations := []*Migration{
+		DDLMigration("2020-01-01 Users", CreateTable("users").Column("id", BigSerial).PrimaryKey("id")),
+		{ID: "2020-01-02 Broken", Script: "?", Engine: ScriptEngineFunc(func(source string, dialect string) (string, error) {
+			return "", errors.New("unrenderable")
+		})},
+	}
+
+	var buf bytes.Buffer
+	if err := NewMigrator(WithDialect(NewSQLite())).GenerateSQL(&buf, migrations[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "id INTEGER PRIMARY KEY") || strings.Contains(buf.String(), "BIGSERIAL") {
+		t.Errorf("Expected the script to be rendered for SQLite:\n%s", buf.String())
+	}
+
+	if err := NewMigrator().GenerateSQL(&buf, migrations); err == nil || !strings.Contains(err.Error(), "unrenderable") {
+		t.Errorf("Expected the render error. Got %v", err)
+	}
+}
+
+func TestGenerateSQLForDialects(t *testing.T) {
+	migrations := []*Migration{
+		{ID: `2020-01-01 C:\Users`, Script: "CREATE TABLE users (id INTEGER)"},
+		{ID: "2020-01-02 Backfill", Script: "ALTER TABLE users ADD email TEXT", Batch: &Batch{Statement: "UPDATE users SET email = ''\n WHERE id > $1 AND id <= $2"}},
+	}
+
+	var mysql bytes.Buffer
+	if err := NewMigrator(WithDialect(MySQL)).GenerateSQL(&mysql, migrations); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(mysql.String(), "START TRANSACTION;\n") {
+		t.Errorf("Expected a MySQL transaction:\n%s", mysql.String())
+	}
+	if !strings.Contains(mysql.String(), `'2020-01-01 C:\\Users'`) {
+		t.Errorf("Expected the backslash to be escaped for MySQL:\n%s", mysql.String())
+	}
+	if !strings.Contains(mysql.String(), "-- Batch: UPDATE users SET email = '' WHERE id > $1 AND id <= $2 is not included\n") {
+		t.Errorf("Expected a note in place of the batches:\n%s", mysql.String())
+	}
+
+	var oracle bytes.Buffer
+	if err := NewMigrator(WithDialect(Oracle)).GenerateSQL(&oracle, migrations[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(oracle.String(), "BEGIN;") {
+		t.Errorf("Expected no BEGIN statement for Oracle:\n%s", oracle.String())
+	}
+	if !strings.Contains(oracle.String(), "END;\n/\n") || !strings.HasSuffix(oracle.String(), "COMMIT;\n") {
+		t.Errorf("Expected the PL/SQL block to be run with a slash:\n%s", oracle.String())
+	}
+}
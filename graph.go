@@ -0,0 +1,132 @@
+package schema
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Kinds of GraphNode
+const (
+	GraphMigration        = "migration"
+	GraphMaterializedView = "materialized-view"
+)
+
+// GraphNode is a migration or declared materialized view in a Graph
+type GraphNode struct {
+	Kind string
+	Name string
+}
+
+// GraphEdge means that From is run or refreshed before To
+type GraphEdge struct {
+	From GraphNode
+	To   GraphNode
+}
+
+// Graph is the order in which Apply runs migrations and refreshes the
+// materialized views declared with WithMaterializedViews, for reviewing in
+// documentation and pull requests. Migrations are run in ID order, so they
+// form a chain. Each view follows the migrations which refresh it and the
+// views it depends on.
+type Graph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+}
+
+// Graph builds the Graph of the migrations and the Migrator's materialized
+// views
+func (m Migrator) Graph(migrations []*Migration) *Graph {
+	sorted := make([]*Migration, len(migrations))
+	copy(sorted, migrations)
+	SortMigrations(sorted)
+
+	g := &Graph{Nodes: make([]GraphNode, 0), Edges: make([]GraphEdge, 0)}
+	var previous *GraphNode
+	for _, migration := range sorted {
+		node := GraphNode{Kind: GraphMigration, Name: migration.ID}
+		g.Nodes = append(g.Nodes, node)
+		if previous != nil {
+			g.Edges = append(g.Edges, GraphEdge{From: *previous, To: node})
+		}
+		previous = &node
+	}
+
+	declared := make(map[string]bool, len(m.MaterializedViews))
+	for _, view := range m.MaterializedViews {
+		declared[view.Name] = true
+		g.Nodes = append(g.Nodes, GraphNode{Kind: GraphMaterializedView, Name: view.Name})
+	}
+	for _, view := range m.MaterializedViews {
+		node := GraphNode{Kind: GraphMaterializedView, Name: view.Name}
+		for _, migration := range sorted {
+			if view.refreshesFor(migration) {
+				g.Edges = append(g.Edges, GraphEdge{From: GraphNode{Kind: GraphMigration, Name: migration.ID}, To: node})
+			}
+		}
+		for _, dependency := range view.DependsOn {
+			if !declared[dependency] {
+				continue
+			}
+			g.Edges = append(g.Edges, GraphEdge{From: GraphNode{Kind: GraphMaterializedView, Name: dependency}, To: node})
+		}
+	}
+	return g
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language. Materialized views
+// are drawn as boxes.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	ids := g.nodeIDs()
+	fmt.Fprintln(b, "digraph migrations {")
+	for _, node := range g.Nodes {
+		shape := "ellipse"
+		if node.Kind == GraphMaterializedView {
+			shape = "box"
+		}
+		fmt.Fprintf(b, "\t%s [label=%s, shape=%s];\n", ids[node], dotQuote(node.Name), shape)
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(b, "\t%s -> %s;\n", ids[edge.From], ids[edge.To])
+	}
+	fmt.Fprintln(b, "}")
+	return b.Flush()
+}
+
+// WriteMermaid writes the graph as a Mermaid flowchart, which GitHub and
+// many documentation tools render. Materialized views are drawn with round
+// ends.
+func (g *Graph) WriteMermaid(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	ids := g.nodeIDs()
+	fmt.Fprintln(b, "flowchart TD")
+	for _, node := range g.Nodes {
+		label := strings.ReplaceAll(node.Name, `"`, "#quot;")
+		if node.Kind == GraphMaterializedView {
+			fmt.Fprintf(b, "\t%s([\"%s\"])\n", ids[node], label)
+		} else {
+			fmt.Fprintf(b, "\t%s[\"%s\"]\n", ids[node], label)
+		}
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(b, "\t%s --> %s\n", ids[edge.From], ids[edge.To])
+	}
+	return b.Flush()
+}
+
+// nodeIDs returns identifiers for the nodes which are safe in any output
+// format, since migration IDs may contain spaces and punctuation
+func (g *Graph) nodeIDs() map[GraphNode]string {
+	ids := make(map[GraphNode]string, len(g.Nodes))
+	for i, node := range g.Nodes {
+		ids[node] = fmt.Sprintf("n%d", i)
+	}
+	return ids
+}
+
+// dotQuote quotes the string as a DOT identifier
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
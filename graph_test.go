@@ -0,0 +1,52 @@
+package schema
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGraph(t *testing.T) {
+	m := NewMigrator(WithMaterializedViews(
+		&MaterializedView{Name: "totals", Migrations: []string{"2020-01-02*"}},
+		&MaterializedView{Name: "summary", DependsOn: []string{"totals"}},
+	))
+	g := m.Graph([]*Migration{
+		{ID: "2020-01-02 Add \"orders\""},
+		{ID: "2020-01-01 Init"},
+	})
+
+	var dot bytes.Buffer
+	if err := g.WriteDOT(&dot); err != nil {
+		t.Fatal(err)
+	}
+	expected := `digraph migrations {
+	n0 [label="2020-01-01 Init", shape=ellipse];
+	n1 [label="2020-01-02 Add \"orders\"", shape=ellipse];
+	n2 [label="totals", shape=box];
+	n3 [label="summary", shape=box];
+	n0 -> n1;
+	n1 -> n2;
+	n2 -> n3;
+}
+`
+	if dot.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, dot.String())
+	}
+
+	var mermaid bytes.Buffer
+	if err := g.WriteMermaid(&mermaid); err != nil {
+		t.Fatal(err)
+	}
+	expected = `flowchart TD
+	n0["2020-01-01 Init"]
+	n1["2020-01-02 Add #quot;orders#quot;"]
+	n2(["totals"])
+	n3(["summary"])
+	n0 --> n1
+	n1 --> n2
+	n2 --> n3
+`
+	if mermaid.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, mermaid.String())
+	}
+}
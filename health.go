@@ -0,0 +1,90 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrPendingMigrations is returned by Checker when migrations are waiting to
+// be applied
+var ErrPendingMigrations = errors.New("schema: migrations are pending")
+
+// ErrChecksumMismatch is returned by Checker when an applied migration's
+// script has changed since it was applied
+var ErrChecksumMismatch = errors.New("schema: applied migrations have changed")
+
+// Checker reports whether a database's schema is current, for use as a
+// health or readiness check. Its Check method has the
+// func(context.Context) error signature accepted by most health-check
+// libraries, so traffic can be held back until every migration is applied.
+type Checker struct {
+	Migrator   Migrator
+	DB         *sql.DB
+	Migrations []*Migration
+}
+
+// NewChecker creates a Checker for the migrations in db
+func NewChecker(migrator Migrator, db *sql.DB, migrations []*Migration) *Checker {
+	return &Checker{
+		Migrator:   migrator,
+		DB:         db,
+		Migrations: migrations,
+	}
+}
+
+// Check returns nil when every migration has been applied and none have
+// changed since. Otherwise it returns an error wrapping ErrPendingMigrations,
+// ErrChecksumMismatch or ErrPartiallyApplied, or the error encountered
+// reading the tracking table. Check never modifies the database.
+func (c *Checker) Check(ctx context.Context) error {
+	if c.DB == nil {
+		return ErrNilDB
+	}
+	var status *Status
+	err := c.Migrator.readTransaction(ctx, c.DB, func(tx *sql.Tx) (err error) {
+		status, err = c.Migrator.Status(contextQueryer{ctx: ctx, db: tx}, c.Migrations)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(status.Drifted) > 0 {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, driftedIDs(status.Drifted))
+	}
+	if len(status.Partial) > 0 {
+		return fmt.Errorf("%w: %s", ErrPartiallyApplied, appliedIDs(status.Partial))
+	}
+	if len(status.Pending) > 0 {
+		ids := make([]string, 0, len(status.Pending))
+		for _, migration := range status.Pending {
+			ids = append(ids, migration.ID)
+		}
+		return fmt.Errorf("%w: %s", ErrPendingMigrations, strings.Join(ids, ", "))
+	}
+	return nil
+}
+
+// contextQueryer adapts a QueryerContext to the Queryer interface, running
+// its queries with a context so health checks honour their deadlines
+type contextQueryer struct {
+	ctx context.Context
+	db  QueryerContext
+}
+
+func (q contextQueryer) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return q.db.QueryContext(q.ctx, query, args...)
+}
+
+// readTransaction runs f in a transaction begun with the Migrator's
+// ReadTxOptions. The transaction is always rolled back, since it only reads.
+func (m Migrator) readTransaction(ctx context.Context, db Transactor, f func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, m.ReadTxOptions)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	return f(tx)
+}
@@ -0,0 +1,89 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AppliedAsOf returns the migrations which had been applied at the time, in
+// the order they were applied, for debugging an incident against the schema
+// as it was then. It is read from the tracking table, which only keeps the
+// latest run of a migration which runs more than once (see
+// Migration.Always), so such a migration is missing if it last ran after
+// the time.
+func (m Migrator) AppliedAsOf(db Queryer, at time.Time) ([]*AppliedMigration, error) {
+	rows, err := m.appliedRows(db)
+	if err != nil {
+		return nil, err
+	}
+	applied := make([]*AppliedMigration, 0, len(rows))
+	for _, row := range rows {
+		if !row.AppliedAt.After(at) {
+			applied = append(applied, row)
+		}
+	}
+	sort.SliceStable(applied, func(i, j int) bool {
+		return applied[i].AppliedAt.Before(applied[j].AppliedAt)
+	})
+	return applied, nil
+}
+
+// ScriptsAsOf returns the stored scripts (see WithScriptRecording) of the
+// migrations which had been applied at the time, in the order they were
+// first applied. Only the latest run before the time is returned for a
+// migration which ran more than once.
+func (m Migrator) ScriptsAsOf(db Queryer, at time.Time) ([]*AppliedScript, error) {
+	scripts, err := m.AppliedScripts(db)
+	if err != nil {
+		return nil, err
+	}
+	asOf := make([]*AppliedScript, 0, len(scripts))
+	positions := make(map[string]int)
+	for _, script := range scripts {
+		if script.AppliedAt.After(at) {
+			continue
+		}
+		if i, exists := positions[script.ID]; exists {
+			asOf[i] = script
+			continue
+		}
+		positions[script.ID] = len(asOf)
+		asOf = append(asOf, script)
+	}
+	return asOf, nil
+}
+
+// ReplayAsOf rebuilds the schema as it was at the time in a scratch
+// database, by running the stored scripts (see WithScriptRecording) of the
+// migrations which had been applied then, in the order they were applied.
+// Each script runs in its own transaction, and nothing is recorded in the
+// scratch database's tracking table. The statements of Batches aren't run,
+// since they change data rather than the schema. It returns the scripts it
+// ran.
+func (m Migrator) ReplayAsOf(ctx context.Context, db Queryer, scratch *sql.DB, at time.Time) ([]*AppliedScript, error) {
+	if scratch == nil {
+		return nil, ErrNilDB
+	}
+	scripts, err := m.ScriptsAsOf(db, at)
+	if err != nil {
+		return nil, err
+	}
+	for i, script := range scripts {
+		migration := &Migration{ID: script.ID, Script: script.Script}
+		if batch := strings.LastIndex(migration.Script, batchMarker); batch >= 0 {
+			migration.Script = migration.Script[:batch]
+		}
+		err = m.transaction(ctx, scratch, func(tx *sql.Tx) error {
+			return m.execScript(ctx, tx, migration)
+		})
+		if err != nil {
+			return scripts[:i], err
+		}
+		m.log(fmt.Sprintf("Migration '%s' replayed\n", script.ID))
+	}
+	return scripts, nil
+}
@@ -0,0 +1,53 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReplayAsOf(t *testing.T) {
+	open := func(name string) *sql.DB {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = db.Close() })
+		return db
+	}
+	db, scratch := open("production.db"), open("scratch.db")
+
+	migrator := NewMigrator(WithDialect(NewSQLite()), WithScriptRecording())
+	migrations := []*Migration{
+		{ID: "2020-01-01 Users", Script: "CREATE TABLE users (id INTEGER)"},
+		{ID: "2020-01-02 Backfill", Script: "CREATE TABLE totals (n INTEGER)", Batch: &Batch{
+			Statement: "UPDATE users SET id = id WHERE id > ?1 AND id <= ?2",
+			KeyRange:  "SELECT MIN(id), MAX(id) FROM users",
+		}},
+	}
+	if err := migrator.Apply(db, migrations); err != nil {
+		t.Fatal(err)
+	}
+	incident := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	migrations = append(migrations, &Migration{ID: "2020-01-03 Orders", Script: "CREATE TABLE orders (id INTEGER)"})
+	if err := migrator.Apply(db, migrations); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := migrator.AppliedAsOf(db, incident)
+	if err != nil || len(applied) != 2 || applied[0].ID != "2020-01-01 Users" {
+		t.Errorf("Expected the migrations applied before the incident. Got %+v (%v)", applied, err)
+	}
+
+	replayed, err := migrator.ReplayAsOf(context.Background(), db, scratch, incident)
+	if err != nil || len(replayed) != 2 {
+		t.Fatalf("Expected 2 scripts to be replayed. Got %d (%v)", len(replayed), err)
+	}
+	tables, err := migrator.ListTables(scratch)
+	if err != nil || len(tables) != 2 || tables[0] != "totals" || tables[1] != "users" {
+		t.Errorf("Expected the schema as it was before the incident. Got %v (%v)", tables, err)
+	}
+}
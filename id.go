@@ -0,0 +1,150 @@
+package schema
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// ErrInvalidID is returned when a migration ID doesn't follow the
+// Migrator's ID convention (see WithIDValidator)
+var ErrInvalidID = errors.New("migration ID does not follow the ID convention")
+
+// TimestampIDLayout is the time layout of the IDs made by NewTimestampID.
+// It sorts chronologically and is safe to use in filenames.
+const TimestampIDLayout = "20060102150405"
+
+// ulidAlphabet is Crockford's base32 alphabet, used to encode ULIDs
+const ulidAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// IDValidator checks that a migration ID follows a convention, returning an
+// error wrapping ErrInvalidID when it doesn't
+type IDValidator func(id string) error
+
+// NewTimestampID returns an ID made of the UTC time in TimestampIDLayout,
+// followed by an underscore and the description when one is supplied, such
+// as "20200102150405_create_users"
+func NewTimestampID(t time.Time, description string) string {
+	return withDescription(t.UTC().Format(TimestampIDLayout), description)
+}
+
+// NewSequenceID returns an ID made of the sequence number zero-padded to
+// width digits, followed by an underscore and the description when one is
+// supplied, such as "0042_create_users"
+func NewSequenceID(n, width int, description string) string {
+	return withDescription(fmt.Sprintf("%0*d", width, n), description)
+}
+
+// NewULID returns a ULID for the time, which sorts chronologically to the
+// millisecond and is unique across machines. Its 80 random bits are read
+// from entropy, or from crypto/rand when entropy is nil, so the ID is
+// deterministic for a deterministic entropy source.
+func NewULID(t time.Time, entropy io.Reader) (string, error) {
+	if entropy == nil {
+		entropy = rand.Reader
+	}
+	var id [16]byte
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(t.UnixNano()/int64(time.Millisecond)))
+	copy(id[:6], ms[2:])
+	_, err := io.ReadFull(entropy, id[6:])
+	if err != nil {
+		return "", err
+	}
+
+	n := new(big.Int).SetBytes(id[:])
+	mask := big.NewInt(31)
+	encoded := make([]byte, 26)
+	for i := len(encoded) - 1; i >= 0; i-- {
+		encoded[i] = ulidAlphabet[new(big.Int).And(n, mask).Int64()]
+		n.Rsh(n, 5)
+	}
+	return string(encoded), nil
+}
+
+// ValidateTimestampID is an IDValidator for IDs made by NewTimestampID
+func ValidateTimestampID(id string) error {
+	prefix := idPrefix(id)
+	if _, err := time.Parse(TimestampIDLayout, prefix); err != nil || len(prefix) != len(TimestampIDLayout) {
+		return fmt.Errorf("%w: %q does not start with a %s timestamp", ErrInvalidID, id, TimestampIDLayout)
+	}
+	return nil
+}
+
+// ValidateULID is an IDValidator for IDs made by NewULID, optionally
+// followed by an underscore and a description
+func ValidateULID(id string) error {
+	prefix := idPrefix(id)
+	valid := len(prefix) == 26 && prefix[0] <= '7'
+	for i := 0; valid && i < len(prefix); i++ {
+		valid = strings.IndexByte(ulidAlphabet, prefix[i]) >= 0
+	}
+	if !valid {
+		return fmt.Errorf("%w: %q does not start with a ULID", ErrInvalidID, id)
+	}
+	return nil
+}
+
+// SequenceIDValidator returns an IDValidator for IDs made by NewSequenceID
+// with the width
+func SequenceIDValidator(width int) IDValidator {
+	return func(id string) error {
+		prefix := idPrefix(id)
+		valid := len(prefix) == width
+		for i := 0; valid && i < len(prefix); i++ {
+			valid = prefix[i] >= '0' && prefix[i] <= '9'
+		}
+		if !valid {
+			return fmt.Errorf("%w: %q does not start with a %d digit sequence number", ErrInvalidID, id, width)
+		}
+		return nil
+	}
+}
+
+// ValidateIDs checks the ID of every migration with the Migrator's
+// IDValidator, so that malformed IDs can be caught when migrations are
+// loaded. Apply calls it before doing anything else. The error lists
+// every invalid ID.
+func (m Migrator) ValidateIDs(migrations []*Migration) error {
+	if m.IDValidator == nil {
+		return nil
+	}
+	var first error
+	invalid := make([]string, 0)
+	for _, migration := range migrations {
+		if err := m.IDValidator(migration.ID); err != nil {
+			if first == nil {
+				first = err
+			}
+			invalid = append(invalid, fmt.Sprintf("%q", migration.ID))
+		}
+	}
+	if first == nil {
+		return nil
+	}
+	if len(invalid) == 1 {
+		return first
+	}
+	return fmt.Errorf("%w (also invalid: %s)", first, strings.Join(invalid[1:], ", "))
+}
+
+// withDescription appends the description to the ID prefix
+func withDescription(prefix, description string) string {
+	if description == "" {
+		return prefix
+	}
+	return prefix + "_" + description
+}
+
+// idPrefix returns the part of the ID before its description
+func idPrefix(id string) string {
+	if i := strings.IndexByte(id, '_'); i >= 0 {
+		return id[:i]
+	}
+	return id
+}
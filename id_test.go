@@ -0,0 +1,72 @@
+package schema
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewIDs(t *testing.T) {
+	at := time.Date(2020, 1, 2, 15, 4, 5, 0, time.FixedZone("EST", -5*60*60))
+	if id := NewTimestampID(at, "create_users"); id != "20200102200405_create_users" {
+		t.Errorf("Unexpected timestamp ID %q", id)
+	}
+	if id := NewSequenceID(42, 4, ""); id != "0042" {
+		t.Errorf("Unexpected sequence ID %q", id)
+	}
+
+	ulid, err := NewULID(time.Unix(1469918176, 385000000), bytes.NewReader(make([]byte, 10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ulid != "01ARYZ6S410000000000000000" {
+		t.Errorf("Unexpected ULID %q", ulid)
+	}
+	random, err := NewULID(time.Now(), nil)
+	if err != nil || ValidateULID(random+"_create_users") != nil {
+		t.Errorf("Expected a valid random ULID. Got %q (%v)", random, err)
+	}
+}
+
+func TestIDValidators(t *testing.T) {
+	tests := []struct {
+		validator IDValidator
+		valid     []string
+		invalid   []string
+	}{
+		{ValidateTimestampID, []string{"20200102150405_create_users", "20200102150405"}, []string{"2020-01-02 Users", "20201302150405_x", "1"}},
+		{ValidateULID, []string{"01ARYZ6S410000000000000000_users"}, []string{"81ARYZ6S410000000000000000", "01ARYZ6S41000000000000000U", "1"}},
+		{SequenceIDValidator(4), []string{"0042_users", "0001"}, []string{"42_users", "00042", "abcd"}},
+	}
+	for _, test := range tests {
+		for _, id := range test.valid {
+			if err := test.validator(id); err != nil {
+				t.Errorf("Expected %q to be valid. Got %v", id, err)
+			}
+		}
+		for _, id := range test.invalid {
+			if err := test.validator(id); !errors.Is(err, ErrInvalidID) {
+				t.Errorf("Expected %q to be invalid. Got %v", id, err)
+			}
+		}
+	}
+}
+
+func TestValidateIDs(t *testing.T) {
+	m := NewMigrator(WithIDValidator(SequenceIDValidator(4)))
+	err := m.ValidateIDs([]*Migration{{ID: "0001_a"}, {ID: "2_b"}, {ID: "three"}})
+	if !errors.Is(err, ErrInvalidID) {
+		t.Fatalf("Expected ErrInvalidID. Got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"2_b"`) || !strings.Contains(err.Error(), `"three"`) {
+		t.Errorf("Expected the error to list every invalid ID. Got %v", err)
+	}
+	if err = m.ValidateIDs([]*Migration{{ID: "0001_a"}}); err != nil {
+		t.Error(err)
+	}
+	if err = NewMigrator().ValidateIDs([]*Migration{{ID: "anything"}}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,175 @@
+package schema
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrIntrospectionNotSupported is returned when the dialect doesn't
+// implement Introspector
+var ErrIntrospectionNotSupported = errors.New("dialect does not support introspection")
+
+// Table describes a table in the database
+type Table struct {
+	Name    string
+	Columns []*Column
+	Indexes []*Index
+}
+
+// Column describes a column of a table. Its Type is as the database reports
+// it, so it differs between dialects. Default is the SQL expression of the
+// column's default, or empty when it has none.
+type Column struct {
+	Name     string
+	Type     string
+	Nullable bool
+	Default  string
+}
+
+// Index describes an index of a table and the columns it covers, in order
+type Index struct {
+	Name    string
+	Unique  bool
+	Columns []string
+}
+
+// Introspect describes the tables in the Migrator's schema (or the current
+// schema when it has none), sorted by name, including the tracking table.
+// It is useful for asserting the structure migrations leave behind in
+// tests, and is used by Diff.
+func (m Migrator) Introspect(db Queryer) ([]*Table, error) {
+	introspector, ok := m.Dialect.(Introspector)
+	if !ok {
+		return nil, ErrIntrospectionNotSupported
+	}
+
+	tables := make([]*Table, 0)
+	byName := make(map[string]*Table)
+	err := m.introspectRows(db, introspector.TablesSQL(m.SchemaName), func(rows *sql.Rows) error {
+		table := &Table{Columns: make([]*Column, 0), Indexes: make([]*Index, 0)}
+		err := rows.Scan(&table.Name)
+		if err != nil {
+			return err
+		}
+		tables = append(tables, table)
+		byName[table.Name] = table
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.introspectRows(db, introspector.ColumnsSQL(m.SchemaName), func(rows *sql.Rows) error {
+		var tableName string
+		var nullable interface{}
+		var defaultExpr sql.NullString
+		column := &Column{}
+		err := rows.Scan(&tableName, &column.Name, &column.Type, &nullable, &defaultExpr)
+		if err != nil {
+			return err
+		}
+		column.Nullable = isTruthy(nullable)
+		column.Default = defaultExpr.String
+		if table, exists := byName[tableName]; exists {
+			table.Columns = append(table.Columns, column)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.introspectRows(db, introspector.IndexesSQL(m.SchemaName), func(rows *sql.Rows) error {
+		var tableName, indexName, columnName string
+		var unique interface{}
+		err := rows.Scan(&tableName, &indexName, &unique, &columnName)
+		if err != nil {
+			return err
+		}
+		table, exists := byName[tableName]
+		if !exists {
+			return nil
+		}
+		indexes := table.Indexes
+		if len(indexes) == 0 || indexes[len(indexes)-1].Name != indexName {
+			table.Indexes = append(indexes, &Index{Name: indexName, Unique: isTruthy(unique)})
+		}
+		index := table.Indexes[len(table.Indexes)-1]
+		index.Columns = append(index.Columns, columnName)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+// ListTables returns the names of the tables in the Migrator's schema,
+// sorted by name
+func (m Migrator) ListTables(db Queryer) ([]string, error) {
+	introspector, ok := m.Dialect.(Introspector)
+	if !ok {
+		return nil, ErrIntrospectionNotSupported
+	}
+	names := make([]string, 0)
+	err := m.introspectRows(db, introspector.TablesSQL(m.SchemaName), func(rows *sql.Rows) error {
+		var name string
+		err := rows.Scan(&name)
+		names = append(names, name)
+		return err
+	})
+	return names, err
+}
+
+// ListColumns returns the columns of the table, in order. It returns no
+// columns when the table doesn't exist.
+func (m Migrator) ListColumns(db Queryer, table string) ([]*Column, error) {
+	t, err := m.introspectTable(db, table)
+	if err != nil || t == nil {
+		return []*Column{}, err
+	}
+	return t.Columns, nil
+}
+
+// ListIndexes returns the indexes of the table, sorted by name. It returns
+// no indexes when the table doesn't exist.
+func (m Migrator) ListIndexes(db Queryer, table string) ([]*Index, error) {
+	t, err := m.introspectTable(db, table)
+	if err != nil || t == nil {
+		return []*Index{}, err
+	}
+	return t.Indexes, nil
+}
+
+// introspectTable describes the table, or returns nil if it doesn't exist
+func (m Migrator) introspectTable(db Queryer, name string) (*Table, error) {
+	tables, err := m.Introspect(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range tables {
+		if table.Name == name {
+			return table, nil
+		}
+	}
+	return nil, nil
+}
+
+// introspectRows runs the introspection query and calls scan for each row
+func (m Migrator) introspectRows(db Queryer, query string, scan func(rows *sql.Rows) error) error {
+	startedAt := time.Now()
+	rows, err := db.Query(query)
+	m.logQuery(query, nil, startedAt, err)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err = scan(rows)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,93 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"time"
+)
+
+// Elector decides whether this instance is the leader of its fleet. When many
+// replicas boot at once, ApplyAsLeader uses it so that only the leader runs
+// the migrations while the others wait for them to finish, rather than all
+// of them queueing on the migration lock.
+type Elector interface {
+	// IsLeader returns whether this instance should run the migrations. It
+	// may block until an election has completed.
+	IsLeader(ctx context.Context) (bool, error)
+}
+
+// ElectorFunc adapts a function to the Elector interface, which is
+// convenient for wrapping an existing leader-election client
+type ElectorFunc func(ctx context.Context) (bool, error)
+
+// IsLeader calls f(ctx)
+func (f ElectorFunc) IsLeader(ctx context.Context) (bool, error) {
+	return f(ctx)
+}
+
+// HostnameElector elects the instance whose hostname is leader, such as the
+// first pod of a Kubernetes StatefulSet ("app-0"). It needs no coordination,
+// which makes it a simple example of an Elector.
+func HostnameElector(leader string) Elector {
+	return ElectorFunc(func(context.Context) (bool, error) {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return false, err
+		}
+		return hostname == leader, nil
+	})
+}
+
+// followerPollInterval is how often followers check whether the leader has
+// finished applying the migrations (see WaitUntilCurrent)
+const followerPollInterval = time.Second
+
+// ApplyAsLeader applies the migrations if the elector says this instance is
+// the leader. Followers don't take the migration lock. Instead they wait
+// until every migration has been applied by the leader, verifying that none
+// have drifted, and return an error if the context ends first. Use a context
+// with a deadline so that followers don't wait forever on a failed leader.
+func (m Migrator) ApplyAsLeader(ctx context.Context, db *sql.DB, migrations []*Migration, elector Elector) error {
+	if db == nil {
+		return ErrNilDB
+	}
+	leader, err := elector.IsLeader(ctx)
+	if err != nil {
+		return err
+	}
+	if leader {
+		m.log("Elected leader, applying migrations")
+		return m.ApplyContext(ctx, db, migrations)
+	}
+
+	m.log("Not the leader, waiting for migrations to be applied")
+	return m.WaitUntilCurrent(ctx, db, migrations)
+}
+
+// WaitUntilCurrent polls the tracking table until every migration has been
+// applied, for instances which don't run Apply themselves but mustn't serve
+// requests on an old schema. It doesn't take the migration lock or write
+// anything. It returns an error wrapping ErrChecksumMismatch or
+// ErrPartiallyApplied as soon as one is found, since waiting won't resolve
+// them, and the context's error if it ends first.
+func (m Migrator) WaitUntilCurrent(ctx context.Context, db *sql.DB, migrations []*Migration) error {
+	if db == nil {
+		return ErrNilDB
+	}
+	checker := NewChecker(m, db, migrations)
+	ticker := time.NewTicker(followerPollInterval)
+	defer ticker.Stop()
+	for {
+		err := checker.Check(ctx)
+		if err == nil || errors.Is(err, ErrChecksumMismatch) || errors.Is(err, ErrPartiallyApplied) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
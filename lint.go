@@ -0,0 +1,229 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LintRule names a pattern which is incompatible with rolling deploys, where
+// instances running the previous release keep using the database while the
+// migrations are applied. Such changes should be split into expand and
+// contract steps shipped in separate releases.
+type LintRule string
+
+// The lint rules checked by Lint
+const (
+	// LintDropColumn flags dropping a column, which breaks instances of the
+	// previous release that still reference it. Drop columns in a release
+	// after the one which stopped using them.
+	LintDropColumn LintRule = "drop-column"
+	// LintNotNullWithoutDefault flags adding a NOT NULL column without a
+	// default, which breaks inserts made by the previous release
+	LintNotNullWithoutDefault LintRule = "not-null-without-default"
+	// LintRename flags renaming a table or column in one step, which breaks
+	// every query of the previous release which uses the old name
+	LintRename LintRule = "rename"
+)
+
+// LintPolicy chooses what Apply does with lint findings in the migrations it
+// is about to run
+type LintPolicy int
+
+const (
+	// LintOff skips linting
+	LintOff LintPolicy = iota
+	// LintWarn logs findings and applies the migrations anyway
+	LintWarn
+	// LintBlock fails Apply with a *LintError before any migration runs,
+	// which is intended for CI
+	LintBlock
+)
+
+// LintFinding describes a statement which breaks a lint rule
+type LintFinding struct {
+	MigrationID string
+	Rule        LintRule
+	Statement   string
+}
+
+func (f *LintFinding) String() string {
+	return fmt.Sprintf("Migration '%s' breaks rule %s: %s", f.MigrationID, f.Rule, f.Statement)
+}
+
+// LintError is returned by Apply when the LintBlock policy finds problems
+type LintError struct {
+	Findings []*LintFinding
+}
+
+func (e *LintError) Error() string {
+	lines := make([]string, len(e.Findings))
+	for i, finding := range e.Findings {
+		lines[i] = finding.String()
+	}
+	return fmt.Sprintf("%d migration lint findings:\n%s", len(e.Findings), strings.Join(lines, "\n"))
+}
+
+// lintIgnorePattern matches comments which exempt a migration from lint
+// rules, such as "-- lint:ignore drop-column rename"
+var lintIgnorePattern = regexp.MustCompile(`(?m)--\s*lint:ignore\s+([a-z\- ]+)$`)
+
+// Lint checks the migrations for changes which are incompatible with rolling
+// deploys. A migration can be exempted from rules with a comment in its
+// script listing them, such as "-- lint:ignore drop-column", once the change
+// has been made safe (for example, by a previous release which stopped using
+// the column).
+func (m Migrator) Lint(migrations []*Migration) []*LintFinding {
+	findings := make([]*LintFinding, 0)
+	sorted := m.forDialect(migrations)
+	SortMigrations(sorted)
+	for _, migration := range sorted {
+		ignored := make(map[LintRule]bool)
+		for _, match := range lintIgnorePattern.FindAllStringSubmatch(migration.Script, -1) {
+			for _, rule := range strings.Fields(match[1]) {
+				ignored[LintRule(rule)] = true
+			}
+		}
+		for _, statement := range m.statements(migration.Script) {
+			for _, rule := range lintStatement(statement) {
+				if !ignored[rule] {
+					findings = append(findings, &LintFinding{
+						MigrationID: migration.ID,
+						Rule:        rule,
+						Statement:   statement,
+					})
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// lint applies the Migrator's LintPolicy to the planned migrations
+func (m Migrator) lint(plan []*Migration) error {
+	if m.LintPolicy == LintOff {
+		return nil
+	}
+	findings := m.Lint(plan)
+	if len(findings) == 0 {
+		return nil
+	}
+	if m.LintPolicy == LintBlock {
+		return &LintError{Findings: findings}
+	}
+	for _, finding := range findings {
+		m.log("Warning: " + finding.String())
+	}
+	return nil
+}
+
+// lintStatement returns the lint rules the statement breaks
+func lintStatement(statement string) []LintRule {
+	words := strings.Fields(strings.ToUpper(stripLeadingComments(statement)))
+	if len(words) >= 2 && words[0] == "RENAME" && words[1] == "TABLE" {
+		return []LintRule{LintRename}
+	}
+	if len(words) < 3 || words[0] != "ALTER" || words[1] != "TABLE" {
+		return nil
+	}
+
+	rules := make([]LintRule, 0)
+	seen := make(map[LintRule]bool)
+	add := func(rule LintRule) {
+		if !seen[rule] {
+			seen[rule] = true
+			rules = append(rules, rule)
+		}
+	}
+	for _, clause := range alterClauses(strings.Join(words[2:], " ")) {
+		clauseWords := strings.Fields(clause)
+		switch {
+		case isDropColumnClause(clauseWords):
+			add(LintDropColumn)
+		case clauseWords[0] == "RENAME":
+			add(LintRename)
+		case clauseWords[0] == "CHANGE":
+			// MySQL's CHANGE [COLUMN] old new renames when the names differ
+			names := clauseWords[1:]
+			if len(names) > 0 && names[0] == "COLUMN" {
+				names = names[1:]
+			}
+			if len(names) >= 2 && names[0] != names[1] {
+				add(LintRename)
+			}
+		case clauseWords[0] == "ADD" && strings.Contains(clause, "NOT NULL") &&
+			!strings.Contains(clause, "DEFAULT") && !isAddConstraintClause(clauseWords):
+			add(LintNotNullWithoutDefault)
+		}
+	}
+	return rules
+}
+
+// alterClauses splits the remainder of an ALTER TABLE statement (starting
+// with the table name) into its comma-separated clauses, ignoring commas
+// within parentheses. The table name is removed from the first clause.
+func alterClauses(rest string) []string {
+	clauses := make([]string, 0)
+	depth, start := 0, 0
+	for i := 0; i < len(rest); i++ {
+		switch rest[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				clauses = append(clauses, strings.TrimSpace(rest[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	clauses = append(clauses, strings.TrimSpace(rest[start:]))
+
+	// Skip the table name, and ONLY or IF EXISTS before it
+	first := strings.Fields(clauses[0])
+	for len(first) > 0 && (first[0] == "ONLY" || first[0] == "IF" || first[0] == "EXISTS") {
+		first = first[1:]
+	}
+	if len(first) > 0 {
+		first = first[1:]
+	}
+	clauses[0] = strings.Join(first, " ")
+
+	nonEmpty := clauses[:0]
+	for _, clause := range clauses {
+		if clause != "" {
+			nonEmpty = append(nonEmpty, clause)
+		}
+	}
+	return nonEmpty
+}
+
+// isDropColumnClause returns whether the ALTER TABLE clause drops a column,
+// as opposed to a constraint, index, default or NOT NULL
+func isDropColumnClause(words []string) bool {
+	if len(words) < 2 || words[0] != "DROP" {
+		return false
+	}
+	switch words[1] {
+	case "COLUMN":
+		return true
+	case "CONSTRAINT", "INDEX", "KEY", "PRIMARY", "FOREIGN", "DEFAULT", "NOT",
+		"CHECK", "PARTITION", "UNIQUE", "EXPRESSION", "IDENTITY", "SYSTEM":
+		return false
+	}
+	return true
+}
+
+// isAddConstraintClause returns whether the ALTER TABLE ADD clause adds a
+// constraint or index rather than a column
+func isAddConstraintClause(words []string) bool {
+	if len(words) < 2 {
+		return false
+	}
+	switch words[1] {
+	case "CONSTRAINT", "PRIMARY", "FOREIGN", "UNIQUE", "CHECK", "INDEX", "KEY":
+		return true
+	}
+	return false
+}
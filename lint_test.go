@@ -0,0 +1,66 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLintStatement(t *testing.T) {
+	cases := map[string][]LintRule{
+		"ALTER TABLE users DROP COLUMN legacy":                       {LintDropColumn},
+		"alter table users drop legacy":                              {LintDropColumn},
+		"ALTER TABLE IF EXISTS users DROP CONSTRAINT users_pkey":     nil,
+		"ALTER TABLE users ALTER COLUMN name DROP NOT NULL":          nil,
+		"ALTER TABLE users ADD COLUMN name TEXT NOT NULL":            {LintNotNullWithoutDefault},
+		"ALTER TABLE users ADD COLUMN name TEXT NOT NULL DEFAULT ''": nil,
+		"ALTER TABLE users ADD CONSTRAINT c CHECK (id IS NOT NULL)":  nil,
+		"ALTER TABLE users RENAME COLUMN name TO full_name":          {LintRename},
+		"ALTER TABLE users CHANGE name full_name TEXT":               {LintRename},
+		"ALTER TABLE users CHANGE name name VARCHAR(100)":            nil,
+		"RENAME TABLE users TO people":                               {LintRename},
+		"ALTER TABLE users ADD COLUMN a INT NOT NULL, DROP COLUMN b": {LintDropColumn, LintNotNullWithoutDefault},
+		"CREATE TABLE users (id INTEGER NOT NULL)":                   nil,
+	}
+	for statement, expected := range cases {
+		rules := lintStatement(statement)
+		if len(rules) != len(expected) {
+			t.Errorf("Expected %v for %q. Got %v", expected, statement, rules)
+			continue
+		}
+		matched := make(map[LintRule]bool)
+		for _, rule := range rules {
+			matched[rule] = true
+		}
+		for _, rule := range expected {
+			if !matched[rule] {
+				t.Errorf("Expected %v for %q. Got %v", expected, statement, rules)
+			}
+		}
+	}
+}
+
+func TestLintIgnoreComments(t *testing.T) {
+	migrator := NewMigrator()
+	findings := migrator.Lint([]*Migration{
+		{ID: "2020-01-02 Drop", Script: "-- lint:ignore drop-column\nALTER TABLE users DROP COLUMN legacy"},
+		{ID: "2020-01-01 Rename", Script: "ALTER TABLE users RENAME TO people; ALTER TABLE people DROP COLUMN x"},
+	})
+	if len(findings) != 2 || findings[0].Rule != LintRename || findings[1].Rule != LintDropColumn {
+		t.Errorf("Expected 2 findings from the unexempted migration. Got %v", findings)
+	}
+}
+
+func TestLintPolicy(t *testing.T) {
+	plan := []*Migration{{ID: "2020-01-01 Drop", Script: "ALTER TABLE users DROP COLUMN legacy"}}
+
+	var lintErr *LintError
+	if err := NewMigrator(WithLintPolicy(LintBlock)).lint(plan); !errors.As(err, &lintErr) || len(lintErr.Findings) != 1 {
+		t.Errorf("Expected a LintError with 1 finding. Got %v", err)
+	}
+	if err := NewMigrator(WithLintPolicy(LintWarn)).lint(plan); err != nil {
+		t.Errorf("Expected findings to only be logged. Got %v", err)
+	}
+	if err := NewMigrator().lint(plan); err != nil {
+		t.Errorf("Expected linting to be off by default. Got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LockHolder describes a session holding the migration lock
+type LockHolder struct {
+	// PID identifies the session, such as a Postgres backend pid or a
+	// MySQL connection ID
+	PID string
+	// Application is the session's application name, if the database
+	// records one (see WithApplicationName)
+	Application string
+	// Client is the address or user and host the session connected from
+	Client string
+	// Since is when the session connected, if the database records it
+	Since time.Time
+}
+
+func (h *LockHolder) String() string {
+	details := []string{"pid " + h.PID}
+	if h.Application != "" {
+		details = append(details, fmt.Sprintf("application '%s'", h.Application))
+	}
+	if h.Client != "" {
+		details = append(details, "client "+h.Client)
+	}
+	if !h.Since.IsZero() {
+		details = append(details, "connected since "+h.Since.Format(time.RFC3339))
+	}
+	return strings.Join(details, ", ")
+}
+
+// LockHolders returns the sessions holding the migration lock, on dialects
+// which implement LockHolderReporter, so that an operator can see what a
+// blocked deploy is waiting for. It is empty when the lock is free.
+func (m Migrator) LockHolders(ctx context.Context, db *sql.DB) ([]*LockHolder, error) {
+	if db == nil {
+		return nil, ErrNilDB
+	}
+	reporter, ok := m.Dialect.(LockHolderReporter)
+	if !ok {
+		return nil, fmt.Errorf("dialect can't report who holds the migration lock")
+	}
+	rows, err := m.query(ctx, db, reporter.LockHolderSQL(m.QuotedTableName()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holders := make([]*LockHolder, 0)
+	for rows.Next() {
+		holder := &LockHolder{}
+		var application, client sql.NullString
+		err = rows.Scan(&holder.PID, &application, &client, timestamp(&holder.Since))
+		if err != nil {
+			return nil, err
+		}
+		holder.Application, holder.Client = application.String, client.String
+		holders = append(holders, holder)
+	}
+	return holders, rows.Err()
+}
+
+// reportLockWait starts reporting who holds the migration lock every
+// LockReportInterval while Apply waits for it, until the returned function
+// is called. It only reports the dialect's own lock, so nothing is reported
+// with a Locker.
+func (m Migrator) reportLockWait(ctx context.Context, db *sql.DB) (stop func()) {
+	_, ok := m.Dialect.(LockHolderReporter)
+	if m.LockReportInterval <= 0 || !ok || m.Locker != nil || db == nil {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	startedAt := time.Now()
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(m.LockReportInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			holders, err := m.LockHolders(ctx, db)
+			if ctx.Err() != nil {
+				return
+			}
+			waited := time.Since(startedAt).Round(time.Second)
+			switch {
+			case err != nil:
+				m.log(fmt.Sprintf("Waited %s for the migration lock. Its holders couldn't be read: %v\n", waited, err))
+			case len(holders) == 0:
+				m.log(fmt.Sprintf("Waited %s for the migration lock, which is no longer held\n", waited))
+			default:
+				for _, holder := range holders {
+					m.log(fmt.Sprintf("Waited %s for the migration lock, held by %s\n", waited, holder))
+				}
+			}
+			if m.OnLockWait != nil {
+				m.OnLockWait(waited, holders)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
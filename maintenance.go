@@ -0,0 +1,152 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Maintenance declares work done after Apply has run migrations, so that
+// large backfills don't leave the query planner with stale statistics. It
+// runs outside of any transaction, since VACUUM can't run inside one, and
+// only when migrations were run.
+type Maintenance struct {
+	// Analyze refreshes the statistics of the tables the migrations
+	// touched, on dialects which implement Maintainer
+	Analyze bool
+
+	// Vacuum reclaims space in the tables the migrations touched, before
+	// they are analyzed. SQLite can only vacuum the whole database.
+	Vacuum bool
+
+	// PostRun holds SQL statements which are executed after any vacuuming
+	// and analyzing
+	PostRun []string
+}
+
+// touchedTables returns the tables which the migrations' statements insert
+// into, update, delete from, alter or index, in the order they are first
+// touched. Names are returned as they are written in the scripts.
+func touchedTables(plan []*Migration) []string {
+	tables := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(table string) {
+		if table != "" && !seen[table] {
+			seen[table] = true
+			tables = append(tables, table)
+		}
+	}
+	for _, migration := range plan {
+		scripts := []string{migration.Script}
+		if migration.Batch != nil {
+			scripts = append(scripts, migration.Batch.Statement)
+		}
+		for _, script := range scripts {
+			for _, statement := range splitStatements(script) {
+				add(touchedTable(statement))
+			}
+		}
+		if migration.Copy != nil {
+			add(migration.Copy.Table)
+		}
+		if migration.Seed != nil {
+			add(migration.Seed.Table)
+		}
+	}
+	return tables
+}
+
+// touchedTable returns the table whose data or structure the statement
+// changes, or an empty string if it changes none
+func touchedTable(statement string) string {
+	words := strings.Fields(stripLeadingComments(statement))
+	keyword := func(i int, expected ...string) bool {
+		if i >= len(words) {
+			return false
+		}
+		for _, e := range expected {
+			if strings.EqualFold(words[i], e) {
+				return true
+			}
+		}
+		return false
+	}
+
+	i := 0
+	switch {
+	case keyword(0, "ALTER") && keyword(1, "TABLE"):
+		i = 2
+	case keyword(0, "UPDATE"):
+		i = 1
+	case keyword(0, "INSERT") && keyword(1, "INTO"):
+		i = 2
+	case keyword(0, "DELETE") && keyword(1, "FROM"):
+		i = 2
+	case keyword(0, "CREATE") && (keyword(1, "INDEX") || keyword(2, "INDEX")):
+		for i < len(words) && !keyword(i, "ON") {
+			i++
+		}
+		i++
+	default:
+		return ""
+	}
+	for keyword(i, "ONLY", "IF", "EXISTS") {
+		i++
+	}
+	if i >= len(words) {
+		return ""
+	}
+	table := words[i]
+	if paren := strings.Index(table, "("); paren >= 0 {
+		table = table[:paren]
+	}
+	return strings.TrimRight(table, ";")
+}
+
+// maintenanceStatements returns the statements which carry out the
+// Migrator's Maintenance after the planned migrations have run
+func (m Migrator) maintenanceStatements(plan []*Migration) []string {
+	statements := make([]string, 0)
+	if len(plan) == 0 {
+		return statements
+	}
+	seen := make(map[string]bool)
+	add := func(statement string) {
+		if statement != "" && !seen[statement] {
+			seen[statement] = true
+			statements = append(statements, statement)
+		}
+	}
+	if d, ok := m.Dialect.(Maintainer); ok && (m.Maintenance.Vacuum || m.Maintenance.Analyze) {
+		tables := touchedTables(plan)
+		if m.Maintenance.Vacuum {
+			for _, table := range tables {
+				add(d.VacuumSQL(table))
+			}
+		}
+		if m.Maintenance.Analyze {
+			for _, table := range tables {
+				add(d.AnalyzeSQL(table))
+			}
+		}
+	}
+	for _, statement := range m.Maintenance.PostRun {
+		add(statement)
+	}
+	return statements
+}
+
+// maintain executes the maintenance statements on the migration connection.
+// The migrations have been committed by then, so a failure is reported
+// without undoing them.
+func (m Migrator) maintain(ctx context.Context, conn *sql.Conn, plan []*Migration) error {
+	for _, statement := range m.maintenanceStatements(plan) {
+		_, err := m.exec(ctx, conn, statement)
+		if err != nil {
+			return fmt.Errorf("Post-migration maintenance '%s' failed:\n%w", m.redact(statement), err)
+		}
+		m.log(fmt.Sprintf("Post-migration maintenance '%s' completed\n", m.redact(statement)))
+	}
+	return nil
+}
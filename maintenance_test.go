@@ -0,0 +1,48 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTouchedTable(t *testing.T) {
+	cases := map[string]string{
+		"UPDATE users SET active = true":                           "users",
+		"update ONLY users set active = true":                      "users",
+		"INSERT INTO audit(id, note) VALUES (1, 'x');":             "audit",
+		"DELETE FROM sessions WHERE expired":                       "sessions",
+		"ALTER TABLE IF EXISTS public.orders ADD COLUMN note TEXT": "public.orders",
+		"CREATE UNIQUE INDEX CONCURRENTLY idx ON ONLY items (sku)": "items",
+		"CREATE INDEX idx ON items(sku)":                           "items",
+		"-- backfill\nUPDATE totals SET n = 0":                     "totals",
+		"CREATE TABLE fresh (id INTEGER)":                          "",
+		"SELECT 1":                                                 "",
+	}
+	for statement, expected := range cases {
+		if table := touchedTable(statement); table != expected {
+			t.Errorf("%q: Expected %q. Got %q", statement, expected, table)
+		}
+	}
+}
+
+func TestMaintenanceStatements(t *testing.T) {
+	plan := []*Migration{
+		{ID: "2020-01-01 Backfill", Script: "UPDATE users SET active = true; INSERT INTO audit VALUES (1)"},
+		{ID: "2020-01-02 Batched", Script: "SELECT 1", Batch: &Batch{Statement: "UPDATE users SET n = 0"}},
+	}
+	m := NewMigrator(WithMaintenance(Maintenance{Analyze: true, Vacuum: true, PostRun: []string{"SELECT 2"}}))
+	expected := []string{"VACUUM users", "VACUUM audit", "ANALYZE users", "ANALYZE audit", "SELECT 2"}
+	if statements := m.maintenanceStatements(plan); !reflect.DeepEqual(statements, expected) {
+		t.Errorf("Expected %v. Got %v", expected, statements)
+	}
+
+	m.Dialect = NewSQLite()
+	expected = []string{"VACUUM", "ANALYZE users", "ANALYZE audit", "SELECT 2"}
+	if statements := m.maintenanceStatements(plan); !reflect.DeepEqual(statements, expected) {
+		t.Errorf("Expected %v. Got %v", expected, statements)
+	}
+
+	if statements := m.maintenanceStatements(nil); len(statements) != 0 {
+		t.Errorf("Expected no maintenance without migrations. Got %v", statements)
+	}
+}
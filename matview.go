@@ -0,0 +1,143 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"sort"
+)
+
+// MaterializedView declares a materialized view which is refreshed after
+// Apply runs any of the migrations it depends on, rather than REFRESH
+// statements being added to unrelated migrations. Views are refreshed in
+// dependency order, after all of the migrations have run and in the same
+// transaction when the dialect allows.
+type MaterializedView struct {
+	// Name is the view's name as written in SQL, optionally qualified
+	// with a schema
+	Name string
+
+	// Migrations lists the IDs of the migrations which require the view
+	// to be refreshed. Shell patterns as understood by path.Match, such as
+	// "2021-*", are allowed.
+	Migrations []string
+
+	// DependsOn lists the names of other declared views which this view
+	// selects from. When they are refreshed, this view is refreshed after
+	// them.
+	DependsOn []string
+
+	// Concurrently refreshes the view without locking out reads, which
+	// requires a unique index on the view
+	Concurrently bool
+}
+
+// refreshSQL returns the statement which refreshes the view
+func (v *MaterializedView) refreshSQL() string {
+	if v.Concurrently {
+		return fmt.Sprintf("REFRESH MATERIALIZED VIEW CONCURRENTLY %s", v.Name)
+	}
+	return fmt.Sprintf("REFRESH MATERIALIZED VIEW %s", v.Name)
+}
+
+// refreshesFor returns whether running the migration requires the view to be
+// refreshed
+func (v *MaterializedView) refreshesFor(migration *Migration) bool {
+	for _, pattern := range v.Migrations {
+		if matched, _ := path.Match(pattern, migration.ID); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// viewsToRefresh returns the declared views which must be refreshed after
+// the planned migrations run, ordered so that every view is refreshed after
+// the views it depends on
+func (m Migrator) viewsToRefresh(plan []*Migration) ([]*MaterializedView, error) {
+	views := make(map[string]*MaterializedView, len(m.MaterializedViews))
+	dependents := make(map[string][]string)
+	for _, view := range m.MaterializedViews {
+		views[view.Name] = view
+		for _, dependency := range view.DependsOn {
+			dependents[dependency] = append(dependents[dependency], view.Name)
+		}
+	}
+
+	// Views refresh when one of their migrations ran, or when a view they
+	// depend on refreshes
+	stale := make(map[string]bool)
+	var markStale func(name string)
+	markStale = func(name string) {
+		if stale[name] {
+			return
+		}
+		stale[name] = true
+		for _, dependent := range dependents[name] {
+			markStale(dependent)
+		}
+	}
+	for _, view := range m.MaterializedViews {
+		for _, migration := range plan {
+			if view.refreshesFor(migration) {
+				markStale(view.Name)
+				break
+			}
+		}
+	}
+
+	names := make([]string, 0, len(stale))
+	for name := range stale {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ordered := make([]*MaterializedView, 0, len(names))
+	state := make(map[string]int) // 1 while visiting, 2 once ordered
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("Materialized view '%s' has a circular dependency", name)
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		view := views[name]
+		for _, dependency := range view.DependsOn {
+			if stale[dependency] {
+				err := visit(dependency)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = 2
+		ordered = append(ordered, view)
+		return nil
+	}
+	for _, name := range names {
+		err := visit(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// refreshViews refreshes the views which depend on the planned migrations
+func (m Migrator) refreshViews(ctx context.Context, tx *sql.Tx, plan []*Migration) error {
+	views, err := m.viewsToRefresh(plan)
+	if err != nil {
+		return err
+	}
+	for _, view := range views {
+		_, err = m.exec(ctx, tx, view.refreshSQL())
+		if err != nil {
+			return fmt.Errorf("Refreshing materialized view '%s' failed:\n%w", view.Name, err)
+		}
+		m.log(fmt.Sprintf("Materialized view '%s' refreshed\n", view.Name))
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestViewsToRefresh(t *testing.T) {
+	migrator := NewMigrator(WithMaterializedViews(
+		&MaterializedView{Name: "monthly_totals", DependsOn: []string{"daily_totals"}, Concurrently: true},
+		&MaterializedView{Name: "daily_totals", Migrations: []string{"2021-*"}},
+		&MaterializedView{Name: "unrelated", Migrations: []string{"2019-01-01 Other"}},
+	))
+
+	views, err := migrator.viewsToRefresh([]*Migration{{ID: "2021-03-01 Orders"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(views))
+	for i, view := range views {
+		names[i] = view.Name
+	}
+	if strings.Join(names, ",") != "daily_totals,monthly_totals" {
+		t.Errorf("Expected dependent views in dependency order. Got %v", names)
+	}
+	if sql := views[1].refreshSQL(); sql != "REFRESH MATERIALIZED VIEW CONCURRENTLY monthly_totals" {
+		t.Errorf("Unexpected refresh statement: %s", sql)
+	}
+
+	views, err = migrator.viewsToRefresh([]*Migration{{ID: "2020-01-01 Users"}})
+	if err != nil || len(views) != 0 {
+		t.Errorf("Expected no views to refresh. Got %v (%v)", views, err)
+	}
+
+	circular := NewMigrator(WithMaterializedViews(
+		&MaterializedView{Name: "a", DependsOn: []string{"b"}, Migrations: []string{"*"}},
+		&MaterializedView{Name: "b", DependsOn: []string{"a"}},
+	))
+	if _, err := circular.viewsToRefresh([]*Migration{{ID: "2020-01-01 Users"}}); err == nil {
+		t.Error("Expected an error for circular dependencies")
+	}
+}
@@ -0,0 +1,26 @@
+package schema
+
+import "context"
+
+// MigrationFunc executes a single migration
+type MigrationFunc func(ctx context.Context, migration *Migration) error
+
+// Middleware wraps the execution of each migration which Apply runs, so
+// that logging, metrics, approval or retry logic can be composed around it.
+// A Middleware may skip a migration by returning an error without calling
+// next, or alter the context next is called with.
+//
+// When the migrations share one transaction, as they usually do on dialects
+// with transactional DDL, next runs the migration within it, so a failed
+// migration can't be retried. Otherwise next runs the migration in its own
+// transaction, which is committed before next returns.
+type Middleware func(next MigrationFunc) MigrationFunc
+
+// withMiddleware wraps run with the Migrator's Middleware, the first of
+// which is outermost
+func (m Migrator) withMiddleware(run MigrationFunc) MigrationFunc {
+	for i := len(m.Middleware) - 1; i >= 0; i-- {
+		run = m.Middleware[i](run)
+	}
+	return run
+}
@@ -1,7 +1,11 @@
 package schema
 
 import (
+	"crypto/md5"
+	"fmt"
+	"io"
 	"sort"
+	"strings"
 	"time"
 )
 
@@ -9,6 +13,144 @@ import (
 type Migration struct {
 	ID     string
 	Script string
+
+	// Always marks a migration which is executed on every Apply, regardless
+	// of whether it has run before (for example REFRESH MATERIALIZED VIEW or
+	// re-granting permissions). Its tracking row is updated with the latest
+	// run rather than being recorded once.
+	Always bool
+
+	// Verify is an optional SQL query executed after Script which asserts an
+	// invariant the migration should have established (for example "no NULLs
+	// remain in the backfilled column"). The verification passes when the
+	// query returns no rows or when the first column of its first row is
+	// truthy. A failed verification rolls back the migration.
+	Verify string
+
+	// Copy optionally bulk loads data after Script has run, using COPY FROM
+	// STDIN on dialects which support it. The copied data is not part of
+	// the migration's checksum.
+	Copy *CopyFrom
+
+	// Seed optionally inserts rows after Script has run, with bound values,
+	// skipping rows which already exist. Unlike Copy, the rows are part of
+	// the migration's checksum. See MigrationFromCSV.
+	Seed *Seed
+
+	// Precondition is an optional SQL query executed before Script, such as
+	// one checking that a column still exists. It holds when the first
+	// column of its first row is truthy, so a boolean or a non-zero row
+	// count passes while no rows, NULL, false or zero fail.
+	Precondition string
+
+	// OnlyIf is an optional SQL query executed before Script which decides
+	// whether the migration applies to this database at all, such as one
+	// checking that an extension is available. When the first column of
+	// its first row isn't truthy, the migration is skipped and recorded as
+	// skipped (see AppliedMigration.Skipped) so it isn't attempted again.
+	OnlyIf string
+
+	// OnPreconditionFail chooses what happens when the Precondition fails.
+	// By default the migration fails with ErrPreconditionFailed.
+	OnPreconditionFail PreconditionFailure
+
+	// DialectScripts optionally holds variants of Script keyed by dialect
+	// name (see NamedDialect), such as "sqlite" or "mysql". When the
+	// Migrator's dialect has a variant it is run instead of Script, so that
+	// one set of migrations can target Postgres in production and SQLite in
+	// tests. The checksum covers the script which is run.
+	DialectScripts map[string]string
+
+	// Dialects optionally restricts the migration to the named dialects
+	// (see NamedDialect), such as "postgres" for one which creates a
+	// Postgres extension. With any other dialect its script isn't run, and
+	// it is recorded as skipped so that it isn't attempted again.
+	Dialects []string
+
+	// Batch optionally runs a large data migration in keyed batches after
+	// Script, committing each batch separately. See Batch.
+	Batch *Batch
+
+	// External executes Script with the dialect's ExternalExecutor instead
+	// of on the migration connection, such as through gh-ost for MySQL (see
+	// WithMySQLOnlineSchemaChange). Verify, Copy and the tracking table
+	// record still run on the migration connection once it completes.
+	External bool
+
+	// DisableTransaction runs the statements of Script outside of a
+	// transaction, each committed as it runs, for statements which can't
+	// run in one such as CREATE INDEX CONCURRENTLY on Postgres. Copy,
+	// Verify and the tracking table record run in a transaction once the
+	// statements complete. Like a Batch, it makes every migration of the
+	// run commit separately.
+	DisableTransaction bool
+
+	// ConcurrentIndex optionally builds an index concurrently in place of
+	// running Script, handling progress, cleanup and retries. It is set by
+	// ConcurrentIndex.Migration, along with a matching Script.
+	ConcurrentIndex *ConcurrentIndex
+
+	// MinServerVersion is the oldest database server version the migration
+	// can run on, such as "12" or "8.0.13". Apply fails before running any
+	// migration when a pending migration requires a newer server.
+	MinServerVersion string
+
+	// Engine optionally renders Script, written in an embedded scripting
+	// language, into the SQL which is executed. The checksum covers the
+	// source, so the rendered SQL must only depend on it and the dialect.
+	// Lint and Plan see the source rather than the rendered SQL.
+	Engine ScriptEngine
+}
+
+// PreconditionFailure is the action taken when a migration's Precondition
+// fails
+type PreconditionFailure int
+
+const (
+	// PreconditionError fails the migration with ErrPreconditionFailed
+	PreconditionError PreconditionFailure = iota
+	// PreconditionSkip skips the migration's Script, but records the
+	// migration as skipped so that it isn't attempted again
+	PreconditionSkip
+)
+
+// appliesToDialect returns whether the migration runs with the Migrator's
+// dialect, according to its Dialects
+func (m Migrator) appliesToDialect(migration *Migration) bool {
+	if len(migration.Dialects) == 0 {
+		return true
+	}
+	named, ok := m.Dialect.(NamedDialect)
+	if !ok {
+		return false
+	}
+	for _, name := range migration.Dialects {
+		if name == named.Name() {
+			return true
+		}
+	}
+	return false
+}
+
+// forDialect returns a new slice of the migrations with each Script replaced
+// by its variant for the Migrator's dialect, if it has one. Migrations are
+// copied rather than modified, since callers often share them between
+// Migrators.
+func (m Migrator) forDialect(migrations []*Migration) []*Migration {
+	name := ""
+	if named, ok := m.Dialect.(NamedDialect); ok {
+		name = named.Name()
+	}
+	resolved := make([]*Migration, len(migrations))
+	for i, migration := range migrations {
+		resolved[i] = migration
+		if script, exists := migration.DialectScripts[name]; exists && name != "" {
+			variant := *migration
+			variant.Script = script
+			resolved[i] = &variant
+		}
+	}
+	return resolved
 }
 
 // AppliedMigration is a schema change which was successfully
@@ -17,7 +159,50 @@ type AppliedMigration struct {
 	Migration
 	Checksum              string
 	ExecutionTimeInMillis int
-	AppliedAt             time.Time
+	// AppliedAt is when the migration started, recorded and read in UTC
+	// whatever the dialect or driver
+	AppliedAt time.Time
+}
+
+// checksum returns the MD5 hex digest of the migration's script, which is
+// recorded in the tracking table when the migration is applied. The
+// statement of a Batch and the rows of a Seed are included, so that
+// changing them is detected.
+func (m *Migration) checksum() string {
+	script := m.Script
+	if m.Batch != nil {
+		script += "\x00" + m.Batch.Statement
+	}
+	if m.Seed == nil {
+		return fmt.Sprintf("%x", md5.Sum([]byte(script)))
+	}
+	h := md5.New()
+	_, _ = io.WriteString(h, script)
+	writeFields(h, m.Seed.fields())
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// skippedPrefix marks the checksum recorded for a migration whose script was
+// skipped, because its OnlyIf condition was false or its Precondition failed
+// with PreconditionSkip. The checksum is truncated to fit the tracking table.
+const skippedPrefix = "skipped:"
+
+// Skipped returns whether the migration was recorded without its script
+// running, because its OnlyIf condition was false or its Precondition
+// failed with PreconditionSkip
+func (a *AppliedMigration) Skipped() bool {
+	return strings.HasPrefix(a.Checksum, skippedPrefix)
+}
+
+// needsRun returns whether Apply would run the migration given the applied
+// migrations, and whether it has run (or started to run) before
+func needsRun(migration *Migration, applied map[string]*AppliedMigration) (run bool, rerun bool) {
+	record, exists := applied[migration.ID]
+	if !exists {
+		return true, false
+	}
+	_, inProgress := batchProgress(record)
+	return migration.Always || inProgress, true
 }
 
 // SortMigrations sorts a slice of migrations by their IDs
@@ -28,25 +213,42 @@ func SortMigrations(migrations []*Migration) {
 	})
 }
 
+// sortApplied sorts a slice of applied migrations by their IDs
+func sortApplied(applied []*AppliedMigration) {
+	sort.Slice(applied, func(i, j int) bool {
+		return applied[i].ID < applied[j].ID
+	})
+}
+
 // GetAppliedMigrations retrieves all already-applied migrations in a map keyed
 // by the migration IDs
 //
 func (m Migrator) GetAppliedMigrations(db Queryer) (applied map[string]*AppliedMigration, err error) {
 	applied = make(map[string]*AppliedMigration)
-	migrations := make([]*AppliedMigration, 0)
+	migrations, err := m.appliedRows(db)
+	for _, migration := range migrations {
+		applied[migration.ID] = migration
+	}
+	return applied, err
+}
+
+// appliedRows retrieves every row of the tracking table, including any
+// duplicates, in ID order
+func (m Migrator) appliedRows(db Queryer) (migrations []*AppliedMigration, err error) {
+	migrations = make([]*AppliedMigration, 0)
 
-	rows, err := db.Query(m.Dialect.SelectSQL(m.QuotedTableName()))
+	selectSQL := m.Dialect.SelectSQL(m.QuotedTableName())
+	startedAt := time.Now()
+	rows, err := db.Query(selectSQL)
+	m.logQuery(selectSQL, nil, startedAt, err)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
 	for rows.Next() {
 		migration := AppliedMigration{}
-		err = rows.Scan(&migration.ID, &migration.Checksum, &migration.ExecutionTimeInMillis, &migration.AppliedAt)
+		err = rows.Scan(&migration.ID, &migration.Checksum, &migration.ExecutionTimeInMillis, timestamp(&migration.AppliedAt))
 		migrations = append(migrations, &migration)
 	}
-	for _, migration := range migrations {
-		applied[migration.ID] = migration
-	}
-	return applied, err
+	return migrations, err
 }
@@ -1,20 +1,221 @@
 package schema
 
 import (
-	"crypto/md5"
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
 // Migrator is an instance customized to perform migrations on a particular
 // against a particular tracking table and with a particular dialect
-// defined.
+// defined. A Migrator holds only configuration, and the state of each Apply
+// is scoped to the call, so one Migrator may be shared by goroutines
+// migrating many databases (such as one per tenant) concurrently.
 type Migrator struct {
 	SchemaName string
 	TableName  string
 	Dialect    Dialect
 	Logger     Logger
+
+	// SessionSetup holds SQL statements executed on the migration connection
+	// before the run, such as SET ROLE or SET lock_timeout.
+	SessionSetup []string
+
+	// PreRunScript and PostRunScript hold SQL statements executed once
+	// before and after the migrations of a run. See WithPreRunScript.
+	PreRunScript  []string
+	PostRunScript []string
+
+	// RequiredExtensions are created, if they don't exist, before the
+	// migrations of a run, on dialects which implement ExtensionCreator.
+	// See WithRequiredExtensions.
+	RequiredExtensions []string
+
+	// Confirm, when set, is called with the planned migrations before any of
+	// them are executed. Returning false aborts Apply with ErrNotConfirmed.
+	Confirm func(plan []*Migration) (bool, error)
+
+	// LintPolicy chooses whether the planned migrations are checked for
+	// changes which are incompatible with rolling deploys. See Lint.
+	LintPolicy LintPolicy
+
+	// QueryLogger, when set, receives every SQL statement the Migrator
+	// executes
+	QueryLogger QueryLogger
+
+	// Redact, when set, is applied to SQL and error messages before they
+	// are logged or returned, so that sensitive literals don't leak. See
+	// MaskLiterals. Statement arguments are masked entirely.
+	Redact func(sql string) string
+
+	// SlowThreshold, when positive, flags migrations which take longer to
+	// run. They are logged as warnings and passed to OnSlowMigration.
+	SlowThreshold time.Duration
+
+	// OnSlowMigration, when set, is called with each migration which took
+	// longer than SlowThreshold
+	OnSlowMigration func(migration *Migration, duration time.Duration)
+
+	// LockReportInterval, when positive, makes Apply report who holds the
+	// migration lock at this interval while it waits for the lock, on
+	// dialects which implement LockHolderReporter. Reports are logged and
+	// passed to OnLockWait.
+	LockReportInterval time.Duration
+
+	// OnLockWait, when set, is called with each report of who holds the
+	// migration lock, and how long Apply has waited for it
+	OnLockWait func(waited time.Duration, holders []*LockHolder)
+
+	// StatementRetries is the number of times a migration statement which
+	// fails with a retryable error is retried, within a savepoint, before
+	// the migration fails. Retries only happen on dialects with
+	// transactional DDL.
+	StatementRetries int
+
+	// StatementRetryBackoff is the pause before the first retry, which
+	// grows linearly with each attempt
+	StatementRetryBackoff time.Duration
+
+	// RetryableError decides which errors are retried. It defaults to
+	// IsRetryableError.
+	RetryableError func(err error) bool
+
+	// TxOptions, when set, are used to begin the transactions which read
+	// the tracking table to plan a run, execute migrations, and record
+	// them, such as to choose an isolation level
+	TxOptions *sql.TxOptions
+
+	// ReadTxOptions, when set, are used for the read-only transactions of
+	// health checks, such as to mark them read-only on database replicas
+	ReadTxOptions *sql.TxOptions
+
+	// MaterializedViews declares views which are refreshed after Apply runs
+	// the migrations they depend on
+	MaterializedViews []*MaterializedView
+
+	// ExistingTableOnly prevents the Migrator from creating the tracking
+	// table, or the builds, scripts and set checksum tables it's configured
+	// to record. Apply fails with ErrTrackingTableMissing when one hasn't
+	// been created in advance, such as by a DBA when the application's role
+	// lacks CREATE privileges.
+	ExistingTableOnly bool
+
+	// RefuseReplicas makes Apply fail with ErrReplica when the dialect
+	// reports that the database is a read-only replica (see
+	// ReplicaDetector), such as when pointed at a reader endpoint
+	RefuseReplicas bool
+
+	// MinServerVersion is the oldest database server version which Apply
+	// will migrate, such as "11". See Migration.MinServerVersion.
+	MinServerVersion string
+
+	// Middleware wraps the execution of each migration, with the first
+	// Middleware outermost. See WithMiddleware.
+	Middleware []Middleware
+
+	// IDValidator, when set, checks every migration's ID before Apply runs.
+	// See ValidateIDs.
+	IDValidator IDValidator
+
+	// StrictOrdering makes Apply fail with a ConflictError when a pending
+	// migration sorts before an applied one, rather than applying it out
+	// of order
+	StrictOrdering bool
+
+	// RefuseOrphans makes Apply fail with a ConflictError when the tracking
+	// table records migrations which aren't supplied. See WithOrphanCheck.
+	RefuseOrphans bool
+
+	// Notifier, when set, is notified when a run applies migrations or
+	// fails
+	Notifier Notifier
+
+	// BuildMetadata, when set, is recorded with each migration Apply runs,
+	// such as a git commit hash or build ID, in a table named after the
+	// tracking table with BuildsTableSuffix. See AppliedBuilds.
+	BuildMetadata string
+
+	// ApplicationName, when set, tags the migration connection on dialects
+	// which implement ApplicationNamer. See WithApplicationName.
+	ApplicationName string
+
+	// Allowlist holds the reviewed migrations, which are checked according
+	// to the AllowlistPolicy. See WithAllowlist.
+	Allowlist       Allowlist
+	AllowlistPolicy AllowlistPolicy
+
+	// SigningKey, when set, makes Apply verify the migrations against the
+	// Signature before doing anything. See WithSignature.
+	SigningKey []byte
+	Signature  string
+
+	// Locker, when set, is used for the migration lock instead of the
+	// dialect's locking, such as a RedisLocker. See WithLocker.
+	Locker Locker
+
+	// Maintenance declares work done after Apply has run migrations, such
+	// as analyzing the tables they touched. See WithMaintenance.
+	Maintenance Maintenance
+
+	// CommentObjects comments the tables and indexes each migration creates
+	// with its ID. See WithObjectComments.
+	CommentObjects bool
+
+	// RecordScripts stores the compressed script of each migration Apply
+	// runs. See WithScriptRecording.
+	RecordScripts bool
+
+	// RecordSetChecksum stores the SetChecksum of the migrations after each
+	// successful Apply. See WithSetChecksum.
+	RecordSetChecksum bool
+
+	// ReconnectAttempts is how many times Apply resumes after the database
+	// connection drops, and ReconnectBackoff the wait before the first
+	// attempt. See WithReconnect.
+	ReconnectAttempts int
+	ReconnectBackoff  time.Duration
+
+	// ConnectionPerMigration runs each migration on a new connection,
+	// discarded afterwards. See WithConnectionPerMigration.
+	ConnectionPerMigration bool
+
+	// DurabilityCheck makes Apply read back the migrations it committed on
+	// a new connection before returning. See WithDurabilityCheck.
+	DurabilityCheck bool
+
+	// ShardConcurrency is how many shards ApplyShards migrates at once, and
+	// ShardTimeout how long each may take. See WithShardConcurrency.
+	ShardConcurrency int
+	ShardTimeout     time.Duration
+
+	// Environment names the deployment, such as "production", and
+	// ScriptFlags holds custom feature flags. Both are available to
+	// migrations rendered by a VarsEngine. See WithEnvironment.
+	Environment string
+	ScriptFlags map[string]bool
+
+	// serverVersion is the version of the server being migrated, which Apply
+	// queries for migrations rendered by a VarsEngine
+	serverVersion string
+
+	// ChecksumScope chooses what the checksum recorded for each migration
+	// covers. See WithChecksumScope.
+	ChecksumScope ChecksumScope
+
+	// atomicDDL records whether the server's DDL statements are atomic,
+	// which Apply detects (see CapabilityDetector)
+	atomicDDL bool
+
+	// sandbox makes apply roll back the run. See SandboxApply.
+	sandbox bool
+
+	// optionErr is the first error of the Options, such as an unknown name
+	// given to WithDialectName, which Apply returns before doing anything
+	optionErr error
 }
 
 // NewMigrator creates a new Migrator with the supplied
@@ -31,55 +232,413 @@ func NewMigrator(options ...Option) Migrator {
 }
 
 // Apply takes a slice of Migrations and applies any which have not yet
-// been applied
-func (m Migrator) Apply(db *sql.DB, migrations []*Migration) (err error) {
-	err = m.lock(db)
+// been applied. Any options override the Migrator's configuration for this
+// call only, such as a one-off WithConfirm to preview the plan.
+func (m Migrator) Apply(db *sql.DB, migrations []*Migration, options ...Option) (err error) {
+	return m.ApplyContext(context.Background(), db, migrations, options...)
+}
+
+// ApplyContext is like Apply, but stops when the supplied context is
+// cancelled. The in-flight migration transaction is rolled back and the lock
+// is explicitly released before returning, so the next deploy isn't blocked
+// by a zombie lock. To stop cleanly when a process receives SIGTERM, pass a
+// context from signal.NotifyContext.
+func (m Migrator) ApplyContext(ctx context.Context, db *sql.DB, migrations []*Migration, options ...Option) (err error) {
+	_, err = m.ApplyReport(ctx, db, migrations, options...)
+	return err
+}
+
+// ApplyReport is like ApplyContext, but also returns a Report of the run.
+// The Report is returned even when the run fails, and lists the migrations
+// which were committed before the failure.
+func (m Migrator) ApplyReport(ctx context.Context, db *sql.DB, migrations []*Migration, options ...Option) (report *Report, err error) {
+	for _, opt := range options {
+		m = opt(m)
+	}
+	run := &applyRun{startedAt: time.Now()}
+	defer func() {
+		err = m.redactError(err)
+		report = run.report()
+		m.notify(run, err)
+	}()
+	err = m.applyResuming(ctx, db, migrations, run)
+	if err != nil || !m.DurabilityCheck {
+		return nil, err
+	}
+	return nil, m.checkDurable(ctx, db, run)
+}
+
+// apply is the implementation of ApplyContext, which records the run
+func (m Migrator) apply(ctx context.Context, db *sql.DB, migrations []*Migration, run *applyRun) (err error) {
+	if db == nil {
+		return ErrNilDB
+	}
+	if m.optionErr != nil {
+		return m.optionErr
+	}
+	err = m.ValidateTableName()
 	if err != nil {
 		return err
 	}
+	if m.SigningKey != nil {
+		err = VerifyMigrations(m.SigningKey, migrations, m.Signature)
+		if err != nil {
+			return err
+		}
+	}
+	// The set checksum covers the migrations as supplied
+	set := migrations
+	migrations = m.forDialect(migrations)
 
-	defer func() {
-		unlockErr := m.unlock(db)
-		if unlockErr != nil {
-			if err == nil {
-				err = unlockErr
-			} else {
-				err = fmt.Errorf("Error unlocking while returning from other err: %w\n%s", err, unlockErr.Error())
-			}
+	err = m.ValidateIDs(migrations)
+	if err != nil {
+		return err
+	}
+	err = m.checkUpdater(migrations)
+	if err != nil {
+		return err
+	}
+
+	// Dialects which lock inside the migration transaction need no lock
+	// management here, since the lock is released along with the transaction
+	txLockSQL := m.transactionLockSQL()
+	if txLockSQL != "" && m.ConnectionPerMigration {
+		return fmt.Errorf("a connection per migration can't be used with a transaction lock")
+	}
+	if m.ConnectionPerMigration && len(m.PreRunScript)+len(m.PostRunScript) > 0 {
+		return fmt.Errorf("a connection per migration can't be used with pre-run or post-run scripts, which wouldn't share its session")
+	}
+	_, lockOnConn := m.Dialect.(SQLLocker)
+	lockOnConn = lockOnConn && m.Locker == nil
+
+	// Dialects which lock through the sql.DB must do so before the migration
+	// connection is claimed, since their pools are often limited to a single
+	// connection (which is common with SQLite)
+	if txLockSQL == "" && !lockOnConn {
+		lockedAt := time.Now()
+		err = m.lock(ctx, db, nil)
+		run.lockWait = time.Since(lockedAt)
+		if err != nil {
+			return err
 		}
-	}()
+		defer m.unlockOnReturn(db, nil, &err)
+	}
+
+	// All other work happens on a single connection so that session state
+	// and session-level locks apply to the statements which follow them
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.releaseConn(conn, &err)
+
+	err = m.setupSession(ctx, conn)
+	if err != nil {
+		return err
+	}
 
-	err = m.createMigrationsTable(db)
+	err = m.checkReplica(ctx, conn)
 	if err != nil {
 		return err
 	}
 
-	err = transaction(db, func(tx *sql.Tx) error {
-		applied, err := m.GetAppliedMigrations(tx)
+	if txLockSQL == "" && lockOnConn {
+		lockedAt := time.Now()
+		err = m.lock(ctx, db, conn)
+		run.lockWait = time.Since(lockedAt)
 		if err != nil {
 			return err
 		}
+		defer m.unlockOnReturn(db, conn, &err)
+	}
+
+	// A sandbox creates the tracking table inside the run's transaction, so
+	// that it is rolled back too
+	if !m.sandbox || m.ExistingTableOnly {
+		err = m.createMigrationsTable(ctx, conn)
+		if err != nil && txLockSQL != "" {
+			// No lock is held yet, so a concurrent migrator may have created
+			// the table at the same moment. If so, a second attempt succeeds.
+			err = m.createMigrationsTable(ctx, conn)
+		}
+		if err != nil {
+			return err
+		}
+	}
 
-		plan := make([]*Migration, 0)
+	// Without transactional DDL, a failed migration can't roll back the
+	// migrations before it, so each one is committed separately to keep the
+	// tracking table truthful. Transaction locks require a single transaction.
+	m, caps, err := m.detectCapabilities(ctx, conn)
+	if err != nil {
+		return err
+	}
+	m.atomicDDL = caps.AtomicDDL
+	perMigrationTx := (!caps.TransactionalDDL || m.ConnectionPerMigration) && txLockSQL == ""
+	if m.sandbox {
+		if !caps.TransactionalDDL {
+			return ErrSandboxNotSupported
+		}
+		perMigrationTx = false
+	} else if !caps.TransactionalDDL && caps.AtomicDDL {
+		m.log("Warning: the server does not support transactional DDL. Each DDL statement is atomic, but a failed migration may be left with its earlier statements applied.")
+	} else if !caps.TransactionalDDL {
+		m.log("Warning: the dialect does not support transactional DDL. A failed migration may be left partially applied.")
+	}
+
+	var (
+		applied map[string]*AppliedMigration
+		plan    []*Migration
+		// completed holds the migrations run in the shared transaction,
+		// which are only reported once it commits
+		completed []*MigrationReport
+	)
+	err = m.transaction(ctx, conn, func(tx *sql.Tx) error {
+		if txLockSQL != "" {
+			lockedAt := time.Now()
+			stopReporting := m.reportLockWait(ctx, db)
+			_, err := m.exec(ctx, tx, txLockSQL)
+			stopReporting()
+			run.lockWait = time.Since(lockedAt)
+			if err != nil {
+				return &LockError{Err: err}
+			}
+			m.log("Locked at ", time.Now().Format(time.RFC3339Nano))
+		}
+
+		if m.sandbox && !m.ExistingTableOnly {
+			err = m.createTables(ctx, tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		applied, err = m.GetAppliedMigrations(tx)
+		if err != nil {
+			return err
+		}
+
+		err = m.checkPartial(migrations, applied)
+		if err != nil {
+			return err
+		}
+
+		if conflict := m.Conflicts(migrations, applied); conflict != nil {
+			return conflict
+		}
+
+		plan = make([]*Migration, 0)
 		for _, migration := range migrations {
-			if _, exists := applied[migration.ID]; !exists {
+			if run, _ := needsRun(migration, applied); run {
 				plan = append(plan, migration)
 			}
 		}
 
 		SortMigrations(plan)
+		if run.plan == nil {
+			run.plan = plan
+		}
+
+		m, err = m.withServerVersion(ctx, tx, plan)
+		if err != nil {
+			return err
+		}
+
+		err = m.lint(plan)
+		if err != nil {
+			return err
+		}
+
+		err = m.validateStatements(plan)
+		if err != nil {
+			return err
+		}
+
+		err = m.checkTransactional(plan)
+		if err != nil {
+			return err
+		}
+
+		err = m.checkAllowlist(plan)
+		if err != nil {
+			return err
+		}
+
+		err = m.checkServerVersion(ctx, tx, plan)
+		if err != nil {
+			return err
+		}
 
+		// Batches and migrations with DisableTransaction are committed
+		// separately, which requires every migration to be committed
+		// separately to keep them in order
 		for _, migration := range plan {
-			err = m.runMigration(tx, migration)
+			if migration.Batch == nil && !migration.DisableTransaction {
+				continue
+			}
+			if txLockSQL != "" && migration.Batch != nil {
+				return fmt.Errorf("Migration '%s' has a Batch, which can't be used with a transaction lock", migration.ID)
+			}
+			if txLockSQL != "" {
+				return fmt.Errorf("Migration '%s' has DisableTransaction, which can't be used with a transaction lock", migration.ID)
+			}
+			perMigrationTx = true
+		}
+
+		if m.sandbox {
+			err = checkSandbox(plan)
 			if err != nil {
 				return err
 			}
 		}
 
+		if m.Confirm != nil && len(plan) > 0 {
+			confirmed, err := m.Confirm(plan)
+			if err != nil {
+				return err
+			}
+			if !confirmed {
+				return ErrNotConfirmed
+			}
+		}
+
+		if perMigrationTx {
+			return nil
+		}
+		err = m.createExtensions(ctx, tx, plan)
+		if err != nil {
+			return err
+		}
+		err = m.runScript(ctx, tx, "Pre-run", m.PreRunScript, plan)
+		if err != nil {
+			return err
+		}
+		for _, migration := range plan {
+			_, rerun := needsRun(migration, applied)
+			startedAt := time.Now()
+			skip := false
+			err = m.withMiddleware(func(ctx context.Context, migration *Migration) (err error) {
+				skip, err = m.runMigration(ctx, tx, migration, rerun)
+				return err
+			})(ctx, migration)
+			if err != nil {
+				return err
+			}
+			completed = append(completed, newMigrationReport(migration, rerun, skip, startedAt))
+		}
+
+		err = m.runScript(ctx, tx, "Post-run", m.PostRunScript, plan)
+		if err != nil {
+			return err
+		}
+		err = m.refreshViews(ctx, tx, plan)
+		if err != nil {
+			return err
+		}
+		if m.sandbox {
+			return errSandboxRollback
+		}
+		return m.recordSet(ctx, tx, set)
+	})
+	if err == errSandboxRollback {
+		run.completed = append(run.completed, completed...)
 		return nil
+	}
+	if err != nil {
+		m.recordPartial(conn, err, applied)
+		return err
+	}
+	run.completed = append(run.completed, completed...)
+	if !perMigrationTx {
+		return m.maintain(ctx, conn, plan)
+	}
+
+	err = m.runMigrations(ctx, db, conn, plan, applied, run)
+	if err != nil {
+		return err
+	}
+
+	err = m.transaction(ctx, conn, func(tx *sql.Tx) error {
+		err := m.refreshViews(ctx, tx, plan)
+		if err != nil {
+			return err
+		}
+		return m.recordSet(ctx, tx, set)
 	})
+	if err != nil {
+		return err
+	}
+	return m.maintain(ctx, conn, plan)
+}
 
-	return err
+// runMigrations runs the planned migrations one at a time, each committed
+// separately, between the pre-run and post-run scripts. The post-run script
+// is run even when a migration fails, without the Apply context so that it
+// still runs after a cancellation.
+func (m Migrator) runMigrations(ctx context.Context, db *sql.DB, conn *sql.Conn, plan []*Migration, applied map[string]*AppliedMigration, run *applyRun) (err error) {
+	err = m.createExtensions(ctx, conn, plan)
+	if err != nil {
+		return err
+	}
+	err = m.runScript(ctx, conn, "Pre-run", m.PreRunScript, plan)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		postRunCtx := ctx
+		if err != nil {
+			postRunCtx = context.Background()
+		}
+		postRunErr := m.runScript(postRunCtx, conn, "Post-run", m.PostRunScript, plan)
+		if postRunErr != nil && err == nil {
+			err = postRunErr
+		} else if postRunErr != nil {
+			err = fmt.Errorf("%w\n%s", err, postRunErr)
+		}
+	}()
+
+	for _, migration := range plan {
+		_, rerun := needsRun(migration, applied)
+		startedAt := time.Now()
+		skip := false
+		err = m.withMiddleware(func(ctx context.Context, migration *Migration) (err error) {
+			conn := conn
+			if m.ConnectionPerMigration {
+				conn, err = m.migrationConn(ctx, db)
+				if err != nil {
+					return err
+				}
+				defer discardConn(conn)
+			}
+			if migration.Batch != nil {
+				skip, err = m.runBatchedMigration(ctx, conn, migration, applied[migration.ID])
+				return err
+			}
+			if migration.DisableTransaction {
+				skip, err = m.runUntransactedMigration(ctx, db, conn, migration, rerun)
+				return err
+			}
+			return m.transaction(ctx, conn, func(tx *sql.Tx) (err error) {
+				skip, err = m.runMigration(ctx, tx, migration, rerun)
+				return err
+			})
+		})(ctx, migration)
+		if err != nil {
+			m.recordPartial(conn, err, applied)
+			return err
+		}
+		run.completed = append(run.completed, newMigrationReport(migration, rerun, skip, startedAt))
+	}
+	return nil
+}
+
+// withOptionErr returns the Migrator with the error of an Option, unless an
+// earlier Option failed
+func (m Migrator) withOptionErr(err error) Migrator {
+	if m.optionErr == nil {
+		m.optionErr = err
+	}
+	return m
 }
 
 // QuotedTableName returns the dialect-quoted fully-qualified name for the
@@ -88,37 +647,326 @@ func (m Migrator) QuotedTableName() string {
 	return m.Dialect.QuotedTableName(m.SchemaName, m.TableName)
 }
 
-func (m Migrator) createMigrationsTable(db *sql.DB) (err error) {
-	return transaction(db, func(tx *sql.Tx) error {
-		_, err := tx.Exec(m.Dialect.CreateSQL(m.QuotedTableName()))
-		return err
+// sessionStatements returns the statements which configure the migration
+// connection: those required by the dialect, then the one setting the
+// ApplicationName, followed by SessionSetup
+func (m Migrator) sessionStatements() []string {
+	statements := make([]string, 0)
+	if d, ok := m.Dialect.(SessionConfigurer); ok {
+		statements = append(statements, d.SessionSQL()...)
+	}
+	if d, ok := m.Dialect.(ApplicationNamer); ok && m.ApplicationName != "" {
+		statements = append(statements, d.ApplicationNameSQL(m.ApplicationName))
+	}
+	return append(statements, m.SessionSetup...)
+}
+
+// runScript executes the statements of a pre-run or post-run script, unless
+// the plan is empty
+func (m Migrator) runScript(ctx context.Context, db ExecerContext, name string, statements []string, plan []*Migration) error {
+	if len(plan) == 0 {
+		return nil
+	}
+	for _, statement := range statements {
+		_, err := m.exec(ctx, db, statement)
+		if err != nil {
+			return fmt.Errorf("%s script '%s' failed:\n%w", name, m.redact(statement), err)
+		}
+	}
+	return nil
+}
+
+// setupSession executes the session statements on the migration connection
+func (m Migrator) setupSession(ctx context.Context, conn *sql.Conn) error {
+	for _, statement := range m.sessionStatements() {
+		_, err := m.exec(ctx, conn, statement)
+		if err != nil {
+			return fmt.Errorf("Session setup '%s' failed:\n%w", m.redact(statement), err)
+		}
+	}
+	return nil
+}
+
+// transaction runs f in a transaction begun with the Migrator's TxOptions
+func (m Migrator) transaction(ctx context.Context, db Transactor, f func(*sql.Tx) error) error {
+	return transactionWithOptions(ctx, db, m.TxOptions, f)
+}
+
+// setupTransaction executes the dialect's TransactionConfigurer statements at
+// the start of a migration's transaction
+func (m Migrator) setupTransaction(ctx context.Context, tx *sql.Tx) error {
+	d, ok := m.Dialect.(TransactionConfigurer)
+	if !ok {
+		return nil
+	}
+	for _, statement := range d.TransactionSQL() {
+		_, err := m.exec(ctx, tx, statement)
+		if err != nil {
+			return fmt.Errorf("Transaction setup '%s' failed:\n%w", statement, err)
+		}
+	}
+	return nil
+}
+
+// releaseConn returns the migration connection to the pool. If session setup
+// statements were executed on it, the connection is discarded instead so
+// that its session state doesn't leak into the application's pool, as it is
+// when the operation failed because the connection dropped, and when the
+// durability check must read the tracking table on another connection.
+func (m Migrator) releaseConn(conn *sql.Conn, err *error) {
+	if len(m.sessionStatements()) > 0 || m.DurabilityCheck || IsConnectionError(*err) {
+		discardConn(conn)
+		return
+	}
+	_ = conn.Close()
+}
+
+// discardConn closes the connection, rather than returning it to the pool
+func discardConn(conn *sql.Conn) {
+	_ = conn.Raw(func(interface{}) error {
+		return driver.ErrBadConn
 	})
+	_ = conn.Close()
+}
+
+// migrationConn claims a new connection for a single migration, set up like
+// the migration connection. The caller discards it afterwards, so that
+// session state the migration leaves behind doesn't reach the next one.
+func (m Migrator) migrationConn(ctx context.Context, db *sql.DB) (*sql.Conn, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = m.setupSession(ctx, conn)
+	if err != nil {
+		discardConn(conn)
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (m Migrator) createMigrationsTable(ctx context.Context, db Transactor) (err error) {
+	if m.ExistingTableOnly {
+		return m.checkMigrationsTable(ctx, db)
+	}
+	return m.transaction(ctx, db, func(tx *sql.Tx) error {
+		return m.createTables(ctx, tx)
+	})
+}
+
+// createTables creates the tracking table and the tables next to it
+func (m Migrator) createTables(ctx context.Context, tx *sql.Tx) error {
+	_, err := m.exec(ctx, tx, m.Dialect.CreateSQL(m.QuotedTableName()))
+	if err != nil {
+		return err
+	}
+	err = m.createBuildsTable(ctx, tx)
+	if err != nil {
+		return err
+	}
+	err = m.createScriptsTable(ctx, tx)
+	if err != nil {
+		return err
+	}
+	return m.createSetTable(ctx, tx)
+}
+
+// checkMigrationsTable verifies that the tracking table, and the tables next
+// to it which the Migrator writes, exist by reading them, without creating
+// them
+func (m Migrator) checkMigrationsTable(ctx context.Context, db Transactor) error {
+	tables := []struct{ name, query string }{
+		{m.QuotedTableName(), m.Dialect.SelectSQL(m.QuotedTableName())},
+	}
+	if m.RecordSetChecksum {
+		tables = append(tables, struct{ name, query string }{m.QuotedSetTableName(), fmt.Sprintf(`SELECT checksum FROM %s`, m.QuotedSetTableName())})
+	}
+	if m.BuildMetadata != "" {
+		tables = append(tables, struct{ name, query string }{m.QuotedBuildsTableName(), fmt.Sprintf(`SELECT id, build, applied_at FROM %s`, m.QuotedBuildsTableName())})
+	}
+	if m.RecordScripts {
+		tables = append(tables, struct{ name, query string }{m.QuotedScriptsTableName(), fmt.Sprintf(`SELECT id, script, applied_at FROM %s`, m.QuotedScriptsTableName())})
+	}
+	for _, table := range tables {
+		err := m.transaction(ctx, db, func(tx *sql.Tx) error {
+			rows, err := m.query(ctx, tx, table.query)
+			if err != nil {
+				return err
+			}
+			return rows.Close()
+		})
+		if isMissingTableError(err) {
+			return fmt.Errorf("%w: %s: %v", ErrTrackingTableMissing, table.name, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missingTableSQLStates are the SQLSTATEs of an undefined table on Postgres
+// and MySQL
+var missingTableSQLStates = map[string]bool{"42P01": true, "42S02": true}
+
+// isMissingTableError returns whether the error reports that a table doesn't
+// exist, such as a tracking table which hasn't been created or a lock table
+// which another process dropped. Drivers whose errors have a SQLState()
+// method are checked by state, and the messages of the others are tested to
+// avoid a driver dependency, like isConstraintError.
+func isMissingTableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var stateful interface{ SQLState() string }
+	if errors.As(err, &stateful) && missingTableSQLStates[stateful.SQLState()] {
+		return true
+	}
+	s := strings.ToLower(err.Error())
+	return strings.Contains(s, "no such table") || // SQLite
+		(strings.Contains(s, "relation") && strings.Contains(s, "does not exist")) || // Postgres
+		strings.Contains(s, "error 1146") || // MySQL
+		strings.Contains(s, "ora-00942") // Oracle
 }
 
-func (m Migrator) lock(db *sql.DB) (err error) {
+// checkUpdater returns ErrUpdateNotSupported for the first migration whose
+// record would be refreshed when the dialect doesn't implement Updater
+func (m Migrator) checkUpdater(migrations []*Migration) error {
+	if _, ok := m.Dialect.(Updater); ok {
+		return nil
+	}
+	for _, migration := range migrations {
+		if migration.Always || migration.Batch != nil {
+			return fmt.Errorf("Migration '%s' Failed:\n%w", migration.ID, ErrUpdateNotSupported)
+		}
+	}
+	return nil
+}
+
+// updateSQL returns the dialect's statement which refreshes the record of a
+// migration in the table
+func (m Migrator) updateSQL(tableName string) (string, error) {
+	updater, ok := m.Dialect.(Updater)
+	if !ok {
+		return "", ErrUpdateNotSupported
+	}
+	return updater.UpdateSQL(tableName), nil
+}
+
+// checkReplica returns ErrReplica when the Migrator refuses replicas and the
+// dialect reports that the connection is to one
+func (m Migrator) checkReplica(ctx context.Context, conn *sql.Conn) error {
+	detector, ok := m.Dialect.(ReplicaDetector)
+	if !m.RefuseReplicas || !ok {
+		return nil
+	}
+	value, found, err := m.queryFirstValue(ctx, conn, detector.ReplicaSQL())
+	if err != nil {
+		return err
+	}
+	if found && isTruthy(value) {
+		return ErrReplica
+	}
+	return nil
+}
+
+// capabilities returns the dialect's Capabilities. Dialects which don't
+// report them are assumed to support transactional DDL.
+func (m Migrator) capabilities() Capabilities {
+	if d, ok := m.Dialect.(CapabilityReporter); ok {
+		return d.Capabilities()
+	}
+	return Capabilities{TransactionalDDL: true}
+}
+
+// detectCapabilities returns the Capabilities of the connected server, for
+// dialects which implement CapabilityDetector, and otherwise those the
+// dialect reports. The Migrator is returned with the server version it
+// queried, so that it isn't queried again.
+func (m Migrator) detectCapabilities(ctx context.Context, conn *sql.Conn) (Migrator, Capabilities, error) {
+	detector, ok := m.Dialect.(CapabilityDetector)
+	reporter, reports := m.Dialect.(VersionReporter)
+	if !ok || !reports {
+		return m, m.capabilities(), nil
+	}
+	value, _, err := m.queryFirstValue(ctx, conn, reporter.VersionSQL())
+	if err != nil {
+		return m, Capabilities{}, err
+	}
+	m.serverVersion = fmt.Sprintf("%s", value)
+	return m, detector.DetectCapabilities(m.serverVersion), nil
+}
+
+// transactionLockSQL returns the statement which locks inside the migration
+// transaction, or an empty string if the dialect doesn't lock that way or
+// the Migrator has its own Locker
+func (m Migrator) transactionLockSQL() string {
+	if m.Locker != nil {
+		return ""
+	}
+	if d, ok := m.Dialect.(TransactionLocker); ok {
+		return d.TransactionLockSQL(m.QuotedTableName())
+	}
+	return ""
+}
+
+// locker returns the Migrator's Locker if it has one, and otherwise its
+// dialect, which implements one of the Locker interfaces
+func (m Migrator) locker() interface{} {
+	if m.Locker != nil {
+		return m.Locker
+	}
+	return m.Dialect
+}
+
+func (m Migrator) lock(ctx context.Context, db *sql.DB, conn *sql.Conn) (err error) {
 	if db == nil {
 		return ErrNilDB
 	}
 
-	switch d := m.Dialect.(type) {
+	stopReporting := m.reportLockWait(ctx, db)
+	switch d := m.locker().(type) {
 	case SQLLocker:
-		_, err = db.Exec(d.LockSQL(m.TableName))
+		_, err = m.exec(ctx, conn, d.LockSQL(m.QuotedTableName()))
+	case ContextLocker:
+		err = d.LockContext(ctx, db)
 	case Locker:
 		err = d.Lock(db)
 	default:
 		panic("dialects must implement at least one locker interface")
 	}
+	stopReporting()
+	if err != nil {
+		return &LockError{Err: err}
+	}
 	m.log("Locked at ", time.Now().Format(time.RFC3339Nano))
-	return err
+	return nil
 }
 
-func (m Migrator) unlock(db *sql.DB) (err error) {
+// unlockOnReturn releases the lock when deferred by Apply, combining any
+// unlocking error with the error Apply is returning. Unlocking deliberately
+// doesn't use the Apply context, so that the lock is still released when
+// that context has been cancelled.
+func (m Migrator) unlockOnReturn(db *sql.DB, conn *sql.Conn, err *error) {
+	unlockErr := m.unlock(db, conn)
+	if unlockErr != nil {
+		if *err == nil {
+			*err = unlockErr
+		} else {
+			*err = fmt.Errorf("Error unlocking while returning from other err: %w\n%s", *err, unlockErr.Error())
+		}
+	}
+}
+
+func (m Migrator) unlock(db *sql.DB, conn *sql.Conn) (err error) {
 	if db == nil {
 		return ErrNilDB
 	}
-	switch d := m.Dialect.(type) {
+	switch d := m.locker().(type) {
 	case SQLLocker:
-		_, err = db.Exec(d.UnlockSQL(m.TableName))
+		_, err = m.exec(context.Background(), conn, d.UnlockSQL(m.QuotedTableName()))
+	case ContextLocker:
+		err = d.UnlockContext(context.Background(), db)
 	case Locker:
 		err = d.Unlock(db)
 	default:
@@ -128,34 +976,359 @@ func (m Migrator) unlock(db *sql.DB) (err error) {
 	return err
 }
 
-func (m Migrator) runMigration(tx *sql.Tx, migration *Migration) error {
-	var (
-		err      error
-		checksum string
-	)
+// runMigration executes the migration's script and records it in the tracking
+// table. When rerun is true the migration has been applied before (which only
+// happens for Always migrations), so its existing row is updated instead. It
+// returns whether the script was skipped because of its OnlyIf condition or
+// precondition.
+func (m Migrator) runMigration(ctx context.Context, tx *sql.Tx, migration *Migration, rerun bool) (skip bool, err error) {
+	err = m.setupTransaction(ctx, tx)
+	if err != nil {
+		return false, err
+	}
 
 	startedAt := time.Now()
-	_, err = tx.Exec(migration.Script)
+	skip, reason, err := m.checkConditions(ctx, tx, migration)
 	if err != nil {
-		return fmt.Errorf("Migration '%s' Failed:\n%w", migration.ID, err)
+		return false, err
+	}
+
+	if !skip {
+		if migration.External {
+			err = m.executeExternally(ctx, migration)
+		} else {
+			err = m.execScript(ctx, tx, migration)
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return skip, m.completeMigration(ctx, tx, migration, rerun, skip, reason, startedAt)
+}
+
+// completeMigration finishes a migration whose script has been executed, or
+// skipped for the reason, by commenting the objects it created, copying in
+// and seeding its data, verifying it and recording it in the tracking table
+func (m Migrator) completeMigration(ctx context.Context, tx *sql.Tx, migration *Migration, rerun, skip bool, reason string, startedAt time.Time) error {
+	var checksum string
+
+	if !skip {
+		err := m.commentObjects(ctx, tx, migration)
+		if err != nil {
+			return err
+		}
+
+		if migration.Copy != nil {
+			err = m.copyIn(ctx, tx, migration)
+			if err != nil {
+				return err
+			}
+		}
+
+		if migration.Seed != nil {
+			err = m.insertSeed(ctx, tx, migration)
+			if err != nil {
+				return err
+			}
+		}
+
+		if migration.Verify != "" {
+			err = m.verifyMigration(ctx, tx, migration)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	executionTime := time.Since(startedAt)
-	m.log(fmt.Sprintf("Migration '%s' applied in %s\n", migration.ID, executionTime))
+	if skip {
+		m.log(fmt.Sprintf("Migration '%s' skipped because %s\n", migration.ID, reason))
+	} else {
+		m.log(fmt.Sprintf("Migration '%s' applied in %s\n", migration.ID, executionTime))
+		m.checkSlow(migration, executionTime)
+	}
 
-	checksum = fmt.Sprintf("%x", md5.Sum([]byte(migration.Script)))
-	_, err = tx.Exec(
-		m.Dialect.InsertSQL(m.QuotedTableName()),
+	checksum = m.checksum(migration)
+	if skip {
+		checksum = m.skippedChecksum(migration)
+	}
+	recordSQL := m.Dialect.InsertSQL(m.QuotedTableName())
+	var err error
+	if rerun {
+		recordSQL, err = m.updateSQL(m.QuotedTableName())
+		if err != nil {
+			return fmt.Errorf("Migration '%s' Failed:\n%w", migration.ID, err)
+		}
+	}
+	_, err = m.exec(
+		ctx,
+		tx,
+		recordSQL,
 		migration.ID,
 		checksum,
 		executionTime.Milliseconds(),
-		startedAt,
+		startedAt.UTC(),
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if !skip {
+		err = m.recordScript(ctx, tx, migration, startedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return m.recordBuild(ctx, tx, migration, startedAt)
+}
+
+// checkSlow flags the migration if it took longer than the SlowThreshold
+func (m Migrator) checkSlow(migration *Migration, duration time.Duration) {
+	if m.SlowThreshold <= 0 || duration <= m.SlowThreshold {
+		return
+	}
+	m.log(fmt.Sprintf("Warning: Migration '%s' took %s, longer than the slow threshold of %s\n", migration.ID, duration, m.SlowThreshold))
+	if m.OnSlowMigration != nil {
+		m.OnSlowMigration(migration, duration)
+	}
+}
+
+// execScript executes the migration's script. Dialects which implement
+// StatementSplitter execute it one statement at a time, so that a failure
+// identifies the statement which caused it, and so that a failure after an
+// implicitly committing statement is reported as a PartialMigrationError.
+func (m Migrator) execScript(ctx context.Context, tx *sql.Tx, migration *Migration) error {
+	script, err := m.renderScript(migration)
+	if err != nil {
+		return err
+	}
+	var statements []string
+	if splitter, ok := m.Dialect.(StatementSplitter); ok {
+		statements = splitter.SplitStatements(script)
+	}
+	if statements == nil {
+		err := m.execStatement(ctx, tx, script)
+		if err != nil {
+			return fmt.Errorf("Migration '%s' Failed:\n%w", migration.ID, err)
+		}
+		return nil
+	}
+
+	detector, _ := m.Dialect.(ImplicitCommitDetector)
+	deferred, _ := m.Dialect.(DeferredSchemaChanger)
+	changes := make([]string, 0)
+	committed := 0
+	for i, statement := range statements {
+		var err error
+		if deferred != nil && deferred.DefersSchemaChange(statement) {
+			var change string
+			change, err = m.submitSchemaChange(ctx, tx, statement)
+			if change != "" {
+				changes = append(changes, change)
+			}
+		} else {
+			err = m.execStatement(ctx, tx, statement)
+		}
+		if err != nil && committed > 0 {
+			return &PartialMigrationError{
+				MigrationID: migration.ID,
+				Committed:   committed,
+				Total:       len(statements),
+				Statement:   m.redact(statement),
+				AtomicDDL:   m.atomicDDL,
+				Err:         err,
+			}
+		}
+		if err != nil && detector != nil && detector.CommitsImplicitly(statement) && !m.atomicDDL {
+			return fmt.Errorf("Migration '%s' Failed at statement %d of %d, which isn't atomic on this server and may have been partly applied:\n%w", migration.ID, i+1, len(statements), err)
+		}
+		if err != nil {
+			return fmt.Errorf("Migration '%s' Failed at statement %d of %d:\n%w", migration.ID, i+1, len(statements), err)
+		}
+		if detector != nil && detector.CommitsImplicitly(statement) {
+			committed = i + 1
+		}
+	}
+	for _, change := range changes {
+		err := deferred.WaitForSchemaChange(ctx, tx, change)
+		if err != nil {
+			return fmt.Errorf("Migration '%s' Failed:\n%w", migration.ID, err)
+		}
+	}
+	return nil
+}
+
+// submitSchemaChange executes a statement which the dialect may defer,
+// returning the ID of the change it submitted, if any
+func (m Migrator) submitSchemaChange(ctx context.Context, tx *sql.Tx, statement string) (string, error) {
+	rows, err := m.query(ctx, tx, statement)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var id sql.NullString
+	if rows.Next() {
+		err = rows.Scan(&id)
+		if err != nil {
+			return "", err
+		}
+	}
+	return id.String, rows.Err()
+}
+
+// validateStatements checks every statement of the planned migrations with
+// the dialect's StatementValidator, so that none run if any would fail
+func (m Migrator) validateStatements(plan []*Migration) error {
+	validator, ok := m.Dialect.(StatementValidator)
+	if !ok {
+		return nil
+	}
+	for _, migration := range plan {
+		if !m.appliesToDialect(migration) {
+			continue
+		}
+		script, err := m.renderScript(migration)
+		if err != nil {
+			return err
+		}
+		for _, statement := range m.statements(script) {
+			err = validator.ValidateStatement(statement)
+			if err != nil {
+				return fmt.Errorf("Migration '%s' Failed:\n%w: %s", migration.ID, err, m.redact(statement))
+			}
+		}
+	}
+	return nil
+}
+
+// executeExternally executes the migration's script with the dialect's
+// ExternalExecutor
+func (m Migrator) executeExternally(ctx context.Context, migration *Migration) error {
+	executor, ok := m.Dialect.(ExternalExecutor)
+	if !ok {
+		return fmt.Errorf("Migration '%s' Failed:\n%w", migration.ID, ErrExternalNotSupported)
+	}
+	script, err := m.renderScript(migration)
+	if err != nil {
+		return err
+	}
+	err = executor.ExecuteExternally(ctx, script)
+	if err != nil {
+		return fmt.Errorf("Migration '%s' Failed:\n%w", migration.ID, err)
+	}
+	return nil
+}
+
+// verifyMigration runs the migration's Verify query and returns
+// ErrVerificationFailed if it produced a falsy result
+func (m Migrator) verifyMigration(ctx context.Context, tx *sql.Tx, migration *Migration) error {
+	value, found, err := m.queryFirstValue(ctx, tx, migration.Verify)
+	if err != nil {
+		return fmt.Errorf("Migration '%s' Verify query failed:\n%w", migration.ID, err)
+	}
+	if found && !isTruthy(value) {
+		return fmt.Errorf("Migration '%s' Failed:\n%w", migration.ID, ErrVerificationFailed)
+	}
+	return nil
+}
+
+// checkConditions checks the migration's Dialects, and runs its OnlyIf and
+// Precondition queries. It returns whether the migration should be skipped and the reason why, or
+// ErrPreconditionFailed if the precondition failed and the migration isn't
+// configured to skip.
+func (m Migrator) checkConditions(ctx context.Context, tx *sql.Tx, migration *Migration) (skip bool, reason string, err error) {
+	if !m.appliesToDialect(migration) {
+		return true, fmt.Sprintf("it only applies to %s", strings.Join(migration.Dialects, ", ")), nil
+	}
+	if migration.OnlyIf != "" {
+		value, found, err := m.queryFirstValue(ctx, tx, migration.OnlyIf)
+		if err != nil {
+			return false, "", fmt.Errorf("Migration '%s' OnlyIf query failed:\n%w", migration.ID, err)
+		}
+		if !found || !isTruthy(value) {
+			return true, "its OnlyIf condition was false", nil
+		}
+	}
+	if migration.Precondition != "" {
+		skip, err = m.checkPrecondition(ctx, tx, migration)
+		return skip, "its precondition failed", err
+	}
+	return false, "", nil
+}
+
+// checkPrecondition runs the migration's Precondition query. It returns
+// whether the migration should be skipped, or ErrPreconditionFailed if the
+// precondition failed and the migration isn't configured to skip.
+func (m Migrator) checkPrecondition(ctx context.Context, tx *sql.Tx, migration *Migration) (skip bool, err error) {
+	value, found, err := m.queryFirstValue(ctx, tx, migration.Precondition)
+	if err != nil {
+		return false, fmt.Errorf("Migration '%s' Precondition query failed:\n%w", migration.ID, err)
+	}
+	if found && isTruthy(value) {
+		return false, nil
+	}
+	if migration.OnPreconditionFail == PreconditionSkip {
+		return true, nil
+	}
+	return false, fmt.Errorf("Migration '%s' Failed:\n%w", migration.ID, ErrPreconditionFailed)
+}
+
+// queryFirstValue runs the query and returns the first column of its first
+// row, and whether there was a row at all
+func (m Migrator) queryFirstValue(ctx context.Context, db QueryerContext, query string) (value interface{}, found bool, err error) {
+	rows, err := m.query(ctx, db, query)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, false, rows.Err()
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(columns) == 0 {
+		return nil, true, nil
+	}
+	values := make([]interface{}, len(columns))
+	for i := range values {
+		values[i] = new(interface{})
+	}
+	err = rows.Scan(values...)
+	if err != nil {
+		return nil, false, err
+	}
+	return *(values[0].(*interface{})), true, nil
+}
+
+// isTruthy interprets a value scanned from a database driver as a boolean.
+// NULL, false, zero and the common textual spellings of false are falsy.
+func isTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	case []byte:
+		return isTruthy(string(v))
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "", "0", "f", "false", "n", "no":
+			return false
+		}
+		return true
+	default:
+		return true
+	}
 }
 
 func (m Migrator) log(msgs ...interface{}) {
 	if m.Logger != nil {
-		m.Logger.Print(msgs...)
+		m.Logger.Print(m.redactMessage(msgs)...)
 	}
 }
@@ -0,0 +1,102 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Module is an independent set of migrations, such as those of one part of a
+// modular application (core, billing, analytics), tracked in a table of its
+// own so that its migration IDs needn't be unique across modules
+type Module struct {
+	// Name identifies the module in errors, and names its tracking table
+	// when TableName is empty
+	Name string
+
+	// TableName is the name of the module's tracking table. It defaults to
+	// the Migrator's TableName followed by "_" and the module's Name.
+	TableName string
+
+	Migrations []*Migration
+}
+
+// heldLocker is the Locker of the Migrators which ApplyModules runs while it
+// holds the lock itself
+type heldLocker struct{}
+
+func (heldLocker) Lock(db *sql.DB) error   { return nil }
+func (heldLocker) Unlock(db *sql.DB) error { return nil }
+
+// ApplyModules applies the migrations of each module in the order the
+// modules are given, each tracked in its own table, under a single lock
+// taken with the Migrator's tracking table. Every instance should apply the
+// modules this way, since Apply with a module's table would take a different
+// lock. A failed module stops the run, leaving the modules after it
+// unapplied. The Migrator's signature covers the migrations of every
+// module. Its pre-run and post-run scripts aren't run, since they would run
+// once per module, while materialized views are refreshed after the module
+// which runs their migrations, and the set checksum is recorded in each
+// module's own table.
+func (m Migrator) ApplyModules(ctx context.Context, db *sql.DB, modules []*Module) (err error) {
+	if db == nil {
+		return ErrNilDB
+	}
+	tables := make([]string, len(modules))
+	seen := make(map[string]string)
+	for i, module := range modules {
+		if module.Name == "" {
+			return fmt.Errorf("Module %d has no name", i+1)
+		}
+		tables[i] = module.TableName
+		if tables[i] == "" {
+			tables[i] = m.TableName + "_" + module.Name
+		}
+		if other, exists := seen[tables[i]]; exists {
+			return fmt.Errorf("Modules '%s' and '%s' both use the tracking table '%s'", other, module.Name, tables[i])
+		}
+		seen[tables[i]] = module.Name
+	}
+
+	if m.SigningKey != nil {
+		all := make([]*Migration, 0)
+		for _, module := range modules {
+			all = append(all, module.Migrations...)
+		}
+		err = VerifyMigrations(m.SigningKey, all, m.Signature)
+		if err != nil {
+			return err
+		}
+	}
+
+	// SQL locks are held by the connection which took them, which must be
+	// kept until every module has been applied
+	var conn *sql.Conn
+	if _, ok := m.locker().(SQLLocker); ok {
+		conn, err = db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer m.releaseConn(conn, &err)
+	}
+	err = m.lock(ctx, db, conn)
+	if err != nil {
+		return err
+	}
+	defer m.unlockOnReturn(db, conn, &err)
+
+	for i, module := range modules {
+		migrator := m
+		migrator.TableName = tables[i]
+		migrator.Locker = heldLocker{}
+		migrator.SigningKey = nil
+		migrator.Signature = ""
+		migrator.PreRunScript = nil
+		migrator.PostRunScript = nil
+		err = migrator.ApplyContext(ctx, db, module.Migrations)
+		if err != nil {
+			return fmt.Errorf("Module '%s' Failed:\n%w", module.Name, err)
+		}
+	}
+	return nil
+}
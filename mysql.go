@@ -0,0 +1,441 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MySQL is the dialect for MySQL-compatible databases. MySQL commits
+// implicitly before and after most DDL statements, so the dialect reports no
+// transactional DDL support: each migration is committed separately and its
+// script is executed one statement at a time.
+var MySQL = mysqlDialect{}
+
+var _ Updater = (*mysqlDialect)(nil)
+var _ ScriptGenerator = (*mysqlDialect)(nil)
+var _ SQLLocker = (*mysqlDialect)(nil)
+var _ CapabilityReporter = (*mysqlDialect)(nil)
+var _ CapabilityDetector = (*mysqlDialect)(nil)
+var _ StatementSplitter = (*mysqlDialect)(nil)
+var _ ImplicitCommitDetector = (*mysqlDialect)(nil)
+var _ ExternalExecutor = (*mysqlDialect)(nil)
+var _ Explainer = (*mysqlDialect)(nil)
+var _ ReplicaDetector = (*mysqlDialect)(nil)
+var _ VersionReporter = (*mysqlDialect)(nil)
+var _ BuildRecorder = (*mysqlDialect)(nil)
+var _ ScriptRecorder = (*mysqlDialect)(nil)
+var _ SetRecorder = (*mysqlDialect)(nil)
+var _ HistoryPruner = (*mysqlDialect)(nil)
+var _ Introspector = (*mysqlDialect)(nil)
+var _ Maintainer = (*mysqlDialect)(nil)
+var _ ObjectCommenter = (*mysqlDialect)(nil)
+var _ LockHolderReporter = (*mysqlDialect)(nil)
+var _ SessionConfigurer = (*mysqlDialect)(nil)
+var _ StatementValidator = (*mysqlDialect)(nil)
+var _ SeedInserter = (*mysqlDialect)(nil)
+var _ DeferredSchemaChanger = (*mysqlDialect)(nil)
+
+// mysqlDialect is the MySQL dialect
+type mysqlDialect struct {
+	onlineSchemaChange *OnlineSchemaChange
+	vitess             *vitessMode
+}
+
+// NewMySQL creates a new MySQL dialect. Customize it with the
+// WithMySQL... options.
+func NewMySQL(opts ...func(m *mysqlDialect)) mysqlDialect {
+	m := mysqlDialect{}
+	for _, opt := range opts {
+		opt(&m)
+	}
+	return m
+}
+
+// WithMySQLOnlineSchemaChange executes migrations marked External with an
+// online schema change tool such as gh-ost or pt-online-schema-change
+func WithMySQLOnlineSchemaChange(osc OnlineSchemaChange) func(m *mysqlDialect) {
+	return func(m *mysqlDialect) {
+		m.onlineSchemaChange = &osc
+	}
+}
+
+// ExecuteExternally runs the script's ALTER TABLE statements with the online
+// schema change tool, returning ErrExternalNotSupported if none is configured
+func (m mysqlDialect) ExecuteExternally(ctx context.Context, script string) error {
+	if m.onlineSchemaChange == nil {
+		return ErrExternalNotSupported
+	}
+	return m.onlineSchemaChange.Execute(ctx, script)
+}
+
+// LockSQL returns a GET_LOCK statement which waits indefinitely for a lock
+// named after the database and the tracking table
+func (m mysqlDialect) LockSQL(tableName string) string {
+	return fmt.Sprintf(`SELECT GET_LOCK(%s, -1)`, m.lockName(tableName))
+}
+
+// UnlockSQL returns the RELEASE_LOCK statement matching LockSQL
+func (m mysqlDialect) UnlockSQL(tableName string) string {
+	return fmt.Sprintf(`SELECT RELEASE_LOCK(%s)`, m.lockName(tableName))
+}
+
+// LockHolderSQL returns the connection holding the GET_LOCK lock taken by
+// LockSQL. MySQL doesn't record application names or connection times.
+func (m mysqlDialect) LockHolderSQL(tableName string) string {
+	return fmt.Sprintf(`
+		SELECT ID, NULL, CONCAT(USER, '@', HOST), NULL
+		FROM information_schema.PROCESSLIST
+		WHERE ID = IS_USED_LOCK(%s)
+	`, m.lockName(tableName))
+}
+
+// Capabilities reports that MySQL doesn't support transactional DDL, nor,
+// without knowing the server version, atomic DDL
+func (m mysqlDialect) Capabilities() Capabilities {
+	return Capabilities{
+		TransactionalDDL: false,
+		LockStrategy:     LockStrategyAdvisory,
+	}
+}
+
+// DetectCapabilities reports atomic DDL for MySQL 8.0 and later, and for
+// MariaDB 10.6 and later, whose versions look like "10.6.4-MariaDB"
+func (m mysqlDialect) DetectCapabilities(serverVersion string) Capabilities {
+	caps := m.Capabilities()
+	atomicSince := "8.0"
+	if strings.Contains(strings.ToLower(serverVersion), "mariadb") {
+		atomicSince = "10.6"
+	}
+	older, err := versionOlder(serverVersion, atomicSince)
+	caps.AtomicDDL = err == nil && !older
+	return caps
+}
+
+// CreateSQL takes the name of the migration tracking table and
+// returns the SQL statement needed to create it
+func (m mysqlDialect) CreateSQL(tableName string) string {
+	return fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id VARCHAR(255) NOT NULL,
+			checksum VARCHAR(32) NOT NULL DEFAULT '',
+			execution_time_in_millis INTEGER NOT NULL DEFAULT 0,
+			applied_at DATETIME(6) NOT NULL
+		)`, tableName)
+}
+
+// CreateBuildsSQL takes the name of the build metadata table and returns
+// the SQL statement needed to create it
+func (m mysqlDialect) CreateBuildsSQL(tableName string) string {
+	return fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id VARCHAR(255) NOT NULL,
+			build VARCHAR(1024) NOT NULL,
+			applied_at DATETIME(6) NOT NULL
+		)`, tableName)
+}
+
+// InsertBuildSQL takes the name of the build metadata table and returns
+// the SQL statement needed to record the build which applied a migration
+func (m mysqlDialect) InsertBuildSQL(tableName string) string {
+	return fmt.Sprintf(`INSERT INTO %s ( id, build, applied_at ) VALUES ( ?, ?, ? )`, tableName)
+}
+
+// CreateScriptsSQL takes the name of the scripts table and returns the SQL
+// statement needed to create it
+func (m mysqlDialect) CreateScriptsSQL(tableName string) string {
+	return fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id VARCHAR(255) NOT NULL,
+			script LONGBLOB NOT NULL,
+			applied_at DATETIME(6) NOT NULL
+		)`, tableName)
+}
+
+// InsertScriptSQL takes the name of the scripts table and returns the SQL
+// statement needed to store the script of an applied migration
+func (m mysqlDialect) InsertScriptSQL(tableName string) string {
+	return fmt.Sprintf(`INSERT INTO %s ( id, script, applied_at ) VALUES ( ?, ?, ? )`, tableName)
+}
+
+// CreateSetSQL takes the name of the set table and returns the SQL
+// statement needed to create it
+func (m mysqlDialect) CreateSetSQL(tableName string) string {
+	return fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			checksum VARCHAR(64) NOT NULL,
+			migrations INT NOT NULL,
+			applied_at DATETIME(6) NOT NULL
+		)`, tableName)
+}
+
+// InsertSetSQL takes the name of the set table and returns the SQL
+// statement needed to store the checksum of an applied migration set
+func (m mysqlDialect) InsertSetSQL(tableName string) string {
+	return fmt.Sprintf(`INSERT INTO %s ( checksum, migrations, applied_at ) VALUES ( ?, ?, ? )`, tableName)
+}
+
+// DeleteSQL takes the name of the tracking table, or a table next to it,
+// and returns the SQL statement needed to delete the rows of a migration
+func (m mysqlDialect) DeleteSQL(tableName string) string {
+	return fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, tableName)
+}
+
+// InsertSQL takes the name of the migration tracking table and
+// returns the SQL statement needed to insert a migration into it
+func (m mysqlDialect) InsertSQL(tableName string) string {
+	return fmt.Sprintf(`
+		INSERT INTO %s
+		( id, checksum, execution_time_in_millis, applied_at )
+		VALUES
+		( ?, ?, ?, ? )
+		`, tableName)
+}
+
+// UpdateSQL takes the name of the migration tracking table and
+// returns the SQL statement needed to refresh the record of a migration
+// which has been run again. MySQL has no numbered placeholders, so the
+// statement is written to take the InsertSQL arguments in the same order.
+func (m mysqlDialect) UpdateSQL(tableName string) string {
+	return fmt.Sprintf(`
+		UPDATE %s AS t
+		JOIN (SELECT ? AS id, ? AS checksum, ? AS execution_time_in_millis, ? AS applied_at) AS v
+		ON t.id = v.id
+		SET t.checksum = v.checksum,
+			t.execution_time_in_millis = v.execution_time_in_millis,
+			t.applied_at = v.applied_at
+		`, tableName)
+}
+
+// SelectSQL takes the name of the migration tracking table and
+// returns the SQL statement to retrieve all records from it
+func (m mysqlDialect) SelectSQL(tableName string) string {
+	return fmt.Sprintf(`
+		SELECT id, checksum, execution_time_in_millis, applied_at
+		FROM %s
+		ORDER BY id ASC
+	`, tableName)
+}
+
+// AnalyzeSQL returns an ANALYZE TABLE statement for the table
+func (m mysqlDialect) AnalyzeSQL(tableName string) string {
+	return "ANALYZE TABLE " + tableName
+}
+
+// CommentTableSQL returns an ALTER TABLE statement which sets the table's
+// comment
+func (m mysqlDialect) CommentTableSQL(tableName, comment string) string {
+	return fmt.Sprintf("ALTER TABLE %s COMMENT = %s", tableName, mysqlLiteral(comment))
+}
+
+// SeedSQL returns a multi-row INSERT, which skips conflicting rows by
+// updating their first column to itself. Unlike INSERT IGNORE, it doesn't
+// also ignore other errors, such as values which don't fit their columns.
+func (m mysqlDialect) SeedSQL(table string, columns []string, rows int, ignoreConflicts bool) string {
+	statement := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, strings.Join(columns, ", "), seedValues(len(columns), rows, func(int) string {
+		return "?"
+	}))
+	if ignoreConflicts && len(columns) > 0 {
+		statement += fmt.Sprintf(" ON DUPLICATE KEY UPDATE %s = %s", columns[0], columns[0])
+	}
+	return statement
+}
+
+// BeginSQL returns the statement which begins a transaction in a script
+// written by GenerateSQL
+func (m mysqlDialect) BeginSQL() string {
+	return "START TRANSACTION"
+}
+
+// CommitSQL returns the statement which commits a transaction in a script
+// written by GenerateSQL
+func (m mysqlDialect) CommitSQL() string {
+	return "COMMIT"
+}
+
+// LiteralSQL quotes the value as a literal, escaping backslashes
+func (m mysqlDialect) LiteralSQL(value string) string {
+	return mysqlLiteral(value)
+}
+
+// TerminateSQL ends the statement with a semicolon
+func (m mysqlDialect) TerminateSQL(statement string) string {
+	return terminated(statement)
+}
+
+// mysqlLiteral renders a string as a single-quoted literal with backslashes
+// escaped too, since MySQL treats them as escape characters by default
+func mysqlLiteral(value string) string {
+	return quotedLiteral(strings.ReplaceAll(value, `\`, `\\`))
+}
+
+// CommentIndexSQL returns an empty statement, since MySQL can only comment
+// an index by recreating it
+func (m mysqlDialect) CommentIndexSQL(indexName, tableName, comment string) string {
+	return ""
+}
+
+// VacuumSQL returns an OPTIMIZE TABLE statement, which rebuilds the table
+// to reclaim space
+func (m mysqlDialect) VacuumSQL(tableName string) string {
+	return "OPTIMIZE TABLE " + tableName
+}
+
+// Name returns "mysql", which selects MySQL script variants
+func (m mysqlDialect) Name() string {
+	return "mysql"
+}
+
+// ReplicaSQL returns a query which is true while the server is read-only,
+// as replicas are (super_read_only also enables read_only)
+func (m mysqlDialect) ReplicaSQL() string {
+	return "SELECT @@global.read_only"
+}
+
+// VersionSQL returns a query for the server version
+func (m mysqlDialect) VersionSQL() string {
+	return "SELECT VERSION()"
+}
+
+// QuotedTableName returns the string value of the name of the migration
+// tracking table after it has been quoted for MySQL
+func (m mysqlDialect) QuotedTableName(schemaName, tableName string) string {
+	if schemaName == "" {
+		return m.quotedIdent(tableName)
+	}
+	return m.quotedIdent(schemaName) + "." + m.quotedIdent(tableName)
+}
+
+// MaxIdentifierLength returns 64, the longest table name MySQL allows
+func (m mysqlDialect) MaxIdentifierLength() int {
+	return 64
+}
+
+// SplitStatements splits a migration script into its statements so that
+// they can be executed (and their progress reported) one at a time
+func (m mysqlDialect) SplitStatements(script string) []string {
+	return splitStatements(script)
+}
+
+// mysqlImplicitCommitKeywords are the leading keywords of statements which
+// cause an implicit commit in MySQL
+var mysqlImplicitCommitKeywords = []string{
+	"ALTER", "CREATE", "DROP", "RENAME", "TRUNCATE", "GRANT", "REVOKE",
+	"LOCK TABLES", "UNLOCK TABLES", "ANALYZE TABLE", "OPTIMIZE TABLE",
+	"REPAIR TABLE", "CHECK TABLE", "INSTALL PLUGIN", "UNINSTALL PLUGIN",
+	"SET PASSWORD", "LOAD DATA",
+}
+
+// CommitsImplicitly returns whether MySQL commits the current transaction
+// when executing the statement. Temporary tables are the exception to the
+// DDL rule.
+func (m mysqlDialect) CommitsImplicitly(statement string) bool {
+	words := strings.Fields(strings.ToUpper(stripLeadingComments(statement)))
+	if len(words) == 0 {
+		return false
+	}
+	if len(words) > 1 && words[1] == "TEMPORARY" {
+		return false
+	}
+	for _, keyword := range mysqlImplicitCommitKeywords {
+		keywords := strings.Fields(keyword)
+		if len(words) >= len(keywords) && strings.Join(words[:len(keywords)], " ") == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// quotedIdent wraps the supplied string in the MySQL identifier
+// quote character
+func (m mysqlDialect) quotedIdent(ident string) string {
+	return "`" + strings.ReplaceAll(ident, "`", "") + "`"
+}
+
+// lockName returns an expression for a lock name specific to the database
+// and the tracking table, which fits within the 64 character limit MySQL
+// places on GET_LOCK names. GET_LOCK locks are server-wide, so the database
+// is included (the current one, when the table isn't qualified with one)
+// for databases on the same server not to block each other's migrations.
+func (m mysqlDialect) lockName(tableName string) string {
+	database := "IFNULL(DATABASE(), '')"
+	table := strings.Trim(tableName, "`")
+	if parts := strings.SplitN(table, "`.`", 2); len(parts) == 2 {
+		database, table = mysqlLiteral(parts[0]), parts[1]
+	}
+	return fmt.Sprintf("CONCAT('schema_migrations_', LEFT(SHA2(CONCAT(%s, '.', %s), 256), 40))", database, mysqlLiteral(table))
+}
+
+// ExplainSQL returns an EXPLAIN statement with JSON output
+func (m mysqlDialect) ExplainSQL(statement string) string {
+	return "EXPLAIN FORMAT=JSON " + statement
+}
+
+// ParseExplain reads the query cost and the rows examined by the first
+// table of the query block. MySQL doesn't report a cost for every kind of
+// statement, in which case the cost is zero.
+func (m mysqlDialect) ParseExplain(output string) (cost float64, rows float64, err error) {
+	var explain struct {
+		QueryBlock struct {
+			CostInfo struct {
+				QueryCost string `json:"query_cost"`
+			} `json:"cost_info"`
+			Table struct {
+				RowsExaminedPerScan float64 `json:"rows_examined_per_scan"`
+			} `json:"table"`
+		} `json:"query_block"`
+	}
+	err = json.Unmarshal([]byte(output), &explain)
+	if err != nil {
+		return 0, 0, err
+	}
+	if explain.QueryBlock.CostInfo.QueryCost != "" {
+		cost, err = strconv.ParseFloat(explain.QueryBlock.CostInfo.QueryCost, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return cost, explain.QueryBlock.Table.RowsExaminedPerScan, nil
+}
+
+// TablesSQL returns a query for the names of the tables in the database
+func (m mysqlDialect) TablesSQL(schemaName string) string {
+	return fmt.Sprintf(`
+		SELECT table_name
+		FROM information_schema.tables
+		WHERE table_schema = %s AND table_type = 'BASE TABLE'
+		ORDER BY table_name
+	`, m.schemaExpr(schemaName))
+}
+
+// ColumnsSQL returns a query for the columns of the tables in the database
+func (m mysqlDialect) ColumnsSQL(schemaName string) string {
+	return fmt.Sprintf(`
+		SELECT table_name, column_name, column_type, is_nullable = 'YES', column_default
+		FROM information_schema.columns
+		WHERE table_schema = %s
+		ORDER BY table_name, ordinal_position
+	`, m.schemaExpr(schemaName))
+}
+
+// IndexesSQL returns a query for the indexed columns of the tables in the
+// database
+func (m mysqlDialect) IndexesSQL(schemaName string) string {
+	return fmt.Sprintf(`
+		SELECT table_name, index_name, non_unique = 0, column_name
+		FROM information_schema.statistics
+		WHERE table_schema = %s
+		ORDER BY table_name, index_name, seq_in_index
+	`, m.schemaExpr(schemaName))
+}
+
+// schemaExpr returns the database name as a string literal, or the current
+// database when it is empty
+func (m mysqlDialect) schemaExpr(schemaName string) string {
+	if schemaName == "" {
+		return "DATABASE()"
+	}
+	return mysqlLiteral(schemaName)
+}
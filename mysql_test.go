@@ -0,0 +1,255 @@
+package schema
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMySQLLockSQL(t *testing.T) {
+	name := MySQL.QuotedTableName("", "schema_migrations")
+	expected := "SELECT GET_LOCK(CONCAT('schema_migrations_', LEFT(SHA2(CONCAT(IFNULL(DATABASE(), ''), '.', 'schema_migrations'), 256), 40)), -1)"
+	if sql := MySQL.LockSQL(name); sql != expected {
+		t.Errorf("Expected a lock on the current database's table:\n%s", sql)
+	}
+	qualified := MySQL.LockSQL(MySQL.QuotedTableName("app", "schema_migrations"))
+	if !strings.Contains(qualified, "CONCAT('app', '.', 'schema_migrations')") {
+		t.Errorf("Expected a lock on the named database's table:\n%s", qualified)
+	}
+}
+
+func TestMySQLLockHolderSQL(t *testing.T) {
+	name := MySQL.QuotedTableName("", "schema_migrations")
+	sql := MySQL.LockHolderSQL(name)
+	if !strings.Contains(sql, fmt.Sprintf("IS_USED_LOCK(%s)", MySQL.lockName(name))) {
+		t.Errorf("EXPECTED IS_USED_LOCK of the migration lock:\n%s", sql)
+	}
+}
+
+func TestMySQLQuotedTableName(t *testing.T) {
+	if name := MySQL.QuotedTableName("app", "schema`migrations"); name != "`app`.`schemamigrations`" {
+		t.Errorf("Unexpected quoted table name: %s", name)
+	}
+}
+
+func TestMySQLCommitsImplicitly(t *testing.T) {
+	implicit := []string{
+		"CREATE TABLE users (id INTEGER)",
+		"-- comment\nalter table users add column name TEXT",
+		"DROP INDEX idx ON users",
+		"LOCK TABLES users WRITE",
+	}
+	for _, statement := range implicit {
+		if !MySQL.CommitsImplicitly(statement) {
+			t.Errorf("Expected implicit commit for %q", statement)
+		}
+	}
+	transactional := []string{
+		"INSERT INTO users (id) VALUES (1)",
+		"UPDATE users SET name = 'CREATE'",
+		"CREATE TEMPORARY TABLE scratch (id INTEGER)",
+		"LOCK IN SHARE MODE",
+	}
+	for _, statement := range transactional {
+		if MySQL.CommitsImplicitly(statement) {
+			t.Errorf("Expected no implicit commit for %q", statement)
+		}
+	}
+}
+
+func TestMySQLCapabilities(t *testing.T) {
+	if MySQL.Capabilities().TransactionalDDL {
+		t.Error("Expected MySQL to report no transactional DDL")
+	}
+}
+
+func TestMySQLOnlineSchemaChange(t *testing.T) {
+	var output bytes.Buffer
+	dialect := NewMySQL(WithMySQLOnlineSchemaChange(OnlineSchemaChange{
+		Command:   []string{"echo", "--database={{.Database}}", "--table={{.Table}}", "--alter={{.Alter}}", "# Done"},
+		Database:  "app",
+		Completed: regexp.MustCompile(`# Done`),
+		Output:    &output,
+	}))
+
+	script := "ALTER TABLE users ADD COLUMN name TEXT;\n-- reporting\nALTER TABLE `reports`.`daily totals` DROP COLUMN legacy"
+	if err := dialect.ExecuteExternally(context.Background(), script); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"--database=app --table=users --alter=ADD COLUMN name TEXT # Done",
+		"--database=reports --table=daily totals --alter=DROP COLUMN legacy # Done",
+	}
+	if out := strings.TrimSpace(output.String()); out != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected tool invocations:\n%s", out)
+	}
+
+	if err := dialect.ExecuteExternally(context.Background(), "UPDATE users SET name = ''"); err == nil {
+		t.Error("Expected statements other than ALTER TABLE to be rejected")
+	}
+	if err := MySQL.ExecuteExternally(context.Background(), script); err != ErrExternalNotSupported {
+		t.Errorf("Expected ErrExternalNotSupported without a tool. Got %v", err)
+	}
+
+	incomplete := NewMySQL(WithMySQLOnlineSchemaChange(OnlineSchemaChange{
+		Command:   []string{"echo", "still running"},
+		Completed: regexp.MustCompile(`# Done`),
+	}))
+	if err := incomplete.ExecuteExternally(context.Background(), script); err == nil {
+		t.Error("Expected an error when the tool doesn't report completion")
+	}
+}
+
+func TestMySQLParseExplain(t *testing.T) {
+	output := `{"query_block": {"select_id": 1, "cost_info": {"query_cost": "102.45"}, "table": {"table_name": "users", "rows_examined_per_scan": 1000}}}`
+	cost, rows, err := MySQL.ParseExplain(output)
+	if err != nil || cost != 102.45 || rows != 1000 {
+		t.Errorf("Unexpected estimate %v, %v (%v)", cost, rows, err)
+	}
+}
+
+func TestMySQLVitess(t *testing.T) {
+	if statements := MySQL.SessionSQL(); len(statements) != 0 {
+		t.Errorf("Expected no session statements without Vitess. Got %v", statements)
+	}
+	if MySQL.DefersSchemaChange("ALTER TABLE users ADD COLUMN name TEXT") {
+		t.Error("Expected no deferred changes without Vitess")
+	}
+
+	dialect := NewMySQL(WithMySQLVitess("vitess", time.Second))
+	if statements := dialect.SessionSQL(); len(statements) != 1 || statements[0] != "SET @@ddl_strategy = 'vitess'" {
+		t.Errorf("Unexpected session statements: %v", statements)
+	}
+	if !dialect.DefersSchemaChange("-- comment\nalter table users add column name TEXT") {
+		t.Error("Expected ALTER TABLE to be deferred")
+	}
+	if dialect.DefersSchemaChange("INSERT INTO users (id) VALUES (1)") {
+		t.Error("Expected INSERT not to be deferred")
+	}
+	if NewMySQL(WithMySQLVitess("direct", time.Second)).DefersSchemaChange("ALTER TABLE users ADD COLUMN name TEXT") {
+		t.Error("Expected the direct strategy not to defer changes")
+	}
+
+	foreignKeys := []string{
+		"CREATE TABLE posts (id INT, user_id INT REFERENCES users (id))",
+		"ALTER TABLE posts ADD CONSTRAINT posts_user FOREIGN KEY (user_id) REFERENCES users (id)",
+		"create table posts (id int, foreign key(user_id) references users(id))",
+	}
+	for _, statement := range foreignKeys {
+		if err := dialect.ValidateStatement(statement); !errors.Is(err, ErrForeignKeysNotSupported) {
+			t.Errorf("Expected ErrForeignKeysNotSupported for %q. Got %v", statement, err)
+		}
+		if err := MySQL.ValidateStatement(statement); err != nil {
+			t.Errorf("Expected foreign keys without Vitess. Got %v", err)
+		}
+	}
+	if err := dialect.ValidateStatement("UPDATE users SET note = 'REFERENCES'"); err != nil {
+		t.Errorf("Expected DML to be valid. Got %v", err)
+	}
+
+	migrator := NewMigrator(WithDialect(dialect))
+	err := migrator.validateStatements([]*Migration{
+		{ID: "2021-01-01 Users", Script: "CREATE TABLE users (id INT PRIMARY KEY)"},
+		{ID: "2021-01-02 Posts", Script: "CREATE TABLE posts (id INT, user_id INT REFERENCES users (id))"},
+	})
+	if !errors.Is(err, ErrForeignKeysNotSupported) || !strings.Contains(err.Error(), "2021-01-02 Posts") {
+		t.Errorf("Expected the Posts migration to be rejected. Got %v", err)
+	}
+}
+
+func TestMySQLDetectCapabilities(t *testing.T) {
+	cases := map[string]bool{
+		"5.7.33-log":       false,
+		"8.0.23":           true,
+		"8.0.30-Vitess":    true,
+		"10.5.9-MariaDB":   false,
+		"10.6.4-MariaDB-1": true,
+		"unknown":          false,
+	}
+	for version, atomic := range cases {
+		caps := MySQL.DetectCapabilities(version)
+		if caps.AtomicDDL != atomic || caps.TransactionalDDL {
+			t.Errorf("%s: Expected atomic DDL to be %t, without transactional DDL. Got %+v", version, atomic, caps)
+		}
+	}
+}
+
+func TestMySQL8Apply(t *testing.T) {
+	db := connectDB(t, "mysql8")
+	tableName := fmt.Sprintf("mysql_migrations_%d", rand.Int())
+	migrator := NewMigrator(WithDialect(MySQL), WithTableName(tableName))
+	migrations := []*Migration{
+		{
+			ID:     "2021-01-01 Users",
+			Script: fmt.Sprintf("CREATE TABLE %s_users (id INTEGER NOT NULL PRIMARY KEY); CREATE INDEX %[1]s_users_id ON %[1]s_users (id)", tableName),
+		},
+		{
+			ID:     "2021-01-02 Refresh",
+			Script: fmt.Sprintf("INSERT INTO %s_users (id) SELECT COUNT(*) + 1 FROM %[1]s_users u", tableName),
+			Always: true,
+		},
+	}
+	for i := 0; i < 2; i++ {
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	applied, err := migrator.GetAppliedMigrations(db)
+	if err != nil || len(applied) != 2 {
+		t.Errorf("Expected 2 applied migrations. Got %d (%v)", len(applied), err)
+	}
+	var count int
+	err = db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s_users", tableName)).Scan(&count)
+	if err != nil || count != 2 {
+		t.Errorf("Expected the Always migration to run on each Apply. Got %d rows (%v)", count, err)
+	}
+}
+
+func TestMySQL8LocksAreSpecificToTheDatabase(t *testing.T) {
+	db := connectDB(t, "mysql8")
+	database := fmt.Sprintf("schematests_%d", rand.Int())
+	if _, err := db.Exec("CREATE DATABASE " + database); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _, _ = db.Exec("DROP DATABASE " + database) }()
+	other, err := sql.Open("mysql", strings.Replace(DBConns["mysql8"].DSN, "/schematests", "/"+database, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = other.Close() }()
+
+	// Hold the lock on the default database's tracking table
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	tableName := MySQL.QuotedTableName("", "schema_migrations")
+	if _, err = conn.ExecContext(ctx, MySQL.LockSQL(tableName)); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _, _ = conn.ExecContext(ctx, MySQL.UnlockSQL(tableName)) }()
+
+	migrations := []*Migration{
+		{ID: "2021-01-01 Users", Script: "CREATE TABLE users (id INTEGER)"},
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err = NewMigrator(WithDialect(MySQL)).ApplyContext(ctx, other, migrations); err != nil {
+		t.Errorf("Expected migrations on another database not to wait for the lock. Got %v", err)
+	}
+
+	holders, err := NewMigrator(WithDialect(MySQL)).LockHolders(ctx, db)
+	if err != nil || len(holders) != 1 {
+		t.Errorf("Expected the lock on the default database to be held once. Got %+v (%v)", holders, err)
+	}
+}
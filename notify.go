@@ -0,0 +1,140 @@
+package schema
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultWebhookTimeout bounds webhook requests made without a Client
+const defaultWebhookTimeout = 10 * time.Second
+
+// Notification describes the result of a run of Apply
+type Notification struct {
+	// Outcome is one of OutcomeApplied, OutcomeLockBusy or OutcomeFailed
+	Outcome string `json:"outcome"`
+	Table   string `json:"table"`
+	// Migrations lists the IDs of the planned migrations. When the run
+	// failed, some of them may not have been applied.
+	Migrations       []string `json:"migrations"`
+	Error            string   `json:"error,omitempty"`
+	DurationInMillis int64    `json:"duration_in_millis"`
+}
+
+// Summary returns a one-line description of the run, suitable for chat
+func (n *Notification) Summary() string {
+	duration := time.Duration(n.DurationInMillis) * time.Millisecond
+	switch n.Outcome {
+	case OutcomeApplied:
+		return fmt.Sprintf("Applied %d migration(s) to %s in %s: %s",
+			len(n.Migrations), n.Table, duration, strings.Join(n.Migrations, ", "))
+	case OutcomeLockBusy:
+		return fmt.Sprintf("Migrations to %s did not run, since another migrator held the lock: %s", n.Table, n.Error)
+	default:
+		return fmt.Sprintf("Migrations to %s failed after %s: %s", n.Table, duration, n.Error)
+	}
+}
+
+// Notifier is notified when a run of Apply completes or fails, such as to
+// post to a deploy channel. Runs with nothing to do aren't notified.
+type Notifier interface {
+	Notify(ctx context.Context, notification *Notification) error
+}
+
+// NotifierFunc adapts a function to the Notifier interface
+type NotifierFunc func(ctx context.Context, notification *Notification) error
+
+// Notify calls f
+func (f NotifierFunc) Notify(ctx context.Context, notification *Notification) error {
+	return f(ctx, notification)
+}
+
+// WebhookNotifier is a Notifier which POSTs each Notification to a URL. By
+// default the body is the Notification as JSON.
+type WebhookNotifier struct {
+	URL string
+	// Client defaults to an http.Client with a 10 second timeout
+	Client *http.Client
+	// Body, when set, builds the request body from the Notification
+	Body func(notification *Notification) ([]byte, error)
+}
+
+// NewSlackNotifier creates a WebhookNotifier for a Slack incoming webhook
+// URL, which posts the Notification's Summary as a message
+func NewSlackNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL: url,
+		Body: func(notification *Notification) ([]byte, error) {
+			return json.Marshal(map[string]string{"text": notification.Summary()})
+		},
+	}
+}
+
+// Notify POSTs the Notification to the webhook URL, returning an error if
+// the response status isn't 2xx
+func (w *WebhookNotifier) Notify(ctx context.Context, notification *Notification) error {
+	body, err := w.body(notification)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultWebhookTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+func (w *WebhookNotifier) body(notification *Notification) ([]byte, error) {
+	if w.Body != nil {
+		return w.Body(notification)
+	}
+	return json.Marshal(notification)
+}
+
+// notify sends the result of the run to the Migrator's Notifier. Failing to
+// notify doesn't fail the run, so the error is logged instead. A new context
+// is used, since the run may have failed because its context was cancelled.
+func (m Migrator) notify(run *applyRun, err error) {
+	if m.Notifier == nil || (err == nil && len(run.plan) == 0) {
+		return
+	}
+	outcome, _ := runOutcome(err, len(run.plan))
+	notification := &Notification{
+		Outcome:          outcome,
+		Table:            m.QuotedTableName(),
+		Migrations:       make([]string, 0, len(run.plan)),
+		DurationInMillis: time.Since(run.startedAt).Milliseconds(),
+	}
+	for _, migration := range run.plan {
+		notification.Migrations = append(notification.Migrations, migration.ID)
+	}
+	if err != nil {
+		notification.Error = err.Error()
+	}
+	notifyErr := m.Notifier.Notify(context.Background(), notification)
+	if notifyErr != nil {
+		m.log("Warning: notification failed: ", notifyErr)
+	}
+}
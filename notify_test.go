@@ -0,0 +1,51 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var received map[string]interface{}
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = nil
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	notification := &Notification{
+		Outcome:          OutcomeApplied,
+		Table:            `"schema_migrations"`,
+		Migrations:       []string{"2020-01-01 A", "2020-01-02 B"},
+		DurationInMillis: 1500,
+	}
+
+	err := (&WebhookNotifier{URL: server.URL}).Notify(context.Background(), notification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received["outcome"] != OutcomeApplied || len(received["migrations"].([]interface{})) != 2 {
+		t.Errorf("Unexpected webhook body: %v", received)
+	}
+
+	err = NewSlackNotifier(server.URL).Notify(context.Background(), notification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, _ := received["text"].(string)
+	if !strings.Contains(text, "Applied 2 migration(s)") || !strings.Contains(text, "2020-01-02 B") {
+		t.Errorf("Unexpected Slack message: %q", text)
+	}
+
+	status = http.StatusInternalServerError
+	err = NewSlackNotifier(server.URL).Notify(context.Background(), notification)
+	if err == nil {
+		t.Error("Expected an error for a failed webhook")
+	}
+}
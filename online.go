@@ -0,0 +1,157 @@
+package schema
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// ErrExternalNotSupported is returned when a migration marked External is
+// applied with a dialect which hasn't been configured to execute scripts
+// externally
+var ErrExternalNotSupported = errors.New("dialect is not configured to execute migrations externally")
+
+// OnlineSchemaChange runs ALTER TABLE statements through an external online
+// schema change tool, such as gh-ost or pt-online-schema-change, so that
+// large MySQL tables can be altered without blocking writes. The tool is run
+// once per ALTER TABLE statement in the migration's script. The migration is
+// still recorded in the tracking table, with its checksum and duration, once
+// the tool has completed.
+//
+// For gh-ost, Command might be:
+//
+//	[]string{"gh-ost", "--host=db", "--database={{.Database}}",
+//	  "--table={{.Table}}", "--alter={{.Alter}}", "--allow-on-master", "--execute"}
+//
+// For pt-online-schema-change:
+//
+//	[]string{"pt-online-schema-change", "--alter={{.Alter}}",
+//	  "D={{.Database}},t={{.Table}}", "--execute"}
+type OnlineSchemaChange struct {
+	// Command is the tool and its arguments. Each element is a text/template
+	// executed with the Database, Table and Alter of the statement. The
+	// command is executed directly rather than through a shell, so values
+	// don't need quoting.
+	Command []string
+
+	// Database is used for tables which aren't qualified with a database in
+	// the ALTER TABLE statement
+	Database string
+
+	// Completed, when set, must match the tool's combined output for the
+	// change to be considered complete, in addition to the tool exiting
+	// successfully. gh-ost, for example, prints "# Done" when it finishes.
+	Completed *regexp.Regexp
+
+	// Output, when set, receives the tool's combined output as it runs
+	Output io.Writer
+}
+
+// onlineAlter is the data available to OnlineSchemaChange command templates
+type onlineAlter struct {
+	Database string
+	Table    string
+	Alter    string
+}
+
+// alterTablePattern matches an ALTER TABLE statement, capturing the
+// optionally database-qualified table name and the alter specification
+var alterTablePattern = regexp.MustCompile("(?is)^ALTER\\s+TABLE\\s+((?:`[^`]+`|[\\w$]+)(?:\\.(?:`[^`]+`|[\\w$]+))?)\\s+(.+)$")
+
+// Execute runs the tool for each ALTER TABLE statement in the script. Any
+// other kind of statement is an error, since it can't be run by the tool.
+func (o OnlineSchemaChange) Execute(ctx context.Context, script string) error {
+	if len(o.Command) == 0 {
+		return ErrExternalNotSupported
+	}
+	alters, err := o.parse(script)
+	if err != nil {
+		return err
+	}
+	for _, alter := range alters {
+		err = o.run(ctx, alter)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parse splits the script into its ALTER TABLE statements
+func (o OnlineSchemaChange) parse(script string) ([]onlineAlter, error) {
+	alters := make([]onlineAlter, 0)
+	for _, statement := range genericSplitter.split(script) {
+		match := alterTablePattern.FindStringSubmatch(stripLeadingComments(statement))
+		if match == nil {
+			return nil, fmt.Errorf("Only ALTER TABLE statements can be run by an online schema change tool:\n%s", statement)
+		}
+		alter := onlineAlter{Database: o.Database, Alter: strings.TrimSpace(match[2])}
+		names := splitQualifiedName(match[1])
+		alter.Table = names[len(names)-1]
+		if len(names) == 2 {
+			alter.Database = names[0]
+		}
+		alters = append(alters, alter)
+	}
+	return alters, nil
+}
+
+// run executes the tool for a single ALTER TABLE statement
+func (o OnlineSchemaChange) run(ctx context.Context, alter onlineAlter) error {
+	args := make([]string, len(o.Command))
+	for i, arg := range o.Command {
+		tmpl, err := template.New("arg").Parse(arg)
+		if err != nil {
+			return err
+		}
+		var b strings.Builder
+		err = tmpl.Execute(&b, alter)
+		if err != nil {
+			return err
+		}
+		args[i] = b.String()
+	}
+
+	var output bytes.Buffer
+	var w io.Writer = &output
+	if o.Output != nil {
+		w = io.MultiWriter(&output, o.Output)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("Online schema change of '%s' failed:\n%w\n%s", alter.Table, err, output.String())
+	}
+	if o.Completed != nil && !o.Completed.Match(output.Bytes()) {
+		return fmt.Errorf("Online schema change of '%s' did not report completion:\n%s", alter.Table, output.String())
+	}
+	return nil
+}
+
+// splitQualifiedName splits a possibly database-qualified MySQL table name
+// into its unquoted parts
+func splitQualifiedName(name string) []string {
+	parts := make([]string, 0, 2)
+	for len(name) > 0 {
+		var part string
+		if name[0] == '`' {
+			end := strings.IndexByte(name[1:], '`') + 1
+			part, name = name[1:end], name[end+1:]
+		} else if dot := strings.IndexByte(name, '.'); dot >= 0 {
+			part, name = name[:dot], name[dot:]
+		} else {
+			part, name = name, ""
+		}
+		parts = append(parts, part)
+		name = strings.TrimPrefix(name, ".")
+	}
+	return parts
+}
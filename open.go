@@ -0,0 +1,112 @@
+package schema
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ErrUnknownDialect is returned when no dialect is known for a database
+// driver or registered with a name
+var ErrUnknownDialect = errors.New("no dialect is known for the database driver")
+
+// ErrDialectMismatch is returned by Open when the dialect supplied with
+// WithDialect doesn't match the database driver
+var ErrDialectMismatch = errors.New("dialect does not match the database driver")
+
+// driverDialects maps the registered names of common database/sql drivers
+// to their dialect names
+var driverDialects = map[string]string{
+	"postgres":  "postgres",
+	"pgx":       "postgres",
+	"cockroach": "postgres",
+	"mysql":     "mysql",
+	"sqlite3":   "sqlite",
+	"sqlite":    "sqlite",
+	"godror":    "oracle",
+	"oracle":    "oracle",
+	"oci8":      "oracle",
+}
+
+// driverPackageDialects maps the import paths of common driver packages,
+// whose types are returned by sql.DB's Driver method, to their dialect names
+var driverPackageDialects = map[string]string{
+	"github.com/lib/pq":              "postgres",
+	"github.com/jackc/pgx":           "postgres",
+	"github.com/go-sql-driver/mysql": "mysql",
+	"github.com/mattn/go-sqlite3":    "sqlite",
+	"modernc.org/sqlite":             "sqlite",
+	"github.com/godror/godror":       "oracle",
+	"github.com/sijms/go-ora":        "oracle",
+	"github.com/mattn/go-oci8":       "oracle",
+}
+
+// Open opens a database with sql.Open and returns it with a Migrator whose
+// dialect is chosen from the driver, so that WithDialect isn't needed. If
+// the options include WithDialect, it must match the driver or
+// ErrDialectMismatch is returned.
+// Usage: db, migrator, err := schema.Open("postgres", dsn, schema.WithTableName("my_migrations"))
+func Open(driverName, dsn string, opts ...Option) (*sql.DB, Migrator, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, Migrator{}, err
+	}
+	dialect, err := DialectForDriver(driverName)
+	if err != nil {
+		dialect, err = DetectDialect(db)
+	}
+	if err != nil {
+		_ = db.Close()
+		return nil, Migrator{}, err
+	}
+
+	m := NewMigrator(append([]Option{WithDialect(dialect)}, opts...)...)
+	if !sameDialect(m.Dialect, dialect) {
+		_ = db.Close()
+		return nil, Migrator{}, fmt.Errorf("%w: driver %q", ErrDialectMismatch, driverName)
+	}
+	return db, m, nil
+}
+
+// DialectForDriver returns the registered dialect (see RegisterDialect) for
+// a database/sql driver name, such as "postgres", "pgx", "mysql" or
+// "sqlite3"
+func DialectForDriver(driverName string) (Dialect, error) {
+	name, exists := driverDialects[driverName]
+	if !exists {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownDialect, driverName)
+	}
+	return LookupDialect(name)
+}
+
+// DetectDialect returns the dialect for an open database from the type of
+// its driver, for callers which didn't open it themselves
+func DetectDialect(db *sql.DB) (Dialect, error) {
+	if db == nil {
+		return nil, ErrNilDB
+	}
+	driverType := reflect.TypeOf(db.Driver())
+	for driverType.Kind() == reflect.Ptr {
+		driverType = driverType.Elem()
+	}
+	pkg := driverType.PkgPath()
+	for prefix, name := range driverPackageDialects {
+		if pkg == prefix || strings.HasPrefix(pkg, prefix+"/") {
+			return LookupDialect(name)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownDialect, driverType)
+}
+
+// sameDialect returns whether two dialects have the same name. Dialects
+// without names are assumed to match, since they can't be compared.
+func sameDialect(a, b Dialect) bool {
+	namedA, okA := a.(NamedDialect)
+	namedB, okB := b.(NamedDialect)
+	if !okA || !okB {
+		return true
+	}
+	return namedA.Name() == namedB.Name()
+}
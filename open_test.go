@@ -0,0 +1,59 @@
+package schema
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDialectForDriver(t *testing.T) {
+	for driver, expected := range map[string]string{"pgx": "postgres", "mysql": "mysql", "sqlite3": "sqlite"} {
+		dialect, err := DialectForDriver(driver)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if name := dialect.(NamedDialect).Name(); name != expected {
+			t.Errorf("Expected the %s driver to use %s. Got %s", driver, expected, name)
+		}
+	}
+	if _, err := DialectForDriver("unknown"); !errors.Is(err, ErrUnknownDialect) {
+		t.Errorf("Expected ErrUnknownDialect. Got %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schema_open")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dsn := filepath.Join(dir, "open.db")
+
+	db, migrator, err := Open("sqlite3", dsn, WithTableName("open_migrations"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, ok := migrator.Dialect.(*sqliteDialect); !ok || migrator.TableName != "open_migrations" {
+		t.Errorf("Expected a SQLite Migrator for open_migrations. Got %T for %s", migrator.Dialect, migrator.TableName)
+	}
+	err = migrator.Apply(db, []*Migration{{ID: "2020-01-01 Open", Script: "CREATE TABLE opened (id INTEGER)"}})
+	if err != nil {
+		t.Error(err)
+	}
+
+	dialect, err := DetectDialect(db)
+	if err != nil {
+		t.Error(err)
+	} else if _, ok := dialect.(*sqliteDialect); !ok {
+		t.Errorf("Expected the SQLite dialect to be detected. Got %T", dialect)
+	}
+
+	_, _, err = Open("sqlite3", dsn, WithDialect(Postgres))
+	if !errors.Is(err, ErrDialectMismatch) {
+		t.Errorf("Expected ErrDialectMismatch. Got %v", err)
+	}
+}
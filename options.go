@@ -1,5 +1,10 @@
 package schema
 
+import (
+	"database/sql"
+	"time"
+)
+
 // Option supports option chaining when creating a Migrator.
 // An Option is a function which takes a Migrator and
 // returns a Migrator with an Option modified.
@@ -37,6 +42,48 @@ func WithDialect(dialect Dialect) Option {
 	}
 }
 
+// WithDialectName builds an Option which will set the dialect registered
+// with the name (see RegisterDialect), such as one read from configuration.
+// If no dialect is registered with the name, Apply fails with an error
+// wrapping ErrUnknownDialect. Configuration can be checked with
+// LookupDialect in advance.
+// Usage: NewMigrator(WithDialectName("mysql"))
+//
+func WithDialectName(name string) Option {
+	return func(m Migrator) Migrator {
+		dialect, err := LookupDialect(name)
+		if err != nil {
+			return m.withOptionErr(err)
+		}
+		m.Dialect = dialect
+		return m
+	}
+}
+
+// WithPlugins builds an Option which applies the plugins registered with the
+// names (see RegisterPlugin), in the order they are given. If no plugin is
+// registered with one of the names, none of them are applied and Apply
+// fails with an error wrapping ErrUnknownPlugin. Configuration can be
+// checked with LookupPlugin in advance.
+// Usage: NewMigrator(WithPlugins("prometheus", "slack"))
+//
+func WithPlugins(names ...string) Option {
+	return func(m Migrator) Migrator {
+		options := make([]Option, len(names))
+		for i, name := range names {
+			plugin, err := LookupPlugin(name)
+			if err != nil {
+				return m.withOptionErr(err)
+			}
+			options[i] = plugin
+		}
+		for _, opt := range options {
+			m = opt(m)
+		}
+		return m
+	}
+}
+
 // Logger is the interface for logging operations of the logger.
 // By default the migrator operates silently. Providing a Logger
 // enables output of the migrator's operations.
@@ -53,3 +100,518 @@ func WithLogger(logger Logger) Option {
 		return m
 	}
 }
+
+// WithSessionSetup builds an Option which runs the supplied SQL statements on
+// the migration connection before locking and applying migrations, for
+// example to SET ROLE or SET lock_timeout. The connection is discarded
+// afterwards rather than returned to the pool.
+// Usage: NewMigrator(WithSessionSetup("SET ROLE migrator"))
+//
+func WithSessionSetup(statements ...string) Option {
+	return func(m Migrator) Migrator {
+		m.SessionSetup = append(m.SessionSetup[:len(m.SessionSetup):len(m.SessionSetup)], statements...)
+		return m
+	}
+}
+
+// WithPreRunScript builds an Option which runs the supplied SQL statements
+// once before Apply runs its migrations, such as to disable triggers across
+// the tables being migrated. They are only run when there are migrations to
+// apply, and run in the migration transaction when the migrations share one.
+// Usage: NewMigrator(WithPreRunScript("SET session_replication_role = replica"))
+//
+func WithPreRunScript(statements ...string) Option {
+	return func(m Migrator) Migrator {
+		m.PreRunScript = append(m.PreRunScript[:len(m.PreRunScript):len(m.PreRunScript)], statements...)
+		return m
+	}
+}
+
+// WithRequiredExtensions builds an Option which creates the named extensions
+// on Postgres, if they don't exist yet, before Apply runs its migrations. A
+// role without the privilege to create an extension gets an error saying how
+// to have it created instead. Other dialects don't create them, so the same
+// Migrator can be used against SQLite in tests.
+// Usage: NewMigrator(WithRequiredExtensions("uuid-ossp", "pgcrypto"))
+//
+func WithRequiredExtensions(names ...string) Option {
+	return func(m Migrator) Migrator {
+		m.RequiredExtensions = append(m.RequiredExtensions[:len(m.RequiredExtensions):len(m.RequiredExtensions)], names...)
+		return m
+	}
+}
+
+// WithPostRunScript builds an Option which runs the supplied SQL statements
+// once after Apply has run its migrations, such as to re-enable triggers.
+// When each migration is committed separately, they also run after a
+// migration fails, so that the work of a pre-run script can be undone.
+// Usage: NewMigrator(WithPostRunScript("SET session_replication_role = DEFAULT"))
+//
+func WithPostRunScript(statements ...string) Option {
+	return func(m Migrator) Migrator {
+		m.PostRunScript = append(m.PostRunScript[:len(m.PostRunScript):len(m.PostRunScript)], statements...)
+		return m
+	}
+}
+
+// WithConfirm builds an Option which sets a callback invoked after Apply has
+// planned which migrations to run, but before executing any of them. It
+// enables CLI prompts or chat-ops approval flows for production runs.
+// Usage: NewMigrator(WithConfirm(promptUser))
+//
+func WithConfirm(confirm func(plan []*Migration) (bool, error)) Option {
+	return func(m Migrator) Migrator {
+		m.Confirm = confirm
+		return m
+	}
+}
+
+// WithLintPolicy builds an Option which checks the migrations Apply is about
+// to run for changes which are incompatible with rolling deploys. LintBlock
+// makes Apply fail before running anything, for use in CI.
+// Usage: NewMigrator(WithLintPolicy(LintBlock))
+//
+func WithLintPolicy(policy LintPolicy) Option {
+	return func(m Migrator) Migrator {
+		m.LintPolicy = policy
+		return m
+	}
+}
+
+// WithMaterializedViews builds an Option which declares materialized views
+// to refresh, in dependency order, after Apply runs the migrations they
+// depend on.
+// Usage: NewMigrator(WithMaterializedViews(&MaterializedView{Name: "totals", Migrations: []string{"2021-*"}}))
+//
+func WithMaterializedViews(views ...*MaterializedView) Option {
+	return func(m Migrator) Migrator {
+		m.MaterializedViews = append(m.MaterializedViews[:len(m.MaterializedViews):len(m.MaterializedViews)], views...)
+		return m
+	}
+}
+
+// WithQueryLogger builds an Option which reports every SQL statement the
+// Migrator executes, with its duration, to the supplied QueryLogger.
+// Usage: NewMigrator(WithQueryLogger(QueryLoggerFunc(logQuery)))
+//
+func WithQueryLogger(logger QueryLogger) Option {
+	return func(m Migrator) Migrator {
+		m.QueryLogger = logger
+		return m
+	}
+}
+
+// WithRedaction builds an Option which applies the supplied function to SQL
+// and error messages before they are logged or returned, so that sensitive
+// literals in migration scripts don't leak into logging pipelines.
+// Usage: NewMigrator(WithRedaction(MaskLiterals))
+//
+func WithRedaction(redact func(sql string) string) Option {
+	return func(m Migrator) Migrator {
+		m.Redact = redact
+		return m
+	}
+}
+
+// WithSlowThreshold builds an Option which flags migrations that take longer
+// than the threshold to run, logging them as warnings.
+// Usage: NewMigrator(WithSlowThreshold(time.Minute))
+//
+func WithSlowThreshold(threshold time.Duration) Option {
+	return func(m Migrator) Migrator {
+		m.SlowThreshold = threshold
+		return m
+	}
+}
+
+// WithSlowMigrationHook builds an Option which calls the supplied function
+// with each migration that took longer than the SlowThreshold, for example
+// to send a metric or a chat notification.
+// Usage: NewMigrator(WithSlowThreshold(time.Minute), WithSlowMigrationHook(notify))
+//
+func WithSlowMigrationHook(onSlow func(migration *Migration, duration time.Duration)) Option {
+	return func(m Migrator) Migrator {
+		m.OnSlowMigration = onSlow
+		return m
+	}
+}
+
+// WithLockWaitReporting builds an Option which reports who holds the
+// migration lock at the interval while Apply waits for it, so that the
+// operator of a blocked deploy can see what is in the way. Reports are
+// logged, and passed to the function when it isn't nil.
+// Usage: NewMigrator(WithLockWaitReporting(10*time.Second, nil))
+//
+func WithLockWaitReporting(interval time.Duration, onWait func(waited time.Duration, holders []*LockHolder)) Option {
+	return func(m Migrator) Migrator {
+		m.LockReportInterval = interval
+		m.OnLockWait = onWait
+		return m
+	}
+}
+
+// WithStatementRetry builds an Option which retries migration statements
+// that fail with a retryable error (see IsRetryableError), wrapping each
+// statement in a savepoint so only the failed statement is rolled back and
+// retried. The backoff before each retry grows linearly.
+// Usage: NewMigrator(WithStatementRetry(3, time.Second))
+//
+func WithStatementRetry(retries int, backoff time.Duration) Option {
+	return func(m Migrator) Migrator {
+		m.StatementRetries = retries
+		m.StatementRetryBackoff = backoff
+		return m
+	}
+}
+
+// WithTxOptions builds an Option which begins the transactions that plan,
+// execute and record migrations with the supplied options, such as an
+// explicit isolation level for strict-serializable stores.
+// Usage: NewMigrator(WithTxOptions(sql.TxOptions{Isolation: sql.LevelSerializable}))
+//
+func WithTxOptions(opts sql.TxOptions) Option {
+	return func(m Migrator) Migrator {
+		m.TxOptions = &opts
+		return m
+	}
+}
+
+// WithReadTxOptions builds an Option which begins the read-only transactions
+// of health checks with the supplied options, such as marking them read-only
+// for database replicas.
+// Usage: NewMigrator(WithReadTxOptions(sql.TxOptions{ReadOnly: true}))
+//
+func WithReadTxOptions(opts sql.TxOptions) Option {
+	return func(m Migrator) Migrator {
+		m.ReadTxOptions = &opts
+		return m
+	}
+}
+
+// WithExistingTableOnly builds an Option which prevents the Migrator from
+// creating the tracking table, for environments where it is provisioned in
+// advance and the application's role lacks CREATE privileges. Apply then
+// fails with ErrTrackingTableMissing when the table, or a builds, scripts or
+// set checksum table the Migrator records, doesn't exist.
+// Usage: NewMigrator(WithExistingTableOnly())
+//
+func WithExistingTableOnly() Option {
+	return func(m Migrator) Migrator {
+		m.ExistingTableOnly = true
+		return m
+	}
+}
+
+// WithReplicaCheck builds an Option which makes Apply check whether the
+// database is a read-only replica before doing anything, and fail with
+// ErrReplica if it is. Dialects which can't tell (such as SQLite) are
+// assumed not to be replicas.
+// Usage: NewMigrator(WithReplicaCheck())
+//
+func WithReplicaCheck() Option {
+	return func(m Migrator) Migrator {
+		m.RefuseReplicas = true
+		return m
+	}
+}
+
+// WithMinServerVersion builds an Option which makes Apply fail with
+// ErrServerVersion when the database server is older than version.
+// Usage: NewMigrator(WithMinServerVersion("11"))
+//
+func WithMinServerVersion(version string) Option {
+	return func(m Migrator) Migrator {
+		m.MinServerVersion = version
+		return m
+	}
+}
+
+// WithMiddleware builds an Option which wraps the execution of each
+// migration with the supplied Middleware, in addition to any already
+// configured. The first Middleware supplied is the outermost.
+// Usage: NewMigrator(WithMiddleware(timing, approval))
+//
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(m Migrator) Migrator {
+		m.Middleware = append(append([]Middleware{}, m.Middleware...), middleware...)
+		return m
+	}
+}
+
+// WithIDValidator builds an Option which makes Apply check every migration's
+// ID with the validator, so that a team can enforce one ID convention.
+// Usage: NewMigrator(WithIDValidator(ValidateTimestampID))
+//
+func WithIDValidator(validator IDValidator) Option {
+	return func(m Migrator) Migrator {
+		m.IDValidator = validator
+		return m
+	}
+}
+
+// WithStrictOrdering builds an Option which makes Apply fail with a
+// ConflictError when a pending migration sorts before one which has been
+// applied, as happens when a branch's migrations are merged late. The
+// author can then renumber the migration rather than having it applied out
+// of order.
+// Usage: NewMigrator(WithStrictOrdering())
+//
+func WithStrictOrdering() Option {
+	return func(m Migrator) Migrator {
+		m.StrictOrdering = true
+		return m
+	}
+}
+
+// WithOrphanCheck builds an Option which makes Apply fail with a
+// ConflictError when the tracking table records migrations which aren't
+// among those supplied. That usually means an old build is being deployed or
+// a migration file is missing, which is better caught before migrating.
+// Usage: NewMigrator(WithOrphanCheck())
+//
+func WithOrphanCheck() Option {
+	return func(m Migrator) Migrator {
+		m.RefuseOrphans = true
+		return m
+	}
+}
+
+// WithNotifier builds an Option which notifies the Notifier when Apply
+// applies migrations or fails, such as to post to a deploy channel.
+// Usage: NewMigrator(WithNotifier(NewSlackNotifier(webhookURL)))
+//
+func WithNotifier(notifier Notifier) Option {
+	return func(m Migrator) Migrator {
+		m.Notifier = notifier
+		return m
+	}
+}
+
+// WithBuildMetadata builds an Option which records the supplied metadata,
+// such as a git commit hash or CI build ID, with each migration Apply runs,
+// so that any schema change can be traced back to the deploy which made it.
+// Usage: NewMigrator(WithBuildMetadata(VCSRevision()))
+//
+func WithBuildMetadata(metadata string) Option {
+	return func(m Migrator) Migrator {
+		m.BuildMetadata = metadata
+		return m
+	}
+}
+
+// DefaultApplicationName is the name WithApplicationName tags the
+// migration connection with when it is given an empty name
+const DefaultApplicationName = "schema-migrator"
+
+// WithChecksumScope builds an Option which chooses what the checksum
+// recorded for each migration covers: its script (the default), its script
+// and metadata, or its script as rendered by its Engine. The scope is
+// recorded with the checksum, so migrations applied with another scope are
+// still verified with theirs.
+// Usage: NewMigrator(WithChecksumScope(ChecksumMetadata))
+//
+func WithChecksumScope(scope ChecksumScope) Option {
+	return func(m Migrator) Migrator {
+		m.ChecksumScope = scope
+		return m
+	}
+}
+
+// WithEnvironment builds an Option which names the deployment, such as
+// "production", for migrations rendered by a VarsEngine such as
+// TemplateEngine. It is available to them as ScriptVars.Environment.
+// Usage: NewMigrator(WithEnvironment("staging"))
+//
+func WithEnvironment(environment string) Option {
+	return func(m Migrator) Migrator {
+		m.Environment = environment
+		return m
+	}
+}
+
+// WithScriptFlags builds an Option which sets custom feature flags for
+// migrations rendered by a VarsEngine such as TemplateEngine. They are
+// available to them as ScriptVars.Flags, and flags which aren't set are
+// false.
+// Usage: NewMigrator(WithScriptFlags(map[string]bool{"audit": true}))
+//
+func WithScriptFlags(flags map[string]bool) Option {
+	return func(m Migrator) Migrator {
+		m.ScriptFlags = flags
+		return m
+	}
+}
+
+// WithApplicationName builds an Option which tags the migration connection
+// with the name, so that DBAs can identify migration sessions and decide
+// whether to wait for or kill them. Postgres sets application_name, shown
+// in pg_stat_activity, and Oracle sets the session's module. MySQL only
+// accepts connection attributes when connecting, so set them in the DSN
+// instead (connectionAttributes=program_name:schema-migrator with
+// go-sql-driver/mysql). An empty name uses DefaultApplicationName.
+// Usage: NewMigrator(WithApplicationName("billing-migrator"))
+//
+func WithApplicationName(name string) Option {
+	if name == "" {
+		name = DefaultApplicationName
+	}
+	return func(m Migrator) Migrator {
+		m.ApplicationName = name
+		return m
+	}
+}
+
+// WithAllowlist builds an Option which checks planned migrations against the
+// reviewed allowlist. With AllowlistEnforce, Apply refuses to run anything
+// if a planned migration is missing from it or has changed since review.
+// Usage: NewMigrator(WithAllowlist(allowlist, AllowlistEnforce))
+//
+func WithAllowlist(allowlist Allowlist, policy AllowlistPolicy) Option {
+	return func(m Migrator) Migrator {
+		m.Allowlist = allowlist
+		m.AllowlistPolicy = policy
+		return m
+	}
+}
+
+// WithSignature builds an Option which makes Apply verify the migrations
+// against a signature created by SignMigrations with the key, failing with
+// ErrInvalidSignature before anything runs if they were tampered with after
+// signing, such as in an artifact store.
+// Usage: NewMigrator(WithSignature(key, signature))
+//
+func WithSignature(key []byte, signature string) Option {
+	return func(m Migrator) Migrator {
+		m.SigningKey = key
+		m.Signature = signature
+		return m
+	}
+}
+
+// WithLocker builds an Option which takes the migration lock with the
+// Locker instead of the dialect's own locking, such as to coordinate
+// migrators through Redis when the database lacks advisory locks.
+// Usage: NewMigrator(WithLocker(NewRedisLocker(client, "migrations")))
+//
+func WithLocker(locker Locker) Option {
+	return func(m Migrator) Migrator {
+		m.Locker = locker
+		return m
+	}
+}
+
+// WithObjectComments builds an Option which comments the tables and indexes
+// each migration creates with the migration's ID, on Postgres and MySQL, so
+// that DBAs inspecting the schema directly can see where an object came
+// from. MySQL indexes aren't commented, since that would rebuild them, and
+// neither are objects the migration comments itself.
+// Usage: NewMigrator(WithObjectComments())
+//
+func WithObjectComments() Option {
+	return func(m Migrator) Migrator {
+		m.CommentObjects = true
+		return m
+	}
+}
+
+// WithMaintenance builds an Option which does the maintenance after Apply
+// has run migrations, such as analyzing the tables they touched so that a
+// large backfill doesn't leave the planner with stale statistics.
+// Usage: NewMigrator(WithMaintenance(Maintenance{Analyze: true}))
+//
+func WithMaintenance(maintenance Maintenance) Option {
+	return func(m Migrator) Migrator {
+		m.Maintenance = maintenance
+		return m
+	}
+}
+
+// WithScriptRecording builds an Option which stores the compressed script of
+// each migration Apply runs, in a table named after the tracking table with
+// a "_scripts" suffix, so auditors can see exactly what ran even after the
+// migrations' source has changed. Scripts are stored unredacted.
+// Usage: NewMigrator(WithScriptRecording())
+//
+func WithScriptRecording() Option {
+	return func(m Migrator) Migrator {
+		m.RecordScripts = true
+		return m
+	}
+}
+
+// WithSetChecksum builds an Option which stores the SetChecksum of the
+// migrations after each successful Apply, in a table named after the
+// tracking table with a "_set" suffix. AppliedSet reads it back, so a
+// service can check that the database has exactly its migrations with a
+// single comparison.
+// Usage: NewMigrator(WithSetChecksum())
+//
+func WithSetChecksum() Option {
+	return func(m Migrator) Migrator {
+		m.RecordSetChecksum = true
+		return m
+	}
+}
+
+// WithReconnect builds an Option which makes Apply resume when the database
+// connection drops (see IsConnectionError), as serverless databases such as
+// Neon and Aurora Serverless do to idle clients and when scaling to zero.
+// Apply reacquires the lock on a new connection, reads the applied
+// migrations again and continues with those still pending. The backoff
+// before each attempt grows linearly.
+// Usage: NewMigrator(WithReconnect(5, 2*time.Second))
+//
+func WithReconnect(attempts int, backoff time.Duration) Option {
+	return func(m Migrator) Migrator {
+		m.ReconnectAttempts = attempts
+		m.ReconnectBackoff = backoff
+		return m
+	}
+}
+
+// WithConnectionPerMigration builds an Option which runs each migration on a
+// new connection, discarded afterwards, so that session state a migration
+// leaves behind (temporary tables, SET values) can't affect the next one,
+// and one bad session can't poison the rest of the run. Each migration is
+// committed separately. The lock stays on the migration connection, so the
+// pool must allow a second connection, and a transaction lock can't be used.
+// Neither can pre-run and post-run scripts, whose session state wouldn't
+// reach the migrations.
+// Usage: NewMigrator(WithConnectionPerMigration())
+//
+func WithConnectionPerMigration() Option {
+	return func(m Migrator) Migrator {
+		m.ConnectionPerMigration = true
+		return m
+	}
+}
+
+// WithDurabilityCheck builds an Option which makes Apply read the tracking
+// table on a new connection once it has committed its migrations, failing
+// with ErrNotDurable unless every one is recorded. It guards deploys against
+// configurations which acknowledge commits before they are durable, such as
+// asynchronous commit or a proxy in front of a failover pair. The migration
+// connection is closed rather than returned to the pool, so that the check
+// can't read it back on the connection which committed it.
+// Usage: NewMigrator(WithDurabilityCheck())
+//
+func WithDurabilityCheck() Option {
+	return func(m Migrator) Migrator {
+		m.DurabilityCheck = true
+		return m
+	}
+}
+
+// WithShardConcurrency builds an Option which makes ApplyShards migrate up
+// to concurrency shards at once, giving each up to timeout (or no limit when
+// it is zero). A shard which runs out of time is rolled back and reported as
+// failed, like one whose context is cancelled.
+// Usage: NewMigrator(WithShardConcurrency(8, 10*time.Minute))
+//
+func WithShardConcurrency(concurrency int, timeout time.Duration) Option {
+	return func(m Migrator) Migrator {
+		m.ShardConcurrency = concurrency
+		m.ShardTimeout = timeout
+		return m
+	}
+}
@@ -1,9 +1,11 @@
 package schema
 
 import (
+	"database/sql"
 	"log"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestWithTableNameOptionWithSchema(t *testing.T) {
@@ -70,3 +72,64 @@ func TestWithLoggerOption(t *testing.T) {
 		t.Errorf("Expected logger to have been added")
 	}
 }
+
+func TestWithConfirmOption(t *testing.T) {
+	m := NewMigrator()
+	if m.Confirm != nil {
+		t.Errorf("Expected nil Confirm by default")
+	}
+	m = NewMigrator(WithConfirm(func(plan []*Migration) (bool, error) {
+		return false, nil
+	}))
+	if m.Confirm == nil {
+		t.Errorf("Expected Confirm to have been added")
+	}
+}
+
+func TestWithSessionSetupOption(t *testing.T) {
+	m := NewMigrator(
+		WithSessionSetup("SET ROLE migrator"),
+		WithSessionSetup("SET lock_timeout = '5s'", "SET search_path = app"),
+	)
+	if len(m.SessionSetup) != 3 {
+		t.Errorf("Expected 3 session setup statements. Got %d", len(m.SessionSetup))
+	}
+	if m.SessionSetup[0] != "SET ROLE migrator" {
+		t.Errorf("Expected statements in the order supplied. Got '%s' first", m.SessionSetup[0])
+	}
+}
+
+func TestWithSlowThresholdOption(t *testing.T) {
+	var flagged []string
+	m := NewMigrator(WithSlowThreshold(time.Second), WithSlowMigrationHook(func(migration *Migration, duration time.Duration) {
+		flagged = append(flagged, migration.ID)
+	}))
+	m.checkSlow(&Migration{ID: "fast"}, time.Millisecond)
+	m.checkSlow(&Migration{ID: "slow"}, 2*time.Second)
+	if len(flagged) != 1 || flagged[0] != "slow" {
+		t.Errorf("Expected only the slow migration to be flagged. Got %v", flagged)
+	}
+	NewMigrator(WithSlowMigrationHook(func(*Migration, time.Duration) {
+		t.Error("Expected no flagging without a threshold")
+	})).checkSlow(&Migration{ID: "slow"}, time.Hour)
+}
+
+func TestWithTxOptionsOptions(t *testing.T) {
+	m := NewMigrator(
+		WithTxOptions(sql.TxOptions{Isolation: sql.LevelSerializable}),
+		WithReadTxOptions(sql.TxOptions{ReadOnly: true}),
+	)
+	if m.TxOptions == nil || m.TxOptions.Isolation != sql.LevelSerializable {
+		t.Errorf("Expected serializable migration transactions. Got %+v", m.TxOptions)
+	}
+	if m.ReadTxOptions == nil || !m.ReadTxOptions.ReadOnly {
+		t.Errorf("Expected read-only health check transactions. Got %+v", m.ReadTxOptions)
+	}
+}
+
+func TestWithLockWaitReportingOption(t *testing.T) {
+	m := NewMigrator(WithLockWaitReporting(time.Second, func(time.Duration, []*LockHolder) {}))
+	if m.LockReportInterval != time.Second || m.OnLockWait == nil {
+		t.Errorf("Expected lock wait reporting every second with a hook. Got %s", m.LockReportInterval)
+	}
+}
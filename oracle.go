@@ -0,0 +1,315 @@
+package schema
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+// Oracle is the dialect for Oracle databases. Oracle commits implicitly
+// around DDL and its drivers execute one statement at a time, so scripts
+// are split into statements (keeping PL/SQL blocks, which end at a line
+// containing only "/", together) and each migration is committed
+// separately. Locking uses DBMS_LOCK, so the migrating user needs EXECUTE
+// privileges on it.
+var Oracle = oracleDialect{}
+
+var _ Updater = (*oracleDialect)(nil)
+var _ ScriptGenerator = (*oracleDialect)(nil)
+var _ SQLLocker = (*oracleDialect)(nil)
+var _ CapabilityReporter = (*oracleDialect)(nil)
+var _ StatementSplitter = (*oracleDialect)(nil)
+var _ ImplicitCommitDetector = (*oracleDialect)(nil)
+var _ BuildRecorder = (*oracleDialect)(nil)
+var _ ScriptRecorder = (*oracleDialect)(nil)
+var _ SetRecorder = (*oracleDialect)(nil)
+var _ HistoryPruner = (*oracleDialect)(nil)
+var _ Introspector = (*oracleDialect)(nil)
+var _ ApplicationNamer = (*oracleDialect)(nil)
+
+// oracleDialect is the Oracle dialect
+type oracleDialect struct{}
+
+// LockSQL returns a PL/SQL block which waits indefinitely for an exclusive
+// DBMS_LOCK lock named after the tracking table
+func (o oracleDialect) LockSQL(tableName string) string {
+	return fmt.Sprintf(`
+		DECLARE
+			handle VARCHAR2(128);
+			result INTEGER;
+		BEGIN
+			DBMS_LOCK.ALLOCATE_UNIQUE('%s', handle);
+			result := DBMS_LOCK.REQUEST(handle, DBMS_LOCK.X_MODE, DBMS_LOCK.MAXWAIT, FALSE);
+			IF result NOT IN (0, 4) THEN
+				RAISE_APPLICATION_ERROR(-20000, 'schema: DBMS_LOCK.REQUEST failed with ' || result);
+			END IF;
+		END;`, o.lockName(tableName))
+}
+
+// UnlockSQL returns the PL/SQL block which releases the lock taken by
+// LockSQL
+func (o oracleDialect) UnlockSQL(tableName string) string {
+	return fmt.Sprintf(`
+		DECLARE
+			handle VARCHAR2(128);
+			result INTEGER;
+		BEGIN
+			DBMS_LOCK.ALLOCATE_UNIQUE('%s', handle);
+			result := DBMS_LOCK.RELEASE(handle);
+		END;`, o.lockName(tableName))
+}
+
+// Capabilities reports that Oracle doesn't support transactional DDL
+func (o oracleDialect) Capabilities() Capabilities {
+	return Capabilities{
+		TransactionalDDL: false,
+		LockStrategy:     LockStrategyAdvisory,
+	}
+}
+
+// CreateSQL takes the name of the migration tracking table and returns a
+// PL/SQL block which creates it, ignoring ORA-00955 when it already exists
+func (o oracleDialect) CreateSQL(tableName string) string {
+	create := fmt.Sprintf(`
+		CREATE TABLE %s (
+			id VARCHAR2(255) NOT NULL,
+			checksum VARCHAR2(32),
+			execution_time_in_millis NUMBER(10) DEFAULT 0 NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL
+		)`, tableName)
+	return o.createIfNotExists(create)
+}
+
+// CreateBuildsSQL takes the name of the build metadata table and returns a
+// PL/SQL block which creates it, ignoring ORA-00955 when it already exists
+func (o oracleDialect) CreateBuildsSQL(tableName string) string {
+	create := fmt.Sprintf(`
+		CREATE TABLE %s (
+			id VARCHAR2(255) NOT NULL,
+			build VARCHAR2(1024) NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL
+		)`, tableName)
+	return o.createIfNotExists(create)
+}
+
+// InsertBuildSQL takes the name of the build metadata table and returns
+// the SQL statement needed to record the build which applied a migration
+func (o oracleDialect) InsertBuildSQL(tableName string) string {
+	return fmt.Sprintf(`INSERT INTO %s ( id, build, applied_at ) VALUES ( :1, :2, :3 )`, tableName)
+}
+
+// CreateScriptsSQL takes the name of the scripts table and returns a PL/SQL
+// block which creates it, ignoring ORA-00955 when it already exists
+func (o oracleDialect) CreateScriptsSQL(tableName string) string {
+	create := fmt.Sprintf(`
+		CREATE TABLE %s (
+			id VARCHAR2(255) NOT NULL,
+			script BLOB NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL
+		)`, tableName)
+	return o.createIfNotExists(create)
+}
+
+// InsertScriptSQL takes the name of the scripts table and returns the SQL
+// statement needed to store the script of an applied migration
+func (o oracleDialect) InsertScriptSQL(tableName string) string {
+	return fmt.Sprintf(`INSERT INTO %s ( id, script, applied_at ) VALUES ( :1, :2, :3 )`, tableName)
+}
+
+// CreateSetSQL takes the name of the set table and returns a PL/SQL
+// block which creates it, ignoring ORA-00955 when it already exists
+func (o oracleDialect) CreateSetSQL(tableName string) string {
+	create := fmt.Sprintf(`
+		CREATE TABLE %s (
+			checksum VARCHAR2(64) NOT NULL,
+			migrations NUMBER(10) NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL
+		)`, tableName)
+	return o.createIfNotExists(create)
+}
+
+// InsertSetSQL takes the name of the set table and returns the SQL
+// statement needed to store the checksum of an applied migration set
+func (o oracleDialect) InsertSetSQL(tableName string) string {
+	return fmt.Sprintf(`INSERT INTO %s ( checksum, migrations, applied_at ) VALUES ( :1, :2, :3 )`, tableName)
+}
+
+// DeleteSQL takes the name of the tracking table, or a table next to it,
+// and returns the SQL statement needed to delete the rows of a migration
+func (o oracleDialect) DeleteSQL(tableName string) string {
+	return fmt.Sprintf(`DELETE FROM %s WHERE id = :1`, tableName)
+}
+
+// ApplicationNameSQL returns a PL/SQL block which sets the session's
+// module, which is shown in V$SESSION
+func (o oracleDialect) ApplicationNameSQL(name string) string {
+	return fmt.Sprintf("BEGIN DBMS_APPLICATION_INFO.SET_MODULE('%s', NULL); END;", strings.ReplaceAll(name, "'", "''"))
+}
+
+// createIfNotExists wraps a CREATE TABLE statement in a PL/SQL block which
+// ignores ORA-00955 when the table already exists
+func (o oracleDialect) createIfNotExists(create string) string {
+	return fmt.Sprintf(`
+		BEGIN
+			EXECUTE IMMEDIATE '%s';
+		EXCEPTION
+			WHEN OTHERS THEN
+				IF SQLCODE != -955 THEN
+					RAISE;
+				END IF;
+		END;`, strings.ReplaceAll(create, "'", "''"))
+}
+
+// BeginSQL returns "", since Oracle begins transactions implicitly and BEGIN
+// would open a PL/SQL block
+func (o oracleDialect) BeginSQL() string {
+	return ""
+}
+
+// CommitSQL returns the statement which commits a transaction in a script
+// written by GenerateSQL
+func (o oracleDialect) CommitSQL() string {
+	return "COMMIT"
+}
+
+// LiteralSQL quotes the value as a literal
+func (o oracleDialect) LiteralSQL(value string) string {
+	return quotedLiteral(value)
+}
+
+// TerminateSQL ends the statement with a semicolon, and PL/SQL blocks with
+// the slash which SQL*Plus runs them on
+func (o oracleDialect) TerminateSQL(statement string) string {
+	if isPLSQLBlock(statement) {
+		return terminated(statement) + "\n/"
+	}
+	return terminated(statement)
+}
+
+// InsertSQL takes the name of the migration tracking table and
+// returns the SQL statement needed to insert a migration into it
+func (o oracleDialect) InsertSQL(tableName string) string {
+	return fmt.Sprintf(`
+		INSERT INTO %s
+		( id, checksum, execution_time_in_millis, applied_at )
+		VALUES
+		( :1, :2, :3, :4 )`, tableName)
+}
+
+// UpdateSQL takes the name of the migration tracking table and
+// returns the SQL statement needed to refresh the record of a migration
+// which has been run again. Oracle drivers bind placeholders in the order
+// they appear, so the statement takes the InsertSQL arguments in the same
+// order.
+func (o oracleDialect) UpdateSQL(tableName string) string {
+	return fmt.Sprintf(`
+		MERGE INTO %s t
+		USING (SELECT :1 AS id, :2 AS checksum, :3 AS execution_time_in_millis, :4 AS applied_at FROM dual) v
+		ON (t.id = v.id)
+		WHEN MATCHED THEN UPDATE SET
+			t.checksum = v.checksum,
+			t.execution_time_in_millis = v.execution_time_in_millis,
+			t.applied_at = v.applied_at`, tableName)
+}
+
+// SelectSQL takes the name of the migration tracking table and
+// returns the SQL statement to retrieve all records from it
+func (o oracleDialect) SelectSQL(tableName string) string {
+	return fmt.Sprintf(`
+		SELECT id, checksum, execution_time_in_millis, applied_at
+		FROM %s
+		ORDER BY id ASC`, tableName)
+}
+
+// Name returns "oracle", which selects Oracle script variants
+func (o oracleDialect) Name() string {
+	return "oracle"
+}
+
+// QuotedTableName returns the string value of the name of the migration
+// tracking table after it has been quoted for Oracle
+func (o oracleDialect) QuotedTableName(schemaName, tableName string) string {
+	if schemaName == "" {
+		return o.quotedIdent(tableName)
+	}
+	return o.quotedIdent(schemaName) + "." + o.quotedIdent(tableName)
+}
+
+// MaxIdentifierLength returns 128, the longest identifier Oracle 12.2 and
+// later allow
+func (o oracleDialect) MaxIdentifierLength() int {
+	return 128
+}
+
+// SplitStatements splits a migration script into its statements. PL/SQL
+// blocks and stored program units are kept whole (including their final
+// semicolon) until a line containing only "/".
+func (o oracleDialect) SplitStatements(script string) []string {
+	return oracleSplitter.split(script)
+}
+
+// oracleImplicitCommitKeywords are the leading keywords of statements which
+// cause an implicit commit in Oracle
+var oracleImplicitCommitKeywords = map[string]bool{
+	"ALTER": true, "ANALYZE": true, "AUDIT": true, "COMMENT": true,
+	"CREATE": true, "DROP": true, "FLASHBACK": true, "GRANT": true,
+	"NOAUDIT": true, "PURGE": true, "RENAME": true, "REVOKE": true,
+	"TRUNCATE": true,
+}
+
+// CommitsImplicitly returns whether Oracle commits the current transaction
+// when executing the statement
+func (o oracleDialect) CommitsImplicitly(statement string) bool {
+	words := strings.Fields(strings.ToUpper(stripLeadingComments(statement)))
+	return len(words) > 0 && oracleImplicitCommitKeywords[words[0]]
+}
+
+// quotedIdent wraps the supplied string in the Oracle identifier
+// quote character
+func (o oracleDialect) quotedIdent(ident string) string {
+	return `"` + strings.ReplaceAll(ident, `"`, "") + `"`
+}
+
+// lockName generates a table-specific DBMS_LOCK name
+func (o oracleDialect) lockName(tableName string) string {
+	return fmt.Sprintf("schema_migrations_%08x", crc32.ChecksumIEEE([]byte(tableName)))
+}
+
+// TablesSQL returns a query for the names of the tables owned by the
+// schema
+func (o oracleDialect) TablesSQL(schemaName string) string {
+	return fmt.Sprintf(`SELECT table_name FROM all_tables WHERE owner = %s ORDER BY table_name`, o.schemaExpr(schemaName))
+}
+
+// ColumnsSQL returns a query for the columns of the tables owned by the
+// schema. Defaults are stored as LONG values, which can't be selected
+// alongside the other columns portably, so none are listed.
+func (o oracleDialect) ColumnsSQL(schemaName string) string {
+	return fmt.Sprintf(`
+		SELECT table_name, column_name, data_type, CASE nullable WHEN 'Y' THEN 1 ELSE 0 END, NULL
+		FROM all_tab_columns
+		WHERE owner = %s
+		ORDER BY table_name, column_id
+	`, o.schemaExpr(schemaName))
+}
+
+// IndexesSQL returns a query for the indexed columns of the tables owned by
+// the schema
+func (o oracleDialect) IndexesSQL(schemaName string) string {
+	return fmt.Sprintf(`
+		SELECT i.table_name, i.index_name, CASE i.uniqueness WHEN 'UNIQUE' THEN 1 ELSE 0 END, c.column_name
+		FROM all_indexes i
+		JOIN all_ind_columns c ON c.index_owner = i.owner AND c.index_name = i.index_name
+		WHERE i.table_owner = %s
+		ORDER BY i.table_name, i.index_name, c.column_position
+	`, o.schemaExpr(schemaName))
+}
+
+// schemaExpr returns the schema name as a string literal, or the current
+// user's schema when it is empty
+func (o oracleDialect) schemaExpr(schemaName string) string {
+	if schemaName == "" {
+		return "USER"
+	}
+	return quotedLiteral(schemaName)
+}
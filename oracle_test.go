@@ -0,0 +1,57 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOracleSplitStatements(t *testing.T) {
+	script := `
+CREATE TABLE users (id NUMBER, name VARCHAR2(255));
+INSERT INTO users VALUES (1, q'[it's; fine]');
+CREATE OR REPLACE PROCEDURE add_user(p_name VARCHAR2) AS
+BEGIN
+	INSERT INTO users (name) VALUES (p_name);
+	COMMIT;
+END;
+/
+BEGIN
+	add_user('a;b');
+END;
+/
+SELECT 1 FROM dual
+/
+`
+	statements := Oracle.SplitStatements(script)
+	if len(statements) != 5 {
+		t.Fatalf("Expected 5 statements. Got %d:\n%#v", len(statements), statements)
+	}
+	if statements[1] != "INSERT INTO users VALUES (1, q'[it's; fine]')" {
+		t.Errorf("Expected alternative quotes to be respected. Got:\n%s", statements[1])
+	}
+	if !strings.HasPrefix(statements[2], "CREATE OR REPLACE PROCEDURE") || !strings.HasSuffix(statements[2], "END;") {
+		t.Errorf("Expected the procedure to stay together with its final semicolon. Got:\n%s", statements[2])
+	}
+	if !strings.HasSuffix(statements[3], "END;") {
+		t.Errorf("Expected the anonymous block to stay together. Got:\n%s", statements[3])
+	}
+	if statements[4] != "SELECT 1 FROM dual" {
+		t.Errorf("Expected a slash to terminate plain SQL. Got:\n%s", statements[4])
+	}
+}
+
+func TestOracleCommitsImplicitly(t *testing.T) {
+	if !Oracle.CommitsImplicitly("-- comment\nCREATE TABLE t (id NUMBER)") {
+		t.Error("Expected CREATE TABLE to commit implicitly")
+	}
+	if Oracle.CommitsImplicitly("INSERT INTO t VALUES (1)") {
+		t.Error("Expected INSERT not to commit implicitly")
+	}
+}
+
+func TestOracleCreateSQLEscapesTheStatement(t *testing.T) {
+	sql := Oracle.CreateSQL(Oracle.QuotedTableName("", "schema_migrations"))
+	if !strings.Contains(sql, "EXECUTE IMMEDIATE") || !strings.Contains(sql, "-955") {
+		t.Errorf("Expected an idempotent PL/SQL create block:\n%s", sql)
+	}
+}
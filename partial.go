@@ -0,0 +1,111 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrPartiallyApplied is wrapped by the PartialMigrationError which Apply
+// returns when an earlier run left a supplied migration partially applied
+var ErrPartiallyApplied = errors.New("an earlier run left the migration partially applied; run its remaining statements by hand, then call ResolvePartial")
+
+// partialPrefix marks the checksum recorded for a migration which failed
+// after some of its statements were implicitly committed. The rest of the
+// checksum is the number of statements committed.
+const partialPrefix = "partial:"
+
+// Partial returns whether the migration failed after some of its statements
+// were implicitly committed, and if so how many were. Apply refuses to run
+// again until it is resolved with ResolvePartial.
+func (a *AppliedMigration) Partial() (committed int, partial bool) {
+	if a == nil || !strings.HasPrefix(a.Checksum, partialPrefix) {
+		return 0, false
+	}
+	committed, err := strconv.Atoi(strings.TrimPrefix(a.Checksum, partialPrefix))
+	return committed, err == nil
+}
+
+// recordPartial records the migration of a PartialMigrationError in the
+// tracking table, so that the next Apply reports where it stopped rather
+// than running it again from the first statement. Recording doesn't use
+// the Apply context, so that it happens even after a cancellation, and a
+// failure to record is only logged, since the migration error matters more.
+func (m Migrator) recordPartial(conn *sql.Conn, err error, applied map[string]*AppliedMigration) {
+	var partial *PartialMigrationError
+	if !errors.As(err, &partial) || errors.Is(err, ErrPartiallyApplied) {
+		return
+	}
+	recordSQL := m.Dialect.InsertSQL(m.QuotedTableName())
+	var recordErr error
+	if _, exists := applied[partial.MigrationID]; exists {
+		recordSQL, recordErr = m.updateSQL(m.QuotedTableName())
+	}
+	ctx := context.Background()
+	if recordErr == nil {
+		recordErr = m.transaction(ctx, conn, func(tx *sql.Tx) error {
+			_, err := m.exec(ctx, tx, recordSQL, partial.MigrationID, partialPrefix+strconv.Itoa(partial.Committed), 0, time.Now().UTC())
+			return err
+		})
+	}
+	if recordErr != nil {
+		m.log(fmt.Sprintf("Warning: Migration '%s' could not be recorded as partially applied: %v\n", partial.MigrationID, recordErr))
+	}
+}
+
+// checkPartial returns a PartialMigrationError wrapping ErrPartiallyApplied
+// for the first supplied migration which an earlier run left partially
+// applied, identifying the statement which failed
+func (m Migrator) checkPartial(migrations []*Migration, applied map[string]*AppliedMigration) error {
+	sorted := make([]*Migration, len(migrations))
+	copy(sorted, migrations)
+	SortMigrations(sorted)
+	for _, migration := range sorted {
+		committed, partial := applied[migration.ID].Partial()
+		if !partial {
+			continue
+		}
+		err := &PartialMigrationError{MigrationID: migration.ID, Committed: committed, AtomicDDL: m.atomicDDL, Err: ErrPartiallyApplied}
+		script, renderErr := m.renderScript(migration)
+		splitter, ok := m.Dialect.(StatementSplitter)
+		if renderErr == nil && ok {
+			statements := splitter.SplitStatements(script)
+			err.Total = len(statements)
+			if committed < len(statements) {
+				err.Statement = m.redact(statements[committed])
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// ResolvePartial records a partially applied migration as applied, once the
+// statements which weren't committed have been run by hand. Until then,
+// Apply fails with ErrPartiallyApplied.
+func (m Migrator) ResolvePartial(db *sql.DB, migration *Migration) error {
+	if db == nil {
+		return ErrNilDB
+	}
+	migration = m.forDialect([]*Migration{migration})[0]
+	ctx := context.Background()
+	return m.transaction(ctx, db, func(tx *sql.Tx) error {
+		applied, err := m.GetAppliedMigrations(tx)
+		if err != nil {
+			return err
+		}
+		if _, partial := applied[migration.ID].Partial(); !partial {
+			return fmt.Errorf("Migration '%s' is not partially applied", migration.ID)
+		}
+		updateSQL, err := m.updateSQL(m.QuotedTableName())
+		if err != nil {
+			return err
+		}
+		_, err = m.exec(ctx, tx, updateSQL, migration.ID, m.checksum(migration), 0, time.Now().UTC())
+		return err
+	})
+}
@@ -0,0 +1,194 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// PartitionInterval is the length of time covered by each partition of a
+// PartitionSet
+type PartitionInterval int
+
+// The supported partition intervals. Partitions begin at midnight UTC, on
+// Mondays for weekly partitions and on the first of the month for monthly
+// partitions.
+const (
+	PartitionDaily PartitionInterval = iota
+	PartitionWeekly
+	PartitionMonthly
+)
+
+// PartitionsTableSuffix is appended to the Migrator's TableName to name the
+// table which tracks partition maintenance, keeping it separate from the
+// tracking of migrations
+const PartitionsTableSuffix = "_partitions"
+
+// PartitionSet describes the time-based partitions of a table, which
+// MaintainPartitions creates ahead of time and detaches once they are older
+// than the retention period
+type PartitionSet struct {
+	// Name identifies the set in the partition tracking table, and is
+	// usually the name of the partitioned table
+	Name     string
+	Interval PartitionInterval
+
+	// Create is a text/template for the statements which create a
+	// partition. It is executed with a PartitionRange. For example:
+	//   CREATE TABLE events_{{.Suffix}} PARTITION OF events
+	//   FOR VALUES FROM ('{{.From.Format "2006-01-02"}}') TO ('{{.To.Format "2006-01-02"}}')
+	Create string
+
+	// Detach is an optional text/template for the statements which detach
+	// (or drop) a partition, executed with a PartitionRange
+	Detach string
+
+	// Premake is the number of partitions created ahead of the current one
+	Premake int
+
+	// Retain is the number of partitions before the current one which are
+	// kept when Detach is set. Zero keeps every partition.
+	Retain int
+}
+
+// PartitionRange is the data available to PartitionSet templates
+type PartitionRange struct {
+	Name string
+	// From is the inclusive start of the partition
+	From time.Time
+	// To is the exclusive end of the partition
+	To time.Time
+	// Suffix identifies the partition, such as "20200131" for a daily
+	// partition or "202001" for a monthly one
+	Suffix string
+}
+
+// MaintainPartitions creates the partitions needed from now until Premake
+// intervals ahead, and detaches partitions older than Retain intervals. Each
+// creation and detachment is applied once, like a migration, and tracked in
+// a separate table named with PartitionsTableSuffix. It is intended to be
+// called on every run, after Apply.
+func (m Migrator) MaintainPartitions(ctx context.Context, db *sql.DB, sets []*PartitionSet, now time.Time) error {
+	if db == nil {
+		return ErrNilDB
+	}
+	// Only the configuration which says where and how to connect carries
+	// over, so that the checks, hooks and records of the user's migrations
+	// (including ones added later) don't apply to the generated partition
+	// migrations
+	pm := Migrator{
+		SchemaName:      m.SchemaName,
+		TableName:       m.TableName + PartitionsTableSuffix,
+		Dialect:         m.Dialect,
+		Logger:          m.Logger,
+		Locker:          m.Locker,
+		TxOptions:       m.TxOptions,
+		ReadTxOptions:   m.ReadTxOptions,
+		SessionSetup:    m.SessionSetup,
+		ApplicationName: m.ApplicationName,
+		optionErr:       m.optionErr,
+	}
+
+	err := pm.createMigrationsTable(ctx, db)
+	if err != nil {
+		return err
+	}
+	applied, err := pm.GetAppliedMigrations(contextQueryer{ctx: ctx, db: db})
+	if err != nil {
+		return err
+	}
+
+	migrations := make([]*Migration, 0)
+	for _, set := range sets {
+		current := set.Interval.start(now)
+		for i := 0; i <= set.Premake; i++ {
+			migration, err := set.migration(set.Interval.add(current, i), "create", set.Create)
+			if err != nil {
+				return err
+			}
+			migrations = append(migrations, migration)
+		}
+
+		if set.Detach == "" || set.Retain <= 0 {
+			continue
+		}
+		cutoff := set.Interval.add(current, -set.Retain)
+		prefix := fmt.Sprintf("partitions/%s/", set.Name)
+		for id := range applied {
+			if !strings.HasPrefix(id, prefix) || !strings.HasSuffix(id, "/create") {
+				continue
+			}
+			from, err := time.Parse(set.Interval.layout(), strings.TrimSuffix(strings.TrimPrefix(id, prefix), "/create"))
+			if err != nil || !from.Before(cutoff) {
+				continue
+			}
+			migration, err := set.migration(from, "detach", set.Detach)
+			if err != nil {
+				return err
+			}
+			migrations = append(migrations, migration)
+		}
+	}
+
+	return pm.ApplyContext(ctx, db, migrations)
+}
+
+// migration renders the template for the partition starting at from as a
+// migration with an ID unique to the partition and action
+func (s *PartitionSet) migration(from time.Time, action, text string) (*Migration, error) {
+	partition := PartitionRange{
+		Name:   s.Name,
+		From:   from,
+		To:     s.Interval.add(from, 1),
+		Suffix: from.Format(s.Interval.layout()),
+	}
+	tmpl, err := template.New(s.Name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Partition set '%s' has an invalid %s template:\n%w", s.Name, action, err)
+	}
+	var script strings.Builder
+	err = tmpl.Execute(&script, partition)
+	if err != nil {
+		return nil, err
+	}
+	return &Migration{
+		ID:     fmt.Sprintf("partitions/%s/%s/%s", s.Name, partition.Suffix, action),
+		Script: script.String(),
+	}, nil
+}
+
+// start returns the start of the partition containing t
+func (i PartitionInterval) start(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch i {
+	case PartitionWeekly:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case PartitionMonthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+// add returns the start of the partition n intervals after the one starting
+// at t
+func (i PartitionInterval) add(t time.Time, n int) time.Time {
+	switch i {
+	case PartitionWeekly:
+		return t.AddDate(0, 0, 7*n)
+	case PartitionMonthly:
+		return t.AddDate(0, n, 0)
+	}
+	return t.AddDate(0, 0, n)
+}
+
+// layout returns the time layout used for partition suffixes
+func (i PartitionInterval) layout() string {
+	if i == PartitionMonthly {
+		return "200601"
+	}
+	return "20060102"
+}
@@ -0,0 +1,133 @@
+package schema
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Plan describes the migrations a run would execute, in execution order. Its
+// JSON form is stable, so that external orchestrators and release tooling can
+// diff plans and approve them programmatically. Approving a plan's Checksum
+// pins the exact set of migrations which were reviewed.
+type Plan struct {
+	// Checksum identifies the planned migrations and their contents
+	Checksum   string              `json:"checksum"`
+	Migrations []*PlannedMigration `json:"migrations"`
+}
+
+// PlannedMigration describes a single migration within a Plan
+type PlannedMigration struct {
+	ID       string `json:"id"`
+	Checksum string `json:"checksum"`
+	// Rerun is true for Always migrations which have been applied before
+	Rerun bool `json:"rerun"`
+	// Destructive is true when any statement drops, truncates, deletes or
+	// renames existing objects or data
+	Destructive bool     `json:"destructive"`
+	Statements  []string `json:"statements"`
+	// Explanations holds the estimated costs of the DML statements, when
+	// the plan has been passed to Migrator.Explain
+	Explanations []*Explanation `json:"explanations,omitempty"`
+}
+
+// Plan compares the migrations with those recorded in the tracking table and
+// returns the Plan that Apply would execute. An error is returned if the
+// tracking table can't be read. Use NewPlan with a nil applied map to plan
+// against a fresh database.
+func (m Migrator) Plan(db Queryer, migrations []*Migration) (*Plan, error) {
+	applied, err := m.GetAppliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	return m.NewPlan(migrations, applied), nil
+}
+
+// NewPlan builds the Plan for running the migrations against a database in
+// which the applied migrations have already been run
+func (m Migrator) NewPlan(migrations []*Migration, applied map[string]*AppliedMigration) *Plan {
+	pending := make([]*Migration, 0)
+	for _, migration := range m.forDialect(migrations) {
+		if run, _ := needsRun(migration, applied); run {
+			pending = append(pending, migration)
+		}
+	}
+	SortMigrations(pending)
+
+	plan := &Plan{Migrations: make([]*PlannedMigration, 0, len(pending))}
+	hash := md5.New()
+	for _, migration := range pending {
+		_, rerun := needsRun(migration, applied)
+		planned := &PlannedMigration{
+			ID:         migration.ID,
+			Checksum:   m.checksum(migration),
+			Rerun:      rerun,
+			Statements: m.statements(migration.Script),
+		}
+		for _, statement := range planned.Statements {
+			if isDestructive(statement) {
+				planned.Destructive = true
+			}
+		}
+		plan.Migrations = append(plan.Migrations, planned)
+		fmt.Fprintf(hash, "%s\x00%s\x00", planned.ID, planned.Checksum)
+	}
+	plan.Checksum = fmt.Sprintf("%x", hash.Sum(nil))
+	return plan
+}
+
+// Destructive returns whether any of the planned migrations is destructive
+func (p *Plan) Destructive() bool {
+	for _, migration := range p.Migrations {
+		if migration.Destructive {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteJSON writes the plan to w as indented JSON
+func (p *Plan) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(p)
+}
+
+// statements splits a script into statements for presentation. Dialects
+// which split scripts for execution are used as they are. Otherwise the
+// quoting rules of the dialect are applied, but the script is still executed
+// whole.
+func (m Migrator) statements(script string) []string {
+	if splitter, ok := m.Dialect.(StatementSplitter); ok {
+		if statements := splitter.SplitStatements(script); statements != nil {
+			return statements
+		}
+	}
+	switch m.Dialect.(type) {
+	case postgresDialect, *postgresDialect:
+		return postgresSplitter.split(script)
+	}
+	return genericSplitter.split(script)
+}
+
+// isDestructive returns whether the statement drops, truncates, deletes or
+// renames existing objects or data
+func isDestructive(statement string) bool {
+	words := strings.Fields(strings.ToUpper(stripLeadingComments(statement)))
+	if len(words) == 0 {
+		return false
+	}
+	switch words[0] {
+	case "DROP", "TRUNCATE", "DELETE", "RENAME":
+		return true
+	case "ALTER":
+		for _, word := range words[1:] {
+			if word == "DROP" || word == "RENAME" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestNewPlan(t *testing.T) {
+	migrator := NewMigrator()
+	migrations := []*Migration{
+		{ID: "2020-01-03 Drop", Script: "ALTER TABLE users DROP COLUMN legacy; DELETE FROM audit"},
+		{ID: "2020-01-02 Refresh", Script: "REFRESH MATERIALIZED VIEW totals", Always: true},
+		{ID: "2020-01-01 Users", Script: "CREATE TABLE users (id INTEGER)"},
+		{ID: "2020-01-04 Function", Script: "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql"},
+	}
+	applied := map[string]*AppliedMigration{
+		"2020-01-01 Users":   {Migration: Migration{ID: "2020-01-01 Users"}},
+		"2020-01-02 Refresh": {Migration: Migration{ID: "2020-01-02 Refresh"}},
+	}
+
+	plan := migrator.NewPlan(migrations, applied)
+	if len(plan.Migrations) != 3 {
+		t.Fatalf("Expected 3 planned migrations. Got %d", len(plan.Migrations))
+	}
+	refresh, drop, function := plan.Migrations[0], plan.Migrations[1], plan.Migrations[2]
+	if refresh.ID != "2020-01-02 Refresh" || !refresh.Rerun || refresh.Destructive {
+		t.Errorf("Expected a non-destructive rerun first. Got %+v", refresh)
+	}
+	if !drop.Destructive || len(drop.Statements) != 2 {
+		t.Errorf("Expected 2 destructive statements. Got %+v", drop)
+	}
+	if len(function.Statements) != 1 {
+		t.Errorf("Expected the function body to stay whole. Got %q", function.Statements)
+	}
+	if !plan.Destructive() {
+		t.Error("Expected the plan to be destructive")
+	}
+
+	if again := migrator.NewPlan(migrations, applied); again.Checksum != plan.Checksum {
+		t.Error("Expected identical plans to have identical checksums")
+	}
+	if fresh := migrator.NewPlan(migrations, nil); fresh.Checksum == plan.Checksum || len(fresh.Migrations) != 4 {
+		t.Errorf("Expected a different plan for a fresh database. Got %+v", fresh)
+	}
+
+	var buf bytes.Buffer
+	if err := plan.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Plan
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Checksum != plan.Checksum || len(decoded.Migrations) != 3 {
+		t.Errorf("Expected the JSON to round trip. Got %s", buf.String())
+	}
+}
+
+func TestIsDML(t *testing.T) {
+	for statement, expected := range map[string]bool{
+		"UPDATE users SET active = true":        true,
+		"-- backfill\ninsert into t values (1)": true,
+		"CREATE TABLE t (id INTEGER)":           false,
+		"SELECT 1":                              false,
+	} {
+		if isDML(statement) != expected {
+			t.Errorf("Expected isDML(%q) to be %v", statement, expected)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package schema
 
 import (
+	"encoding/json"
 	"fmt"
 	"hash/crc32"
 	"strings"
+	"time"
 )
 
 const postgresAdvisoryLockSalt uint32 = 542384964
@@ -12,10 +14,190 @@ const postgresAdvisoryLockSalt uint32 = 542384964
 // databases
 var Postgres = postgresDialect{}
 
+var _ Updater = (*postgresDialect)(nil)
 var _ SQLLocker = (*postgresDialect)(nil)
+var _ TransactionLocker = (*postgresDialect)(nil)
+var _ CapabilityReporter = (*postgresDialect)(nil)
+var _ StatementSplitter = (*postgresDialect)(nil)
+var _ CopyInSQL = (*postgresDialect)(nil)
+var _ SeedInserter = (*postgresDialect)(nil)
+var _ Explainer = (*postgresDialect)(nil)
+var _ TransactionConfigurer = (*postgresDialect)(nil)
+var _ ReplicaDetector = (*postgresDialect)(nil)
+var _ VersionReporter = (*postgresDialect)(nil)
+var _ BuildRecorder = (*postgresDialect)(nil)
+var _ ScriptRecorder = (*postgresDialect)(nil)
+var _ SetRecorder = (*postgresDialect)(nil)
+var _ HistoryPruner = (*postgresDialect)(nil)
+var _ Introspector = (*postgresDialect)(nil)
+var _ ApplicationNamer = (*postgresDialect)(nil)
+var _ Maintainer = (*postgresDialect)(nil)
+var _ ObjectCommenter = (*postgresDialect)(nil)
+var _ LockHolderReporter = (*postgresDialect)(nil)
+var _ ExtensionCreator = (*postgresDialect)(nil)
+var _ NonTransactionalDetector = (*postgresDialect)(nil)
+var _ ConcurrentIndexBuilder = (*postgresDialect)(nil)
 
 // Postgres is the Postgresql dialect
-type postgresDialect struct{}
+type postgresDialect struct {
+	lockMode         postgresLockMode
+	splitStatements  bool
+	lockTimeout      time.Duration
+	statementTimeout time.Duration
+}
+
+// postgresLockMode selects how the Postgres dialect serializes migrators
+type postgresLockMode int
+
+const (
+	// postgresSessionLock holds pg_advisory_lock for the whole run
+	postgresSessionLock postgresLockMode = iota
+	// postgresTransactionLock takes pg_advisory_xact_lock in the migration
+	// transaction
+	postgresTransactionLock
+	// postgresTableLock locks the tracking table itself in the migration
+	// transaction
+	postgresTableLock
+)
+
+// NewPostgres creates a new Postgres dialect. Without options it is
+// identical to the Postgres variable. Customization of the locking
+// strategy is made with the WithPostgresTransactionLock and
+// WithPostgresTableLock options, and per-statement execution is enabled
+// with WithPostgresStatementSplitting.
+func NewPostgres(opts ...func(p *postgresDialect)) postgresDialect {
+	p := postgresDialect{}
+	for _, opt := range opts {
+		opt(&p)
+	}
+	return p
+}
+
+// WithPostgresMigrationTimeouts sets lock_timeout and statement_timeout with
+// SET LOCAL at the start of each migration's transaction. An ALTER TABLE
+// waiting for a lock held by a long-running query then fails after
+// lockTimeout, rather than queueing behind it and blocking all other traffic
+// on the table. Zero leaves a timeout unchanged. Note that with a
+// transaction lock, every migration shares one transaction, so the
+// timeouts apply to each statement rather than to each migration.
+func WithPostgresMigrationTimeouts(lockTimeout, statementTimeout time.Duration) func(p *postgresDialect) {
+	return func(p *postgresDialect) {
+		p.lockTimeout = lockTimeout
+		p.statementTimeout = statementTimeout
+	}
+}
+
+// WithPostgresTransactionLock configures the dialect to lock with
+// pg_advisory_xact_lock inside the migration transaction instead of holding
+// a session-level advisory lock. The lock is then released automatically on
+// commit, rollback or connection death, so a migrator process killed mid-run
+// can never leave a stuck lock behind.
+func WithPostgresTransactionLock() func(p *postgresDialect) {
+	return func(p *postgresDialect) {
+		p.lockMode = postgresTransactionLock
+	}
+}
+
+// WithPostgresTableLock configures the dialect to lock the tracking table
+// itself (LOCK TABLE ... IN SHARE ROW EXCLUSIVE MODE) inside the migration
+// transaction rather than using advisory locks. Use it behind PgBouncer in
+// transaction pooling mode, or behind proxies which don't support advisory
+// locks. Readers of the tracking table are not blocked by the lock. Note
+// that WithSessionSetup statements are unreliable in transaction pooling
+// mode, since they may run on a different server connection.
+func WithPostgresTableLock() func(p *postgresDialect) {
+	return func(p *postgresDialect) {
+		p.lockMode = postgresTableLock
+	}
+}
+
+// WithPostgresStatementSplitting configures the dialect to execute migration
+// scripts one statement at a time, so that a failure reports which statement
+// caused it. The splitter understands dollar-quoted function bodies and DO
+// blocks ($$ ... $$ and $tag$ ... $tag$), BEGIN ATOMIC bodies, escape strings
+// and nested comments, so plpgsql-heavy migrations are not split apart.
+func WithPostgresStatementSplitting() func(p *postgresDialect) {
+	return func(p *postgresDialect) {
+		p.splitStatements = true
+	}
+}
+
+// SplitStatements splits a migration script into its statements when the
+// dialect was configured with WithPostgresStatementSplitting, and returns
+// nil otherwise
+func (p postgresDialect) SplitStatements(script string) []string {
+	if !p.splitStatements {
+		return nil
+	}
+	return postgresSplitter.split(script)
+}
+
+// TransactionSQL returns the SET LOCAL statements for the configured
+// migration timeouts
+func (p postgresDialect) TransactionSQL() []string {
+	statements := make([]string, 0)
+	if p.lockTimeout > 0 {
+		statements = append(statements, fmt.Sprintf("SET LOCAL lock_timeout = %d", timeoutMillis(p.lockTimeout)))
+	}
+	if p.statementTimeout > 0 {
+		statements = append(statements, fmt.Sprintf("SET LOCAL statement_timeout = %d", timeoutMillis(p.statementTimeout)))
+	}
+	return statements
+}
+
+// timeoutMillis returns the timeout in whole milliseconds, rounded up so
+// that a timeout under a millisecond isn't set as 0, which Postgres treats
+// as no timeout at all
+func timeoutMillis(timeout time.Duration) int64 {
+	return int64((timeout + time.Millisecond - 1) / time.Millisecond)
+}
+
+// ReplicaSQL returns a query which is true while the server is a standby
+func (p postgresDialect) ReplicaSQL() string {
+	return "SELECT pg_is_in_recovery()"
+}
+
+// VersionSQL returns a query for the server version
+func (p postgresDialect) VersionSQL() string {
+	return "SHOW server_version"
+}
+
+// ApplicationNameSQL returns the statement which sets application_name,
+// which is shown in pg_stat_activity
+func (p postgresDialect) ApplicationNameSQL(name string) string {
+	return fmt.Sprintf("SET application_name = '%s'", strings.ReplaceAll(name, "'", "''"))
+}
+
+// Capabilities reports that Postgres supports transactional DDL, along with
+// the configured lock strategy
+func (p postgresDialect) Capabilities() Capabilities {
+	c := Capabilities{
+		TransactionalDDL: true,
+		LockStrategy:     LockStrategyAdvisory,
+	}
+	switch p.lockMode {
+	case postgresTransactionLock:
+		c.LockStrategy = LockStrategyTransactionAdvisory
+	case postgresTableLock:
+		c.LockStrategy = LockStrategyTable
+	}
+	return c
+}
+
+// TransactionLockSQL returns the statement which locks inside the migration
+// transaction when the dialect was configured with WithPostgresTransactionLock
+// or WithPostgresTableLock, and an empty string otherwise
+func (p postgresDialect) TransactionLockSQL(tableName string) string {
+	switch p.lockMode {
+	case postgresTransactionLock:
+		lockID := p.advisoryLockID(tableName)
+		return fmt.Sprintf(`SELECT pg_advisory_xact_lock(%s)`, lockID)
+	case postgresTableLock:
+		return fmt.Sprintf(`LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE`, tableName)
+	default:
+		return ""
+	}
+}
 
 func (p postgresDialect) LockSQL(tableName string) string {
 	lockID := p.advisoryLockID(tableName)
@@ -27,6 +209,22 @@ func (p postgresDialect) UnlockSQL(tableName string) string {
 	return fmt.Sprintf(`SELECT pg_advisory_unlock(%s)`, lockID)
 }
 
+// LockHolderSQL returns the sessions holding the lock which LockSQL or
+// TransactionLockSQL takes, from pg_locks
+func (p postgresDialect) LockHolderSQL(tableName string) string {
+	held := fmt.Sprintf(`l.locktype = 'advisory' AND l.classid = 0 AND l.objid::bigint = %s AND l.objsubid = 1`, p.advisoryLockID(tableName))
+	if p.lockMode == postgresTableLock {
+		held = fmt.Sprintf(`l.locktype = 'relation' AND l.relation = %s::regclass AND l.mode = 'ShareRowExclusiveLock'`, quotedLiteral(tableName))
+	}
+	return fmt.Sprintf(`
+		SELECT a.pid, a.application_name, host(a.client_addr), a.backend_start
+		FROM pg_locks l
+		JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE %s AND l.granted
+		ORDER BY a.pid
+	`, held)
+}
+
 // CreateSQL takes the name of the migration tracking table and
 // returns the SQL statement needed to create it
 func (p postgresDialect) CreateSQL(tableName string) string {
@@ -53,6 +251,79 @@ func (p postgresDialect) InsertSQL(tableName string) string {
 	)
 }
 
+// UpdateSQL takes the name of the migration tracking table and
+// returns the SQL statement needed to refresh the record of a migration
+// which has been run again. Its arguments match InsertSQL.
+func (p postgresDialect) UpdateSQL(tableName string) string {
+	return fmt.Sprintf(`
+				UPDATE %s
+				SET checksum = $2, execution_time_in_millis = $3, applied_at = $4
+				WHERE id = $1
+				`,
+		tableName,
+	)
+}
+
+// CreateBuildsSQL takes the name of the build metadata table and returns
+// the SQL statement needed to create it
+func (p postgresDialect) CreateBuildsSQL(tableName string) string {
+	return fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s (
+					id VARCHAR(255) NOT NULL,
+					build VARCHAR(1024) NOT NULL,
+					applied_at TIMESTAMP WITH TIME ZONE NOT NULL
+				)
+			`, tableName)
+}
+
+// InsertBuildSQL takes the name of the build metadata table and returns
+// the SQL statement needed to record the build which applied a migration
+func (p postgresDialect) InsertBuildSQL(tableName string) string {
+	return fmt.Sprintf(`INSERT INTO %s ( id, build, applied_at ) VALUES ( $1, $2, $3 )`, tableName)
+}
+
+// CreateScriptsSQL takes the name of the scripts table and returns the SQL
+// statement needed to create it
+func (p postgresDialect) CreateScriptsSQL(tableName string) string {
+	return fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s (
+					id VARCHAR(255) NOT NULL,
+					script BYTEA NOT NULL,
+					applied_at TIMESTAMP WITH TIME ZONE NOT NULL
+				)
+			`, tableName)
+}
+
+// InsertScriptSQL takes the name of the scripts table and returns the SQL
+// statement needed to store the script of an applied migration
+func (p postgresDialect) InsertScriptSQL(tableName string) string {
+	return fmt.Sprintf(`INSERT INTO %s ( id, script, applied_at ) VALUES ( $1, $2, $3 )`, tableName)
+}
+
+// CreateSetSQL takes the name of the set table and returns the SQL
+// statement needed to create it
+func (p postgresDialect) CreateSetSQL(tableName string) string {
+	return fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s (
+					checksum VARCHAR(64) NOT NULL,
+					migrations INTEGER NOT NULL,
+					applied_at TIMESTAMP WITH TIME ZONE NOT NULL
+				)
+			`, tableName)
+}
+
+// InsertSetSQL takes the name of the set table and returns the SQL
+// statement needed to store the checksum of an applied migration set
+func (p postgresDialect) InsertSetSQL(tableName string) string {
+	return fmt.Sprintf(`INSERT INTO %s ( checksum, migrations, applied_at ) VALUES ( $1, $2, $3 )`, tableName)
+}
+
+// DeleteSQL takes the name of the tracking table, or a table next to it,
+// and returns the SQL statement needed to delete the rows of a migration
+func (p postgresDialect) DeleteSQL(tableName string) string {
+	return fmt.Sprintf(`DELETE FROM %s WHERE id = $1`, tableName)
+}
+
 // SelectSQL takes the name of the migration tracking table and
 // returns the SQL statement to retrieve all records from it
 //
@@ -64,6 +335,130 @@ func (p postgresDialect) SelectSQL(tableName string) string {
 	`, tableName)
 }
 
+// CopyInSQL returns the COPY FROM STDIN statement which bulk loads the
+// columns of the table. The table may be schema-qualified with a dot. The
+// statement is understood by the lib/pq driver, which streams the rows
+// passed to each execution of the prepared statement.
+func (p postgresDialect) CopyInSQL(table string, columns []string) string {
+	quotedColumns := make([]string, len(columns))
+	for i, column := range columns {
+		quotedColumns[i] = p.quotedIdent(column)
+	}
+	parts := strings.SplitN(table, ".", 2)
+	quotedTable := p.QuotedTableName("", parts[0])
+	if len(parts) == 2 {
+		quotedTable = p.QuotedTableName(parts[0], parts[1])
+	}
+	return fmt.Sprintf(`COPY %s (%s) FROM STDIN`, quotedTable, strings.Join(quotedColumns, ", "))
+}
+
+// SeedSQL returns a multi-row INSERT with numbered placeholders, which skips
+// conflicting rows with ON CONFLICT DO NOTHING
+func (p postgresDialect) SeedSQL(table string, columns []string, rows int, ignoreConflicts bool) string {
+	statement := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, strings.Join(columns, ", "), seedValues(len(columns), rows, func(i int) string {
+		return fmt.Sprintf("$%d", i)
+	}))
+	if ignoreConflicts {
+		statement += " ON CONFLICT DO NOTHING"
+	}
+	return statement
+}
+
+// AnalyzeSQL returns an ANALYZE statement for the table
+func (p postgresDialect) AnalyzeSQL(tableName string) string {
+	return "ANALYZE " + tableName
+}
+
+// CommentTableSQL returns a COMMENT ON TABLE statement
+func (p postgresDialect) CommentTableSQL(tableName, comment string) string {
+	return fmt.Sprintf("COMMENT ON TABLE %s IS %s", tableName, quotedLiteral(comment))
+}
+
+// CommentIndexSQL returns a COMMENT ON INDEX statement
+func (p postgresDialect) CommentIndexSQL(indexName, tableName, comment string) string {
+	return fmt.Sprintf("COMMENT ON INDEX %s IS %s", indexName, quotedLiteral(comment))
+}
+
+// CreateExtensionSQL returns a CREATE EXTENSION IF NOT EXISTS statement
+func (p postgresDialect) CreateExtensionSQL(name string) string {
+	return "CREATE EXTENSION IF NOT EXISTS " + p.quotedIdent(name)
+}
+
+// RequiresNoTransaction reports the statements which Postgres refuses to run
+// inside a transaction: concurrent index builds and drops, REINDEX and
+// DETACH PARTITION CONCURRENTLY, VACUUM, database and tablespace DDL, ALTER
+// SYSTEM, and before Postgres 12, ALTER TYPE ... ADD VALUE
+func (p postgresDialect) RequiresNoTransaction(statement, serverVersion string) bool {
+	words := strings.Fields(strings.ToUpper(strings.TrimRight(stripLeadingComments(statement), "; \t\n")))
+	has := func(word string) bool {
+		for _, w := range words {
+			if w == word {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case len(words) == 0:
+		return false
+	case words[0] == "VACUUM":
+		return true
+	case words[0] == "REINDEX":
+		return has("CONCURRENTLY")
+	case len(words) < 2:
+		return false
+	}
+	switch words[0] + " " + words[1] {
+	case "CREATE DATABASE", "DROP DATABASE", "CREATE TABLESPACE", "DROP TABLESPACE", "ALTER SYSTEM":
+		return true
+	case "CREATE INDEX", "CREATE UNIQUE", "DROP INDEX", "ALTER TABLE":
+		return has("CONCURRENTLY") && (words[1] != "TABLE" || has("DETACH"))
+	case "ALTER TYPE":
+		if !has("ADD") || !has("VALUE") || serverVersion == "" {
+			return false
+		}
+		older, err := versionOlder(serverVersion, "12")
+		return err == nil && older
+	}
+	return false
+}
+
+// IndexValiditySQL returns whether the index is valid from pg_index. A
+// concurrent build which fails leaves the index invalid.
+func (p postgresDialect) IndexValiditySQL() string {
+	return `SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass($1)`
+}
+
+// SessionIDSQL returns the backend pid of the session
+func (p postgresDialect) SessionIDSQL() string {
+	return `SELECT pg_backend_pid()`
+}
+
+// IndexProgressSQL returns the progress of the index build by the backend
+// from pg_stat_progress_create_index, which requires Postgres 12
+func (p postgresDialect) IndexProgressSQL() string {
+	return `
+		SELECT phase, blocks_done, blocks_total, tuples_done, tuples_total
+		FROM pg_stat_progress_create_index
+		WHERE pid = $1
+	`
+}
+
+// DropIndexConcurrentlySQL returns a DROP INDEX CONCURRENTLY statement
+func (p postgresDialect) DropIndexConcurrentlySQL(indexName string) string {
+	return "DROP INDEX CONCURRENTLY IF EXISTS " + indexName
+}
+
+// VacuumSQL returns a VACUUM statement for the table
+func (p postgresDialect) VacuumSQL(tableName string) string {
+	return "VACUUM " + tableName
+}
+
+// Name returns "postgres", which selects Postgres script variants
+func (p postgresDialect) Name() string {
+	return "postgres"
+}
+
 // QuotedTableName returns the string value of the name of the migration
 // tracking table after it has been quoted for Postgres
 //
@@ -74,15 +469,99 @@ func (p postgresDialect) QuotedTableName(schemaName, tableName string) string {
 	return p.quotedIdent(schemaName) + "." + p.quotedIdent(tableName)
 }
 
+// MaxIdentifierLength returns 63, the longest identifier Postgres keeps
+// without truncating it
+func (p postgresDialect) MaxIdentifierLength() int {
+	return 63
+}
+
 // quotedIdent wraps the supplied string in the Postgres identifier
 // quote character
 func (p postgresDialect) quotedIdent(ident string) string {
 	return `"` + strings.ReplaceAll(ident, `"`, "") + `"`
 }
 
-// advisoryLockID generates a table-specific lock name to use
+// advisoryLockID generates a table-specific lock name to use. The Migrator
+// supplies the quoted, schema-qualified tracking table name, so migrators
+// tracking different tables never block each other. Postgres already scopes
+// advisory locks to the current database, so applications in different
+// databases of a shared cluster never contend either. A name without a
+// schema is hashed without its quotes, which keeps the key earlier versions
+// used, so that old and new instances exclude each other during a rolling
+// deploy.
 func (p postgresDialect) advisoryLockID(tableName string) string {
+	if unquoted := strings.Trim(tableName, `"`); !strings.Contains(unquoted, `"`) {
+		tableName = unquoted
+	}
 	sum := crc32.ChecksumIEEE([]byte(tableName))
 	sum = sum * postgresAdvisoryLockSalt
 	return fmt.Sprint(sum)
 }
+
+// ExplainSQL returns an EXPLAIN statement with JSON output
+func (p postgresDialect) ExplainSQL(statement string) string {
+	return "EXPLAIN (FORMAT JSON) " + statement
+}
+
+// ParseExplain reads the total cost and row estimate of the top plan node
+func (p postgresDialect) ParseExplain(output string) (cost float64, rows float64, err error) {
+	var plans []struct {
+		Plan struct {
+			TotalCost float64 `json:"Total Cost"`
+			PlanRows  float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	err = json.Unmarshal([]byte(output), &plans)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(plans) == 0 {
+		return 0, 0, fmt.Errorf("EXPLAIN produced no plan")
+	}
+	return plans[0].Plan.TotalCost, plans[0].Plan.PlanRows, nil
+}
+
+// TablesSQL returns a query for the names of the tables in the schema
+func (p postgresDialect) TablesSQL(schemaName string) string {
+	return fmt.Sprintf(`
+		SELECT table_name
+		FROM information_schema.tables
+		WHERE table_schema = %s AND table_type = 'BASE TABLE'
+		ORDER BY table_name
+	`, p.schemaExpr(schemaName))
+}
+
+// ColumnsSQL returns a query for the columns of the tables in the schema
+func (p postgresDialect) ColumnsSQL(schemaName string) string {
+	return fmt.Sprintf(`
+		SELECT table_name, column_name, data_type, is_nullable = 'YES', column_default
+		FROM information_schema.columns
+		WHERE table_schema = %s
+		ORDER BY table_name, ordinal_position
+	`, p.schemaExpr(schemaName))
+}
+
+// IndexesSQL returns a query for the indexed columns of the tables in the
+// schema. Expressions in indexes aren't listed.
+func (p postgresDialect) IndexesSQL(schemaName string) string {
+	return fmt.Sprintf(`
+		SELECT t.relname, i.relname, ix.indisunique, a.attname
+		FROM pg_class t
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN pg_index ix ON ix.indrelid = t.oid
+		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN LATERAL unnest(ix.indkey::int2[]) WITH ORDINALITY AS k(attnum, position) ON true
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE n.nspname = %s
+		ORDER BY t.relname, i.relname, k.position
+	`, p.schemaExpr(schemaName))
+}
+
+// schemaExpr returns the schema name as a string literal, or the current
+// schema when it is empty
+func (p postgresDialect) schemaExpr(schemaName string) string {
+	if schemaName == "" {
+		return "current_schema()"
+	}
+	return quotedLiteral(schemaName)
+}
@@ -1,8 +1,14 @@
 package schema
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestPostgresLockSQL(t *testing.T) {
@@ -13,21 +19,145 @@ func TestPostgresLockSQL(t *testing.T) {
 		t.Errorf("EXPECTED pg_advisory_lock:\n%s", sql)
 	}
 }
+func TestPostgresLockSQLDependsOnTrackingTable(t *testing.T) {
+	public := NewMigrator(WithTableName("public", "schema_migrations"))
+	other := NewMigrator(WithTableName("other", "schema_migrations"))
+	if Postgres.LockSQL(public.QuotedTableName()) == Postgres.LockSQL(other.QuotedTableName()) {
+		t.Error("Expected tracking tables in different schemas to use different lock keys")
+	}
+
+	// Earlier versions hashed the unquoted table name, which must keep its
+	// key for rolling deploys
+	if sql := Postgres.LockSQL(NewMigrator().QuotedTableName()); sql != "SELECT pg_advisory_lock(1367654712)" {
+		t.Errorf("Expected the default tracking table to keep its lock key. Got %s", sql)
+	}
+}
+
+func TestPostgresCapabilities(t *testing.T) {
+	if !Postgres.Capabilities().TransactionalDDL {
+		t.Error("Expected Postgres to support transactional DDL")
+	}
+	if s := Postgres.Capabilities().LockStrategy; s != LockStrategyAdvisory {
+		t.Errorf("Expected %s lock strategy by default. Got %s", LockStrategyAdvisory, s)
+	}
+	if s := NewPostgres(WithPostgresTableLock()).Capabilities().LockStrategy; s != LockStrategyTable {
+		t.Errorf("Expected %s lock strategy. Got %s", LockStrategyTable, s)
+	}
+}
+
+func TestPostgresTransactionLockSQL(t *testing.T) {
+	name := `"schema_migrations"`
+
+	if sql := Postgres.TransactionLockSQL(name); sql != "" {
+		t.Errorf("Expected no transaction lock by default. Got:\n%s", sql)
+	}
+	sql := NewPostgres(WithPostgresTransactionLock()).TransactionLockSQL(name)
+	if !strings.Contains(strings.ToLower(sql), "pg_advisory_xact_lock") {
+		t.Errorf("EXPECTED pg_advisory_xact_lock:\n%s", sql)
+	}
+	sql = NewPostgres(WithPostgresTableLock()).TransactionLockSQL(name)
+	if !strings.Contains(sql, "LOCK TABLE "+name) {
+		t.Errorf("EXPECTED LOCK TABLE:\n%s", sql)
+	}
+}
+
+func TestPostgres11SimultaneousTransactionLockMigrations(t *testing.T) {
+	testSimultaneousMigrationsWithDialect(t, NewPostgres(WithPostgresTransactionLock()))
+}
+
+func TestPostgres11SimultaneousTableLockMigrations(t *testing.T) {
+	testSimultaneousMigrationsWithDialect(t, NewPostgres(WithPostgresTableLock()))
+}
+
+func testSimultaneousMigrationsWithDialect(t *testing.T, dialect Dialect) {
+	concurrency := 4
+	migrationsTable := fmt.Sprintf("locking_migrations_%d", rand.Int())
+	dataTable := fmt.Sprintf("locking_data_%d", rand.Int())
+	migrations := []*Migration{
+		{
+			ID:     "2020-05-01 Create Data Table",
+			Script: fmt.Sprintf("CREATE TABLE %s (id INTEGER)", dataTable),
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db := connectDB(t, "postgres11")
+			migrator := NewMigrator(
+				WithDialect(dialect),
+				WithTableName(migrationsTable),
+			)
+			err := migrator.Apply(db, migrations)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPostgresCopyInSQL(t *testing.T) {
+	sql := Postgres.CopyInSQL("public.users", []string{"id", "name"})
+	if sql != `COPY "public"."users" ("id", "name") FROM STDIN` {
+		t.Errorf("Unexpected COPY statement:\n%s", sql)
+	}
+}
+
+func TestPostgres11CopyFromMigration(t *testing.T) {
+	db := connectDB(t, "postgres11")
+	dataTable := fmt.Sprintf("copied_%d", rand.Int())
+	migrator := NewMigrator(WithTableName(fmt.Sprintf("copy_migrations_%d", rand.Int())))
+	err := migrator.Apply(db, []*Migration{
+		{
+			ID:     "2020-01-01 Seed",
+			Script: fmt.Sprintf("CREATE TABLE %s (id INTEGER, name TEXT)", dataTable),
+			Copy: &CopyFrom{
+				Table:   dataTable,
+				Columns: []string{"id", "name"},
+				Source:  CSVCopySource(strings.NewReader("1,Alice\n2,\"Bob, Jr.\"\n")),
+			},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	count := 0
+	err = db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", dataTable)).Scan(&count)
+	if err != nil {
+		t.Error(err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 copied rows. Got %d", count)
+	}
+}
+
 func TestPostgres11CreateMigrationsTable(t *testing.T) {
 	db := connectDB(t, "postgres11")
 	migrator := NewMigrator(WithDialect(Postgres))
-	err := migrator.createMigrationsTable(db)
+	err := migrator.createMigrationsTable(context.Background(), db)
 	if err != nil {
 		t.Errorf("Error occurred when creating migrations table: %s", err)
 	}
 
 	// Test that we can re-run it safely
-	err = migrator.createMigrationsTable(db)
+	err = migrator.createMigrationsTable(context.Background(), db)
 	if err != nil {
 		t.Errorf("Calling createMigrationsTable a second time failed: %s", err)
 	}
 }
 
+func TestPostgres11ReplicaCheck(t *testing.T) {
+	db := connectDB(t, "postgres11")
+	migrator := NewMigrator(WithDialect(Postgres), WithTableName("replica_migrations"), WithReplicaCheck())
+	err := migrator.Apply(db, []*Migration{{ID: "2020-01-01 Primary", Script: "SELECT 1"}})
+	if err != nil {
+		t.Errorf("Expected the primary not to be refused. Got %v", err)
+	}
+}
+
 func TestPostgres11MultiStatementMigrations(t *testing.T) {
 	db := connectDB(t, "postgres11")
 	tableName := "musicdatabase_migrations"
@@ -78,3 +208,314 @@ func TestPostgres11MultiStatementMigrations(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestPostgres11BlueGreen(t *testing.T) {
+	db := connectDB(t, "postgres11")
+	live := fmt.Sprintf("live_%d", rand.Int())
+	_, err := db.Exec(fmt.Sprintf(`CREATE SCHEMA "%s"`, live))
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator := NewMigrator(WithTableName(live, "schema_migrations"))
+	initial := []*Migration{
+		{ID: "2020-01-01 Users", Script: fmt.Sprintf(`CREATE TABLE "%s".users (id INTEGER PRIMARY KEY, name TEXT)`, live)},
+	}
+	err = migrator.Apply(db, initial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(fmt.Sprintf(`INSERT INTO "%s".users VALUES (1, 'Alice')`, live))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verified := false
+	rollout := &BlueGreen{
+		Migrator: migrator,
+		DB:       db,
+		Target:   live + "_green",
+		CopyData: true,
+		Verify: func(ctx context.Context, db *sql.DB, schema string) error {
+			verified = true
+			var count int
+			return db.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(email) + COUNT(*) FROM "%s".users`, schema)).Scan(&count)
+		},
+	}
+	migrations := append(initial, &Migration{ID: "2020-01-02 Email", Script: "ALTER TABLE users ADD COLUMN email TEXT"})
+	err = rollout.Prepare(context.Background(), migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified {
+		t.Error("Expected the Verify callback to be called")
+	}
+
+	var columns int
+	err = db.QueryRow(`SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = $1 AND table_name = 'users' AND column_name = 'email'`, live).Scan(&columns)
+	if err != nil || columns != 0 {
+		t.Errorf("Expected the live schema to be untouched. Got %d (%v)", columns, err)
+	}
+	status, err := migrator.Status(db, migrations)
+	if err != nil || len(status.Pending) != 1 {
+		t.Errorf("Expected the live schema to still have 1 pending migration. Got %+v (%v)", status, err)
+	}
+}
+
+func TestPostgresParseExplain(t *testing.T) {
+	output := `[{"Plan": {"Node Type": "ModifyTable", "Total Cost": 35.5, "Plan Rows": 1200}}]`
+	cost, rows, err := Postgres.ParseExplain(output)
+	if err != nil || cost != 35.5 || rows != 1200 {
+		t.Errorf("Unexpected estimate %v, %v (%v)", cost, rows, err)
+	}
+	if sql := Postgres.ExplainSQL("DELETE FROM users"); sql != "EXPLAIN (FORMAT JSON) DELETE FROM users" {
+		t.Errorf("Unexpected EXPLAIN statement: %s", sql)
+	}
+}
+
+func TestPostgresMigrationTimeouts(t *testing.T) {
+	if statements := Postgres.TransactionSQL(); len(statements) != 0 {
+		t.Errorf("Expected no timeouts by default. Got %v", statements)
+	}
+	p := NewPostgres(WithPostgresMigrationTimeouts(5*time.Second, time.Minute))
+	statements := p.TransactionSQL()
+	expected := []string{"SET LOCAL lock_timeout = 5000", "SET LOCAL statement_timeout = 60000"}
+	if strings.Join(statements, ";") != strings.Join(expected, ";") {
+		t.Errorf("Expected %v. Got %v", expected, statements)
+	}
+	p = NewPostgres(WithPostgresMigrationTimeouts(time.Microsecond, 1500*time.Microsecond))
+	statements = p.TransactionSQL()
+	expected = []string{"SET LOCAL lock_timeout = 1", "SET LOCAL statement_timeout = 2"}
+	if strings.Join(statements, ";") != strings.Join(expected, ";") {
+		t.Errorf("Expected timeouts to be rounded up. Got %v", statements)
+	}
+}
+
+func TestPostgresApplicationName(t *testing.T) {
+	m := NewMigrator(WithApplicationName(""), WithSessionSetup("SET ROLE deployer"))
+	expected := []string{"SET application_name = 'schema-migrator'", "SET ROLE deployer"}
+	if statements := m.sessionStatements(); strings.Join(statements, ";") != strings.Join(expected, ";") {
+		t.Errorf("Expected %v. Got %v", expected, statements)
+	}
+	if sql := Postgres.ApplicationNameSQL("o'brien"); sql != "SET application_name = 'o''brien'" {
+		t.Errorf("Expected the name to be quoted. Got %s", sql)
+	}
+}
+
+func TestPostgres11Introspection(t *testing.T) {
+	db := connectDB(t, "postgres11")
+	migrator := NewMigrator(WithDialect(Postgres), WithTableName("introspected_migrations"))
+	err := migrator.Apply(db, []*Migration{{ID: "2020-01-01 Introspected", Script: `
+		CREATE TABLE introspected (id BIGSERIAL PRIMARY KEY, name TEXT NOT NULL, email TEXT);
+		CREATE UNIQUE INDEX introspected_name_email ON introspected (name, email);
+	`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns, err := migrator.ListColumns(db, "introspected")
+	if err != nil || len(columns) != 3 {
+		t.Fatalf("Expected 3 columns. Got %d (%v)", len(columns), err)
+	}
+	if c := columns[0]; c.Name != "id" || c.Type != "bigint" || c.Nullable || !strings.HasPrefix(c.Default, "nextval(") {
+		t.Errorf("Unexpected column: %+v", c)
+	}
+	indexes, err := migrator.ListIndexes(db, "introspected")
+	if err != nil || len(indexes) != 2 {
+		t.Fatalf("Expected 2 indexes. Got %d (%v)", len(indexes), err)
+	}
+	if i := indexes[0]; i.Name != "introspected_name_email" || !i.Unique || strings.Join(i.Columns, ",") != "name,email" {
+		t.Errorf("Unexpected index: %+v", i)
+	}
+}
+
+func TestPostgres11ObjectComments(t *testing.T) {
+	db := connectDB(t, "postgres11")
+	migrator := NewMigrator(WithDialect(Postgres), WithTableName("commented_migrations"), WithObjectComments())
+	err := migrator.Apply(db, []*Migration{{ID: "2020-01-01 Commented", Script: `
+		CREATE TABLE commented (id INTEGER);
+		CREATE INDEX commented_id ON commented (id);
+	`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, object := range []string{"commented", "commented_id"} {
+		var comment string
+		err = db.QueryRow(`SELECT obj_description($1::regclass, 'pg_class')`, object).Scan(&comment)
+		if err != nil || comment != "Created by migration '2020-01-01 Commented'" {
+			t.Errorf("Expected %s to be commented with the migration ID. Got %q (%v)", object, comment, err)
+		}
+	}
+}
+
+func TestPostgres11TemplateDatabase(t *testing.T) {
+	admin := connectDB(t, "postgres11")
+	dsn := DBConns["postgres11"].DSN
+	template := &TemplateDatabase{
+		Migrator: NewMigrator(),
+		Admin:    admin,
+		Name:     fmt.Sprintf("template_%d", rand.Int()),
+		Open: func(name string) (*sql.DB, error) {
+			return sql.Open("postgres", strings.Replace(dsn, "/schematests?", "/"+name+"?", 1))
+		},
+	}
+	defer func() { _ = template.Drop(context.Background(), template.Name) }()
+	migrations := []*Migration{
+		{ID: "2020-01-01 Users", Script: "CREATE TABLE users (id INTEGER)"},
+		{ID: "2020-01-02 Seed", Script: "INSERT INTO users VALUES (1)"},
+	}
+	for i := 0; i < 2; i++ {
+		if err := template.Prepare(context.Background(), migrations); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		name := fmt.Sprintf("clone_%d", rand.Int())
+		db, err := template.Clone(context.Background(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var count int
+		err = db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+		if err != nil || count != 1 {
+			t.Errorf("Expected the clone to have the seeded user. Got %d (%v)", count, err)
+		}
+		status, err := template.Migrator.Status(db, migrations)
+		if err != nil || !status.Current() {
+			t.Errorf("Expected the clone to be current. Got %+v (%v)", status, err)
+		}
+		_ = db.Close()
+		if err = template.Drop(context.Background(), name); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestPostgresLockHolderSQL(t *testing.T) {
+	name := `"schema_migrations"`
+	sql := Postgres.LockHolderSQL(name)
+	if !strings.Contains(sql, "pg_locks") || !strings.Contains(sql, Postgres.advisoryLockID(name)) {
+		t.Errorf("EXPECTED the advisory lock in pg_locks:\n%s", sql)
+	}
+	sql = NewPostgres(WithPostgresTableLock()).LockHolderSQL(name)
+	if !strings.Contains(sql, `'"schema_migrations"'::regclass`) {
+		t.Errorf("EXPECTED the tracking table's lock in pg_locks:\n%s", sql)
+	}
+}
+
+func TestPostgres11LockWaitReporting(t *testing.T) {
+	db := connectDB(t, "postgres11")
+	tableName := fmt.Sprintf("waiting_migrations_%d", rand.Int())
+	holder := NewMigrator(WithDialect(Postgres), WithTableName(tableName))
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.ExecContext(context.Background(), `SET application_name = 'blocking-deploy'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = holder.lock(context.Background(), db, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var reported []*LockHolder
+	waiter := NewMigrator(WithDialect(Postgres), WithTableName(tableName),
+		WithLockWaitReporting(100*time.Millisecond, func(waited time.Duration, holders []*LockHolder) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, holders...)
+		}))
+	done := make(chan error)
+	go func() {
+		done <- waiter.Apply(db, []*Migration{{ID: "2020-01-01 Waited", Script: "SELECT 1"}})
+	}()
+	time.Sleep(500 * time.Millisecond)
+	err = holder.unlock(db, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) == 0 || reported[0].Application != "blocking-deploy" || reported[0].PID == "" {
+		t.Errorf("Expected the blocking session to be reported. Got %v", reported)
+	}
+}
+
+func TestPostgres11RequiredExtensions(t *testing.T) {
+	db := connectDB(t, "postgres11")
+	migrator := NewMigrator(WithDialect(Postgres), WithTableName("extension_migrations"), WithRequiredExtensions("pgcrypto"))
+	err := migrator.Apply(db, []*Migration{{ID: "2020-01-01 Uses pgcrypto", Script: `
+		CREATE TABLE hashed (digest BYTEA DEFAULT digest('', 'sha256'));
+	`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostgresRequiresNoTransaction(t *testing.T) {
+	for statement, expected := range map[string]bool{
+		"CREATE INDEX CONCURRENTLY idx ON t (c)":         true,
+		"create unique index concurrently idx on t (c);": true,
+		"DROP INDEX CONCURRENTLY IF EXISTS idx":          true,
+		"REINDEX INDEX CONCURRENTLY idx":                 true,
+		"ALTER TABLE p DETACH PARTITION c CONCURRENTLY":  true,
+		"-- Reclaim space\nVACUUM;":                      true,
+		"CREATE DATABASE other":                          true,
+		"CREATE INDEX idx ON t (c)":                      false,
+		"REFRESH MATERIALIZED VIEW CONCURRENTLY v":       false,
+		"ALTER TABLE t ADD COLUMN concurrently INTEGER":  false,
+		"ALTER TYPE mood ADD VALUE 'happy'":              false,
+		"INSERT INTO t (c) VALUES ('VACUUM')":            false,
+	} {
+		if actual := Postgres.RequiresNoTransaction(statement, "12.4"); actual != expected {
+			t.Errorf("Expected %t for %q. Got %t", expected, statement, actual)
+		}
+	}
+	if !Postgres.RequiresNoTransaction("ALTER TYPE mood ADD VALUE 'happy'", "11.9") {
+		t.Error("Expected ALTER TYPE ... ADD VALUE to require no transaction before Postgres 12")
+	}
+}
+
+func TestPostgres11ConcurrentIndex(t *testing.T) {
+	db := connectDB(t, "postgres11")
+	tableName := fmt.Sprintf("indexed_%d", rand.Int())
+	migrator := NewMigrator(WithDialect(Postgres), WithTableName(tableName+"_migrations"))
+	index := &ConcurrentIndex{Name: tableName + "_email", Table: tableName, Definition: "(email)", Unique: true}
+	migrations := []*Migration{
+		{ID: "2021-03-01 Table", Script: fmt.Sprintf("CREATE TABLE %s (email TEXT); INSERT INTO %[1]s VALUES ('a'), ('a')", tableName)},
+		index.Migration("2021-03-02 Index"),
+	}
+
+	err := migrator.Apply(db, migrations)
+	if err == nil {
+		t.Fatal("Expected the unique index to fail on the duplicate rows")
+	}
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM pg_index WHERE indexrelid = to_regclass($1)`, index.Name).Scan(&count)
+	if err != nil || count != 0 {
+		t.Errorf("Expected the invalid index to be dropped. Got %d (%v)", count, err)
+	}
+
+	_, err = db.Exec(fmt.Sprintf("UPDATE %s SET email = 'b' WHERE ctid = (SELECT ctid FROM %[1]s LIMIT 1)", tableName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = migrator.Apply(db, migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var valid bool
+	err = db.QueryRow(`SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass($1)`, index.Name).Scan(&valid)
+	if err != nil || !valid {
+		t.Errorf("Expected a valid index. Got %t (%v)", valid, err)
+	}
+}
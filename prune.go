@@ -0,0 +1,180 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNoRetention is returned by PruneHistory when the Retention would
+	// prune every row
+	ErrNoRetention = errors.New("retention must set Before or KeepLast")
+
+	// ErrPruneUnsafe is returned by PruneHistory when it would prune the row
+	// of a migration which is still supplied, which Apply would then run
+	// again
+	ErrPruneUnsafe = errors.New("pruning would cause migrations to run again")
+
+	// ErrPruneNotSupported is returned by PruneHistory when the dialect
+	// doesn't implement HistoryPruner
+	ErrPruneNotSupported = errors.New("dialect does not support pruning history")
+)
+
+// Retention chooses which rows of the tracking table PruneHistory keeps.
+// When both fields are set, a row is only pruned if both would prune it.
+type Retention struct {
+	// Before prunes rows applied before the time
+	Before time.Time
+
+	// KeepLast keeps the most recently applied rows, pruning the others
+	KeepLast int
+}
+
+// PruneHistory deletes rows from the tracking table, and from the build and
+// script tables when the Migrator records them, according to the retention,
+// for projects whose tracking table has grown large or which must purge rows
+// for data retention. The migrations are those which Apply is called with:
+// PruneHistory fails with ErrPruneUnsafe rather than prune the row of one of
+// them, since Apply would run it again. Typically the pruned migrations have
+// been squashed into a baseline. It returns the pruned rows.
+func (m Migrator) PruneHistory(db *sql.DB, migrations []*Migration, retention Retention) ([]*AppliedMigration, error) {
+	return m.PruneHistoryContext(context.Background(), db, migrations, retention)
+}
+
+// PruneHistoryContext is PruneHistory with a context. It takes the migration
+// lock, so that it can't race with Apply.
+func (m Migrator) PruneHistoryContext(ctx context.Context, db *sql.DB, migrations []*Migration, retention Retention) (pruned []*AppliedMigration, err error) {
+	if db == nil {
+		return nil, ErrNilDB
+	}
+	if retention.Before.IsZero() && retention.KeepLast <= 0 {
+		return nil, ErrNoRetention
+	}
+	pruner, ok := m.Dialect.(HistoryPruner)
+	if !ok {
+		return nil, ErrPruneNotSupported
+	}
+
+	txLockSQL := m.transactionLockSQL()
+	_, lockOnConn := m.Dialect.(SQLLocker)
+	lockOnConn = lockOnConn && m.Locker == nil
+	if txLockSQL == "" && !lockOnConn {
+		err = m.lock(ctx, db, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer m.unlockOnReturn(db, nil, &err)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.releaseConn(conn, &err)
+
+	err = m.setupSession(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if txLockSQL == "" && lockOnConn {
+		err = m.lock(ctx, db, conn)
+		if err != nil {
+			return nil, err
+		}
+		defer m.unlockOnReturn(db, conn, &err)
+	}
+
+	err = m.transaction(ctx, conn, func(tx *sql.Tx) error {
+		if txLockSQL != "" {
+			_, err := m.exec(ctx, tx, txLockSQL)
+			if err != nil {
+				return &LockError{Err: err}
+			}
+		}
+
+		rows, err := m.appliedRows(tx)
+		if err != nil {
+			return err
+		}
+		pruned, err = pruneable(rows, migrations, retention)
+		if err != nil {
+			return err
+		}
+
+		tables := []string{m.QuotedTableName()}
+		if m.BuildMetadata != "" {
+			tables = append(tables, m.QuotedBuildsTableName())
+		}
+		if m.RecordScripts {
+			tables = append(tables, m.QuotedScriptsTableName())
+		}
+		for _, row := range pruned {
+			for _, table := range tables {
+				_, err = m.exec(ctx, tx, pruner.DeleteSQL(table), row.ID)
+				if err != nil {
+					return err
+				}
+			}
+			m.log(fmt.Sprintf("Migration '%s' pruned from history\n", row.ID))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pruned, nil
+}
+
+// pruneable returns the rows the retention prunes, failing with
+// ErrPruneUnsafe if any of them belongs to one of the migrations
+func pruneable(rows []*AppliedMigration, migrations []*Migration, retention Retention) ([]*AppliedMigration, error) {
+	newestFirst := make([]*AppliedMigration, len(rows))
+	copy(newestFirst, rows)
+	sort.SliceStable(newestFirst, func(i, j int) bool {
+		if !newestFirst[i].AppliedAt.Equal(newestFirst[j].AppliedAt) {
+			return newestFirst[i].AppliedAt.After(newestFirst[j].AppliedAt)
+		}
+		return newestFirst[i].ID > newestFirst[j].ID
+	})
+
+	pruned := make([]*AppliedMigration, 0)
+	seen := make(map[string]bool)
+	for i, row := range newestFirst {
+		if seen[row.ID] {
+			continue
+		}
+		if retention.KeepLast > 0 && i < retention.KeepLast {
+			// A row which is kept keeps every row of its migration
+			seen[row.ID] = true
+			continue
+		}
+		if !retention.Before.IsZero() && !row.AppliedAt.Before(retention.Before) {
+			seen[row.ID] = true
+			continue
+		}
+		seen[row.ID] = true
+		pruned = append(pruned, row)
+	}
+	sortApplied(pruned)
+
+	supplied := make(map[string]bool, len(migrations))
+	for _, migration := range migrations {
+		supplied[migration.ID] = true
+	}
+	unsafe := make([]string, 0)
+	for _, row := range pruned {
+		if supplied[row.ID] {
+			unsafe = append(unsafe, fmt.Sprintf("'%s'", row.ID))
+		}
+	}
+	if len(unsafe) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrPruneUnsafe, strings.Join(unsafe, ", "))
+	}
+	return pruned, nil
+}
@@ -0,0 +1,44 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPruneable(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	rows := []*AppliedMigration{
+		{Migration: Migration{ID: "1"}, AppliedAt: day(1)},
+		{Migration: Migration{ID: "2"}, AppliedAt: day(2)},
+		{Migration: Migration{ID: "3"}, AppliedAt: day(3)},
+		{Migration: Migration{ID: "4"}, AppliedAt: day(4)},
+	}
+	ids := func(pruned []*AppliedMigration) (ids string) {
+		for _, row := range pruned {
+			ids += row.ID
+		}
+		return ids
+	}
+
+	cases := map[string]struct {
+		retention Retention
+		expected  string
+	}{
+		"before":    {Retention{Before: day(3)}, "12"},
+		"keep last": {Retention{KeepLast: 1}, "123"},
+		"both":      {Retention{Before: day(3), KeepLast: 3}, "1"},
+		"nothing":   {Retention{KeepLast: 10}, ""},
+	}
+	for name, c := range cases {
+		pruned, err := pruneable(rows, []*Migration{{ID: "4"}}, c.retention)
+		if err != nil || ids(pruned) != c.expected {
+			t.Errorf("%s: Expected %q to be pruned. Got %q (%v)", name, c.expected, ids(pruned), err)
+		}
+	}
+
+	_, err := pruneable(rows, []*Migration{{ID: "2"}}, Retention{Before: day(3)})
+	if !errors.Is(err, ErrPruneUnsafe) {
+		t.Errorf("Expected ErrPruneUnsafe. Got %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// QueryLogger receives every SQL statement the Migrator executes, including
+// locking, session setup, tracking table reads and writes, and migration
+// statements, along with their arguments, durations and errors. It is useful
+// for debugging and in environments where all DDL must be logged. Statements
+// executed internally by dialects which implement Locker (such as SQLite)
+// aren't included.
+type QueryLogger interface {
+	LogQuery(query string, args []interface{}, duration time.Duration, err error)
+}
+
+// QueryLoggerFunc adapts a function to the QueryLogger interface
+type QueryLoggerFunc func(query string, args []interface{}, duration time.Duration, err error)
+
+// LogQuery calls f(query, args, duration, err)
+func (f QueryLoggerFunc) LogQuery(query string, args []interface{}, duration time.Duration, err error) {
+	f(query, args, duration, err)
+}
+
+// exec executes the statement, reporting it to the QueryLogger
+func (m Migrator) exec(ctx context.Context, db ExecerContext, query string, args ...interface{}) (sql.Result, error) {
+	startedAt := time.Now()
+	result, err := db.ExecContext(ctx, query, args...)
+	m.logQuery(query, args, startedAt, err)
+	return result, err
+}
+
+// query runs the query, reporting it to the QueryLogger. The duration covers
+// executing the query, but not reading its rows.
+func (m Migrator) query(ctx context.Context, db QueryerContext, query string, args ...interface{}) (*sql.Rows, error) {
+	startedAt := time.Now()
+	rows, err := db.QueryContext(ctx, query, args...)
+	m.logQuery(query, args, startedAt, err)
+	return rows, err
+}
+
+// logQuery reports a statement which started at startedAt to the
+// QueryLogger, if there is one
+func (m Migrator) logQuery(query string, args []interface{}, startedAt time.Time, err error) {
+	if m.QueryLogger != nil {
+		m.QueryLogger.LogQuery(m.redact(query), m.redactArgs(args), time.Since(startedAt), m.redactError(err))
+	}
+}
@@ -0,0 +1,89 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// connectionSQLStates are the SQLSTATE codes of errors which mean the
+// connection was lost or refused: connection exceptions, and the server
+// shutting down or still starting up (as a serverless database scaled to
+// zero does when it wakes)
+var connectionSQLStates = map[string]bool{
+	"08000": true,
+	"08001": true,
+	"08003": true,
+	"08004": true,
+	"08006": true,
+	"57P01": true,
+	"57P02": true,
+	"57P03": true,
+}
+
+// connectionErrorMessages are fragments of the messages of drivers which
+// report a dropped connection without a typed error
+var connectionErrorMessages = []string{
+	"bad connection",
+	"broken pipe",
+	"connection reset by peer",
+	"server closed the connection unexpectedly",
+	"unexpected eof",
+}
+
+// IsConnectionError returns whether the error means the database connection
+// was dropped or refused, as happens when a serverless database such as Neon
+// or Aurora Serverless disconnects idle clients or scales to zero
+func IsConnectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var stateful interface{ SQLState() string }
+	if errors.As(err, &stateful) {
+		return connectionSQLStates[stateful.SQLState()]
+	}
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) || errors.As(err, &netErr) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, fragment := range connectionErrorMessages {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyResuming runs apply, running it again when it fails because the
+// connection dropped, up to ReconnectAttempts times. Each attempt acquires
+// the lock and reads the tracking table afresh on a new connection, so it
+// continues the plan from the last committed migration. A migration which
+// was partially applied outside a transaction isn't resumed, since running
+// it again could repeat its committed statements.
+func (m Migrator) applyResuming(ctx context.Context, db *sql.DB, migrations []*Migration, run *applyRun) error {
+	for attempt := 1; ; attempt++ {
+		err := m.apply(ctx, db, migrations, run)
+		var partial *PartialMigrationError
+		if err == nil || attempt > m.ReconnectAttempts || !IsConnectionError(err) || errors.As(err, &partial) {
+			return err
+		}
+		backoff := m.ReconnectBackoff * time.Duration(attempt)
+		m.log(fmt.Sprintf("Warning: the database connection dropped (%v). Resuming in %s (attempt %d of %d)\n", m.redactError(err), backoff, attempt, m.ReconnectAttempts))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+	}
+}
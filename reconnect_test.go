@@ -0,0 +1,39 @@
+package schema
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	dropped := []error{
+		driver.ErrBadConn,
+		fmt.Errorf("wrapped: %w", io.ErrUnexpectedEOF),
+		syscall.ECONNRESET,
+		sqlStateError("57P01"),
+		sqlStateError("08006"),
+		errors.New("pq: server closed the connection unexpectedly"),
+	}
+	for _, err := range dropped {
+		if !IsConnectionError(err) {
+			t.Errorf("Expected %v to be a connection error", err)
+		}
+	}
+	other := []error{
+		nil,
+		sqlStateError("42601"),
+		context.DeadlineExceeded,
+		fmt.Errorf("wrapped: %w", context.Canceled),
+		errors.New("relation \"users\" does not exist"),
+	}
+	for _, err := range other {
+		if IsConnectionError(err) {
+			t.Errorf("Expected %v not to be a connection error", err)
+		}
+	}
+}
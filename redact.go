@@ -0,0 +1,102 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaskLiterals replaces the contents of every quoted string literal in the
+// SQL with ***, so that seeded credentials and personal data in migration
+// scripts don't reach logs. Quoted identifiers, comments and dollar-quoted
+// bodies are left as they are.
+func MaskLiterals(sql string) string {
+	var b strings.Builder
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'':
+			end := closingQuote(sql, i, isEscapeStringPrefix(sql, i))
+			b.WriteString("'***'")
+			i = end
+		case c == '"':
+			end := closingQuote(sql, i, false)
+			b.WriteString(sql[i:end])
+			i = end
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			b.WriteString(sql[i : i+end])
+			i += end
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := postgresSplitter.closingComment(sql, i)
+			b.WriteString(sql[i:end])
+			i = end
+		case c == '$' && dollarTag(sql, i) != "":
+			tag := dollarTag(sql, i)
+			end := len(sql)
+			if j := strings.Index(sql[i+len(tag):], tag); j >= 0 {
+				end = i + len(tag) + j + len(tag)
+			}
+			b.WriteString(sql[i:end])
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// redactedError presents an error with its message redacted, while still
+// unwrapping to the original so errors.Is and errors.As work
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redact applies the Migrator's Redact hook to the SQL, if there is one
+func (m Migrator) redact(sql string) string {
+	if m.Redact == nil {
+		return sql
+	}
+	return m.Redact(sql)
+}
+
+// redactError applies the Migrator's Redact hook to the error's message
+func (m Migrator) redactError(err error) error {
+	if err == nil || m.Redact == nil {
+		return err
+	}
+	return &redactedError{message: m.Redact(err.Error()), err: err}
+}
+
+// redactArgs masks statement arguments when a Redact hook is set, since
+// they may carry the same sensitive values as literals
+func (m Migrator) redactArgs(args []interface{}) []interface{} {
+	if m.Redact == nil || len(args) == 0 {
+		return args
+	}
+	masked := make([]interface{}, len(args))
+	for i := range args {
+		masked[i] = "***"
+	}
+	return masked
+}
+
+// redactMessage applies the Migrator's Redact hook to a log message
+func (m Migrator) redactMessage(msgs []interface{}) []interface{} {
+	if m.Redact == nil {
+		return msgs
+	}
+	return []interface{}{m.Redact(fmt.Sprint(msgs...))}
+}
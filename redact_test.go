@@ -0,0 +1,37 @@
+package schema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMaskLiterals(t *testing.T) {
+	cases := map[string]string{
+		"INSERT INTO users VALUES ('alice', 'hunter2')":       "INSERT INTO users VALUES ('***', '***')",
+		"UPDATE users SET note = 'it''s secret' WHERE id = 1": "UPDATE users SET note = '***' WHERE id = 1",
+		`SELECT "it's" FROM t -- don't mask comments`:         `SELECT "it's" FROM t -- don't mask comments`,
+		"SELECT E'a\\'b', 'c'":                                "SELECT E'***', '***'",
+		"CREATE FUNCTION f() AS $$ SELECT 'kept' $$":          "CREATE FUNCTION f() AS $$ SELECT 'kept' $$",
+	}
+	for sql, expected := range cases {
+		if masked := MaskLiterals(sql); masked != expected {
+			t.Errorf("Expected %q to be masked as %q. Got %q", sql, expected, masked)
+		}
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	partial := &PartialMigrationError{MigrationID: "1", Err: errors.New("near 'hunter2': syntax error")}
+	err := NewMigrator(WithRedaction(MaskLiterals)).redactError(partial)
+	if strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("Expected the literal to be masked. Got %q", err.Error())
+	}
+	var unwrapped *PartialMigrationError
+	if !errors.As(err, &unwrapped) {
+		t.Error("Expected the redacted error to unwrap to the original")
+	}
+	if NewMigrator().redactError(partial) != partial {
+		t.Error("Expected errors to be unchanged without a Redact hook")
+	}
+}
@@ -0,0 +1,235 @@
+package schema
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultRedisLockTTL = 30 * time.Second
+
+// minRedisLockTTL is the shortest TTL Redis can set, as expiry times are
+// given in milliseconds
+const minRedisLockTTL = time.Millisecond
+
+var (
+	// ErrRedisLockTimeout is returned by RedisLocker when another migrator
+	// held the lock for longer than the lock timeout
+	ErrRedisLockTimeout = errors.New("redis: timeout requesting lock")
+
+	// ErrRedisLockLost is returned by RedisLocker's Unlock when the lock
+	// expired or was taken by another migrator before it was released, so
+	// the migrations may not have run exclusively
+	ErrRedisLockLost = errors.New("redis: lock was lost before it was released")
+)
+
+// redisRenewScript extends the lock's TTL if it is still held with the token
+const redisRenewScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`
+
+// redisReleaseScript deletes the lock if it is still held with the token
+const redisReleaseScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+
+// RedisClient is the subset of a Redis client used by RedisLocker. SetNX
+// sets the key to the value with the TTL if the key doesn't exist, returning
+// whether it was set. Eval runs a Lua script, returning its result. Adapting
+// a client such as go-redis takes a few lines, so that this package needn't
+// depend on one.
+type RedisClient interface {
+	SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error)
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// RedisLocker is a Locker which coordinates migrators through a Redis key,
+// for databases which lack advisory locks or fleets which migrate many
+// shards and want a single point of coordination. The key is set with a TTL,
+// so a crashed migrator's lock expires, and renewed while the lock is held.
+// Migrators sharing a key run one at a time, even when they migrate
+// different databases. Use it with WithLocker.
+type RedisLocker struct {
+	client       RedisClient
+	key          string
+	ttl          time.Duration
+	timeout      time.Duration
+	pollInterval time.Duration
+
+	// mutex is held from Lock until Unlock, so that goroutines sharing the
+	// locker queue for it in-process
+	mutex sync.Mutex
+	held  *redisLock
+}
+
+// redisLock is the state of a lock held by a RedisLocker
+type redisLock struct {
+	token string
+	stop  chan struct{}
+	done  chan struct{}
+	lost  error
+}
+
+var (
+	_ Locker        = (*RedisLocker)(nil)
+	_ ContextLocker = (*RedisLocker)(nil)
+)
+
+// NewRedisLocker creates a RedisLocker which locks the key. The TTL, lock
+// timeout and poll interval are customized with the WithRedisLock...
+// options.
+func NewRedisLocker(client RedisClient, key string, opts ...func(r *RedisLocker)) *RedisLocker {
+	r := &RedisLocker{
+		client:       client,
+		key:          key,
+		ttl:          defaultRedisLockTTL,
+		pollInterval: defaultLockPollInterval,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// WithRedisLockTTL sets how long the lock outlives a migrator which stops
+// renewing it, such as one which crashed. The lock is renewed every third of
+// the TTL. The default is 30 seconds. A TTL which isn't positive is ignored,
+// and one under a millisecond is raised to a millisecond.
+func WithRedisLockTTL(d time.Duration) func(r *RedisLocker) {
+	return func(r *RedisLocker) {
+		if d <= 0 {
+			return
+		}
+		if d < minRedisLockTTL {
+			d = minRedisLockTTL
+		}
+		r.ttl = d
+	}
+}
+
+// WithRedisLockTimeout sets how long Lock waits to claim the lock before
+// giving up with ErrRedisLockTimeout. By default it waits for the TTL.
+func WithRedisLockTimeout(d time.Duration) func(r *RedisLocker) {
+	return func(r *RedisLocker) {
+		r.timeout = d
+	}
+}
+
+// WithRedisLockPollInterval sets how long Lock sleeps between attempts to
+// claim a lock held by another migrator. The default is 1 second.
+func WithRedisLockPollInterval(d time.Duration) func(r *RedisLocker) {
+	return func(r *RedisLocker) {
+		r.pollInterval = d
+	}
+}
+
+// Lock claims the key, waiting for up to the lock timeout while another
+// migrator holds it. The database is ignored.
+func (r *RedisLocker) Lock(db *sql.DB) error {
+	return r.LockContext(context.Background(), db)
+}
+
+// LockContext is like Lock, but stops waiting for the lock when the context
+// is cancelled
+func (r *RedisLocker) LockContext(ctx context.Context, db *sql.DB) error {
+	r.mutex.Lock()
+
+	token, err := redisLockToken()
+	if err != nil {
+		r.mutex.Unlock()
+		return err
+	}
+	timeout := r.timeout
+	if timeout == 0 {
+		timeout = r.ttl
+	}
+	deadline := time.Now().Add(timeout)
+
+	for {
+		locked, err := r.client.SetNX(ctx, r.key, token, r.ttl)
+		if err != nil {
+			r.mutex.Unlock()
+			return err
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			r.mutex.Unlock()
+			return ErrRedisLockTimeout
+		}
+		select {
+		case <-ctx.Done():
+			r.mutex.Unlock()
+			return ctx.Err()
+		case <-time.After(r.pollInterval):
+		}
+	}
+
+	r.held = &redisLock{token: token, stop: make(chan struct{}), done: make(chan struct{})}
+	go r.renew(r.held)
+	return nil
+}
+
+// Unlock stops renewing the lock and deletes the key if it is still held,
+// returning ErrRedisLockLost if it was lost in the meantime
+func (r *RedisLocker) Unlock(db *sql.DB) error {
+	return r.UnlockContext(context.Background(), db)
+}
+
+// UnlockContext is like Unlock, but deletes the key with the context
+func (r *RedisLocker) UnlockContext(ctx context.Context, db *sql.DB) error {
+	held := r.held
+	if held == nil {
+		return nil
+	}
+	defer r.mutex.Unlock()
+	r.held = nil
+
+	close(held.stop)
+	<-held.done
+	released, err := r.client.Eval(ctx, redisReleaseScript, []string{r.key}, held.token)
+	if err != nil {
+		return err
+	}
+	if held.lost != nil {
+		return held.lost
+	}
+	if !isTruthy(released) {
+		return ErrRedisLockLost
+	}
+	return nil
+}
+
+// renew extends the lock's TTL until it is stopped, or until it finds the
+// lock has been lost. Failed renewals are retried at the next interval,
+// since the lock is only lost once the key has expired.
+func (r *RedisLocker) renew(held *redisLock) {
+	defer close(held.done)
+	ticker := time.NewTicker(r.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-held.stop:
+			return
+		case <-ticker.C:
+			renewed, err := r.client.Eval(context.Background(), redisRenewScript, []string{r.key}, held.token, r.ttl.Milliseconds())
+			if err == nil && !isTruthy(renewed) {
+				held.lost = fmt.Errorf("%w: '%s' expired or was taken", ErrRedisLockLost, r.key)
+				return
+			}
+		}
+	}
+}
+
+// redisLockToken returns a random value identifying the holder of the lock,
+// so that a migrator never releases or renews another's lock
+func redisLockToken() (string, error) {
+	token := make([]byte, 16)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
@@ -0,0 +1,103 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is an in-memory RedisClient which understands the lock scripts
+type fakeRedis struct {
+	mutex   sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{values: make(map[string]string), expires: make(map[string]time.Time)}
+}
+
+func (f *fakeRedis) get(key string) (string, bool) {
+	if time.Now().After(f.expires[key]) {
+		delete(f.values, key)
+	}
+	value, exists := f.values[key]
+	return value, exists
+}
+
+func (f *fakeRedis) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if _, exists := f.get(key); exists {
+		return false, nil
+	}
+	f.values[key] = value
+	f.expires[key] = time.Now().Add(ttl)
+	return true, nil
+}
+
+func (f *fakeRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if value, exists := f.get(keys[0]); !exists || value != args[0] {
+		return int64(0), nil
+	}
+	switch script {
+	case redisRenewScript:
+		f.expires[keys[0]] = time.Now().Add(time.Duration(args[1].(int64)) * time.Millisecond)
+	case redisReleaseScript:
+		delete(f.values, keys[0])
+	}
+	return int64(1), nil
+}
+
+func TestRedisLocker(t *testing.T) {
+	client := newFakeRedis()
+	opts := []func(r *RedisLocker){
+		WithRedisLockTTL(30 * time.Millisecond),
+		WithRedisLockTimeout(100 * time.Millisecond),
+		WithRedisLockPollInterval(10 * time.Millisecond),
+	}
+	holder := NewRedisLocker(client, "migrations", opts...)
+	contender := NewRedisLocker(client, "migrations", opts...)
+
+	if err := holder.Lock(nil); err != nil {
+		t.Fatal(err)
+	}
+	// The lock outlives its TTL because it is renewed
+	if err := contender.Lock(nil); err != ErrRedisLockTimeout {
+		t.Errorf("Expected ErrRedisLockTimeout. Got %v", err)
+	}
+	if err := holder.Unlock(nil); err != nil {
+		t.Error(err)
+	}
+
+	if err := contender.Lock(nil); err != nil {
+		t.Fatal(err)
+	}
+	client.mutex.Lock()
+	delete(client.values, "migrations")
+	client.mutex.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	if err := contender.Unlock(nil); !errors.Is(err, ErrRedisLockLost) {
+		t.Errorf("Expected ErrRedisLockLost. Got %v", err)
+	}
+}
+
+func TestRedisLockTTL(t *testing.T) {
+	client := newFakeRedis()
+	if r := NewRedisLocker(client, "ttl", WithRedisLockTTL(0)); r.ttl != defaultRedisLockTTL {
+		t.Errorf("Expected a zero TTL to be ignored. Got %v", r.ttl)
+	}
+	r := NewRedisLocker(client, "ttl", WithRedisLockTTL(time.Nanosecond))
+	if r.ttl != time.Millisecond {
+		t.Errorf("Expected the TTL to be raised to a millisecond. Got %v", r.ttl)
+	}
+	if err := r.Lock(nil); err != nil {
+		t.Fatal(err)
+	}
+	// The lock may have expired on a slow machine, which isn't under test
+	_ = r.Unlock(nil)
+}
@@ -0,0 +1,110 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrUnknownPlugin is returned when no plugin is registered with a name
+var ErrUnknownPlugin = errors.New("no plugin is registered with the name")
+
+var (
+	dialectsMutex sync.RWMutex
+	dialects      = map[string]Dialect{
+		"postgres": Postgres,
+		"mysql":    MySQL,
+		"sqlite":   NewSQLite(),
+		"oracle":   Oracle,
+	}
+)
+
+// RegisterDialect makes a dialect available by name to WithDialectName, so
+// that it can be selected from configuration. Registering a name which is
+// already registered replaces its dialect, including the built-in
+// "postgres", "mysql", "sqlite" and "oracle" dialects.
+func RegisterDialect(name string, dialect Dialect) {
+	if dialect == nil {
+		panic("schema: RegisterDialect dialect is nil")
+	}
+	dialectsMutex.Lock()
+	defer dialectsMutex.Unlock()
+	dialects[name] = dialect
+}
+
+// LookupDialect returns the dialect registered with the name, or an error
+// wrapping ErrUnknownDialect, so that configuration can be validated
+// before calling WithDialectName
+func LookupDialect(name string) (Dialect, error) {
+	dialectsMutex.RLock()
+	defer dialectsMutex.RUnlock()
+	dialect, exists := dialects[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownDialect, name)
+	}
+	return dialect, nil
+}
+
+// DialectNames returns the sorted names of the registered dialects
+func DialectNames() []string {
+	dialectsMutex.RLock()
+	defer dialectsMutex.RUnlock()
+	names := make([]string, 0, len(dialects))
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	pluginsMutex sync.RWMutex
+	plugins      = map[string]Option{}
+)
+
+// RegisterPlugin makes an Option available by name to WithPlugins, so that
+// integrations such as metrics, notifiers and lockers can register
+// themselves from an init function, and be enabled with a blank import and
+// a name from configuration:
+//
+//	import _ "example.com/schemaprometheus"
+//
+//	migrator := schema.NewMigrator(schema.WithPlugins("prometheus"))
+//
+// A plugin's Option should add to lists such as Middleware rather than
+// replacing them, so that plugins compose. Registering a name which is
+// already registered replaces its plugin.
+func RegisterPlugin(name string, plugin Option) {
+	if plugin == nil {
+		panic("schema: RegisterPlugin plugin is nil")
+	}
+	pluginsMutex.Lock()
+	defer pluginsMutex.Unlock()
+	plugins[name] = plugin
+}
+
+// LookupPlugin returns the plugin registered with the name, or an error
+// wrapping ErrUnknownPlugin, so that configuration can be validated before
+// calling WithPlugins
+func LookupPlugin(name string) (Option, error) {
+	pluginsMutex.RLock()
+	defer pluginsMutex.RUnlock()
+	plugin, exists := plugins[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPlugin, name)
+	}
+	return plugin, nil
+}
+
+// PluginNames returns the sorted names of the registered plugins
+func PluginNames() []string {
+	pluginsMutex.RLock()
+	defer pluginsMutex.RUnlock()
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
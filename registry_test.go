@@ -0,0 +1,70 @@
+package schema
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestRegisterDialect(t *testing.T) {
+	custom := NewPostgres(WithPostgresTableLock())
+	RegisterDialect("cockroachdb", custom)
+
+	m := NewMigrator(WithDialectName("cockroachdb"))
+	if m.Dialect != custom {
+		t.Errorf("Expected the registered dialect. Got %#v", m.Dialect)
+	}
+	if m = NewMigrator(WithDialectName("mysql")); m.Dialect != MySQL {
+		t.Errorf("Expected the built-in MySQL dialect. Got %#v", m.Dialect)
+	}
+
+	found := false
+	for _, name := range DialectNames() {
+		found = found || name == "cockroachdb"
+	}
+	if !found {
+		t.Errorf("Expected cockroachdb in %v", DialectNames())
+	}
+}
+
+func TestWithDialectNameUnknown(t *testing.T) {
+	if _, err := LookupDialect("db2"); !errors.Is(err, ErrUnknownDialect) {
+		t.Errorf("Expected ErrUnknownDialect. Got %v", err)
+	}
+	m := NewMigrator(WithDialectName("db2"))
+	if err := m.Apply(&sql.DB{}, []*Migration{}); !errors.Is(err, ErrUnknownDialect) {
+		t.Errorf("Expected Apply to fail with ErrUnknownDialect. Got %v", err)
+	}
+}
+
+func TestRegisterPlugin(t *testing.T) {
+	outer := Middleware(func(next MigrationFunc) MigrationFunc { return next })
+	RegisterPlugin("test-metrics", WithMiddleware(outer))
+	RegisterPlugin("test-locker", WithLocker(NewFileLocker("schema.lock")))
+
+	m := NewMigrator(WithPlugins("test-metrics", "test-metrics", "test-locker"))
+	if len(m.Middleware) != 2 {
+		t.Errorf("Expected each plugin's middleware to be added. Got %d", len(m.Middleware))
+	}
+	if _, ok := m.Locker.(*FileLocker); !ok {
+		t.Errorf("Expected the plugin's locker. Got %#v", m.Locker)
+	}
+
+	names := map[string]bool{}
+	for _, name := range PluginNames() {
+		names[name] = true
+	}
+	if !names["test-metrics"] || !names["test-locker"] {
+		t.Errorf("Expected the registered plugins in %v", PluginNames())
+	}
+}
+
+func TestWithPluginsUnknown(t *testing.T) {
+	if _, err := LookupPlugin("datadog"); !errors.Is(err, ErrUnknownPlugin) {
+		t.Errorf("Expected ErrUnknownPlugin. Got %v", err)
+	}
+	m := NewMigrator(WithPlugins("datadog"))
+	if err := m.Apply(&sql.DB{}, []*Migration{}); !errors.Is(err, ErrUnknownPlugin) {
+		t.Errorf("Expected Apply to fail with ErrUnknownPlugin. Got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package schema
+
+import "time"
+
+// Report describes a run of Apply. See ApplyReport.
+type Report struct {
+	// Applied lists the migrations whose scripts ran, in order
+	Applied []*MigrationReport `json:"applied"`
+	// Skipped lists the migrations which were recorded without running
+	// their scripts because their preconditions failed
+	Skipped []*MigrationReport `json:"skipped"`
+	// Duration is the total time taken by the run
+	Duration time.Duration `json:"duration"`
+	// LockWait is the time spent waiting for the migration lock
+	LockWait time.Duration `json:"lock_wait"`
+}
+
+// MigrationReport describes a single migration within a Report
+type MigrationReport struct {
+	ID string `json:"id"`
+	// Rerun is true for Always migrations which had been applied before
+	Rerun bool `json:"rerun"`
+	// Duration includes the time taken to record the migration, and to
+	// commit it when migrations are committed separately
+	Duration time.Duration `json:"duration"`
+
+	skipped bool
+}
+
+// applyRun records what happened during a call to apply
+type applyRun struct {
+	startedAt time.Time
+	lockWait  time.Duration
+	// plan holds the migrations which were planned to run, in order
+	plan []*Migration
+	// completed holds the migrations which have been committed
+	completed []*MigrationReport
+}
+
+// report builds the Report of the run
+func (run *applyRun) report() *Report {
+	report := &Report{
+		Applied:  make([]*MigrationReport, 0, len(run.completed)),
+		Skipped:  make([]*MigrationReport, 0),
+		Duration: time.Since(run.startedAt),
+		LockWait: run.lockWait,
+	}
+	for _, migration := range run.completed {
+		if migration.skipped {
+			report.Skipped = append(report.Skipped, migration)
+		} else {
+			report.Applied = append(report.Applied, migration)
+		}
+	}
+	return report
+}
+
+// newMigrationReport describes a migration which started at startedAt
+func newMigrationReport(migration *Migration, rerun, skip bool, startedAt time.Time) *MigrationReport {
+	return &MigrationReport{
+		ID:       migration.ID,
+		Rerun:    rerun,
+		Duration: time.Since(startedAt),
+		skipped:  skip,
+	}
+}
@@ -0,0 +1,74 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// statementSavepoint names the savepoint which wraps each statement when
+// statement retries are enabled
+const statementSavepoint = "schema_statement"
+
+// retryableSQLStates are the SQLSTATE codes of errors which are likely to
+// succeed when the statement is retried: serialization failures, deadlocks
+// and lock timeouts
+var retryableSQLStates = map[string]bool{
+	"40001": true,
+	"40P01": true,
+	"55P03": true,
+}
+
+// IsRetryableError returns whether the error is a serialization failure,
+// deadlock or lock timeout, as reported by drivers whose errors have a
+// SQLState() method (such as lib/pq and pgx)
+func IsRetryableError(err error) bool {
+	var stateful interface{ SQLState() string }
+	if errors.As(err, &stateful) {
+		return retryableSQLStates[stateful.SQLState()]
+	}
+	return false
+}
+
+// execStatement executes a statement of a migration. When statement retries
+// are enabled and the dialect supports transactional DDL, the statement is
+// wrapped in a savepoint, so that a retryable failure can be rolled back and
+// the statement retried without abandoning the whole migration.
+func (m Migrator) execStatement(ctx context.Context, tx *sql.Tx, statement string) error {
+	if m.StatementRetries <= 0 || !m.capabilities().TransactionalDDL {
+		_, err := m.exec(ctx, tx, statement)
+		return err
+	}
+
+	retryable := m.RetryableError
+	if retryable == nil {
+		retryable = IsRetryableError
+	}
+	for attempt := 1; ; attempt++ {
+		_, err := m.exec(ctx, tx, "SAVEPOINT "+statementSavepoint)
+		if err != nil {
+			return err
+		}
+		_, err = m.exec(ctx, tx, statement)
+		if err == nil {
+			_, err = m.exec(ctx, tx, "RELEASE SAVEPOINT "+statementSavepoint)
+			return err
+		}
+		if attempt > m.StatementRetries || !retryable(err) {
+			return err
+		}
+		_, rollbackErr := m.exec(ctx, tx, "ROLLBACK TO SAVEPOINT "+statementSavepoint)
+		if rollbackErr != nil {
+			return err
+		}
+		m.log(fmt.Sprintf("Retrying statement after attempt %d failed: %s\n", attempt, m.redactError(err)))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(m.StatementRetryBackoff * time.Duration(attempt)):
+		}
+	}
+}
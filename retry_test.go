@@ -0,0 +1,24 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "sql error " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+func TestIsRetryableError(t *testing.T) {
+	if !IsRetryableError(fmt.Errorf("wrapped: %w", sqlStateError("40P01"))) {
+		t.Error("Expected deadlocks to be retryable")
+	}
+	if IsRetryableError(sqlStateError("42601")) {
+		t.Error("Expected syntax errors not to be retryable")
+	}
+	if IsRetryableError(errors.New("no SQLSTATE")) {
+		t.Error("Expected errors without a SQLSTATE not to be retryable")
+	}
+}
@@ -0,0 +1,104 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// Exit codes returned by RunOnce. Kubernetes treats every non-zero code as a
+// failure, so a run with nothing to do exits 0 like one which applied
+// migrations, and the difference is reported in RunSummary.Outcome. The
+// failure codes are distinct so that scripts around an init container or
+// pre-deploy Job can tell what happened without parsing logs.
+const (
+	// ExitApplied means the run succeeded, whether or not any migrations
+	// were pending
+	ExitApplied = 0
+	// ExitFailed means a migration (or the run around it) failed
+	ExitFailed = 1
+	// ExitNothingToDo means every migration had already been applied. It is
+	// the same as ExitApplied.
+	ExitNothingToDo = ExitApplied
+	// ExitLockBusy means the migration lock couldn't be acquired, because
+	// another migrator held it until the lock timeout or context deadline.
+	// It matches EX_TEMPFAIL, since trying again later is appropriate.
+	ExitLockBusy = 75
+)
+
+// Outcomes reported in a RunSummary
+const (
+	OutcomeApplied     = "applied"
+	OutcomeNothingToDo = "nothing-to-do"
+	OutcomeLockBusy    = "lock-busy"
+	OutcomeFailed      = "failed"
+)
+
+// RunSummary is the machine-readable result of RunOnce. Applied and Skipped
+// list the migrations which were committed, including those committed before
+// a failure.
+type RunSummary struct {
+	Outcome          string   `json:"outcome"`
+	ExitCode         int      `json:"exit_code"`
+	Applied          []string `json:"applied"`
+	Skipped          []string `json:"skipped,omitempty"`
+	Slow             []string `json:"slow,omitempty"`
+	Error            string   `json:"error,omitempty"`
+	DurationInMillis int64    `json:"duration_in_millis"`
+}
+
+// RunOnce applies the migrations once and summarizes the result, for running
+// migrations from an init container or pre-deploy Job rather than from the
+// application itself. When w is non-nil the summary is written to it as a
+// single line of JSON. The summary's ExitCode is intended to be passed to
+// os.Exit. Use a context with a deadline to bound how long RunOnce waits for
+// a lock held by another migrator.
+func (m Migrator) RunOnce(ctx context.Context, db *sql.DB, migrations []*Migration, w io.Writer) *RunSummary {
+	startedAt := time.Now()
+	summary := &RunSummary{Applied: make([]string, 0)}
+
+	onSlow := m.OnSlowMigration
+	m.OnSlowMigration = func(migration *Migration, duration time.Duration) {
+		summary.Slow = append(summary.Slow, migration.ID)
+		if onSlow != nil {
+			onSlow(migration, duration)
+		}
+	}
+
+	report, err := m.ApplyReport(ctx, db, migrations)
+	for _, migration := range report.Applied {
+		summary.Applied = append(summary.Applied, migration.ID)
+	}
+	for _, migration := range report.Skipped {
+		summary.Skipped = append(summary.Skipped, migration.ID)
+	}
+	summary.Outcome, summary.ExitCode = runOutcome(err, len(report.Applied)+len(report.Skipped))
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	summary.DurationInMillis = time.Since(startedAt).Milliseconds()
+
+	if w != nil {
+		_ = json.NewEncoder(w).Encode(summary)
+	}
+	return summary
+}
+
+// runOutcome classifies the result of a run which committed the number of
+// migrations
+func runOutcome(err error, committed int) (outcome string, exitCode int) {
+	var lockErr *LockError
+	switch {
+	case errors.As(err, &lockErr):
+		return OutcomeLockBusy, ExitLockBusy
+	case err != nil:
+		return OutcomeFailed, ExitFailed
+	case committed == 0:
+		return OutcomeNothingToDo, ExitNothingToDo
+	default:
+		return OutcomeApplied, ExitApplied
+	}
+}
@@ -0,0 +1,50 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSandboxNotSupported is returned by SandboxApply when the dialect can't
+// roll back schema changes (see Capabilities)
+var ErrSandboxNotSupported = errors.New("dialect does not support transactional DDL, which a sandbox requires")
+
+// errSandboxRollback ends the transaction of a sandbox run, rolling it back
+var errSandboxRollback = errors.New("sandbox run rolled back")
+
+// SandboxApply runs the whole plan as Apply would, including the pre-run
+// and post-run scripts, in a single transaction which is then rolled back,
+// verifying that every statement executes without permanently changing
+// anything. Even the tracking table is only created inside the transaction.
+// It requires a dialect with transactional DDL, and fails for plans with
+// migrations which can't be rolled back, such as those with a Batch or
+// which are External. Nothing is notified, and no maintenance is done. The
+// Report lists the migrations which ran before being rolled back.
+func (m Migrator) SandboxApply(ctx context.Context, db *sql.DB, migrations []*Migration) (*Report, error) {
+	m.sandbox = true
+	run := &applyRun{startedAt: time.Now()}
+	err := m.apply(ctx, db, migrations, run)
+	if err == nil {
+		m.log("Sandbox run rolled back")
+	}
+	return run.report(), m.redactError(err)
+}
+
+// checkSandbox returns an error for the first planned migration which can't
+// be rolled back along with the sandbox transaction
+func checkSandbox(plan []*Migration) error {
+	for _, migration := range plan {
+		switch {
+		case migration.Batch != nil:
+			return fmt.Errorf("Migration '%s' has a Batch, which can't be run in a sandbox", migration.ID)
+		case migration.External:
+			return fmt.Errorf("Migration '%s' is External, so it can't be run in a sandbox", migration.ID)
+		case migration.DisableTransaction:
+			return fmt.Errorf("Migration '%s' has DisableTransaction, so it can't be run in a sandbox", migration.ID)
+		}
+	}
+	return nil
+}
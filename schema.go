@@ -1,6 +1,7 @@
 package schema
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -13,20 +14,83 @@ const DefaultTableName = "schema_migrations"
 // ErrNilDB is thrown when the database pointer is nil
 var ErrNilDB = errors.New("DB pointer is nil")
 
+// ErrNotConfirmed is returned by Apply when the Confirm callback declines
+// to execute the plan
+var ErrNotConfirmed = errors.New("migration plan was not confirmed")
+
+// ErrVerificationFailed is returned when a migration's Verify query
+// does not produce a truthy result
+var ErrVerificationFailed = errors.New("verification query returned a falsy result")
+
+// ErrPreconditionFailed is returned when a migration's Precondition query
+// does not produce a truthy result
+var ErrPreconditionFailed = errors.New("precondition query returned a falsy result")
+
+// ErrTrackingTableMissing is returned when the Migrator is configured with
+// WithExistingTableOnly and the tracking table can't be read
+var ErrTrackingTableMissing = errors.New("migration tracking table does not exist")
+
+// ErrReplica is returned by Apply when the Migrator is configured with
+// WithReplicaCheck and the database is a read-only replica
+var ErrReplica = errors.New("database is a read-only replica")
+
+// ErrServerVersion is returned by Apply when the database server is older
+// than the Migrator's or a pending migration's MinServerVersion
+var ErrServerVersion = errors.New("database server version is too old")
+
+// ErrUpdateNotSupported is returned by Apply when an Always or Batch
+// migration is applied with a dialect which doesn't implement Updater
+var ErrUpdateNotSupported = errors.New("dialect does not support updating the record of a migration")
+
 // Queryer is something which can execute a Query (either a sql.DB
 // or a sql.Tx))
 type Queryer interface {
 	Query(sql string, args ...interface{}) (*sql.Rows, error)
 }
 
+// Transactor is something which can begin a transaction (either a sql.DB
+// or a sql.Conn)
+type Transactor interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// ExecerContext is something which can execute a statement with a context
+// (a sql.DB, sql.Conn or sql.Tx)
+type ExecerContext interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// QueryerContext is something which can run a query with a context (a
+// sql.DB, sql.Conn or sql.Tx). Use QueryerWithContext to pass one where a
+// Queryer is expected.
+type QueryerContext interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// QueryerWithContext adapts a QueryerContext to the Queryer interface,
+// running its queries with the context. It allows a sql.Conn, which only
+// has context methods, to be used with GetAppliedMigrations, Status and
+// Introspect, and makes queries through a sql.DB or sql.Tx honour a
+// deadline.
+// Usage: migrator.GetAppliedMigrations(schema.QueryerWithContext(ctx, conn))
+func QueryerWithContext(ctx context.Context, db QueryerContext) Queryer {
+	return contextQueryer{ctx: ctx, db: db}
+}
+
 // transaction wraps the supplied function in a transaction with the supplied
 // database connecion
 //
-func transaction(db *sql.DB, f func(*sql.Tx) error) (err error) {
-	if db == nil {
+func transaction(ctx context.Context, db Transactor, f func(*sql.Tx) error) (err error) {
+	return transactionWithOptions(ctx, db, nil, f)
+}
+
+// transactionWithOptions is like transaction, but begins the transaction
+// with the supplied options
+func transactionWithOptions(ctx context.Context, db Transactor, opts *sql.TxOptions, f func(*sql.Tx) error) (err error) {
+	if db == nil || db == (*sql.DB)(nil) || db == (*sql.Conn)(nil) {
 		return ErrNilDB
 	}
-	tx, err := db.Begin()
+	tx, err := db.BeginTx(ctx, opts)
 	if err != nil {
 		return
 	}
@@ -49,3 +113,51 @@ func transaction(db *sql.DB, f func(*sql.Tx) error) (err error) {
 
 	return f(tx)
 }
+
+// PartialMigrationError is returned when a migration fails after some of its
+// statements were implicitly committed by the database (as DDL is in MySQL).
+// Those statements can't be rolled back, so the migration is left partially
+// applied and needs manual attention before it can be retried.
+type PartialMigrationError struct {
+	MigrationID string
+	// Committed is the number of leading statements which were committed
+	Committed int
+	// Total is the number of statements in the migration
+	Total int
+	// Statement is the statement which failed
+	Statement string
+	// AtomicDDL is true when the server's DDL statements are atomic, so
+	// the failed statement was rolled back entirely
+	AtomicDDL bool
+	Err       error
+}
+
+func (e *PartialMigrationError) Error() string {
+	failed := "The failed statement may itself have been partly applied"
+	if e.AtomicDDL {
+		failed = "The failed statement was rolled back"
+	}
+	return fmt.Sprintf(
+		"Migration '%s' Failed after committing %d of %d statements. The migration is partially applied. %s. Failed statement:\n%s\n%s",
+		e.MigrationID, e.Committed, e.Total, failed, e.Statement, e.Err,
+	)
+}
+
+func (e *PartialMigrationError) Unwrap() error {
+	return e.Err
+}
+
+// LockError is returned by Apply when the migration lock can't be acquired,
+// typically because another migrator held it until a lock timeout or the
+// context deadline expired
+type LockError struct {
+	Err error
+}
+
+func (e *LockError) Error() string {
+	return fmt.Sprintf("Failed to acquire the migration lock:\n%s", e.Err)
+}
+
+func (e *LockError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,178 @@
+// Package schemahttp exposes the migration status of a database over HTTP,
+// so that services can report it on an admin port and readiness probes can
+// wait until the schema is current.
+package schemahttp
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/adlio/schema"
+)
+
+// StatusResponse is the JSON document served by Handler
+type StatusResponse struct {
+	Current   bool               `json:"current"`
+	Applied   []AppliedResponse  `json:"applied"`
+	Pending   []string           `json:"pending"`
+	Drifted   []DriftResponse    `json:"drifted"`
+	Unknown   []string           `json:"unknown"`
+	Partial   []string           `json:"partial"`
+	Error     string             `json:"error,omitempty"`
+	LastError *LastErrorResponse `json:"last_error,omitempty"`
+	CheckedAt time.Time          `json:"checked_at"`
+}
+
+// LastErrorResponse describes the most recent run of Apply, when it failed
+type LastErrorResponse struct {
+	Error string `json:"error"`
+	// Migrations lists the IDs of the migrations the run planned
+	Migrations []string  `json:"migrations"`
+	FailedAt   time.Time `json:"failed_at"`
+}
+
+// ErrorRecorder is a schema.Notifier which remembers the error of the most
+// recent run of Apply, so that Handler can report it. A run which succeeds
+// clears it. Notifications are passed on to Next when it is set.
+// Usage: schema.NewMigrator(schema.WithNotifier(&schemahttp.ErrorRecorder{}))
+type ErrorRecorder struct {
+	Next schema.Notifier
+
+	mutex sync.Mutex
+	last  *LastErrorResponse
+}
+
+// Notify records the error of a failed run, or clears it after one which
+// succeeded
+func (e *ErrorRecorder) Notify(ctx context.Context, notification *schema.Notification) error {
+	e.mutex.Lock()
+	e.last = nil
+	if notification.Error != "" {
+		e.last = &LastErrorResponse{
+			Error:      notification.Error,
+			Migrations: notification.Migrations,
+			FailedAt:   time.Now().UTC(),
+		}
+	}
+	e.mutex.Unlock()
+	if e.Next != nil {
+		return e.Next.Notify(ctx, notification)
+	}
+	return nil
+}
+
+// LastError returns the most recent run's error, or nil when it succeeded
+func (e *ErrorRecorder) LastError() *LastErrorResponse {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.last
+}
+
+// AppliedResponse describes an applied migration
+type AppliedResponse struct {
+	ID                    string    `json:"id"`
+	Checksum              string    `json:"checksum"`
+	ExecutionTimeInMillis int       `json:"execution_time_in_millis"`
+	AppliedAt             time.Time `json:"applied_at"`
+}
+
+// DriftResponse describes an applied migration whose source has changed
+type DriftResponse struct {
+	ID              string `json:"id"`
+	AppliedChecksum string `json:"applied_checksum"`
+	CurrentChecksum string `json:"current_checksum"`
+}
+
+// Handler returns an http.Handler which serves the migration status of the
+// database as JSON. It responds 200 OK when every migration is applied with
+// no checksum drift and none was left partially applied, and 503 Service Unavailable otherwise (including when
+// the status can't be determined, in which case the error is reported), so
+// it can be used directly as a readiness probe. The database is only read,
+// in a transaction begun with the Migrator's ReadTxOptions, and the read
+// stops when the request is cancelled. When the Migrator's Notifier is an
+// ErrorRecorder, the error of its most recent failed run is reported too.
+func Handler(migrator schema.Migrator, db *sql.DB, migrations []*schema.Migration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		response := StatusResponse{CheckedAt: time.Now().UTC()}
+		status, err := readStatus(r.Context(), migrator, db, migrations)
+		if err != nil {
+			response.Error = err.Error()
+		} else {
+			response = newStatusResponse(status, response.CheckedAt)
+		}
+		if recorder, ok := migrator.Notifier.(*ErrorRecorder); ok {
+			response.LastError = recorder.LastError()
+		}
+
+		code := http.StatusOK
+		if !response.Current {
+			code = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(response)
+		}
+	})
+}
+
+// readStatus reads the status of the migrations in a read-only transaction
+// which honours the context
+func readStatus(ctx context.Context, migrator schema.Migrator, db *sql.DB, migrations []*schema.Migration) (*schema.Status, error) {
+	if db == nil {
+		return nil, schema.ErrNilDB
+	}
+	tx, err := db.BeginTx(ctx, migrator.ReadTxOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	return migrator.Status(schema.QueryerWithContext(ctx, tx), migrations)
+}
+
+func newStatusResponse(status *schema.Status, checkedAt time.Time) StatusResponse {
+	response := StatusResponse{
+		Current:   status.Current(),
+		Applied:   make([]AppliedResponse, 0, len(status.Applied)),
+		Pending:   make([]string, 0, len(status.Pending)),
+		Drifted:   make([]DriftResponse, 0, len(status.Drifted)),
+		Unknown:   make([]string, 0, len(status.Unknown)),
+		Partial:   make([]string, 0, len(status.Partial)),
+		CheckedAt: checkedAt,
+	}
+	for _, applied := range status.Applied {
+		response.Applied = append(response.Applied, AppliedResponse{
+			ID:                    applied.ID,
+			Checksum:              applied.Checksum,
+			ExecutionTimeInMillis: applied.ExecutionTimeInMillis,
+			AppliedAt:             applied.AppliedAt,
+		})
+	}
+	for _, migration := range status.Pending {
+		response.Pending = append(response.Pending, migration.ID)
+	}
+	for _, drift := range status.Drifted {
+		response.Drifted = append(response.Drifted, DriftResponse{
+			ID:              drift.Applied.ID,
+			AppliedChecksum: drift.Applied.Checksum,
+			CurrentChecksum: drift.CurrentChecksum,
+		})
+	}
+	for _, unknown := range status.Unknown {
+		response.Unknown = append(response.Unknown, unknown.ID)
+	}
+	for _, partial := range status.Partial {
+		response.Partial = append(response.Partial, partial.ID)
+	}
+	return response
+}
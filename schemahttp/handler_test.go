@@ -0,0 +1,154 @@
+package schemahttp
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/adlio/schema"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestHandler(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "handler.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	migrator := schema.NewMigrator(schema.WithDialect(schema.NewSQLite()))
+	migrations := []*schema.Migration{
+		{ID: "2020-01-01 Users", Script: "CREATE TABLE users (id INTEGER)"},
+	}
+
+	response := serve(t, Handler(migrator, db, migrations))
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before the tracking table exists. Got %d", response.Code)
+	}
+	body := decode(t, response)
+	if body.Error == "" {
+		t.Error("Expected the error to be reported")
+	}
+
+	if err := migrator.Apply(db, migrations); err != nil {
+		t.Fatal(err)
+	}
+	pending := append(migrations, &schema.Migration{ID: "2020-01-02 Albums", Script: "CREATE TABLE albums (id INTEGER)"})
+	response = serve(t, Handler(migrator, db, pending))
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 with pending migrations. Got %d", response.Code)
+	}
+	body = decode(t, response)
+	if len(body.Pending) != 1 || body.Pending[0] != "2020-01-02 Albums" {
+		t.Errorf("Expected the pending migration to be listed. Got %v", body.Pending)
+	}
+
+	response = serve(t, Handler(migrator, db, migrations))
+	if response.Code != http.StatusOK {
+		t.Errorf("Expected 200 when current. Got %d", response.Code)
+	}
+	body = decode(t, response)
+	if !body.Current || len(body.Applied) != 1 {
+		t.Errorf("Expected 1 applied migration and a current status. Got %+v", body)
+	}
+
+	drifted := []*schema.Migration{
+		{ID: "2020-01-01 Users", Script: "CREATE TABLE users (id BIGINT)"},
+	}
+	body = decode(t, serve(t, Handler(migrator, db, drifted)))
+	if len(body.Drifted) != 1 {
+		t.Errorf("Expected checksum drift to be reported. Got %+v", body.Drifted)
+	}
+
+	// A migration which failed after committing one of its statements is
+	// recorded with a partial checksum
+	if _, err := db.Exec(`INSERT INTO schema_migrations (id, checksum, execution_time_in_millis, applied_at) VALUES ('2020-01-02 Albums', 'partial:1', 0, CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatal(err)
+	}
+	response = serve(t, Handler(migrator, db, pending))
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 with a partially applied migration. Got %d", response.Code)
+	}
+	body = decode(t, response)
+	if len(body.Partial) != 1 || body.Partial[0] != "2020-01-02 Albums" || len(body.Pending) != 0 {
+		t.Errorf("Expected the partial migration to be listed. Got %+v", body)
+	}
+}
+
+func serve(t *testing.T, handler http.Handler) *httptest.ResponseRecorder {
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/schema", nil))
+	return response
+}
+
+func decode(t *testing.T, response *httptest.ResponseRecorder) StatusResponse {
+	var body StatusResponse
+	if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestHandlerUsesRequestContext(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "cancelled.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	migrator := schema.NewMigrator(schema.WithDialect(schema.NewSQLite()))
+	migrations := []*schema.Migration{{ID: "2020-01-01 Users", Script: "CREATE TABLE users (id INTEGER)"}}
+	if err := migrator.Apply(db, migrations); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	response := httptest.NewRecorder()
+	Handler(migrator, db, migrations).ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/schema", nil).WithContext(ctx))
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 for a cancelled request. Got %d", response.Code)
+	}
+	if body := decode(t, response); body.Error != context.Canceled.Error() {
+		t.Errorf("Expected the cancellation to be reported. Got %q", body.Error)
+	}
+}
+
+func TestHandlerReportsLastError(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "last_error.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var forwarded int
+	recorder := &ErrorRecorder{Next: schema.NotifierFunc(func(ctx context.Context, notification *schema.Notification) error {
+		forwarded++
+		return nil
+	})}
+	migrator := schema.NewMigrator(schema.WithDialect(schema.NewSQLite()), schema.WithNotifier(recorder))
+	broken := []*schema.Migration{{ID: "2020-01-01 Broken", Script: "NOT SQL"}}
+	if err := migrator.Apply(db, broken); err == nil {
+		t.Fatal("Expected the migration to fail")
+	}
+
+	body := decode(t, serve(t, Handler(migrator, db, broken)))
+	if body.LastError == nil || body.LastError.Error == "" || len(body.LastError.Migrations) != 1 || body.LastError.Migrations[0] != "2020-01-01 Broken" {
+		t.Errorf("Expected the failed run to be reported. Got %+v", body.LastError)
+	}
+
+	fixed := []*schema.Migration{{ID: "2020-01-01 Broken", Script: "CREATE TABLE fixed (id INTEGER)"}}
+	if err := migrator.Apply(db, fixed); err != nil {
+		t.Fatal(err)
+	}
+	if body = decode(t, serve(t, Handler(migrator, db, fixed))); body.LastError != nil {
+		t.Errorf("Expected a successful run to clear the error. Got %+v", body.LastError)
+	}
+	if forwarded != 2 {
+		t.Errorf("Expected both notifications to be forwarded. Got %d", forwarded)
+	}
+}
@@ -0,0 +1,13 @@
+// Package schemapgx applies migrations through a pgxpool.Pool, for
+// applications which use pgx's native interface rather than database/sql.
+// It is built with the pgx build tag, so that the schema package doesn't
+// depend on pgx unless it is used:
+//
+//	go get github.com/jackc/pgx/v5
+//	go build -tags pgx
+//
+// The Migrator needs a sql.DB, which DB opens on top of the pool, so that
+// migrations share the pool's connections and configuration:
+//
+//	err := schemapgx.Apply(schema.NewMigrator(), pool, migrations)
+package schemapgx
@@ -0,0 +1,26 @@
+//go:build pgx
+// +build pgx
+
+package schemapgx
+
+import (
+	"database/sql"
+
+	"github.com/adlio/schema"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// DB opens a sql.DB which checks connections out of the pool. It keeps no
+// idle connections of its own, leaving them to the pool.
+func DB(pool *pgxpool.Pool) *sql.DB {
+	return stdlib.OpenDBFromPool(pool)
+}
+
+// Apply applies the migrations through a sql.DB opened on the pool, closing
+// it afterwards
+func Apply(m schema.Migrator, pool *pgxpool.Pool, migrations []*schema.Migration) error {
+	db := DB(pool)
+	defer db.Close()
+	return m.Apply(db, migrations)
+}
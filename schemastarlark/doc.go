@@ -0,0 +1,21 @@
+// Package schemastarlark renders migrations written in Starlark, a dialect
+// of Python designed for embedding, into SQL. It is built with the starlark
+// build tag, so that the schema package doesn't depend on a Starlark
+// interpreter unless it is used:
+//
+//	go get go.starlark.net
+//	go build -tags starlark
+//
+// A Starlark migration emits SQL statements by calling sql(), and can read
+// the name of the dialect, the server version, the Migrator's environment
+// and its script flags from the predeclared dialect, server_version,
+// environment and flags variables (see schema.ScriptVars):
+//
+//	for tenant in ["acme", "globex"]:
+//	    sql("CREATE SCHEMA %s" % tenant)
+//	    sql("CREATE TABLE %s.users (id INTEGER)" % tenant)
+//
+// Set the Engine of such a migration to an Engine:
+//
+//	&schema.Migration{ID: "2021-03-01 Tenants", Script: source, Engine: schemastarlark.Engine{}}
+package schemastarlark
@@ -0,0 +1,69 @@
+//go:build starlark
+// +build starlark
+
+package schemastarlark
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/adlio/schema"
+	"go.starlark.net/starlark"
+)
+
+var _ schema.VarsEngine = Engine{}
+
+// Engine is a schema.ScriptEngine which executes Starlark. Predeclared
+// values, such as a list of tenants, are available to every migration
+// alongside sql(), dialect, server_version, environment and flags.
+type Engine struct {
+	Predeclared starlark.StringDict
+}
+
+// Render executes the Starlark source with only the dialect known
+func (e Engine) Render(source string, dialect string) (string, error) {
+	return e.RenderVars(source, schema.ScriptVars{Dialect: dialect})
+}
+
+// RenderVars executes the Starlark source and returns the statements it
+// emitted with sql(), separated by semicolons
+func (e Engine) RenderVars(source string, vars schema.ScriptVars) (string, error) {
+	statements := make([]string, 0)
+	emit := func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var statement string
+		err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &statement)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, strings.TrimRight(strings.TrimSpace(statement), ";"))
+		return starlark.None, nil
+	}
+
+	flags := starlark.NewDict(len(vars.Flags))
+	for name, value := range vars.Flags {
+		_ = flags.SetKey(starlark.String(name), starlark.Bool(value))
+	}
+	predeclared := starlark.StringDict{
+		"sql":            starlark.NewBuiltin("sql", emit),
+		"dialect":        starlark.String(vars.Dialect),
+		"server_version": starlark.String(vars.ServerVersion),
+		"environment":    starlark.String(vars.Environment),
+		"flags":          flags,
+	}
+	for name, value := range e.Predeclared {
+		predeclared[name] = value
+	}
+
+	thread := &starlark.Thread{Name: "migration"}
+	_, err := starlark.ExecFile(thread, "migration.star", source, predeclared)
+	if err != nil {
+		if evalErr, ok := err.(*starlark.EvalError); ok {
+			return "", fmt.Errorf("%s", evalErr.Backtrace())
+		}
+		return "", err
+	}
+	if len(statements) == 0 {
+		return "", nil
+	}
+	return strings.Join(statements, ";\n") + ";", nil
+}
@@ -0,0 +1,128 @@
+package schema
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// ScriptsTableSuffix is appended to the name of the tracking table to name
+// the table in which the scripts of applied migrations are stored
+const ScriptsTableSuffix = "_scripts"
+
+// ErrScriptsNotSupported is returned by Apply when the Migrator records
+// scripts, but its dialect doesn't implement ScriptRecorder
+var ErrScriptsNotSupported = errors.New("dialect does not support recording scripts")
+
+// batchMarker separates the statement of a Batch from the migration's
+// script when it is stored
+const batchMarker = "\n\n-- Batch:\n"
+
+// AppliedScript is the script which ran when a migration was applied. A
+// migration which runs more than once (see Migration.Always) has a record
+// for each run.
+type AppliedScript struct {
+	ID        string
+	Script    string
+	AppliedAt time.Time
+}
+
+// QuotedScriptsTableName returns the dialect-quoted fully-qualified name of
+// the table in which the scripts of applied migrations are stored
+func (m Migrator) QuotedScriptsTableName() string {
+	return m.Dialect.QuotedTableName(m.SchemaName, m.TableName+ScriptsTableSuffix)
+}
+
+// createScriptsTable creates the scripts table when the Migrator records
+// scripts
+func (m Migrator) createScriptsTable(ctx context.Context, tx *sql.Tx) error {
+	if !m.RecordScripts {
+		return nil
+	}
+	recorder, ok := m.Dialect.(ScriptRecorder)
+	if !ok {
+		return ErrScriptsNotSupported
+	}
+	_, err := m.exec(ctx, tx, recorder.CreateScriptsSQL(m.QuotedScriptsTableName()))
+	return err
+}
+
+// recordScript stores the compressed script which ran for the migration, as
+// rendered by its Engine, including the statement of a Batch
+func (m Migrator) recordScript(ctx context.Context, tx *sql.Tx, migration *Migration, appliedAt time.Time) error {
+	recorder, ok := m.Dialect.(ScriptRecorder)
+	if !m.RecordScripts || !ok {
+		return nil
+	}
+	script, err := m.renderScript(migration)
+	if err != nil {
+		return err
+	}
+	if migration.Batch != nil {
+		script += batchMarker + migration.Batch.Statement
+	}
+	compressed, err := compressScript(script)
+	if err != nil {
+		return err
+	}
+	_, err = m.exec(ctx, tx, recorder.InsertScriptSQL(m.QuotedScriptsTableName()), migration.ID, compressed, appliedAt.UTC())
+	return err
+}
+
+// AppliedScripts retrieves the stored scripts in the order the migrations
+// were applied, so that auditors can see exactly what ran even after the
+// migrations' source has changed
+func (m Migrator) AppliedScripts(db Queryer) ([]*AppliedScript, error) {
+	selectSQL := fmt.Sprintf(`SELECT id, script, applied_at FROM %s ORDER BY applied_at, id`, m.QuotedScriptsTableName())
+	startedAt := time.Now()
+	rows, err := db.Query(selectSQL)
+	m.logQuery(selectSQL, nil, startedAt, err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scripts := make([]*AppliedScript, 0)
+	for rows.Next() {
+		script := &AppliedScript{}
+		var compressed []byte
+		err = rows.Scan(&script.ID, &compressed, timestamp(&script.AppliedAt))
+		if err != nil {
+			return nil, err
+		}
+		script.Script, err = decompressScript(compressed)
+		if err != nil {
+			return nil, fmt.Errorf("Script of migration '%s' is corrupt:\n%w", script.ID, err)
+		}
+		scripts = append(scripts, script)
+	}
+	return scripts, rows.Err()
+}
+
+// compressScript gzips the script for storage
+func compressScript(script string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(script))
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	return buf.Bytes(), err
+}
+
+// decompressScript reverses compressScript
+func decompressScript(compressed []byte) (string, error) {
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	script, err := ioutil.ReadAll(r)
+	return string(script), err
+}
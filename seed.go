@@ -0,0 +1,220 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"strings"
+)
+
+const defaultCSVBatchSize = 500
+
+// maxSeedParameters is the most values a Seed binds in one statement, which
+// every supported database accepts
+const maxSeedParameters = 999
+
+// ErrSeedNotSupported is returned when a migration with a Seed is applied
+// with a dialect which doesn't implement SeedInserter
+var ErrSeedNotSupported = errors.New("dialect does not support inserting seed rows")
+
+var csvColumnPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Seed describes rows inserted into a table when a migration runs, after its
+// Script, such as the reference data loaded by MigrationFromCSV. The values
+// are bound as parameters rather than written into the SQL, and are part of
+// the migration's checksum. Rows which conflict with existing rows (by the
+// table's unique constraints) are skipped, so a Seed can be applied again.
+type Seed struct {
+	// Table and Columns are written into the INSERT statements as they are
+	// given, so they must be valid SQL identifiers
+	Table   string
+	Columns []string
+
+	// Rows holds the values of each row, in the order of Columns. A nil
+	// value is inserted as NULL.
+	Rows [][]interface{}
+
+	// BatchSize is the number of rows inserted by each statement. It
+	// defaults to 500, and is reduced so that no statement binds more than
+	// 999 values.
+	BatchSize int
+
+	// ConflictClause, when set, is appended to each INSERT in place of the
+	// dialect's skipping of conflicting rows, such as
+	// "ON CONFLICT (code) DO UPDATE SET name = EXCLUDED.name" on Postgres
+	ConflictClause string
+}
+
+// SeedInserter defines an interface for dialects which can insert the rows
+// of a Seed. SeedSQL returns an INSERT of the number of rows into the
+// columns, written with the dialect's placeholders, which skips rows that
+// conflict with existing ones when ignoreConflicts is true.
+type SeedInserter interface {
+	SeedSQL(table string, columns []string, rows int, ignoreConflicts bool) string
+}
+
+// batchSize returns the number of rows inserted by each statement
+func (s *Seed) batchSize() int {
+	size := s.BatchSize
+	if size < 1 {
+		size = defaultCSVBatchSize
+	}
+	if len(s.Columns) > 0 && size*len(s.Columns) > maxSeedParameters {
+		size = maxSeedParameters / len(s.Columns)
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// fields returns the table, columns, conflict clause and values of the seed,
+// which its migration's checksum and signature cover
+func (s *Seed) fields() []string {
+	fields := append([]string{s.Table, s.ConflictClause}, s.Columns...)
+	for _, row := range s.Rows {
+		fields = append(fields, ":row")
+		for _, value := range row {
+			fields = append(fields, fmt.Sprintf("%#v", value))
+		}
+	}
+	return fields
+}
+
+// insertSeed inserts the rows of the migration's Seed within the migration
+// transaction
+func (m Migrator) insertSeed(ctx context.Context, tx *sql.Tx, migration *Migration) error {
+	inserter, ok := m.Dialect.(SeedInserter)
+	if !ok {
+		return fmt.Errorf("Migration '%s' Failed:\n%w", migration.ID, ErrSeedNotSupported)
+	}
+	seed := migration.Seed
+	size := seed.batchSize()
+	for start := 0; start < len(seed.Rows); start += size {
+		end := start + size
+		if end > len(seed.Rows) {
+			end = len(seed.Rows)
+		}
+		args := make([]interface{}, 0, (end-start)*len(seed.Columns))
+		for i, row := range seed.Rows[start:end] {
+			if len(row) != len(seed.Columns) {
+				return fmt.Errorf("Migration '%s' seed row %d has %d values for %d columns", migration.ID, start+i+1, len(row), len(seed.Columns))
+			}
+			args = append(args, row...)
+		}
+		seedSQL := inserter.SeedSQL(seed.Table, seed.Columns, end-start, seed.ConflictClause == "")
+		if seed.ConflictClause != "" {
+			seedSQL += " " + seed.ConflictClause
+		}
+		_, err := m.exec(ctx, tx, seedSQL, args...)
+		if err != nil {
+			return fmt.Errorf("Migration '%s' seed failed at row %d:\n%w", migration.ID, start+1, err)
+		}
+	}
+	m.log(fmt.Sprintf("Migration '%s' seeded %d rows into %s\n", migration.ID, len(seed.Rows), seed.Table))
+	return nil
+}
+
+// seedValues returns the placeholders of the rows of a multi-row INSERT
+func seedValues(columns, rows int, placeholder func(i int) string) string {
+	values := make([]string, rows)
+	for row := range values {
+		placeholders := make([]string, columns)
+		for column := range placeholders {
+			placeholders[column] = placeholder(row*columns + column + 1)
+		}
+		values[row] = "(" + strings.Join(placeholders, ", ") + ")"
+	}
+	return strings.Join(values, ", ")
+}
+
+type csvSeed struct {
+	batchSize      int
+	conflictClause string
+}
+
+// CSVOption customizes the migration built by MigrationFromCSV
+type CSVOption func(c *csvSeed)
+
+// WithCSVBatchSize sets how many rows are inserted by each INSERT statement.
+// The default is 500. See Seed.BatchSize.
+func WithCSVBatchSize(n int) CSVOption {
+	return func(c *csvSeed) {
+		c.batchSize = n
+	}
+}
+
+// WithCSVConflictClause sets a clause appended to each INSERT statement to
+// handle rows which already exist, in place of the dialect's skipping of
+// them, such as one which updates them instead. See Seed.ConflictClause.
+func WithCSVConflictClause(clause string) CSVOption {
+	return func(c *csvSeed) {
+		c.conflictClause = clause
+	}
+}
+
+// MigrationFromCSV builds a data-load migration from a CSV file, so that
+// reference tables can be versioned alongside DDL. The first row of the file
+// names the columns, and each following row is inserted into the table by
+// the migration's Seed. Rows which already exist (by the table's unique
+// constraints) are skipped, making the load idempotent. Set Always on the
+// returned migration to add newly versioned rows on every Apply. Empty
+// fields are inserted as NULL. The migration's ID is derived from the file
+// name.
+func MigrationFromCSV(fsys fs.FS, filename, table string, opts ...CSVOption) (*Migration, error) {
+	options := csvSeed{batchSize: defaultCSVBatchSize}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	file, err := fsys.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read CSV from '%s': %w", filename, err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	columns, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read CSV header from '%s': %w", filename, err)
+	}
+	for _, column := range columns {
+		if !csvColumnPattern.MatchString(column) {
+			return nil, fmt.Errorf("CSV '%s' has invalid column name '%s'", filename, column)
+		}
+	}
+
+	seed := &Seed{
+		Table:          table,
+		Columns:        columns,
+		Rows:           make([][]interface{}, 0),
+		BatchSize:      options.batchSize,
+		ConflictClause: options.conflictClause,
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CSV from '%s': %w", filename, err)
+		}
+		row := make([]interface{}, len(record))
+		for i, value := range record {
+			if value != "" {
+				row[i] = value
+			}
+		}
+		seed.Rows = append(seed.Rows, row)
+	}
+
+	return &Migration{
+		ID:   MigrationIDFromFilename(filename),
+		Seed: seed,
+	}, nil
+}
@@ -0,0 +1,84 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrationFromCSV(t *testing.T) {
+	fsys := fstest.MapFS{
+		"seeds/2020-01-01 Countries.csv": &fstest.MapFile{
+			Data: []byte("code,name\nUS,United States\nCI,Côte d'Ivoire\nXX,\n"),
+		},
+	}
+	migration, err := MigrationFromCSV(fsys, "seeds/2020-01-01 Countries.csv", "countries", WithCSVBatchSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migration.ID != "2020-01-01 Countries" {
+		t.Errorf("Incorrect ID: %s", migration.ID)
+	}
+	if migration.Script != "" {
+		t.Errorf("Expected the rows to be left out of the script:\n%s", migration.Script)
+	}
+	seed := migration.Seed
+	if seed == nil {
+		t.Fatal("Expected a Seed")
+	}
+	if seed.Table != "countries" || !reflect.DeepEqual(seed.Columns, []string{"code", "name"}) {
+		t.Errorf("Incorrect table or columns: %s %v", seed.Table, seed.Columns)
+	}
+	expected := [][]interface{}{
+		{"US", "United States"},
+		{"CI", "Côte d'Ivoire"},
+		{"XX", nil},
+	}
+	if !reflect.DeepEqual(seed.Rows, expected) {
+		t.Errorf("Expected %v, got %v", expected, seed.Rows)
+	}
+	if seed.batchSize() != 2 {
+		t.Errorf("Expected a batch size of 2, got %d", seed.batchSize())
+	}
+}
+
+func TestMigrationFromCSVRejectsInvalidColumns(t *testing.T) {
+	fsys := fstest.MapFS{
+		"bad.csv": &fstest.MapFile{Data: []byte("id,\"name; DROP TABLE users\"\n1,a\n")},
+	}
+	_, err := MigrationFromCSV(fsys, "bad.csv", "users")
+	if err == nil {
+		t.Error("Expected an error for an invalid column name")
+	}
+}
+
+func TestSeedBatchSize(t *testing.T) {
+	seed := &Seed{Columns: make([]string, 10)}
+	if seed.batchSize() != 99 {
+		t.Errorf("Expected the batch to be limited to 999 values, got %d rows", seed.batchSize())
+	}
+}
+
+func TestSeedSQL(t *testing.T) {
+	columns := []string{"code", "name"}
+	tests := []struct {
+		dialect  SeedInserter
+		expected string
+	}{
+		{Postgres, "INSERT INTO countries (code, name) VALUES ($1, $2), ($3, $4) ON CONFLICT DO NOTHING"},
+		{NewSQLite(), "INSERT INTO countries (code, name) VALUES (?, ?), (?, ?) ON CONFLICT DO NOTHING"},
+		{MySQL, "INSERT INTO countries (code, name) VALUES (?, ?), (?, ?) ON DUPLICATE KEY UPDATE code = code"},
+	}
+	for _, test := range tests {
+		got := test.dialect.SeedSQL("countries", columns, 2, true)
+		if got != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, got)
+		}
+	}
+	if got := Postgres.SeedSQL("countries", columns, 1, false); got != "INSERT INTO countries (code, name) VALUES ($1, $2)" {
+		t.Errorf("Expected no conflict handling, got %s", got)
+	}
+	if _, ok := interface{}(Oracle).(SeedInserter); ok {
+		t.Error("Expected Oracle not to insert seeds")
+	}
+}
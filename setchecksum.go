@@ -0,0 +1,100 @@
+package schema
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SetTableSuffix is appended to the name of the tracking table to name the
+// table in which the checksum of the last applied migration set is stored
+const SetTableSuffix = "_set"
+
+// ErrSetNotSupported is returned by Apply when the Migrator records the set
+// checksum, but its dialect doesn't implement SetRecorder
+var ErrSetNotSupported = errors.New("dialect does not support recording the set checksum")
+
+// AppliedSet is the migration set most recently applied in full
+type AppliedSet struct {
+	Checksum   string
+	Migrations int
+	AppliedAt  time.Time
+}
+
+// SetChecksum returns the hex encoded SHA-256 of the whole migration set,
+// covering each migration's ID and every script it can run. Like the
+// signature of SignMigrations it doesn't depend on the order of the slice,
+// since Apply sorts the migrations anyway. Comparing it to the Checksum of
+// AppliedSet tells whether the database has exactly the migrations a build
+// ships, without comparing them one at a time.
+func SetChecksum(migrations []*Migration) string {
+	h := sha256.New()
+	for _, migration := range sortedForSigning(migrations) {
+		writeSigned(h, migration)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// QuotedSetTableName returns the dialect-quoted fully-qualified name of the
+// table in which the checksum of the last applied migration set is stored
+func (m Migrator) QuotedSetTableName() string {
+	return m.Dialect.QuotedTableName(m.SchemaName, m.TableName+SetTableSuffix)
+}
+
+// createSetTable creates the set table when the Migrator records the set
+// checksum
+func (m Migrator) createSetTable(ctx context.Context, tx *sql.Tx) error {
+	if !m.RecordSetChecksum {
+		return nil
+	}
+	recorder, ok := m.Dialect.(SetRecorder)
+	if !ok {
+		return ErrSetNotSupported
+	}
+	_, err := m.exec(ctx, tx, recorder.CreateSetSQL(m.QuotedSetTableName()))
+	return err
+}
+
+// recordSet replaces the stored set checksum with that of the migrations,
+// once Apply has brought the database up to date with them. It is recorded
+// while the migration lock is held, so that concurrent runs record their
+// sets in the order they applied them.
+func (m Migrator) recordSet(ctx context.Context, tx *sql.Tx, migrations []*Migration) error {
+	recorder, ok := m.Dialect.(SetRecorder)
+	if !m.RecordSetChecksum || !ok {
+		return nil
+	}
+	_, err := m.exec(ctx, tx, fmt.Sprintf(`DELETE FROM %s`, m.QuotedSetTableName()))
+	if err != nil {
+		return err
+	}
+	_, err = m.exec(ctx, tx, recorder.InsertSetSQL(m.QuotedSetTableName()), SetChecksum(migrations), len(migrations), time.Now().UTC())
+	return err
+}
+
+// AppliedSet retrieves the checksum of the migration set most recently
+// applied in full, or nil if none has been recorded
+func (m Migrator) AppliedSet(db Queryer) (*AppliedSet, error) {
+	selectSQL := fmt.Sprintf(`SELECT checksum, migrations, applied_at FROM %s`, m.QuotedSetTableName())
+	startedAt := time.Now()
+	rows, err := db.Query(selectSQL)
+	m.logQuery(selectSQL, nil, startedAt, err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var set *AppliedSet
+	for rows.Next() {
+		set = &AppliedSet{}
+		err = rows.Scan(&set.Checksum, &set.Migrations, timestamp(&set.AppliedAt))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return set, rows.Err()
+}
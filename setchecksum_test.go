@@ -0,0 +1,28 @@
+package schema
+
+import "testing"
+
+func TestSetChecksum(t *testing.T) {
+	migrations := []*Migration{
+		{ID: "2020-01-01 First", Script: "CREATE TABLE first (id INTEGER)"},
+		{ID: "2020-01-02 Second", Script: "CREATE TABLE second (id INTEGER)"},
+	}
+	checksum := SetChecksum(migrations)
+	if len(checksum) != 64 {
+		t.Errorf("Expected a hex encoded SHA-256. Got %q", checksum)
+	}
+	if reordered := SetChecksum([]*Migration{migrations[1], migrations[0]}); reordered != checksum {
+		t.Errorf("Expected the checksum not to depend on order. Got %s and %s", checksum, reordered)
+	}
+
+	changed := map[string][]*Migration{
+		"removed": migrations[:1],
+		"changed": {migrations[0], {ID: migrations[1].ID, Script: "DROP TABLE first"}},
+		"added":   append([]*Migration{{ID: "2020-01-03 Third", Script: "SELECT 1"}}, migrations...),
+	}
+	for name, set := range changed {
+		if SetChecksum(set) == checksum {
+			t.Errorf("%s: Expected the checksum to change", name)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Shard is one of the databases migrated by ApplyShards
+type Shard struct {
+	// Name identifies the shard in results and errors
+	Name string
+	DB   *sql.DB
+}
+
+// ShardResult is the outcome of applying migrations to a shard. Report is
+// nil for a shard which wasn't started because the context was cancelled.
+type ShardResult struct {
+	Name   string
+	Report *Report
+	Err    error
+}
+
+// ShardError is returned by ApplyShards when some shards failed. The other
+// shards were migrated regardless.
+type ShardError struct {
+	Failed []*ShardResult
+}
+
+func (e *ShardError) Error() string {
+	lines := make([]string, len(e.Failed))
+	for i, result := range e.Failed {
+		lines[i] = fmt.Sprintf("Shard '%s': %v", result.Name, result.Err)
+	}
+	return fmt.Sprintf("%d shards failed:\n%s", len(e.Failed), strings.Join(lines, "\n"))
+}
+
+// ApplyShards applies the migrations to each shard, such as the databases
+// of a sharded or multi-tenant deployment, running up to ShardConcurrency
+// shards at once (one at a time by default), each with a ShardTimeout if
+// one is set. A failed shard doesn't stop the others. The results are in the
+// order of the shards, and a *ShardError lists those which failed.
+func (m Migrator) ApplyShards(ctx context.Context, shards []*Shard, migrations []*Migration) ([]*ShardResult, error) {
+	concurrency := m.ShardConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	results := make([]*ShardResult, len(shards))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		results[i] = &ShardResult{Name: shard.Name}
+		if ctx.Err() != nil {
+			results[i].Err = ctx.Err()
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		case slots <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(result *ShardResult, db *sql.DB) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			result.Report, result.Err = m.applyShard(ctx, db, migrations)
+		}(results[i], shard.DB)
+	}
+	wg.Wait()
+
+	failed := make([]*ShardResult, 0)
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	if len(failed) > 0 {
+		return results, &ShardError{Failed: failed}
+	}
+	return results, nil
+}
+
+// applyShard applies the migrations to a single shard within its timeout
+func (m Migrator) applyShard(ctx context.Context, db *sql.DB, migrations []*Migration) (*Report, error) {
+	if m.ShardTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.ShardTimeout)
+		defer cancel()
+	}
+	return m.ApplyReport(ctx, db, migrations)
+}
@@ -0,0 +1,77 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestApplyShardsSQLite(t *testing.T) {
+	shards := make([]*Shard, 0)
+	for i := 0; i < 5; i++ {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), fmt.Sprintf("shard%d.db", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = db.Close() })
+		shards = append(shards, &Shard{Name: fmt.Sprintf("shard%d", i), DB: db})
+	}
+	shards[2].DB = nil
+
+	var running, peak int32
+	track := func(next MigrationFunc) MigrationFunc {
+		return func(ctx context.Context, migration *Migration) error {
+			current := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				seen := atomic.LoadInt32(&peak)
+				if current <= seen || atomic.CompareAndSwapInt32(&peak, seen, current) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			return next(ctx, migration)
+		}
+	}
+	migrator := NewMigrator(WithDialect(NewSQLite()), WithMiddleware(track), WithShardConcurrency(2, time.Minute))
+	migrations := []*Migration{{ID: "2021-01-01 Users", Script: "CREATE TABLE users (id INTEGER)"}}
+
+	results, err := migrator.ApplyShards(context.Background(), shards, migrations)
+	var shardErr *ShardError
+	if !errors.As(err, &shardErr) || len(shardErr.Failed) != 1 || shardErr.Failed[0].Name != "shard2" {
+		t.Fatalf("Expected only shard2 to fail. Got %v", err)
+	}
+	if !errors.Is(results[2].Err, ErrNilDB) {
+		t.Errorf("Expected ErrNilDB for shard2. Got %v", results[2].Err)
+	}
+	for i, result := range results {
+		if result.Name != shards[i].Name {
+			t.Errorf("Expected results in shard order. Got %s at %d", result.Name, i)
+		}
+		if i != 2 && (result.Err != nil || len(result.Report.Applied) != 1) {
+			t.Errorf("Expected %s to be migrated. Got %+v", result.Name, result)
+		}
+	}
+	if peak > 2 {
+		t.Errorf("Expected at most 2 shards at once. Got %d", peak)
+	}
+}
+
+func TestApplyShardsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := NewMigrator().ApplyShards(ctx, []*Shard{{Name: "a"}, {Name: "b"}}, nil)
+	if err == nil || len(results) != 2 {
+		t.Fatalf("Expected both shards to fail. Got %v", err)
+	}
+	for _, result := range results {
+		if !errors.Is(result.Err, context.Canceled) || result.Report != nil {
+			t.Errorf("Unexpected error for %s: %v", result.Name, result.Err)
+		}
+	}
+}
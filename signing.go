@@ -0,0 +1,123 @@
+package schema
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// ErrInvalidSignature is returned by VerifyMigrations, and by Apply when the
+// Migrator has a SigningKey, when the migrations don't match the signature
+var ErrInvalidSignature = errors.New("migrations don't match their signature")
+
+// SignMigrations returns the hex encoded HMAC-SHA256 of the migrations'
+// SQL under the key, to be published alongside them in an artifact store.
+// The signature covers each migration's ID and every script it can run, but
+// not the order of the slice, so migrations loaded in any order verify.
+func SignMigrations(key []byte, migrations []*Migration) string {
+	mac := hmac.New(sha256.New, key)
+	for _, migration := range sortedForSigning(migrations) {
+		writeSigned(mac, migration)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sortedForSigning returns a copy of the migrations sorted by ID, and those
+// sharing an ID (such as those of different Modules) by their signed fields,
+// so that the order of the slice never matters
+func sortedForSigning(migrations []*Migration) []*Migration {
+	sorted := append([]*Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].ID != sorted[j].ID {
+			return sorted[i].ID < sorted[j].ID
+		}
+		var a, b bytes.Buffer
+		writeSigned(&a, sorted[i])
+		writeSigned(&b, sorted[j])
+		return bytes.Compare(a.Bytes(), b.Bytes()) < 0
+	})
+	return sorted
+}
+
+// VerifyMigrations checks the migrations against a signature created by
+// SignMigrations with the same key, returning ErrInvalidSignature if any of
+// them was added, removed or changed since it was signed
+func VerifyMigrations(key []byte, migrations []*Migration, signature string) error {
+	expected, err := hex.DecodeString(SignMigrations(key, migrations))
+	if err != nil {
+		return err
+	}
+	actual, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+	if !hmac.Equal(expected, actual) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// writeSigned writes the fields of the migration which affect what Apply
+// executes, each prefixed with its length so that content can't be moved
+// between fields without changing the signature. Fields which were added
+// later are only written when they are set, after a tag naming them, so
+// that signatures and checksums made before them still verify.
+func writeSigned(h io.Writer, migration *Migration) {
+	fields := []string{migration.ID, migration.Script, migration.Verify, migration.Precondition, migration.OnlyIf}
+	if migration.Batch != nil {
+		fields = append(fields, migration.Batch.Statement)
+	}
+	names := make([]string, 0, len(migration.DialectScripts))
+	for name := range migration.DialectScripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fields = append(fields, name, migration.DialectScripts[name])
+	}
+
+	if migration.Batch != nil && migration.Batch.KeyRange != "" {
+		fields = append(fields, ":batch-key-range", migration.Batch.KeyRange)
+	}
+	if migration.Copy != nil {
+		fields = append(fields, ":copy-table", migration.Copy.Table)
+		for _, column := range migration.Copy.Columns {
+			fields = append(fields, ":copy-column", column)
+		}
+	}
+	if migration.External {
+		fields = append(fields, ":external")
+	}
+	if migration.DisableTransaction {
+		fields = append(fields, ":disable-transaction")
+	}
+	dialects := append([]string{}, migration.Dialects...)
+	sort.Strings(dialects)
+	for _, dialect := range dialects {
+		fields = append(fields, ":dialect", dialect)
+	}
+	if index := migration.ConcurrentIndex; index != nil {
+		fields = append(fields, ":concurrent-index", index.createSQL(), strconv.Itoa(index.Retries))
+	}
+	if migration.Seed != nil {
+		fields = append(append(fields, ":seed"), migration.Seed.fields()...)
+	}
+	writeFields(h, fields)
+}
+
+// writeFields writes the number of fields, followed by each field prefixed
+// with its length
+func writeFields(h io.Writer, fields []string) {
+	_ = binary.Write(h, binary.BigEndian, uint64(len(fields)))
+	for _, field := range fields {
+		_ = binary.Write(h, binary.BigEndian, uint64(len(field)))
+		_, _ = h.Write([]byte(field))
+	}
+}
@@ -0,0 +1,48 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSignMigrations(t *testing.T) {
+	key := []byte("secret")
+	migrations := []*Migration{
+		{ID: "2020-01-01 First", Script: "CREATE TABLE first (id INTEGER)"},
+		{ID: "2020-01-02 Second", Script: "CREATE TABLE second (id INTEGER)", DialectScripts: map[string]string{"sqlite": "SELECT 1"}},
+	}
+	signature := SignMigrations(key, migrations)
+
+	reordered := []*Migration{migrations[1], migrations[0]}
+	if err := VerifyMigrations(key, reordered, signature); err != nil {
+		t.Errorf("Expected the signature to verify regardless of order. Got %v", err)
+	}
+
+	tampered := []*Migration{migrations[0], {ID: migrations[1].ID, Script: migrations[1].Script, DialectScripts: map[string]string{"sqlite": "DROP TABLE first"}}}
+	changed := func(change func(migration *Migration)) []*Migration {
+		migration := *migrations[1]
+		change(&migration)
+		return []*Migration{migrations[0], &migration}
+	}
+	cases := map[string]struct {
+		key        []byte
+		migrations []*Migration
+		signature  string
+	}{
+		"wrong key":       {[]byte("guess"), migrations, signature},
+		"tampered script": {key, tampered, signature},
+		"removed":         {key, migrations[:1], signature},
+		"not hex":         {key, migrations, "not-a-signature"},
+		"batch key range": {key, changed(func(m *Migration) { m.Batch = &Batch{KeyRange: "SELECT 1, 2"} }), signature},
+		"copy":            {key, changed(func(m *Migration) { m.Copy = &CopyFrom{Table: "first"} }), signature},
+		"external":        {key, changed(func(m *Migration) { m.External = true }), signature},
+		"no transaction":  {key, changed(func(m *Migration) { m.DisableTransaction = true }), signature},
+		"dialects":        {key, changed(func(m *Migration) { m.Dialects = []string{"postgres"} }), signature},
+		"index":           {key, changed(func(m *Migration) { m.ConcurrentIndex = &ConcurrentIndex{Name: "i"} }), signature},
+	}
+	for name, c := range cases {
+		if err := VerifyMigrations(c.key, c.migrations, c.signature); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: Expected ErrInvalidSignature. Got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package schema
+
+import (
+	"strings"
+	"unicode"
+)
+
+// statementSplitter splits SQL scripts into their individual statements
+// according to the quoting and block rules of a dialect. Semicolons only end
+// a statement when they are outside quoted strings, quoted identifiers,
+// comments, parentheses and procedural bodies.
+type statementSplitter struct {
+	// backslashEscapes treats backslashes as escapes inside all quoted
+	// strings (MySQL). Without it, only Postgres E'...' strings use them.
+	backslashEscapes bool
+	// backtickIdents treats `...` as a quoted identifier (MySQL)
+	backtickIdents bool
+	// dollarQuotes treats $$...$$ and $tag$...$tag$ as quoted strings, as
+	// used for Postgres function bodies and DO blocks
+	dollarQuotes bool
+	// nestedComments allows /* */ comments to nest (Postgres)
+	nestedComments bool
+	// atomicBlocks keeps SQL-standard BEGIN ATOMIC ... END function bodies
+	// (Postgres 14+) together
+	atomicBlocks bool
+	// plsqlBlocks keeps PL/SQL blocks and stored program units together
+	// until a line containing only "/" (Oracle). Any statement may also be
+	// terminated by such a line.
+	plsqlBlocks bool
+	// alternativeQuotes treats q'[...]' style literals as quoted strings
+	// (Oracle)
+	alternativeQuotes bool
+}
+
+// genericSplitter applies the rules shared by most dialects, plus MySQL's
+// backslash escapes and backtick identifiers
+var genericSplitter = statementSplitter{
+	backslashEscapes: true,
+	backtickIdents:   true,
+}
+
+// postgresSplitter applies Postgres quoting and procedural body rules
+var postgresSplitter = statementSplitter{
+	dollarQuotes:   true,
+	nestedComments: true,
+	atomicBlocks:   true,
+}
+
+// oracleSplitter applies Oracle quoting and PL/SQL block rules
+var oracleSplitter = statementSplitter{
+	plsqlBlocks:       true,
+	alternativeQuotes: true,
+}
+
+// splitStatements splits a SQL script with the generic splitting rules
+func splitStatements(script string) []string {
+	return genericSplitter.split(script)
+}
+
+// split returns the statements in the script, trimmed and without their
+// terminating semicolons. Empty and comment-only statements are dropped.
+func (s statementSplitter) split(script string) []string {
+	statements := make([]string, 0)
+	start := 0
+	parens := 0
+	atomicDepth := 0
+	caseDepth := 0
+
+	flush := func(end int) {
+		statement := strings.TrimSpace(script[start:end])
+		if statement != "" && !isCommentOnly(statement) {
+			statements = append(statements, statement)
+		}
+	}
+
+	for i := 0; i < len(script); {
+		c := script[i]
+		switch {
+		case c == '\'' && s.alternativeQuotes && isAlternativeQuotePrefix(script, i):
+			i = closingAlternativeQuote(script, i)
+		case c == '\'':
+			escapes := s.backslashEscapes || isEscapeStringPrefix(script, i)
+			i = closingQuote(script, i, escapes)
+		case c == '"' || (c == '`' && s.backtickIdents):
+			i = closingQuote(script, i, s.backslashEscapes && c == '"')
+		case c == '$' && s.dollarQuotes && dollarTag(script, i) != "":
+			tag := dollarTag(script, i)
+			end := strings.Index(script[i+len(tag):], tag)
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += len(tag) + end + len(tag)
+			}
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 1
+			}
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			i = s.closingComment(script, i)
+		case c == '/' && s.plsqlBlocks && isSlashLine(script, i):
+			flush(i)
+			start = i + 1
+			i++
+		case c == '(':
+			parens++
+			i++
+		case c == ')':
+			if parens > 0 {
+				parens--
+			}
+			i++
+		case isIdentStart(c) && (i == 0 || !isIdentChar(script[i-1])):
+			word := readWord(script, i)
+			if s.atomicBlocks {
+				switch strings.ToUpper(word) {
+				case "BEGIN":
+					next := readWord(script, skipSpace(script, i+len(word)))
+					if strings.EqualFold(next, "ATOMIC") {
+						atomicDepth++
+					}
+				case "CASE":
+					if atomicDepth > 0 {
+						caseDepth++
+					}
+				case "END":
+					if caseDepth > 0 {
+						caseDepth--
+					} else if atomicDepth > 0 {
+						atomicDepth--
+					}
+				}
+			}
+			i += len(word)
+		case c == ';' && s.plsqlBlocks && isPLSQLBlock(script[start:i]):
+			// Semicolons inside a PL/SQL block are part of the block, which
+			// only ends at a "/" line (or the end of the script)
+			i++
+		case c == ';' && parens == 0 && atomicDepth == 0:
+			flush(i)
+			start = i + 1
+			i++
+		default:
+			i++
+		}
+	}
+	flush(len(script))
+
+	return statements
+}
+
+// closingComment returns the index just past the end of the block comment
+// which starts at start. An unterminated comment extends to the end of the
+// script.
+func (s statementSplitter) closingComment(script string, start int) int {
+	depth := 0
+	for i := start; i < len(script)-1; i++ {
+		switch {
+		case script[i] == '/' && script[i+1] == '*' && (depth == 0 || s.nestedComments):
+			depth++
+			i++
+		case script[i] == '*' && script[i+1] == '/':
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(script)
+}
+
+// closingQuote returns the index just past the quote which closes the quoted
+// section opened at start. Doubled quote characters are treated as escapes,
+// as are backslashes when escapes is true. An unterminated quote extends to
+// the end of the script.
+func closingQuote(script string, start int, escapes bool) int {
+	quote := script[start]
+	for i := start + 1; i < len(script); i++ {
+		if escapes && script[i] == '\\' {
+			i++
+			continue
+		}
+		if script[i] == quote {
+			if i+1 < len(script) && script[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(script)
+}
+
+// isEscapeStringPrefix returns whether the quote at i opens a Postgres
+// escape string constant such as E'it\'s'
+func isEscapeStringPrefix(script string, i int) bool {
+	if i == 0 || (script[i-1] != 'E' && script[i-1] != 'e') {
+		return false
+	}
+	return i == 1 || !isIdentChar(script[i-2])
+}
+
+// dollarTag returns the dollar-quote tag (such as "$$" or "$body$") which
+// starts at i, or an empty string if there isn't one. Positional parameters
+// like $1 are not tags.
+func dollarTag(script string, i int) string {
+	for j := i + 1; j < len(script); j++ {
+		c := script[j]
+		switch {
+		case c == '$':
+			return script[i : j+1]
+		case j == i+1 && unicode.IsDigit(rune(c)):
+			return ""
+		case !isIdentChar(c):
+			return ""
+		}
+	}
+	return ""
+}
+
+// isAlternativeQuotePrefix returns whether the quote at i opens an Oracle
+// alternative quoting literal such as q'[it's]'
+func isAlternativeQuotePrefix(script string, i int) bool {
+	if i == 0 || (script[i-1] != 'q' && script[i-1] != 'Q') || i+1 >= len(script) {
+		return false
+	}
+	j := i - 1
+	if j > 0 && (script[j-1] == 'n' || script[j-1] == 'N') {
+		j--
+	}
+	return j == 0 || !isIdentChar(script[j-1])
+}
+
+// closingAlternativeQuote returns the index just past the end of the Oracle
+// alternative quoting literal whose opening quote is at start
+func closingAlternativeQuote(script string, start int) int {
+	closing := script[start+1]
+	switch closing {
+	case '[':
+		closing = ']'
+	case '{':
+		closing = '}'
+	case '(':
+		closing = ')'
+	case '<':
+		closing = '>'
+	}
+	end := strings.Index(script[start+2:], string(closing)+"'")
+	if end < 0 {
+		return len(script)
+	}
+	return start + 2 + end + 2
+}
+
+// isSlashLine returns whether the "/" at i is alone on its line, which
+// terminates the current statement or PL/SQL block in Oracle scripts
+func isSlashLine(script string, i int) bool {
+	lineStart := strings.LastIndexByte(script[:i], '\n') + 1
+	if strings.TrimSpace(script[lineStart:i]) != "" {
+		return false
+	}
+	lineEnd := strings.IndexByte(script[i+1:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(script) - i - 1
+	}
+	return strings.TrimSpace(script[i+1:i+1+lineEnd]) == ""
+}
+
+// plsqlUnits are the stored program units whose CREATE statements contain a
+// PL/SQL body
+var plsqlUnits = map[string]bool{
+	"FUNCTION":  true,
+	"PROCEDURE": true,
+	"PACKAGE":   true,
+	"TRIGGER":   true,
+	"TYPE":      true,
+	"LIBRARY":   true,
+}
+
+// isPLSQLBlock returns whether the statement begins an anonymous PL/SQL
+// block or creates a stored program unit
+func isPLSQLBlock(statement string) bool {
+	words := strings.Fields(strings.ToUpper(stripLeadingComments(statement)))
+	if len(words) == 0 {
+		return false
+	}
+	switch words[0] {
+	case "BEGIN", "DECLARE":
+		return true
+	case "CREATE":
+		for _, word := range words[1:] {
+			switch word {
+			case "OR", "REPLACE", "EDITIONABLE", "NONEDITIONABLE":
+				continue
+			}
+			return plsqlUnits[word]
+		}
+	}
+	return false
+}
+
+// readWord returns the identifier-like word which starts at i
+func readWord(script string, i int) string {
+	j := i
+	for j < len(script) && isIdentChar(script[j]) {
+		j++
+	}
+	return script[i:j]
+}
+
+// skipSpace returns the index of the first non-whitespace character at or
+// after i
+func skipSpace(script string, i int) int {
+	for i < len(script) && unicode.IsSpace(rune(script[i])) {
+		i++
+	}
+	return i
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || unicode.IsLetter(rune(c)) || c >= 0x80
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || unicode.IsDigit(rune(c)) || c == '$'
+}
+
+// isCommentOnly returns whether the statement consists only of comments,
+// which happens when a script ends with a comment after its last semicolon
+func isCommentOnly(statement string) bool {
+	return stripLeadingComments(statement) == ""
+}
+
+// stripLeadingComments removes whitespace and comments from the start of a
+// statement, so that its leading keywords can be examined
+func stripLeadingComments(statement string) string {
+	for {
+		statement = strings.TrimSpace(statement)
+		switch {
+		case strings.HasPrefix(statement, "--"):
+			end := strings.IndexByte(statement, '\n')
+			if end < 0 {
+				return ""
+			}
+			statement = statement[end+1:]
+		case strings.HasPrefix(statement, "/*"):
+			end := strings.Index(statement, "*/")
+			if end < 0 {
+				return ""
+			}
+			statement = statement[end+2:]
+		default:
+			return statement
+		}
+	}
+}
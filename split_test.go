@@ -0,0 +1,77 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	script := `
+		CREATE TABLE users (id INTEGER, name TEXT DEFAULT 'a;b');
+		-- a comment; with a semicolon
+		INSERT INTO users (name) VALUES ('it''s; fine'), ("double;quoted");
+		/* block; comment */
+		UPDATE ` + "`users;table`" + ` SET name = 'x'
+		;;
+		-- trailing comment
+	`
+	expected := []string{
+		"CREATE TABLE users (id INTEGER, name TEXT DEFAULT 'a;b')",
+		"-- a comment; with a semicolon\n\t\tINSERT INTO users (name) VALUES ('it''s; fine'), (\"double;quoted\")",
+		"/* block; comment */\n\t\tUPDATE `users;table` SET name = 'x'",
+	}
+	statements := splitStatements(script)
+	if !reflect.DeepEqual(statements, expected) {
+		t.Errorf("Unexpected statements:\n%#v", statements)
+	}
+}
+
+func TestStripLeadingComments(t *testing.T) {
+	statement := stripLeadingComments("  -- one\n /* two */ SELECT 1")
+	if statement != "SELECT 1" {
+		t.Errorf("Expected comments to be stripped. Got %q", statement)
+	}
+}
+
+func TestPostgresSplitStatements(t *testing.T) {
+	script := `
+		CREATE FUNCTION add(a integer, b integer) RETURNS integer AS $$
+		BEGIN
+			RETURN a + b;
+		END;
+		$$ LANGUAGE plpgsql;
+		DO $body$ BEGIN PERFORM 1; PERFORM 'it''s'; END $body$;
+		CREATE FUNCTION sub(a integer, b integer) RETURNS integer
+		BEGIN ATOMIC
+			SELECT CASE WHEN a > b THEN a - b ELSE b - a END;
+			SELECT a - b;
+		END;
+		CREATE RULE r AS ON INSERT TO t DO ALSO (INSERT INTO u VALUES (1); INSERT INTO v VALUES (2));
+		/* nested /* comment; */ still; comment */
+		SELECT E'escaped\' quote;', 'C:\', $1;
+	`
+	statements := postgresSplitter.split(script)
+	if len(statements) != 5 {
+		t.Fatalf("Expected 5 statements. Got %d:\n%#v", len(statements), statements)
+	}
+	if !strings.HasSuffix(statements[0], "$$ LANGUAGE plpgsql") {
+		t.Errorf("Expected the function body to stay together. Got:\n%s", statements[0])
+	}
+	if !strings.HasSuffix(statements[2], "END") {
+		t.Errorf("Expected the BEGIN ATOMIC body to stay together. Got:\n%s", statements[2])
+	}
+	if !strings.HasSuffix(statements[4], "$1") {
+		t.Errorf("Expected escape strings to be handled. Got:\n%s", statements[4])
+	}
+}
+
+func TestPostgresSplittingIsOptIn(t *testing.T) {
+	if Postgres.SplitStatements("SELECT 1; SELECT 2") != nil {
+		t.Error("Expected no splitting by default")
+	}
+	statements := NewPostgres(WithPostgresStatementSplitting()).SplitStatements("SELECT 1; SELECT 2")
+	if len(statements) != 2 {
+		t.Errorf("Expected 2 statements. Got %d", len(statements))
+	}
+}
@@ -1,9 +1,11 @@
 package schema
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"math/rand"
 	"strings"
 	"sync"
 	"time"
@@ -12,24 +14,96 @@ import (
 const lockMagicNum = 794774819
 const defaultSQLiteLockTable = "schema_lock"
 const defaultLockDuration = 30 * time.Second
+const defaultLockPollInterval = time.Second
 
 type sqliteDialect struct {
-	mutex        sync.Mutex
-	lockDuration time.Duration
-	lockTable    string
-	code         int64
+	mutex           sync.Mutex
+	locks           map[*sql.DB]*sqliteLock
+	lockDuration    time.Duration
+	lockTimeout     time.Duration
+	pollInterval    time.Duration
+	maxPollInterval time.Duration
+	lockTable       string
+	immediateLock   bool
+	busyTimeout     time.Duration
+	wal             bool
+	dropLockTable   bool
 }
 
+// sqliteLock is the in-process state of the lock on one database. Its mutex
+// is held from Lock until Unlock, so that goroutines sharing the dialect
+// queue for the lock on that database without contending for the lock on
+// any other.
+type sqliteLock struct {
+	mutex sync.Mutex
+	code  int64
+
+	// users counts the goroutines holding or waiting for the lock. It is
+	// guarded by the dialect's mutex.
+	users int
+}
+
+// lockFor returns the lock state for the database, creating it on first use,
+// and counts the caller as one of its users until releaseLock
+func (s *sqliteDialect) lockFor(db *sql.DB) *sqliteLock {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.locks == nil {
+		s.locks = make(map[*sql.DB]*sqliteLock)
+	}
+	l, exists := s.locks[db]
+	if !exists {
+		l = &sqliteLock{}
+		s.locks[db] = l
+	}
+	l.users++
+	return l
+}
+
+// releaseLock stops counting the caller as a user of the lock state, which
+// is forgotten once it has no users, so that the dialect doesn't keep every
+// database it has locked (such as one per tenant) reachable after they are
+// closed
+func (s *sqliteDialect) releaseLock(db *sql.DB, l *sqliteLock) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	l.users--
+	if l.users == 0 {
+		delete(s.locks, db)
+	}
+}
+
+var _ Updater = (*sqliteDialect)(nil)
 var _ Locker = (*sqliteDialect)(nil)
+var _ ContextLocker = (*sqliteDialect)(nil)
+var _ TransactionLocker = (*sqliteDialect)(nil)
+var _ SessionConfigurer = (*sqliteDialect)(nil)
+var _ CapabilityReporter = (*sqliteDialect)(nil)
+var _ VersionReporter = (*sqliteDialect)(nil)
+var _ BuildRecorder = (*sqliteDialect)(nil)
+var _ ScriptRecorder = (*sqliteDialect)(nil)
+var _ SetRecorder = (*sqliteDialect)(nil)
+var _ HistoryPruner = (*sqliteDialect)(nil)
+var _ Introspector = (*sqliteDialect)(nil)
+var _ Maintainer = (*sqliteDialect)(nil)
+var _ NonTransactionalDetector = (*sqliteDialect)(nil)
+var _ SeedInserter = (*sqliteDialect)(nil)
 
 var ErrSQLiteLockTimeout = errors.New("sqlite: timeout requesting lock")
 
+// ErrSQLiteNotLocked is returned by Unlock when the dialect doesn't hold the
+// lock on the database
+var ErrSQLiteNotLocked = errors.New("sqlite: database is not locked")
+
 // NewSQLite creates a new sqlite dialect. Customization of the lock table
 // name and lock duration are made with WithSQLiteLockTable and
-// WithSQLiteLockDuration options.
+// WithSQLiteLockDuration options. Lock polling is customized with
+// WithSQLiteLockTimeout, WithSQLiteLockPollInterval and
+// WithSQLiteLockBackoff.
 func NewSQLite(opts ...func(s *sqliteDialect)) *sqliteDialect {
 	s := &sqliteDialect{
 		lockDuration: defaultLockDuration,
+		pollInterval: defaultLockPollInterval,
 		lockTable:    defaultSQLiteLockTable,
 	}
 
@@ -57,31 +131,165 @@ func WithSQLiteLockDuration(d time.Duration) func(s *sqliteDialect) {
 	}
 }
 
+// WithSQLiteDropLockTable configures Unlock to drop the lock table when no
+// other lock remains in it, so that embedded applications aren't left with
+// a permanent extra table as a side effect of migrating.
+func WithSQLiteDropLockTable() func(s *sqliteDialect) {
+	return func(s *sqliteDialect) {
+		s.dropLockTable = true
+	}
+}
+
+// WithSQLiteLockTimeout sets how long Lock waits to claim the lock before
+// giving up with ErrSQLiteLockTimeout. By default it waits for the lock
+// duration.
+func WithSQLiteLockTimeout(d time.Duration) func(s *sqliteDialect) {
+	return func(s *sqliteDialect) {
+		s.lockTimeout = d
+	}
+}
+
+// WithSQLiteLockPollInterval sets how long Lock sleeps between attempts to
+// claim a lock held by another process. The default is 1 second.
+func WithSQLiteLockPollInterval(d time.Duration) func(s *sqliteDialect) {
+	return func(s *sqliteDialect) {
+		s.pollInterval = d
+	}
+}
+
+// WithSQLiteLockBackoff enables jittered exponential backoff between lock
+// attempts. The sleep starts at the poll interval and doubles after every
+// failed attempt, up to max. Each sleep is randomized to between half and
+// all of the current interval so that contending processes spread out.
+func WithSQLiteLockBackoff(max time.Duration) func(s *sqliteDialect) {
+	return func(s *sqliteDialect) {
+		s.maxPollInterval = max
+	}
+}
+
+// WithSQLiteImmediateLock configures the dialect to lock by claiming the
+// database write lock at the start of the migration transaction, which is
+// equivalent to BEGIN IMMEDIATE on the migration connection. No lock table
+// is created and there is no lock expiration to tune. Concurrent migrators
+// wait for the lock according to the connection's busy timeout.
+func WithSQLiteImmediateLock() func(s *sqliteDialect) {
+	return func(s *sqliteDialect) {
+		s.immediateLock = true
+	}
+}
+
+// WithSQLiteBusyTimeout sets PRAGMA busy_timeout on the migration connection,
+// so that concurrent Apply calls wait for each other instead of immediately
+// failing with SQLITE_BUSY.
+func WithSQLiteBusyTimeout(d time.Duration) func(s *sqliteDialect) {
+	return func(s *sqliteDialect) {
+		s.busyTimeout = d
+	}
+}
+
+// WithSQLiteWAL switches the database to write-ahead logging
+// (PRAGMA journal_mode=WAL) before migrating, which lets readers
+// continue while migrations write. The journal mode is persistent, so
+// it remains in effect for all connections after Apply returns.
+func WithSQLiteWAL() func(s *sqliteDialect) {
+	return func(s *sqliteDialect) {
+		s.wal = true
+	}
+}
+
+// Capabilities reports that SQLite supports transactional DDL, along with
+// the configured lock strategy
+func (s *sqliteDialect) Capabilities() Capabilities {
+	c := Capabilities{
+		TransactionalDDL: true,
+		LockStrategy:     LockStrategyLockTable,
+	}
+	if s.immediateLock {
+		c.LockStrategy = LockStrategyWriteLock
+	}
+	return c
+}
+
+// RequiresNoTransaction reports VACUUM, which SQLite refuses to run inside a
+// transaction
+func (s *sqliteDialect) RequiresNoTransaction(statement, serverVersion string) bool {
+	words := strings.Fields(stripLeadingComments(statement))
+	return len(words) > 0 && strings.EqualFold(strings.TrimRight(words[0], ";"), "VACUUM")
+}
+
+// SessionSQL returns the PRAGMA statements configured with
+// WithSQLiteBusyTimeout and WithSQLiteWAL
+func (s *sqliteDialect) SessionSQL() []string {
+	statements := make([]string, 0)
+	if s.busyTimeout > 0 {
+		statements = append(statements, fmt.Sprintf(`PRAGMA busy_timeout = %d`, s.busyTimeout.Milliseconds()))
+	}
+	if s.wal {
+		statements = append(statements, `PRAGMA journal_mode = WAL`)
+	}
+	return statements
+}
+
+// TransactionLockSQL returns a no-op write to the tracking table when the
+// dialect was configured with WithSQLiteImmediateLock, and an empty string
+// otherwise. Any write statement makes SQLite take the database write lock,
+// even when it affects no rows.
+func (s *sqliteDialect) TransactionLockSQL(tableName string) string {
+	if !s.immediateLock {
+		return ""
+	}
+	return fmt.Sprintf(`DELETE FROM %s WHERE 0 = 1`, tableName)
+}
+
 // Lock attempts to obtain a lock of the database. nil is returned if the lock
 // is successfully claimed. A non-nil value is returned for database errors
 // or if the lock timeout is reached.
 func (s *sqliteDialect) Lock(db *sql.DB) error {
-	s.mutex.Lock()
+	return s.LockContext(context.Background(), db)
+}
 
-	_, err := db.Exec(fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS %s (
-			id INTEGER PRIMARY KEY,
-			code INTEGER,
-			expiration DATETIME NOT NULL)`, s.lockTable))
-	if err != nil {
-		return err
-	}
+// LockContext is like Lock, but stops waiting for the lock when the context
+// is cancelled
+func (s *sqliteDialect) LockContext(ctx context.Context, db *sql.DB) (err error) {
+	l := s.lockFor(db)
+	l.mutex.Lock()
+	defer func() {
+		// Unlock won't be called when the lock wasn't claimed
+		if err != nil {
+			l.mutex.Unlock()
+			s.releaseLock(db, l)
+		}
+	}()
 
 	// Only try to fetch the lock for a limited time
-	timeout := time.Now().Add(s.lockDuration)
+	lockTimeout := s.lockTimeout
+	if lockTimeout <= 0 {
+		lockTimeout = s.lockDuration
+	}
+	timeout := time.Now().Add(lockTimeout)
+	interval := s.pollInterval
 
 	for time.Now().Before(timeout) {
 
+		// The table is (re)created on every attempt, since the lock holder
+		// may drop it when unlocking (see WithSQLiteDropLockTable)
+		_, err = db.ExecContext(ctx, fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS %s (
+				id INTEGER PRIMARY KEY,
+				code INTEGER,
+				expiration DATETIME NOT NULL)`, s.lockTable))
+		if err != nil {
+			return err
+		}
+
 		// Delete any expired locks
-		_, err := db.Exec(
+		_, err = db.ExecContext(ctx,
 			fmt.Sprintf(`
 				DELETE FROM %s
 				WHERE datetime(expiration) < datetime('now')`, s.lockTable))
+		if err != nil && isMissingTableError(err) {
+			continue
+		}
 		if err != nil {
 			return err
 		}
@@ -90,43 +298,95 @@ func (s *sqliteDialect) Lock(db *sql.DB) error {
 		code := time.Now().UnixNano()
 
 		// Locking relies on the PRIMARY KEY constraint. Successfully inserting the id lockMagicNum
-		// means the lock was obtained. An UNIQUE constraint error results in us trying again one
-		// second later. Any other error is returned.
-		_, err = db.Exec(
+		// means the lock was obtained. An UNIQUE constraint error results in us trying again
+		// after the poll interval. Any other error is returned.
+		_, err = db.ExecContext(ctx,
 			fmt.Sprintf(`INSERT INTO %s (id, code, expiration) VALUES(?, ?, ?)`, s.lockTable),
 			lockMagicNum, code, time.Now().Add(s.lockDuration))
 
 		if err == nil {
-			s.code = code
+			l.code = code
 			return nil
 		}
 
+		if isMissingTableError(err) {
+			continue
+		}
 		if !isConstraintError(err) {
 			return err
 		}
 
-		time.Sleep(time.Second)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.nextPollSleep(&interval, time.Until(timeout))):
+		}
 	}
 
 	return ErrSQLiteLockTimeout
 }
 
+// nextPollSleep returns how long to sleep before the next lock attempt,
+// advancing interval when backoff is enabled. The sleep never exceeds the
+// time remaining before the lock timeout.
+func (s *sqliteDialect) nextPollSleep(interval *time.Duration, remaining time.Duration) time.Duration {
+	sleep := *interval
+	if s.maxPollInterval > s.pollInterval {
+		sleep = sleep/2 + time.Duration(rand.Int63n(int64(sleep/2)+1))
+		*interval *= 2
+		if *interval > s.maxPollInterval {
+			*interval = s.maxPollInterval
+		}
+	}
+	if sleep > remaining {
+		sleep = remaining
+	}
+	return sleep
+}
+
 // Unlock releases the database lock.
 func (s *sqliteDialect) Unlock(db *sql.DB) error {
-	defer s.mutex.Unlock()
+	return s.UnlockContext(context.Background(), db)
+}
+
+// UnlockContext is like Unlock, but runs its statements with the context
+func (s *sqliteDialect) UnlockContext(ctx context.Context, db *sql.DB) error {
+	s.mutex.Lock()
+	l := s.locks[db]
+	s.mutex.Unlock()
+	if l == nil {
+		return ErrSQLiteNotLocked
+	}
+	defer func() {
+		l.mutex.Unlock()
+		s.releaseLock(db, l)
+	}()
 
-	// Delete only the lock we created by checking 'code'. This guards against the
-	// edge case where another process has deleted our expired lock and grabbed
-	// their own just before we process Unlock().
-	_, err := db.Exec(
-		fmt.Sprintf(`DELETE FROM %s WHERE id=? AND code=?;`, s.lockTable), lockMagicNum, s.code)
+	return transaction(ctx, db, func(tx *sql.Tx) error {
+		// Delete only the lock we created by checking 'code'. This guards against the
+		// edge case where another process has deleted our expired lock and grabbed
+		// their own just before we process Unlock().
+		_, err := tx.ExecContext(ctx,
+			fmt.Sprintf(`DELETE FROM %s WHERE id=? AND code=?;`, s.lockTable), lockMagicNum, l.code)
+		if err != nil || !s.dropLockTable {
+			return err
+		}
 
-	return err
+		// The DELETE holds the database write lock, so no other process can
+		// claim the lock between counting and dropping
+		var remaining int
+		err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %s`, s.lockTable)).Scan(&remaining)
+		if err != nil || remaining > 0 {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`DROP TABLE %s`, s.lockTable))
+		return err
+	})
 }
 
 // CreateSQL takes the name of the migration tracking table and
 // returns the SQL statement needed to create it
-func (s sqliteDialect) CreateSQL(tableName string) string {
+func (s *sqliteDialect) CreateSQL(tableName string) string {
 	return fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS %s (
 			id TEXT NOT NULL,
@@ -136,9 +396,78 @@ func (s sqliteDialect) CreateSQL(tableName string) string {
 		);`, tableName)
 }
 
+// CreateBuildsSQL takes the name of the build metadata table and returns
+// the SQL statement needed to create it
+func (s *sqliteDialect) CreateBuildsSQL(tableName string) string {
+	return fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id TEXT NOT NULL,
+			build TEXT NOT NULL,
+			applied_at DATETIME
+		);`, tableName)
+}
+
+// InsertBuildSQL takes the name of the build metadata table and returns
+// the SQL statement needed to record the build which applied a migration
+func (s *sqliteDialect) InsertBuildSQL(tableName string) string {
+	return fmt.Sprintf(`INSERT INTO %s ( id, build, applied_at ) VALUES ( ?, ?, ? )`, tableName)
+}
+
+// CreateScriptsSQL takes the name of the scripts table and returns the SQL
+// statement needed to create it
+func (s *sqliteDialect) CreateScriptsSQL(tableName string) string {
+	return fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id TEXT NOT NULL,
+			script BLOB NOT NULL,
+			applied_at DATETIME
+		);`, tableName)
+}
+
+// InsertScriptSQL takes the name of the scripts table and returns the SQL
+// statement needed to store the script of an applied migration
+func (s *sqliteDialect) InsertScriptSQL(tableName string) string {
+	return fmt.Sprintf(`INSERT INTO %s ( id, script, applied_at ) VALUES ( ?, ?, ? )`, tableName)
+}
+
+// CreateSetSQL takes the name of the set table and returns the SQL
+// statement needed to create it
+func (s *sqliteDialect) CreateSetSQL(tableName string) string {
+	return fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			checksum TEXT NOT NULL,
+			migrations INTEGER NOT NULL,
+			applied_at DATETIME
+		);`, tableName)
+}
+
+// InsertSetSQL takes the name of the set table and returns the SQL
+// statement needed to store the checksum of an applied migration set
+func (s *sqliteDialect) InsertSetSQL(tableName string) string {
+	return fmt.Sprintf(`INSERT INTO %s ( checksum, migrations, applied_at ) VALUES ( ?, ?, ? )`, tableName)
+}
+
+// DeleteSQL takes the name of the tracking table, or a table next to it,
+// and returns the SQL statement needed to delete the rows of a migration
+func (s *sqliteDialect) DeleteSQL(tableName string) string {
+	return fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, tableName)
+}
+
+// SeedSQL returns a multi-row INSERT, which skips conflicting rows with ON
+// CONFLICT DO NOTHING
+func (s *sqliteDialect) SeedSQL(table string, columns []string, rows int, ignoreConflicts bool) string {
+	statement := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, strings.Join(columns, ", "), seedValues(len(columns), rows, func(int) string {
+		return "?"
+	}))
+	if ignoreConflicts {
+		statement += " ON CONFLICT DO NOTHING"
+	}
+	return statement
+}
+
 // InsertSQL takes the name of the migration tracking table and
 // returns the SQL statement needed to insert a migration into it
-func (s sqliteDialect) InsertSQL(tableName string) string {
+func (s *sqliteDialect) InsertSQL(tableName string) string {
 	return fmt.Sprintf(`
 		INSERT INTO %s
 		( id, checksum, execution_time_in_millis, applied_at )
@@ -147,9 +476,20 @@ func (s sqliteDialect) InsertSQL(tableName string) string {
 		`, tableName)
 }
 
+// UpdateSQL takes the name of the migration tracking table and
+// returns the SQL statement needed to refresh the record of a migration
+// which has been run again. Its arguments match InsertSQL.
+func (s *sqliteDialect) UpdateSQL(tableName string) string {
+	return fmt.Sprintf(`
+		UPDATE %s
+		SET checksum = ?2, execution_time_in_millis = ?3, applied_at = ?4
+		WHERE id = ?1
+		`, tableName)
+}
+
 // SelectSQL takes the name of the migration tracking table and
 // returns trhe SQL statement to retrieve all records from it
-func (s sqliteDialect) SelectSQL(tableName string) string {
+func (s *sqliteDialect) SelectSQL(tableName string) string {
 	return fmt.Sprintf(`
 		SELECT id, checksum, execution_time_in_millis, applied_at
 		FROM %s
@@ -157,9 +497,30 @@ func (s sqliteDialect) SelectSQL(tableName string) string {
 	`, tableName)
 }
 
+// AnalyzeSQL returns an ANALYZE statement for the table
+func (s *sqliteDialect) AnalyzeSQL(tableName string) string {
+	return "ANALYZE " + tableName
+}
+
+// VacuumSQL returns a VACUUM statement, which rebuilds the whole database
+// since SQLite can't vacuum a single table
+func (s *sqliteDialect) VacuumSQL(tableName string) string {
+	return "VACUUM"
+}
+
+// Name returns "sqlite", which selects SQLite script variants
+func (s *sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+// VersionSQL returns a query for the version of the SQLite library
+func (s *sqliteDialect) VersionSQL() string {
+	return "SELECT sqlite_version()"
+}
+
 // QuotedTableName returns the string value of the name of the migration
 // tracking table after it has been quoted for Postgres
-func (s sqliteDialect) QuotedTableName(_, tableName string) string {
+func (s *sqliteDialect) QuotedTableName(_, tableName string) string {
 	return `"` + strings.ReplaceAll(tableName, `"`, "") + `"`
 }
 
@@ -172,3 +533,33 @@ func isConstraintError(err error) bool {
 
 	return strings.Contains(s, "constraint") || strings.Contains(s, "unique")
 }
+
+// TablesSQL returns a query for the names of the tables in the database.
+// The schema name is ignored.
+func (s *sqliteDialect) TablesSQL(schemaName string) string {
+	return `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`
+}
+
+// ColumnsSQL returns a query for the columns of the tables in the database
+func (s *sqliteDialect) ColumnsSQL(schemaName string) string {
+	return `
+		SELECT m.name, p.name, p.type, p."notnull" = 0, p.dflt_value
+		FROM sqlite_master m
+		JOIN pragma_table_info(m.name) p
+		WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%'
+		ORDER BY m.name, p.cid
+	`
+}
+
+// IndexesSQL returns a query for the indexed columns of the tables in the
+// database, including the indexes SQLite creates for UNIQUE constraints
+func (s *sqliteDialect) IndexesSQL(schemaName string) string {
+	return `
+		SELECT m.name, l.name, l."unique", i.name
+		FROM sqlite_master m
+		JOIN pragma_index_list(m.name) l
+		JOIN pragma_index_info(l.name) i
+		WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%'
+		ORDER BY m.name, l.name, i.seqno
+	`
+}
@@ -1,10 +1,20 @@
 package schema
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -82,6 +92,1434 @@ func TestSQLite(t *testing.T) {
 		}
 	})
 
+	t.Run("health check", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("health_migrations"))
+		migrations := []*Migration{
+			{ID: "2020-01-01 Health", Script: "CREATE TABLE health (id INTEGER)"},
+		}
+		checker := NewChecker(migrator, db, migrations)
+		checker.Migrator.ReadTxOptions = &sql.TxOptions{ReadOnly: true}
+
+		if err := checker.Check(context.Background()); err == nil {
+			t.Error("Expected an error before the tracking table exists")
+		}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+		if err := checker.Check(context.Background()); err != nil {
+			t.Errorf("Expected a healthy check. Got %v", err)
+		}
+
+		checker.Migrations = append(migrations, &Migration{ID: "2020-01-02 Pending", Script: "SELECT 1"})
+		if err := checker.Check(context.Background()); !errors.Is(err, ErrPendingMigrations) {
+			t.Errorf("Expected ErrPendingMigrations. Got %v", err)
+		}
+
+		checker.Migrations = []*Migration{
+			{ID: "2020-01-01 Health", Script: "CREATE TABLE health (id TEXT)"},
+		}
+		if err := checker.Check(context.Background()); !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("Expected ErrChecksumMismatch. Got %v", err)
+		}
+	})
+
+	t.Run("verify", func(t *testing.T) {
+		migrator := NewMigrator(
+			WithDialect(NewSQLite()),
+			WithTableName("verify_migrations"),
+			WithReadTxOptions(sql.TxOptions{ReadOnly: true}),
+		)
+		migrations := []*Migration{
+			{ID: "2020-01-01 Verify", Script: "CREATE TABLE verified (id INTEGER)"},
+		}
+
+		_, err := migrator.Verify(db, migrations)
+		if !errors.Is(err, ErrTrackingTableMissing) {
+			t.Errorf("Expected ErrTrackingTableMissing. Got %v", err)
+		}
+		if err = migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+
+		pending := append(migrations, &Migration{ID: "2020-01-02 Pending", Script: "SELECT 1"})
+		status, err := migrator.Verify(db, pending)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(status.Pending) != 1 || status.Pending[0].ID != "2020-01-02 Pending" {
+			t.Errorf("Expected one pending migration. Got %+v", status.Pending)
+		}
+
+		_, err = migrator.Verify(db, []*Migration{{ID: "2020-01-01 Verify", Script: "CREATE TABLE verified (id TEXT)"}})
+		if !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("Expected ErrChecksumMismatch. Got %v", err)
+		}
+		_, err = migrator.Verify(db, []*Migration{})
+		if !errors.Is(err, ErrUnknownMigrations) {
+			t.Errorf("Expected ErrUnknownMigrations. Got %v", err)
+		}
+	})
+
+	t.Run("audit", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("audit_migrations"))
+		migrations := []*Migration{{ID: "2020-01-01 Audited", Script: "CREATE TABLE audited (id INTEGER)"}}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := migrator.Audit(db, []*Migration{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Findings) != 1 || report.Findings[0].Kind != AuditMissingSource {
+			t.Errorf("Expected one missing source. Got %+v", report.Findings)
+		}
+	})
+
+	t.Run("csv seed", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("seed_migrations"))
+		fsys := fstest.MapFS{
+			"2020-01-02 Paths.csv": &fstest.MapFile{Data: []byte("code,path\na,C:\\Temp\nb,it's\nc,\n")},
+		}
+		seed, err := MigrationFromCSV(fsys, "2020-01-02 Paths.csv", "seed_paths", WithCSVBatchSize(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		seed.Always = true
+		migrations := []*Migration{
+			{ID: "2020-01-01 Paths", Script: "CREATE TABLE seed_paths (code TEXT PRIMARY KEY, path TEXT)"},
+			seed,
+		}
+		for i := 0; i < 2; i++ {
+			if err := migrator.Apply(db, migrations); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM seed_paths").Scan(&count); err != nil || count != 3 {
+			t.Errorf("Expected 3 seeded rows. Got %d (%v)", count, err)
+		}
+		var path string
+		if err := db.QueryRow("SELECT path FROM seed_paths WHERE code = 'a'").Scan(&path); err != nil || path != `C:\Temp` {
+			t.Errorf("Expected the path to be stored intact. Got %q (%v)", path, err)
+		}
+		if err := db.QueryRow("SELECT path FROM seed_paths WHERE code = 'b'").Scan(&path); err != nil || path != "it's" {
+			t.Errorf("Expected the quote to be stored intact. Got %q (%v)", path, err)
+		}
+		var null sql.NullString
+		if err := db.QueryRow("SELECT path FROM seed_paths WHERE code = 'c'").Scan(&null); err != nil || null.Valid {
+			t.Errorf("Expected an empty field to be NULL. Got %v (%v)", null, err)
+		}
+	})
+
+	t.Run("dialect without updates", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(minimalSQLite{NewSQLite()}), WithTableName("minimal_migrations"))
+		migrations := []*Migration{
+			{ID: "2020-01-01 Minimal", Script: "CREATE TABLE minimal (id INTEGER)"},
+		}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+		always := append(migrations, &Migration{ID: "2020-01-02 Always", Script: "SELECT 1", Always: true})
+		if err := migrator.Apply(db, always); !errors.Is(err, ErrUpdateNotSupported) {
+			t.Errorf("Expected ErrUpdateNotSupported. Got %v", err)
+		}
+	})
+
+	t.Run("run once", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("run_once_migrations"))
+		migrations := []*Migration{
+			{ID: "2020-01-01 RunOnce", Script: "CREATE TABLE run_once (id INTEGER)"},
+		}
+
+		var out bytes.Buffer
+		summary := migrator.RunOnce(context.Background(), db, migrations, &out)
+		if summary.ExitCode != ExitApplied || len(summary.Applied) != 1 {
+			t.Errorf("Expected 1 applied migration. Got %+v", summary)
+		}
+		var decoded RunSummary
+		if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || decoded.Outcome != OutcomeApplied {
+			t.Errorf("Expected a JSON summary. Got %q (%v)", out.String(), err)
+		}
+
+		summary = migrator.RunOnce(context.Background(), db, migrations, nil)
+		if summary.ExitCode != 0 || summary.Outcome != OutcomeNothingToDo || len(summary.Applied) != 0 {
+			t.Errorf("Expected nothing to do, exiting 0. Got %+v", summary)
+		}
+
+		skipped := append(migrations, &Migration{ID: "2020-01-02 Skipped", Script: "SELECT 1", OnlyIf: "SELECT 0"})
+		summary = migrator.RunOnce(context.Background(), db, skipped, nil)
+		if summary.Outcome != OutcomeApplied || len(summary.Applied) != 0 || len(summary.Skipped) != 1 {
+			t.Errorf("Expected the skipped migration to be reported apart. Got %+v", summary)
+		}
+
+		failing := append(skipped, &Migration{ID: "2020-01-03 Broken", Script: "NOT SQL"})
+		summary = migrator.RunOnce(context.Background(), db, failing, nil)
+		if summary.ExitCode != ExitFailed || summary.Error == "" {
+			t.Errorf("Expected a failure. Got %+v", summary)
+		}
+
+		busy := NewSQLite(WithSQLiteLockTable("run_once_locks"), WithSQLiteLockTimeout(100*time.Millisecond))
+		if err := busy.Lock(db); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = busy.Unlock(db) }()
+		contender := NewSQLite(WithSQLiteLockTable("run_once_locks"), WithSQLiteLockTimeout(100*time.Millisecond))
+		summary = NewMigrator(WithDialect(contender), WithTableName("run_once_migrations")).
+			RunOnce(context.Background(), db, migrations, nil)
+		if summary.ExitCode != ExitLockBusy {
+			t.Errorf("Expected the lock to be busy. Got %+v", summary)
+		}
+	})
+
+	t.Run("apply as leader", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("leader_migrations"))
+		migrations := []*Migration{
+			{ID: "2020-01-01 Leader", Script: "CREATE TABLE leader (id INTEGER)"},
+		}
+		leader := ElectorFunc(func(context.Context) (bool, error) { return true, nil })
+		follower := ElectorFunc(func(context.Context) (bool, error) { return false, nil })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		if err := migrator.ApplyAsLeader(ctx, db, migrations, follower); err != context.DeadlineExceeded {
+			t.Errorf("Expected the follower to wait for the leader. Got %v", err)
+		}
+
+		if err := migrator.ApplyAsLeader(context.Background(), db, migrations, leader); err != nil {
+			t.Fatal(err)
+		}
+		if err := migrator.ApplyAsLeader(context.Background(), db, migrations, follower); err != nil {
+			t.Errorf("Expected the follower to see the applied migrations. Got %v", err)
+		}
+	})
+
+	t.Run("wait until current", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("waiting_migrations"))
+		migrations := []*Migration{{ID: "2020-01-01 Wait", Script: "CREATE TABLE waiting (id INTEGER)"}}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		pending := append(migrations, &Migration{ID: "2020-01-02 Pending", Script: "SELECT 1"})
+		if err := migrator.WaitUntilCurrent(ctx, db, pending); err != context.DeadlineExceeded {
+			t.Errorf("Expected to wait for the pending migration. Got %v", err)
+		}
+		if err := migrator.WaitUntilCurrent(context.Background(), db, migrations); err != nil {
+			t.Errorf("Expected the migrations to be current. Got %v", err)
+		}
+		drifted := []*Migration{{ID: "2020-01-01 Wait", Script: "CREATE TABLE changed (id INTEGER)"}}
+		if err := migrator.WaitUntilCurrent(context.Background(), db, drifted); !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("Expected drift to end the wait. Got %v", err)
+		}
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		dir := t.TempDir()
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("watch_migrations"))
+		watcher := NewWatcher(migrator, db, dir)
+		watcher.Interval = 10 * time.Millisecond
+		watcher.Debounce = 20 * time.Millisecond
+		watcher.OnError = func(err error) { t.Error(err) }
+
+		var preview bytes.Buffer
+		watcher.Preview = &preview
+		watcher.DryRun = true
+		dryRun, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		err := ioutil.WriteFile(filepath.Join(dir, "2020-01-01 Watched.sql"), []byte("CREATE TABLE watched (id INTEGER);"), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := watcher.Watch(dryRun); err != context.DeadlineExceeded {
+			t.Errorf("Expected the watcher to stop with the context. Got %v", err)
+		}
+		if !strings.Contains(preview.String(), "CREATE TABLE watched") {
+			t.Errorf("Expected a preview of the pending migration. Got %q", preview.String())
+		}
+		if _, err := migrator.GetAppliedMigrations(db); err == nil {
+			t.Error("Expected the dry run to apply nothing")
+		}
+
+		watcher.Preview = nil
+		watcher.DryRun = false
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- watcher.Watch(ctx) }()
+		defer func() {
+			cancel()
+			<-done
+		}()
+
+		err = ioutil.WriteFile(filepath.Join(dir, "2020-01-02 Later.sql"), []byte("CREATE TABLE later (id INTEGER);"), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			applied, _ := migrator.GetAppliedMigrations(db)
+			if len(applied) == 2 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected both migrations to be applied. Got %d", len(applied))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("preconditions", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("precondition_migrations"))
+		migrations := []*Migration{
+			{ID: "2020-01-01 Table", Script: "CREATE TABLE precondition (id INTEGER)"},
+			{
+				ID:                 "2020-01-02 Skipped",
+				Script:             "CREATE TABLE skipped (id INTEGER)",
+				Precondition:       "SELECT COUNT(*) FROM sqlite_master WHERE name = 'missing'",
+				OnPreconditionFail: PreconditionSkip,
+			},
+			{
+				ID:           "2020-01-03 Run",
+				Script:       "CREATE TABLE run (id INTEGER)",
+				Precondition: "SELECT 1 FROM sqlite_master WHERE name = 'precondition'",
+			},
+		}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+		applied, err := migrator.GetAppliedMigrations(db)
+		if err != nil || len(applied) != 3 {
+			t.Errorf("Expected all 3 migrations to be recorded. Got %d (%v)", len(applied), err)
+		}
+		var name string
+		if err := db.QueryRow("SELECT name FROM sqlite_master WHERE name = 'skipped'").Scan(&name); err != sql.ErrNoRows {
+			t.Errorf("Expected the skipped migration not to run. Got %q (%v)", name, err)
+		}
+		if err := db.QueryRow("SELECT name FROM sqlite_master WHERE name = 'run'").Scan(&name); err != nil {
+			t.Errorf("Expected the migration with a passing precondition to run: %v", err)
+		}
+
+		failing := append(migrations, &Migration{
+			ID:           "2020-01-04 Failing",
+			Script:       "CREATE TABLE failing (id INTEGER)",
+			Precondition: "SELECT 1 WHERE 1 = 0",
+		})
+		if err := migrator.Apply(db, failing); !errors.Is(err, ErrPreconditionFailed) {
+			t.Errorf("Expected ErrPreconditionFailed. Got %v", err)
+		}
+	})
+
+	t.Run("only if", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("only_if_migrations"))
+		migrations := []*Migration{
+			{
+				ID:     "2020-01-01 Production Only",
+				Script: "CREATE TABLE production_only (id INTEGER)",
+				OnlyIf: "SELECT 1 FROM sqlite_master WHERE name = 'production_marker'",
+			},
+			{
+				ID:     "2020-01-02 Batched Production Only",
+				OnlyIf: "SELECT 0",
+				Batch:  &Batch{KeyRange: "SELECT MIN(id), MAX(id) FROM production_only", Statement: "SELECT ?, ?"},
+			},
+			{ID: "2020-01-03 Everywhere", Script: "CREATE TABLE everywhere (id INTEGER)", OnlyIf: "SELECT 1"},
+		}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+
+		applied, err := migrator.GetAppliedMigrations(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for id, skipped := range map[string]bool{
+			"2020-01-01 Production Only":         true,
+			"2020-01-02 Batched Production Only": true,
+			"2020-01-03 Everywhere":              false,
+		} {
+			if record, exists := applied[id]; !exists || record.Skipped() != skipped {
+				t.Errorf("Expected '%s' to be recorded with Skipped() == %t", id, skipped)
+			}
+		}
+		var name string
+		if err = db.QueryRow("SELECT name FROM sqlite_master WHERE name = 'production_only'").Scan(&name); err != sql.ErrNoRows {
+			t.Errorf("Expected the skipped migration not to run. Got %q (%v)", name, err)
+		}
+
+		status, err := migrator.Verify(db, migrations)
+		if err != nil || len(status.Pending) != 0 {
+			t.Errorf("Expected skipped migrations to verify as applied. Got %+v (%v)", status, err)
+		}
+	})
+
+	t.Run("batched migration", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("batch_migrations"))
+		setup := []*Migration{{
+			ID: "2020-01-01 Setup",
+			Script: `CREATE TABLE batched (id INTEGER PRIMARY KEY, v INTEGER NOT NULL DEFAULT 0);
+				CREATE TABLE fail_switch (id INTEGER);
+				INSERT INTO fail_switch VALUES (1);
+				WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 25)
+				INSERT INTO batched (id) SELECT i FROM n;`,
+		}}
+		backfill := append(setup, &Migration{
+			ID: "2020-01-02 Backfill",
+			Batch: &Batch{
+				Statement: `UPDATE batched SET v = CASE
+					WHEN id > 15 AND EXISTS (SELECT 1 FROM fail_switch) THEN NULL ELSE 1 END
+					WHERE id > ?1 AND id <= ?2`,
+				KeyRange: "SELECT MIN(id), MAX(id) FROM batched",
+				Size:     10,
+			},
+		})
+
+		if err := migrator.Apply(db, backfill); err == nil {
+			t.Fatal("Expected the second batch to fail")
+		}
+		applied, err := migrator.GetAppliedMigrations(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if progress := applied["2020-01-02 Backfill"]; progress == nil || progress.Checksum != "batch:10" {
+			t.Fatalf("Expected progress to be recorded after the first batch. Got %+v", progress)
+		}
+
+		if _, err := db.Exec("DELETE FROM fail_switch"); err != nil {
+			t.Fatal(err)
+		}
+		if err := migrator.Apply(db, backfill); err != nil {
+			t.Fatal(err)
+		}
+		var remaining int
+		if err := db.QueryRow("SELECT COUNT(*) FROM batched WHERE v <> 1").Scan(&remaining); err != nil || remaining != 0 {
+			t.Errorf("Expected every row to be backfilled. %d remain (%v)", remaining, err)
+		}
+		status, err := migrator.Status(db, backfill)
+		if err != nil || !status.Current() {
+			t.Errorf("Expected the backfill to be recorded as complete. Got %+v (%v)", status, err)
+		}
+	})
+
+	t.Run("partitions", func(t *testing.T) {
+		var notified, wrapped int
+		migrator := NewMigrator(
+			WithNotifier(NotifierFunc(func(ctx context.Context, notification *Notification) error {
+				notified++
+				return nil
+			})),
+			WithMiddleware(func(next MigrationFunc) MigrationFunc {
+				return func(ctx context.Context, migration *Migration) error {
+					wrapped++
+					return next(ctx, migration)
+				}
+			}),
+			WithSetChecksum(),
+			WithDialect(NewSQLite()),
+			WithTableName("partition_migrations"),
+			WithSignature([]byte("secret"), SignMigrations([]byte("secret"), []*Migration{})),
+			WithStrictOrdering(),
+			WithIDValidator(ValidateTimestampID),
+			WithAllowlist(Allowlist{}, AllowlistEnforce),
+			WithOrphanCheck(),
+			WithPreRunScript("CREATE TABLE partition_runs (id INTEGER)"),
+		)
+		sets := []*PartitionSet{{
+			Name:     "events",
+			Interval: PartitionDaily,
+			Create:   "CREATE TABLE events_{{.Suffix}} (at DATETIME CHECK (at >= '{{.From.Format \"2006-01-02\"}}'))",
+			Detach:   "DROP TABLE events_{{.Suffix}}",
+			Premake:  2,
+			Retain:   1,
+		}}
+		tables := func() []string {
+			rows, err := db.Query("SELECT name FROM sqlite_master WHERE name LIKE 'events_%' ORDER BY name")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			names := make([]string, 0)
+			for rows.Next() {
+				var name string
+				if err := rows.Scan(&name); err != nil {
+					t.Fatal(err)
+				}
+				names = append(names, name)
+			}
+			return names
+		}
+
+		now := time.Date(2020, 1, 30, 15, 0, 0, 0, time.UTC)
+		if err := migrator.MaintainPartitions(context.Background(), db, sets, now); err != nil {
+			t.Fatal(err)
+		}
+		if names := strings.Join(tables(), ","); names != "events_20200130,events_20200131,events_20200201" {
+			t.Errorf("Unexpected partitions: %s", names)
+		}
+
+		if err := migrator.MaintainPartitions(context.Background(), db, sets, now.AddDate(0, 0, 2)); err != nil {
+			t.Fatal(err)
+		}
+		if names := strings.Join(tables(), ","); names != "events_20200131,events_20200201,events_20200202,events_20200203" {
+			t.Errorf("Unexpected partitions after two days: %s", names)
+		}
+		if _, err := migrator.GetAppliedMigrations(db); err == nil {
+			t.Error("Expected partitions to be tracked separately from migrations")
+		}
+		if notified != 0 || wrapped != 0 {
+			t.Errorf("Expected the notifier and middleware to be left out. Got %d notifications and %d wrapped runs", notified, wrapped)
+		}
+		var setTables int
+		if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'partition_migrations_partitions_set'").Scan(&setTables); err != nil || setTables != 0 {
+			t.Errorf("Expected no set checksum table. Got %d (%v)", setTables, err)
+		}
+	})
+
+	t.Run("query logger", func(t *testing.T) {
+		queries := make([]string, 0)
+		logger := QueryLoggerFunc(func(query string, args []interface{}, duration time.Duration, err error) {
+			queries = append(queries, strings.TrimSpace(query))
+		})
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("logged_migrations"), WithQueryLogger(logger))
+		err := migrator.Apply(db, []*Migration{
+			{ID: "2020-01-01 Logged", Script: "CREATE TABLE logged (id INTEGER)", Verify: "SELECT 1"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{"CREATE TABLE IF NOT EXISTS", "SELECT id, checksum", "CREATE TABLE logged", "SELECT 1", "INSERT INTO"}
+		if len(queries) < len(expected) {
+			t.Fatalf("Expected at least %d logged queries. Got %q", len(expected), queries)
+		}
+		i := 0
+		for _, query := range queries {
+			if i < len(expected) && strings.HasPrefix(query, expected[i]) {
+				i++
+			}
+		}
+		if i != len(expected) {
+			t.Errorf("Expected queries starting with %q in order. Got %q", expected, queries)
+		}
+	})
+
+	t.Run("statement retry", func(t *testing.T) {
+		attempts, rollbacks := 0, 0
+		logger := QueryLoggerFunc(func(query string, args []interface{}, duration time.Duration, err error) {
+			switch {
+			case strings.HasPrefix(query, "INSERT INTO missing"):
+				attempts++
+			case strings.HasPrefix(query, "ROLLBACK TO SAVEPOINT"):
+				rollbacks++
+			}
+		})
+		migrator := NewMigrator(
+			WithDialect(NewSQLite()),
+			WithTableName("retry_migrations"),
+			WithQueryLogger(logger),
+			WithStatementRetry(2, time.Millisecond),
+		)
+		migrator.RetryableError = func(error) bool { return true }
+
+		err := migrator.Apply(db, []*Migration{{ID: "2020-01-01 Retried", Script: "INSERT INTO missing VALUES (1)"}})
+		if err == nil {
+			t.Fatal("Expected the migration to fail")
+		}
+		if attempts != 3 || rollbacks != 2 {
+			t.Errorf("Expected 3 attempts and 2 rollbacks. Got %d and %d", attempts, rollbacks)
+		}
+
+		migrator.RetryableError = nil
+		attempts = 0
+		err = migrator.Apply(db, []*Migration{{ID: "2020-01-01 Retried", Script: "INSERT INTO missing VALUES (1)"}})
+		if err == nil || attempts != 1 {
+			t.Errorf("Expected a non-retryable error to fail immediately. Got %d attempts (%v)", attempts, err)
+		}
+	})
+
+	t.Run("existing table only", func(t *testing.T) {
+		migrator := NewMigrator(
+			WithDialect(NewSQLite()),
+			WithTableName("provisioned_migrations"),
+			WithExistingTableOnly(),
+		)
+		migrations := []*Migration{{ID: "2020-01-01 Provisioned", Script: "CREATE TABLE provisioned (id INTEGER)"}}
+
+		err := migrator.Apply(db, migrations)
+		if !errors.Is(err, ErrTrackingTableMissing) {
+			t.Fatalf("Expected ErrTrackingTableMissing. Got %v", err)
+		}
+
+		_, err = db.Exec(NewSQLite().CreateSQL(migrator.QuotedTableName()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = migrator.Apply(db, migrations)
+		if err != nil {
+			t.Error(err)
+		}
+
+		built := NewMigrator(
+			WithDialect(NewSQLite()),
+			WithTableName("provisioned_migrations"),
+			WithExistingTableOnly(),
+			WithBuildMetadata("abc123"),
+		)
+		err = built.Apply(db, migrations)
+		if !errors.Is(err, ErrTrackingTableMissing) || !strings.Contains(err.Error(), built.QuotedBuildsTableName()) {
+			t.Errorf("Expected the missing builds table to be reported. Got %v", err)
+		}
+
+		unreadable := NewMigrator(
+			WithDialect(brokenSelectSQLite{NewSQLite()}),
+			WithTableName("provisioned_migrations"),
+			WithExistingTableOnly(),
+		)
+		err = unreadable.Apply(db, migrations)
+		if err == nil || errors.Is(err, ErrTrackingTableMissing) {
+			t.Errorf("Expected a read error other than ErrTrackingTableMissing. Got %v", err)
+		}
+	})
+
+	t.Run("replica check", func(t *testing.T) {
+		migrations := []*Migration{{ID: "2020-01-01 Replica", Script: "CREATE TABLE replicated (id INTEGER)"}}
+		migrator := NewMigrator(
+			WithDialect(replicaSQLite{NewSQLite(), "SELECT 1"}),
+			WithTableName("replica_migrations"),
+			WithReplicaCheck(),
+		)
+		err := migrator.Apply(db, migrations)
+		if !errors.Is(err, ErrReplica) {
+			t.Errorf("Expected ErrReplica. Got %v", err)
+		}
+
+		migrator.Dialect = replicaSQLite{NewSQLite(), "SELECT 0"}
+		err = migrator.Apply(db, migrations)
+		if err != nil {
+			t.Errorf("Expected the primary to be migrated. Got %v", err)
+		}
+	})
+
+	t.Run("minimum server version", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("version_migrations"))
+		migrations := []*Migration{
+			{ID: "2020-01-01 Old", Script: "CREATE TABLE old_syntax (id INTEGER)"},
+			{ID: "2020-01-02 Future", Script: "SELECT 1", MinServerVersion: "99"},
+		}
+		err := migrator.Apply(db, migrations)
+		if !errors.Is(err, ErrServerVersion) || !strings.Contains(err.Error(), "2020-01-02 Future") {
+			t.Errorf("Expected ErrServerVersion for the future migration. Got %v", err)
+		}
+		applied, _ := migrator.GetAppliedMigrations(db)
+		if len(applied) != 0 {
+			t.Errorf("Expected no migrations to run. Got %d", len(applied))
+		}
+
+		migrations[1].MinServerVersion = "3"
+		if err = migrator.Apply(db, migrations); err != nil {
+			t.Error(err)
+		}
+
+		migrator = NewMigrator(WithDialect(NewSQLite()), WithTableName("version_migrations"), WithMinServerVersion("99.1"))
+		if err = migrator.Apply(db, migrations); !errors.Is(err, ErrServerVersion) {
+			t.Errorf("Expected ErrServerVersion for the Migrator. Got %v", err)
+		}
+	})
+
+	t.Run("per-call options", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("override_migrations"))
+		migrations := []*Migration{{ID: "2020-01-01 Override", Script: "CREATE TABLE overridden (id INTEGER)"}}
+
+		var planned []*Migration
+		dryRun := WithConfirm(func(plan []*Migration) (bool, error) {
+			planned = plan
+			return false, nil
+		})
+		err := migrator.Apply(db, migrations, dryRun)
+		if err != ErrNotConfirmed || len(planned) != 1 {
+			t.Errorf("Expected the one-off dry run to preview 1 migration. Got %d (%v)", len(planned), err)
+		}
+		if migrator.Confirm != nil {
+			t.Error("Expected the Migrator to be unchanged by the per-call option")
+		}
+
+		if err = migrator.Apply(db, migrations); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("shared migrator", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("tenant_migrations"))
+		migrations := []*Migration{{ID: "2020-01-01 Tenant", Script: "CREATE TABLE tenant (id INTEGER)"}}
+
+		tenants := make([]*sql.DB, 4)
+		for i := range tenants {
+			path := filepath.Join(t.TempDir(), fmt.Sprintf("tenant_%d.db", i))
+			tenant, err := sql.Open("sqlite3", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tenant.Close()
+			tenants[i] = tenant
+		}
+
+		// Holding the lock on one tenant must not block the others
+		dialect := migrator.Dialect.(Locker)
+		if err := dialect.Lock(tenants[0]); err != nil {
+			t.Fatal(err)
+		}
+		errs := make(chan error, len(tenants)-1)
+		for _, tenant := range tenants[1:] {
+			go func(tenant *sql.DB) {
+				errs <- migrator.Apply(tenant, migrations)
+			}(tenant)
+		}
+		for range tenants[1:] {
+			if err := <-errs; err != nil {
+				t.Error(err)
+			}
+		}
+		if err := dialect.Unlock(tenants[0]); err != nil {
+			t.Error(err)
+		}
+		if locks := len(migrator.Dialect.(*sqliteDialect).locks); locks != 0 {
+			t.Errorf("Expected the lock state of every tenant to be released. Got %d", locks)
+		}
+		if err := dialect.Unlock(tenants[0]); !errors.Is(err, ErrSQLiteNotLocked) {
+			t.Errorf("Expected ErrSQLiteNotLocked. Got %v", err)
+		}
+	})
+
+	t.Run("middleware", func(t *testing.T) {
+		calls := make([]string, 0)
+		trace := func(name string) Middleware {
+			return func(next MigrationFunc) MigrationFunc {
+				return func(ctx context.Context, migration *Migration) error {
+					calls = append(calls, name+" "+migration.ID)
+					return next(ctx, migration)
+				}
+			}
+		}
+		denied := errors.New("not approved")
+		approval := func(next MigrationFunc) MigrationFunc {
+			return func(ctx context.Context, migration *Migration) error {
+				if strings.Contains(migration.Script, "DROP") {
+					return denied
+				}
+				return next(ctx, migration)
+			}
+		}
+		migrator := NewMigrator(
+			WithDialect(NewSQLite()),
+			WithTableName("middleware_migrations"),
+			WithMiddleware(trace("outer"), trace("inner")),
+			WithMiddleware(approval),
+		)
+
+		err := migrator.Apply(db, []*Migration{
+			{ID: "2020-01-01 Create", Script: "CREATE TABLE wrapped (id INTEGER)"},
+			{ID: "2020-01-02 Drop", Script: "DROP TABLE wrapped"},
+		})
+		if !errors.Is(err, denied) {
+			t.Errorf("Expected the approval middleware to refuse the drop. Got %v", err)
+		}
+		expected := []string{"outer 2020-01-01 Create", "inner 2020-01-01 Create", "outer 2020-01-02 Drop", "inner 2020-01-02 Drop"}
+		if strings.Join(calls, ", ") != strings.Join(expected, ", ") {
+			t.Errorf("Unexpected middleware calls: %v", calls)
+		}
+	})
+
+	t.Run("strict ordering", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("ordered_migrations"), WithStrictOrdering())
+		err := migrator.Apply(db, []*Migration{{ID: "2020-01-02 Main", Script: "SELECT 1"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var conflict *ConflictError
+		err = migrator.Apply(db, []*Migration{
+			{ID: "2020-01-01 Branch", Script: "SELECT 1"},
+			{ID: "2020-01-02 Main", Script: "SELECT 1"},
+		})
+		if !errors.As(err, &conflict) || len(conflict.Interleaved) != 1 {
+			t.Errorf("Expected a ConflictError for the branch migration. Got %v", err)
+		}
+	})
+
+	t.Run("pre-run and post-run scripts", func(t *testing.T) {
+		migrator := NewMigrator(
+			WithDialect(NewSQLite()),
+			WithTableName("run_script_migrations"),
+			WithPreRunScript("CREATE TABLE IF NOT EXISTS run_log (entry TEXT)", "INSERT INTO run_log VALUES ('pre')"),
+			WithPostRunScript("INSERT INTO run_log VALUES ('post')"),
+		)
+		migrations := []*Migration{{ID: "2020-01-01 Log", Script: "INSERT INTO run_log VALUES ('migration')"}}
+		for i := 0; i < 2; i++ {
+			if err := migrator.Apply(db, migrations); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Each migration is committed separately, so the post-run script
+		// runs after the failure
+		broken := append(migrations, &Migration{ID: "2020-01-02 Broken", Script: "NOT SQL", DisableTransaction: true})
+		if err := migrator.Apply(db, broken); err == nil {
+			t.Fatalf("Expected the broken migration to fail. Got %v", err)
+		}
+		if err := migrator.Apply(db, broken, WithConnectionPerMigration()); err == nil || !strings.Contains(err.Error(), "pre-run") {
+			t.Errorf("Expected scripts to be refused with a connection per migration. Got %v", err)
+		}
+
+		rows, err := db.Query("SELECT entry FROM run_log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		entries := make([]string, 0)
+		for rows.Next() {
+			var entry string
+			if err = rows.Scan(&entry); err != nil {
+				t.Fatal(err)
+			}
+			entries = append(entries, entry)
+		}
+		if strings.Join(entries, ", ") != "pre, migration, post, pre, post" {
+			t.Errorf("Unexpected run log: %v", entries)
+		}
+	})
+
+	t.Run("partially applied migration", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(implicitCommitSQLite{NewSQLite()}), WithTableName("partial_migrations"))
+		migration := &Migration{
+			ID:     "2020-01-01 Partial",
+			Script: "CREATE TABLE partial_a (id INTEGER); CREATE TABLE partial_b (id INTEGER); NOT SQL",
+		}
+		var partial *PartialMigrationError
+		err := migrator.Apply(db, []*Migration{migration})
+		if !errors.As(err, &partial) || partial.Committed != 2 {
+			t.Fatalf("Expected a PartialMigrationError after 2 statements. Got %v", err)
+		}
+
+		// The next run explains where the first stopped instead of
+		// running the migration again
+		err = migrator.Apply(db, []*Migration{migration})
+		if !errors.As(err, &partial) || !errors.Is(err, ErrPartiallyApplied) || partial.Committed != 2 || partial.Total != 3 || partial.Statement != "NOT SQL" {
+			t.Fatalf("Expected the partial migration to be reported. Got %v", err)
+		}
+		status, err := migrator.Status(db, []*Migration{migration})
+		if err != nil || len(status.Partial) != 1 || status.Current() {
+			t.Errorf("Expected the status to list the partial migration. Got %+v (%v)", status, err)
+		}
+
+		if err = migrator.ResolvePartial(db, migration); err != nil {
+			t.Fatal(err)
+		}
+		if err = migrator.Apply(db, []*Migration{migration}); err != nil {
+			t.Errorf("Expected the resolved migration to be applied. Got %v", err)
+		}
+		if err = migrator.ResolvePartial(db, migration); err == nil {
+			t.Error("Expected an error resolving a migration which isn't partial")
+		}
+	})
+
+	t.Run("atomic ddl", func(t *testing.T) {
+		script := "CREATE TABLE atomic_a (id INTEGER); NOT SQL"
+		migrator := NewMigrator(WithDialect(implicitCommitSQLite{NewSQLite()}), WithTableName("nonatomic_migrations"))
+		err := migrator.Apply(db, []*Migration{{ID: "2020-01-01 Nonatomic", Script: script}})
+		var partial *PartialMigrationError
+		if !errors.As(err, &partial) || partial.AtomicDDL || !strings.Contains(err.Error(), "may itself have been partly applied") {
+			t.Errorf("Expected the failed statement to be reported as possibly partial. Got %v", err)
+		}
+
+		migrator = NewMigrator(WithDialect(atomicSQLite{implicitCommitSQLite{NewSQLite()}}), WithTableName("atomic_migrations"))
+		err = migrator.Apply(db, []*Migration{{ID: "2020-01-01 Atomic", Script: strings.Replace(script, "atomic_a", "atomic_b", 1)}})
+		if !errors.As(err, &partial) || !partial.AtomicDDL || !strings.Contains(err.Error(), "was rolled back") {
+			t.Errorf("Expected the failed statement to be reported as rolled back. Got %v", err)
+		}
+
+		// A failure of the first statement leaves nothing applied, unless
+		// the statement itself isn't atomic
+		broken := []*Migration{{ID: "2020-01-02 Broken", Script: "CREATE TABLE VALUES"}}
+		if err = migrator.Apply(db, broken); err == nil || strings.Contains(err.Error(), "partly applied") {
+			t.Errorf("Expected no warning about an atomic statement. Got %v", err)
+		}
+		migrator.Dialect = implicitCommitSQLite{NewSQLite()}
+		if err = migrator.Apply(db, broken); err == nil || !strings.Contains(err.Error(), "isn't atomic") {
+			t.Errorf("Expected a warning about a statement which isn't atomic. Got %v", err)
+		}
+	})
+
+	t.Run("disable transaction", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("untransacted_migrations"))
+		migrations := []*Migration{
+			{ID: "2020-01-01 Create", Script: "CREATE TABLE untransacted (id INTEGER)"},
+			{ID: "2020-01-02 Vacuum", Script: "DELETE FROM untransacted; VACUUM"},
+		}
+		err := migrator.Apply(db, migrations)
+		if !errors.Is(err, ErrNotTransactional) || !strings.Contains(err.Error(), "2020-01-02 Vacuum") {
+			t.Fatalf("Expected the plan to fail on VACUUM. Got %v", err)
+		}
+		if _, err = db.Exec("SELECT * FROM untransacted"); err == nil {
+			t.Error("Expected no migration to run before the plan failed")
+		}
+
+		migrations[1].DisableTransaction = true
+		err = migrator.Apply(db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		applied, err := migrator.GetAppliedMigrations(db)
+		if err != nil || len(applied) != 2 {
+			t.Errorf("Expected both migrations to be recorded. Got %d (%v)", len(applied), err)
+		}
+	})
+
+	t.Run("dialect restriction", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("restricted_migrations"))
+		migrations := []*Migration{
+			{ID: "2020-01-01 Extension", Script: "CREATE EXTENSION pgcrypto", Dialects: []string{"postgres"}, MinServerVersion: "99"},
+			{ID: "2020-01-02 Portable", Script: "CREATE TABLE restricted (id INTEGER)", Dialects: []string{"postgres", "sqlite"}},
+		}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+		applied, err := migrator.GetAppliedMigrations(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !applied["2020-01-01 Extension"].Skipped() || applied["2020-01-02 Portable"].Skipped() {
+			t.Errorf("Expected only the Postgres migration to be skipped. Got %+v", applied)
+		}
+	})
+
+	t.Run("durability check", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("durable_migrations"), WithDurabilityCheck())
+		migration := &Migration{ID: "2020-01-01 Durable", Script: "CREATE TABLE durable (id INTEGER)"}
+		if err := migrator.Apply(db, []*Migration{migration}); err != nil {
+			t.Fatal(err)
+		}
+
+		lost := &applyRun{
+			plan:      []*Migration{migration, {ID: "2020-01-02 Lost", Script: "SELECT 1"}},
+			completed: []*MigrationReport{{ID: "2020-01-01 Durable"}, {ID: "2020-01-02 Lost"}},
+		}
+		err := migrator.checkDurable(context.Background(), db, lost)
+		if !errors.Is(err, ErrNotDurable) || !strings.Contains(err.Error(), "2020-01-02 Lost") || strings.Contains(err.Error(), "2020-01-01 Durable") {
+			t.Errorf("Expected only the lost migration to be reported. Got %v", err)
+		}
+
+		// A temporary table shadows the tracking table on the migration
+		// connection only, so the record is visible there and nowhere else.
+		// The pool holds a single connection, which it would hand back to
+		// the check if the migration connection were returned to it.
+		single, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "durable.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer single.Close()
+		single.SetMaxOpenConns(1)
+		shadowed := &Migration{ID: "2020-01-01 Shadowed", Script: NewSQLite().CreateSQL(migrator.QuotedTableName())}
+		shadowed.Script = strings.Replace(shadowed.Script, "CREATE TABLE", "CREATE TEMP TABLE", 1)
+		if err := migrator.Apply(single, []*Migration{shadowed}); !errors.Is(err, ErrNotDurable) {
+			t.Errorf("Expected the record on the migration connection only to be reported. Got %v", err)
+		}
+	})
+
+	t.Run("notifier", func(t *testing.T) {
+		notifications := make([]*Notification, 0)
+		notifier := NotifierFunc(func(ctx context.Context, n *Notification) error {
+			notifications = append(notifications, n)
+			return nil
+		})
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("notified_migrations"), WithNotifier(notifier))
+		migrations := []*Migration{{ID: "2020-01-01 Notified", Script: "CREATE TABLE notified (id INTEGER)"}}
+
+		for i := 0; i < 2; i++ {
+			if err := migrator.Apply(db, migrations); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := migrator.Apply(db, append(migrations, &Migration{ID: "2020-01-02 Broken", Script: "NOT SQL"}))
+		if err == nil {
+			t.Fatal("Expected the broken migration to fail")
+		}
+
+		if len(notifications) != 2 {
+			t.Fatalf("Expected notifications for the applied and failed runs only. Got %d", len(notifications))
+		}
+		if n := notifications[0]; n.Outcome != OutcomeApplied || len(n.Migrations) != 1 {
+			t.Errorf("Unexpected notification: %+v", n)
+		}
+		if n := notifications[1]; n.Outcome != OutcomeFailed || n.Error == "" || n.Migrations[0] != "2020-01-02 Broken" {
+			t.Errorf("Unexpected notification: %+v", n)
+		}
+	})
+
+	t.Run("apply report", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("report_migrations"))
+		report, err := migrator.ApplyReport(context.Background(), db, []*Migration{
+			{ID: "2020-01-01 Reported", Script: "CREATE TABLE reported (id INTEGER)"},
+			{ID: "2020-01-02 Skipped", Script: "SELECT 1", Precondition: "SELECT 0", OnPreconditionFail: PreconditionSkip},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Applied) != 1 || report.Applied[0].ID != "2020-01-01 Reported" {
+			t.Errorf("Expected one applied migration. Got %+v", report.Applied)
+		}
+		if len(report.Skipped) != 1 || report.Skipped[0].ID != "2020-01-02 Skipped" {
+			t.Errorf("Expected one skipped migration. Got %+v", report.Skipped)
+		}
+		if report.Duration <= 0 || report.Duration < report.LockWait {
+			t.Errorf("Unexpected durations: %+v", report)
+		}
+
+		report, err = migrator.ApplyReport(context.Background(), db, []*Migration{
+			{ID: "2020-01-03 Rolled Back", Script: "CREATE TABLE rolled_back (id INTEGER)"},
+			{ID: "2020-01-04 Broken", Script: "NOT SQL"},
+		})
+		if err == nil || report == nil || len(report.Applied) != 0 {
+			t.Errorf("Expected a failed run to report nothing applied. Got %+v (%v)", report, err)
+		}
+	})
+
+	t.Run("build metadata", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("built_migrations"), WithBuildMetadata("abc123"))
+		migrations := []*Migration{{ID: "2020-01-01 Built", Script: "CREATE TABLE built (id INTEGER)"}}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+		migrator = NewMigrator(WithDialect(NewSQLite()), WithTableName("built_migrations"), WithBuildMetadata("def456"))
+		migrations = append(migrations, &Migration{ID: "2020-01-02 Rebuilt", Script: "SELECT 1"})
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+
+		builds, err := migrator.AppliedBuilds(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(builds) != 2 || builds[0].Build != "abc123" || builds[1].ID != "2020-01-02 Rebuilt" || builds[1].Build != "def456" {
+			t.Errorf("Unexpected builds: %+v %+v", builds[0], builds[len(builds)-1])
+		}
+	})
+
+	t.Run("script recording", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("recorded_migrations"), WithScriptRecording())
+		migrations := []*Migration{
+			{ID: "2020-01-01 Recorded", Script: "CREATE TABLE recorded (id INTEGER)"},
+			{ID: "2020-01-02 Skipped", Script: "SELECT 1", OnlyIf: "SELECT 0"},
+			{ID: "2020-01-03 Rendered", Script: "CREATE TABLE recorded_{{.Dialect}} (id INTEGER)", Engine: TemplateEngine{}},
+		}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+
+		scripts, err := migrator.AppliedScripts(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(scripts) != 2 || scripts[0].ID != "2020-01-01 Recorded" || scripts[0].Script != migrations[0].Script {
+			t.Errorf("Expected only the scripts which ran. Got %+v", scripts)
+		}
+		if len(scripts) == 2 && scripts[1].Script != "CREATE TABLE recorded_sqlite (id INTEGER)" {
+			t.Errorf("Expected the rendered script to be recorded. Got %q", scripts[1].Script)
+		}
+	})
+
+	t.Run("set checksum", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("set_migrations"), WithSetChecksum())
+		migrations := []*Migration{
+			{ID: "2020-01-01 First", Script: "SELECT 1"},
+		}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+		migrations = append(migrations, &Migration{ID: "2020-01-02 Second", Script: "SELECT 2"})
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+
+		set, err := migrator.AppliedSet(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if set == nil || set.Checksum != SetChecksum(migrations) || set.Migrations != 2 {
+			t.Errorf("Expected the checksum of the whole set. Got %+v", set)
+		}
+
+		if err := migrator.Apply(db, migrations, WithExistingTableOnly()); err != nil {
+			t.Errorf("Expected the provisioned set table to be used. Got %v", err)
+		}
+		provisioned := NewMigrator(WithDialect(NewSQLite()), WithTableName("provisioned_set_migrations"), WithSetChecksum(), WithExistingTableOnly())
+		if _, err := db.Exec(NewSQLite().CreateSQL(provisioned.QuotedTableName())); err != nil {
+			t.Fatal(err)
+		}
+		if err := provisioned.Apply(db, migrations); !errors.Is(err, ErrTrackingTableMissing) {
+			t.Errorf("Expected the missing set table to be reported. Got %v", err)
+		}
+	})
+
+	t.Run("modules", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("module_migrations"))
+		modules := []*Module{
+			{Name: "core", Migrations: []*Migration{
+				{ID: "2020-01-01 Init", Script: "CREATE TABLE core_accounts (id INTEGER)"},
+			}},
+			{Name: "billing", TableName: "billing_migrations", Migrations: []*Migration{
+				{ID: "2020-01-01 Init", Script: "CREATE TABLE billing_invoices (account_id INTEGER REFERENCES core_accounts (id))"},
+			}},
+		}
+		if err := migrator.ApplyModules(context.Background(), db, modules); err != nil {
+			t.Fatal(err)
+		}
+		for _, table := range []string{"module_migrations_core", "billing_migrations"} {
+			var count int
+			if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", table)).Scan(&count); err != nil || count != 1 {
+				t.Errorf("Expected %s to track its module's migration. Got %d (%v)", table, count, err)
+			}
+		}
+
+		modules = append(modules, &Module{Name: "analytics", TableName: "billing_migrations"})
+		if err := migrator.ApplyModules(context.Background(), db, modules); err == nil || !strings.Contains(err.Error(), "both use") {
+			t.Errorf("Expected modules sharing a table to be refused. Got %v", err)
+		}
+
+		modules[2] = &Module{Name: "analytics", Migrations: []*Migration{{ID: "2020-01-01 Init", Script: "SYNTAX ERROR"}}}
+		if err := migrator.ApplyModules(context.Background(), db, modules); err == nil || !strings.Contains(err.Error(), "Module 'analytics'") {
+			t.Errorf("Expected the failed module to be identified. Got %v", err)
+		}
+		if err := migrator.Apply(db, []*Migration{}); err != nil {
+			t.Errorf("Expected the lock to have been released. Got %v", err)
+		}
+	})
+
+	t.Run("signed modules", func(t *testing.T) {
+		key := []byte("secret")
+		modules := []*Module{
+			{Name: "core", Migrations: []*Migration{
+				{ID: "2020-01-01 Init", Script: "CREATE TABLE signed_core (id INTEGER)"},
+			}},
+			{Name: "billing", Migrations: []*Migration{
+				{ID: "2020-01-01 Init", Script: "CREATE TABLE signed_billing (id INTEGER)"},
+			}},
+		}
+		migrator := NewMigrator(
+			WithDialect(NewSQLite()),
+			WithTableName("signed_module_migrations"),
+			WithSignature(key, SignMigrations(key, modules[0].Migrations)),
+		)
+		if err := migrator.ApplyModules(context.Background(), db, modules); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("Expected a signature over one module to be refused. Got %v", err)
+		}
+
+		all := append(append([]*Migration{}, modules[1].Migrations...), modules[0].Migrations...)
+		migrator = NewMigrator(
+			WithDialect(NewSQLite()),
+			WithTableName("signed_module_migrations"),
+			WithSignature(key, SignMigrations(key, all)),
+		)
+		if err := migrator.ApplyModules(context.Background(), db, modules); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("sandbox", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("sandbox_migrations"), WithPostRunScript("CREATE TABLE sandbox_post (id INTEGER)"))
+		migrations := []*Migration{
+			{ID: "2020-01-01 Sandboxed", Script: "CREATE TABLE sandboxed (id INTEGER)"},
+			{ID: "2020-01-02 Filled", Script: "INSERT INTO sandboxed VALUES (1)"},
+		}
+		report, err := migrator.SandboxApply(context.Background(), db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Applied) != 2 {
+			t.Errorf("Expected both migrations to have run. Got %+v", report.Applied)
+		}
+		for _, table := range []string{"sandbox_migrations", "sandboxed", "sandbox_post"} {
+			var count int
+			if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = ?", table).Scan(&count); err != nil || count != 0 {
+				t.Errorf("Expected %s to have been rolled back. Got %d (%v)", table, count, err)
+			}
+		}
+
+		broken := append(migrations, &Migration{ID: "2020-01-03 Broken", Script: "INSERT INTO missing VALUES (1)"})
+		if _, err := migrator.SandboxApply(context.Background(), db, broken); err == nil || !strings.Contains(err.Error(), "missing") {
+			t.Errorf("Expected the failing statement to be reported. Got %v", err)
+		}
+
+		batched := append(migrations, &Migration{ID: "2020-01-03 Batched", Script: "SELECT 1", Batch: &Batch{Statement: "SELECT ?1, ?2", KeyRange: "SELECT 1, 2"}})
+		if _, err := migrator.SandboxApply(context.Background(), db, batched); err == nil || !strings.Contains(err.Error(), "sandbox") {
+			t.Errorf("Expected a Batch to be refused. Got %v", err)
+		}
+	})
+
+	t.Run("prune history", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("pruned_migrations"), WithScriptRecording())
+		migrations := []*Migration{
+			{ID: "2020-01-01 Old", Script: "SELECT 1"},
+			{ID: "2020-01-02 Baseline", Script: "SELECT 2"},
+		}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := migrator.PruneHistory(db, migrations, Retention{KeepLast: 1}); !errors.Is(err, ErrPruneUnsafe) {
+			t.Errorf("Expected ErrPruneUnsafe. Got %v", err)
+		}
+		if _, err := migrator.PruneHistory(db, migrations, Retention{}); err != ErrNoRetention {
+			t.Errorf("Expected ErrNoRetention. Got %v", err)
+		}
+
+		squashed := migrations[1:]
+		pruned, err := migrator.PruneHistory(db, squashed, Retention{KeepLast: 1})
+		if err != nil || len(pruned) != 1 || pruned[0].ID != "2020-01-01 Old" {
+			t.Fatalf("Expected the old migration to be pruned. Got %+v (%v)", pruned, err)
+		}
+		status, err := migrator.Verify(db, squashed)
+		if err != nil || len(status.Applied) != 1 {
+			t.Errorf("Expected only the baseline to remain. Got %+v (%v)", status, err)
+		}
+		scripts, err := migrator.AppliedScripts(db)
+		if err != nil || len(scripts) != 1 {
+			t.Errorf("Expected the pruned script to be deleted. Got %+v (%v)", scripts, err)
+		}
+	})
+
+	t.Run("script engine", func(t *testing.T) {
+		tenants := ScriptEngineFunc(func(source string, dialect string) (string, error) {
+			if dialect != "sqlite" {
+				return "", fmt.Errorf("unexpected dialect %q", dialect)
+			}
+			var script strings.Builder
+			for _, tenant := range strings.Fields(source) {
+				fmt.Fprintf(&script, "CREATE TABLE %s_users (id INTEGER);\n", tenant)
+			}
+			return script.String(), nil
+		})
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("engine_migrations"))
+		migrations := []*Migration{{ID: "2020-01-01 Tenants", Script: "acme globex", Engine: tenants}}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+		var name string
+		if err := db.QueryRow("SELECT name FROM sqlite_master WHERE name = 'globex_users'").Scan(&name); err != nil {
+			t.Errorf("Expected the rendered script to run: %v", err)
+		}
+
+		broken := ScriptEngineFunc(func(string, string) (string, error) { return "", errors.New("syntax error") })
+		migrations = append(migrations, &Migration{ID: "2020-01-02 Broken", Script: "?", Engine: broken})
+		if err := migrator.Apply(db, migrations); err == nil || !strings.Contains(err.Error(), "syntax error") {
+			t.Errorf("Expected the render error. Got %v", err)
+		}
+	})
+
+	t.Run("script vars", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("vars_migrations"), WithEnvironment("test"), WithScriptFlags(map[string]bool{"strict": true}))
+		migrations := []*Migration{{
+			ID:     "2020-01-01 Vars",
+			Script: `CREATE TABLE {{.Environment}}_vars (id INTEGER{{if and .Flags.strict (.VersionAtLeast "3")}} NOT NULL{{end}})`,
+			Engine: TemplateEngine{},
+		}}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+		var sql string
+		if err := db.QueryRow("SELECT sql FROM sqlite_master WHERE name = 'test_vars'").Scan(&sql); err != nil {
+			t.Fatalf("Expected the rendered script to run: %v", err)
+		}
+		if !strings.Contains(sql, "NOT NULL") {
+			t.Errorf("Expected the server version and flag to be rendered. Got %s", sql)
+		}
+	})
+
+	t.Run("ddl builder", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("ddl_migrations"))
+		migrations := []*Migration{
+			DDLMigration("2020-01-01 Accounts",
+				CreateTable("accounts").Column("id", BigSerial).Column("name", Text, NotNull()).PrimaryKey("id"),
+				CreateIndex("accounts_name", "accounts", "name"),
+			),
+		}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+		result, err := db.Exec("INSERT INTO accounts (name) VALUES ('acme')")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id, err := result.LastInsertId(); err != nil || id != 1 {
+			t.Errorf("Expected an auto-incremented ID. Got %d (%v)", id, err)
+		}
+	})
+
+	t.Run("introspection", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("introspected_migrations"))
+		migrations := []*Migration{{ID: "2020-01-01 Introspected", Script: `
+			CREATE TABLE introspected (id INTEGER NOT NULL, name TEXT DEFAULT 'none', email TEXT);
+			CREATE UNIQUE INDEX introspected_name_email ON introspected (name, email);
+		`}}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+
+		tables, err := migrator.ListTables(db)
+		listed := " " + strings.Join(tables, " ") + " "
+		if err != nil || !strings.Contains(listed, " introspected ") || !strings.Contains(listed, " introspected_migrations ") {
+			t.Errorf("Expected the table and its tracking table. Got %v (%v)", tables, err)
+		}
+		columns, err := migrator.ListColumns(db, "introspected")
+		if err != nil || len(columns) != 3 {
+			t.Fatalf("Expected 3 columns. Got %d (%v)", len(columns), err)
+		}
+		if c := columns[0]; c.Name != "id" || c.Type != "INTEGER" || c.Nullable {
+			t.Errorf("Unexpected column: %+v", c)
+		}
+		if c := columns[1]; c.Name != "name" || !c.Nullable || c.Default != "'none'" {
+			t.Errorf("Unexpected column: %+v", c)
+		}
+		indexes, err := migrator.ListIndexes(db, "introspected")
+		if err != nil || len(indexes) != 1 {
+			t.Fatalf("Expected 1 index. Got %d (%v)", len(indexes), err)
+		}
+		if i := indexes[0]; i.Name != "introspected_name_email" || !i.Unique || strings.Join(i.Columns, ",") != "name,email" {
+			t.Errorf("Unexpected index: %+v", i)
+		}
+		if columns, err = migrator.ListColumns(db, "missing"); err != nil || len(columns) != 0 {
+			t.Errorf("Expected no columns for a missing table. Got %v (%v)", columns, err)
+		}
+	})
+
+	t.Run("conn queryer", func(t *testing.T) {
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("conn_migrations"))
+		migrations := []*Migration{{ID: "2020-01-01 Conn", Script: "CREATE TABLE conn_queried (id INTEGER)"}}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+		conn, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		applied, err := migrator.GetAppliedMigrations(QueryerWithContext(context.Background(), conn))
+		if err != nil || len(applied) != 1 {
+			t.Errorf("Expected 1 applied migration through the sql.Conn. Got %d (%v)", len(applied), err)
+		}
+	})
+
+	t.Run("reconnect", func(t *testing.T) {
+		drops := 0
+		dropOnce := func(next MigrationFunc) MigrationFunc {
+			return func(ctx context.Context, migration *Migration) error {
+				if migration.ID == "2020-01-02 Second" && drops == 0 {
+					drops++
+					return driver.ErrBadConn
+				}
+				return next(ctx, migration)
+			}
+		}
+		migrations := []*Migration{
+			{ID: "2020-01-01 First", Script: "CREATE TABLE reconnect_first (id INTEGER)"},
+			{ID: "2020-01-02 Second", Script: "CREATE TABLE reconnect_second (id INTEGER)"},
+		}
+
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("dropped_migrations"), WithMiddleware(dropOnce))
+		if err := migrator.Apply(db, migrations); !errors.Is(err, driver.ErrBadConn) {
+			t.Errorf("Expected the dropped connection without WithReconnect. Got %v", err)
+		}
+
+		drops = 0
+		migrator = NewMigrator(WithDialect(NewSQLite()), WithTableName("reconnect_migrations"), WithMiddleware(dropOnce), WithReconnect(2, time.Millisecond))
+		report, err := migrator.ApplyReport(context.Background(), db, migrations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if drops != 1 || len(report.Applied) != 2 {
+			t.Errorf("Expected both migrations to be applied after 1 drop. Got %d applied after %d drops", len(report.Applied), drops)
+		}
+	})
+
+	t.Run("connection per migration", func(t *testing.T) {
+		migrations := []*Migration{
+			{ID: "2020-01-01 First Scratch", Script: "CREATE TEMP TABLE scratch (id INTEGER)"},
+			{ID: "2020-01-02 Second Scratch", Script: "CREATE TEMP TABLE scratch (id INTEGER)"},
+		}
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("shared_session_migrations"))
+		if err := migrator.Apply(db, migrations); err == nil {
+			t.Error("Expected the second temporary table to collide with the first on a shared connection")
+		}
+		migrator = NewMigrator(WithDialect(NewSQLite()), WithTableName("fresh_session_migrations"), WithConnectionPerMigration())
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Error(err)
+		}
+		applied, err := migrator.GetAppliedMigrations(db)
+		if err != nil || len(applied) != 2 {
+			t.Errorf("Expected 2 applied migrations. Got %d (%v)", len(applied), err)
+		}
+	})
+
+	t.Run("signature", func(t *testing.T) {
+		key := []byte("secret")
+		migrations := []*Migration{{ID: "2020-01-01 Signed", Script: "CREATE TABLE signed (id INTEGER)"}}
+		signature := SignMigrations(key, migrations)
+
+		tampered := []*Migration{{ID: "2020-01-01 Signed", Script: "CREATE TABLE unsigned (id INTEGER)"}}
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("signed_migrations"), WithSignature(key, signature))
+		if err := migrator.Apply(db, tampered); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("Expected ErrInvalidSignature. Got %v", err)
+		}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("redis locker", func(t *testing.T) {
+		locker := NewRedisLocker(newFakeRedis(), "sqlite-migrations")
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("redis_migrations"), WithLocker(locker))
+		migrations := []*Migration{{ID: "2020-01-01 Redis", Script: "CREATE TABLE redis_locked (id INTEGER)"}}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Error(err)
+		}
+		if err := locker.Lock(nil); err != nil {
+			t.Errorf("Expected Apply to release the lock. Got %v", err)
+		}
+		_ = locker.Unlock(nil)
+	})
+
+	t.Run("file locker", func(t *testing.T) {
+		locker := NewFileLocker(filepath.Join(t.TempDir(), "sqlite.lock"))
+		migrator := NewMigrator(WithDialect(NewSQLite()), WithTableName("file_locked_migrations"), WithLocker(locker))
+		migrations := []*Migration{{ID: "2020-01-01 File", Script: "CREATE TABLE file_locked (id INTEGER)"}}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("maintenance", func(t *testing.T) {
+		var statements []string
+		migrator := NewMigrator(
+			WithDialect(NewSQLite()),
+			WithTableName("maintenance_migrations"),
+			WithMaintenance(Maintenance{Analyze: true, Vacuum: true, PostRun: []string{"PRAGMA optimize"}}),
+			WithQueryLogger(QueryLoggerFunc(func(query string, args []interface{}, duration time.Duration, err error) {
+				statements = append(statements, query)
+			})),
+		)
+		migrations := []*Migration{
+			{ID: "2020-01-01 Backfilled", Script: "CREATE TABLE backfilled (n INTEGER); INSERT INTO backfilled VALUES (1)"},
+		}
+		if err := migrator.Apply(db, migrations); err != nil {
+			t.Fatal(err)
+		}
+		last := strings.Join(statements[len(statements)-3:], "; ")
+		if last != "VACUUM; ANALYZE backfilled; PRAGMA optimize" {
+			t.Errorf("Expected maintenance after the migrations. Got %q", last)
+		}
+	})
+
 	t.Run("locking", func(t *testing.T) {
 		var wg sync.WaitGroup
 		var inflight int32
@@ -110,6 +1548,114 @@ func TestSQLite(t *testing.T) {
 		wg.Wait()
 	})
 
+	t.Run("immediate locking", func(t *testing.T) {
+		var wg sync.WaitGroup
+		tableName := fmt.Sprintf("immediate_migrations_%d", time.Now().UnixNano())
+		dataTable := fmt.Sprintf("immediate_data_%d", time.Now().UnixNano())
+		migrations := []*Migration{
+			{
+				ID:     "A",
+				Script: fmt.Sprintf("CREATE TABLE %s (id INTEGER);", dataTable),
+			},
+		}
+
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				migrator := NewMigrator(
+					WithDialect(NewSQLite(WithSQLiteImmediateLock(), WithSQLiteLockTable("unused_locks"))),
+					WithTableName(tableName),
+				)
+				if err := migrator.Apply(db, migrations); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		var count int
+		err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'unused_locks'`).Scan(&count)
+		if err != nil {
+			t.Error(err)
+		}
+		if count != 0 {
+			t.Error("expected no lock table with immediate locking")
+		}
+	})
+
+	t.Run("drop lock table", func(t *testing.T) {
+		s := NewSQLite(WithSQLiteLockTable("dropped_locks"), WithSQLiteDropLockTable())
+		migrator := NewMigrator(WithDialect(s), WithTableName("dropped_lock_migrations"))
+		err := migrator.Apply(db, []*Migration{
+			{
+				ID:     "A",
+				Script: "SELECT 1;",
+			},
+		})
+		if err != nil {
+			t.Error(err)
+		}
+
+		var count int
+		err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'dropped_locks'`).Scan(&count)
+		if err != nil {
+			t.Error(err)
+		}
+		if count != 0 {
+			t.Error("expected the lock table to be dropped after unlocking")
+		}
+	})
+
+	t.Run("session pragmas", func(t *testing.T) {
+		s := NewSQLite(WithSQLiteBusyTimeout(10*time.Second), WithSQLiteWAL())
+		migrator := NewMigrator(WithDialect(s), WithTableName("pragma_migrations"))
+		err := migrator.Apply(db, []*Migration{
+			{
+				ID:     "A",
+				Script: "SELECT 1;",
+			},
+		})
+		if err != nil {
+			t.Error(err)
+		}
+
+		var mode string
+		if err := db.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil {
+			t.Error(err)
+		}
+		if mode != "wal" {
+			t.Errorf("expected journal_mode wal, got %q", mode)
+		}
+	})
+
+	t.Run("lock timeout with backoff", func(t *testing.T) {
+		s := NewSQLite(
+			WithSQLiteLockTimeout(time.Second),
+			WithSQLiteLockPollInterval(10*time.Millisecond),
+			WithSQLiteLockBackoff(200*time.Millisecond),
+		)
+
+		_, err := db.Exec(
+			fmt.Sprintf(`INSERT INTO %s (id, code, expiration) VALUES (?,?,?)`, s.lockTable),
+			lockMagicNum, 1234, time.Now().Add(10*time.Second))
+		if err != nil {
+			t.Error(err)
+		}
+		defer func() {
+			_, _ = db.Exec(fmt.Sprintf(`DELETE FROM %s`, s.lockTable))
+		}()
+
+		startedAt := time.Now()
+		err = s.Lock(db)
+		if err != ErrSQLiteLockTimeout {
+			t.Errorf("expected timeout error, got %v", err)
+		}
+		if elapsed := time.Since(startedAt); elapsed > 2*time.Second {
+			t.Errorf("expected lock timeout after about 1s, took %s", elapsed)
+		}
+	})
+
 	t.Run("lock timeout", func(t *testing.T) {
 		s := NewSQLite(WithSQLiteLockDuration(3 * time.Second))
 
@@ -126,3 +1672,70 @@ func TestSQLite(t *testing.T) {
 		}
 	})
 }
+
+// implicitCommitSQLite is a SQLite dialect which splits statements and
+// treats CREATE as committing implicitly, as MySQL does
+type implicitCommitSQLite struct {
+	*sqliteDialect
+}
+
+func (i implicitCommitSQLite) Capabilities() Capabilities {
+	return Capabilities{LockStrategy: LockStrategyLockTable}
+}
+
+func (i implicitCommitSQLite) SplitStatements(script string) []string {
+	return splitStatements(script)
+}
+
+func (i implicitCommitSQLite) CommitsImplicitly(statement string) bool {
+	return strings.HasPrefix(statement, "CREATE")
+}
+
+// atomicSQLite is an implicitCommitSQLite dialect which detects atomic DDL,
+// as MySQL 8 does
+type atomicSQLite struct {
+	implicitCommitSQLite
+}
+
+func (a atomicSQLite) DetectCapabilities(serverVersion string) Capabilities {
+	caps := a.Capabilities()
+	caps.AtomicDDL = serverVersion != ""
+	return caps
+}
+
+// replicaSQLite is a SQLite dialect which reports whether it is a replica
+// with the supplied query
+type replicaSQLite struct {
+	*sqliteDialect
+	replicaSQL string
+}
+
+func (r replicaSQLite) ReplicaSQL() string {
+	return r.replicaSQL
+}
+
+// brokenSelectSQLite reads the tracking table with a query which fails for a
+// reason other than the table being missing
+type brokenSelectSQLite struct {
+	*sqliteDialect
+}
+
+func (b brokenSelectSQLite) SelectSQL(tableName string) string {
+	return fmt.Sprintf("SELECT no_such_column FROM %s", tableName)
+}
+
+// minimalSQLite implements only Dialect and Locker, like a third-party
+// dialect written before the optional interfaces
+type minimalSQLite struct {
+	s *sqliteDialect
+}
+
+func (d minimalSQLite) QuotedTableName(schemaName, tableName string) string {
+	return d.s.QuotedTableName(schemaName, tableName)
+}
+
+func (d minimalSQLite) CreateSQL(tableName string) string { return d.s.CreateSQL(tableName) }
+func (d minimalSQLite) SelectSQL(tableName string) string { return d.s.SelectSQL(tableName) }
+func (d minimalSQLite) InsertSQL(tableName string) string { return d.s.InsertSQL(tableName) }
+func (d minimalSQLite) Lock(db *sql.DB) error             { return d.s.Lock(db) }
+func (d minimalSQLite) Unlock(db *sql.DB) error           { return d.s.Unlock(db) }
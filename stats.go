@@ -0,0 +1,88 @@
+package schema
+
+import (
+	"sort"
+	"time"
+)
+
+// StatsSlowest is the number of migrations listed in Stats.Slowest
+const StatsSlowest = 10
+
+// Stats aggregates the execution times recorded in the tracking table, so
+// that the cost of migrating can be followed over the life of a project
+type Stats struct {
+	// Count is the number of migrations recorded, including skipped ones
+	Count int
+	// Total is the time taken to run every recorded migration. Always
+	// migrations only count their latest run.
+	Total time.Duration
+	// Slowest lists up to StatsSlowest migrations which took longest, the
+	// slowest first
+	Slowest []*AppliedMigration
+	// Months counts the migrations applied each month, oldest first.
+	// Months in which none were applied are left out.
+	Months []*MonthStats
+}
+
+// MonthStats counts the migrations applied in a calendar month
+type MonthStats struct {
+	// Month is midnight UTC on the first day of the month
+	Month time.Time
+	Count int
+	Total time.Duration
+}
+
+// Stats reads the tracking table and aggregates the recorded execution
+// times. Like Status, it changes nothing and is safe with read-only
+// credentials.
+func (m Migrator) Stats(db Queryer) (*Stats, error) {
+	applied, err := m.GetAppliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	return newStats(applied), nil
+}
+
+// newStats aggregates the applied migrations
+func newStats(applied map[string]*AppliedMigration) *Stats {
+	stats := &Stats{
+		Count:   len(applied),
+		Slowest: make([]*AppliedMigration, 0, StatsSlowest),
+		Months:  make([]*MonthStats, 0),
+	}
+
+	ran := make([]*AppliedMigration, 0, len(applied))
+	months := make(map[time.Time]*MonthStats)
+	for _, migration := range applied {
+		took := time.Duration(migration.ExecutionTimeInMillis) * time.Millisecond
+		stats.Total += took
+
+		at := migration.AppliedAt.UTC()
+		month := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if months[month] == nil {
+			months[month] = &MonthStats{Month: month}
+			stats.Months = append(stats.Months, months[month])
+		}
+		months[month].Count++
+		months[month].Total += took
+
+		if !migration.Skipped() {
+			ran = append(ran, migration)
+		}
+	}
+
+	sort.Slice(stats.Months, func(i, j int) bool {
+		return stats.Months[i].Month.Before(stats.Months[j].Month)
+	})
+	// Sort by ID first so that migrations which took as long are listed in
+	// a stable order
+	sortApplied(ran)
+	sort.SliceStable(ran, func(i, j int) bool {
+		return ran[i].ExecutionTimeInMillis > ran[j].ExecutionTimeInMillis
+	})
+	if len(ran) > StatsSlowest {
+		ran = ran[:StatsSlowest]
+	}
+	stats.Slowest = append(stats.Slowest, ran...)
+	return stats
+}
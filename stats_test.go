@@ -0,0 +1,41 @@
+package schema
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	applied := map[string]*AppliedMigration{
+		"2020-01-01 A": {Migration: Migration{ID: "2020-01-01 A"}, ExecutionTimeInMillis: 200, AppliedAt: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)},
+		"2020-01-20 B": {Migration: Migration{ID: "2020-01-20 B"}, ExecutionTimeInMillis: 1500, AppliedAt: time.Date(2020, 1, 20, 12, 0, 0, 0, time.UTC)},
+		"2020-03-02 C": {Migration: Migration{ID: "2020-03-02 C"}, ExecutionTimeInMillis: 200, AppliedAt: time.Date(2020, 3, 2, 12, 0, 0, 0, time.UTC)},
+		"2020-03-03 D": {Migration: Migration{ID: "2020-03-03 D"}, Checksum: skippedPrefix + "abc", AppliedAt: time.Date(2020, 3, 3, 12, 0, 0, 0, time.UTC)},
+	}
+
+	stats := newStats(applied)
+	if stats.Count != 4 || stats.Total != 1900*time.Millisecond {
+		t.Errorf("Expected 4 migrations taking 1.9s. Got %d taking %s", stats.Count, stats.Total)
+	}
+
+	expectedSlowest := []string{"2020-01-20 B", "2020-01-01 A", "2020-03-02 C"}
+	if len(stats.Slowest) != len(expectedSlowest) {
+		t.Fatalf("Expected %d slowest migrations. Got %d", len(expectedSlowest), len(stats.Slowest))
+	}
+	for i, id := range expectedSlowest {
+		if stats.Slowest[i].ID != id {
+			t.Errorf("Expected slowest migration %d to be %s. Got %s", i, id, stats.Slowest[i].ID)
+		}
+	}
+
+	if len(stats.Months) != 2 {
+		t.Fatalf("Expected 2 months. Got %d", len(stats.Months))
+	}
+	january, march := stats.Months[0], stats.Months[1]
+	if january.Month.Month() != time.January || january.Count != 2 || january.Total != 1700*time.Millisecond {
+		t.Errorf("Unexpected January stats: %+v", january)
+	}
+	if march.Month.Month() != time.March || march.Count != 2 || march.Total != 200*time.Millisecond {
+		t.Errorf("Unexpected March stats: %+v", march)
+	}
+}
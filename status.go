@@ -0,0 +1,93 @@
+package schema
+
+// Status describes how a set of migrations compares with the migrations
+// recorded in a database's tracking table.
+type Status struct {
+	// Applied lists the migrations recorded in the tracking table
+	Applied []*AppliedMigration
+	// Pending lists the supplied migrations which Apply would run. Always
+	// migrations are only pending until they have run once.
+	Pending []*Migration
+	// Drifted lists applied migrations whose source script no longer
+	// matches the checksum recorded when it was applied
+	Drifted []*Drift
+	// Unknown lists applied migrations which are missing from the
+	// supplied migrations
+	Unknown []*AppliedMigration
+	// Partial lists applied migrations which failed after some of their
+	// statements were committed. See ResolvePartial.
+	Partial []*AppliedMigration
+}
+
+// Drift describes an applied migration whose source has changed since it
+// was applied
+type Drift struct {
+	Migration       *Migration
+	Applied         *AppliedMigration
+	CurrentChecksum string
+}
+
+// Current returns whether the database has every supplied migration
+// applied, with no checksum drift or partially applied migrations
+func (s *Status) Current() bool {
+	return len(s.Pending) == 0 && len(s.Drifted) == 0 && len(s.Partial) == 0
+}
+
+// Status compares the supplied migrations with those recorded in the
+// database's tracking table without changing anything, so it is safe to call
+// from health checks and with read-only credentials. An error is returned if
+// the tracking table can't be read, including when it doesn't exist yet.
+func (m Migrator) Status(db Queryer, migrations []*Migration) (*Status, error) {
+	applied, err := m.GetAppliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	return m.newStatus(applied, m.forDialect(migrations)), nil
+}
+
+// newStatus builds a Status from the applied migrations and the supplied
+// migrations, with every list sorted by ID
+func (m Migrator) newStatus(applied map[string]*AppliedMigration, migrations []*Migration) *Status {
+	status := &Status{
+		Applied: make([]*AppliedMigration, 0, len(applied)),
+		Pending: make([]*Migration, 0),
+		Drifted: make([]*Drift, 0),
+		Unknown: make([]*AppliedMigration, 0),
+		Partial: make([]*AppliedMigration, 0),
+	}
+
+	known := make(map[string]bool, len(migrations))
+	sorted := make([]*Migration, len(migrations))
+	copy(sorted, migrations)
+	SortMigrations(sorted)
+	for _, migration := range sorted {
+		known[migration.ID] = true
+		record, exists := applied[migration.ID]
+		if _, inProgress := batchProgress(record); !exists || inProgress {
+			status.Pending = append(status.Pending, migration)
+			continue
+		}
+		if _, partial := record.Partial(); partial {
+			status.Partial = append(status.Partial, record)
+			continue
+		}
+		if !m.matches(record, migration) {
+			status.Drifted = append(status.Drifted, &Drift{
+				Migration:       migration,
+				Applied:         record,
+				CurrentChecksum: m.checksum(migration),
+			})
+		}
+	}
+
+	for _, record := range applied {
+		status.Applied = append(status.Applied, record)
+		if !known[record.ID] {
+			status.Unknown = append(status.Unknown, record)
+		}
+	}
+	sortApplied(status.Applied)
+	sortApplied(status.Unknown)
+
+	return status
+}
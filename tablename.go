@@ -0,0 +1,97 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInvalidTableName is wrapped by the TableNameError returned when the
+// tracking table's name or schema can't be used safely
+var ErrInvalidTableName = errors.New("invalid tracking table name")
+
+// TableNameError is returned by Apply when the name of the tracking table,
+// or of its schema, is unsafe to interpolate into SQL or too long for the
+// database (see WithTableName)
+type TableNameError struct {
+	Name   string
+	Reason string
+}
+
+func (e *TableNameError) Error() string {
+	return fmt.Sprintf("Invalid tracking table name %q: %s", e.Name, e.Reason)
+}
+
+// Unwrap returns ErrInvalidTableName, so that errors.Is can match it
+func (e *TableNameError) Unwrap() error {
+	return ErrInvalidTableName
+}
+
+// IdentifierLimiter defines an interface for dialects which limit the
+// length of identifiers, such as the 63 bytes of Postgres, so that names
+// which are too long are refused before the database truncates them.
+// Lengths are compared in bytes.
+type IdentifierLimiter interface {
+	MaxIdentifierLength() int
+}
+
+// ValidateTableName checks the names of the tracking table and its schema,
+// including the tables named after it which the Migrator records builds and
+// scripts in. Names are always quoted, so reserved words such as "order"
+// are safe, but quote characters, control characters and invalid UTF-8 are
+// refused rather than risk breaking out of the quoting, as are names longer
+// than the dialect allows. It returns a *TableNameError for the first
+// problem found, or nil.
+func (m Migrator) ValidateTableName() error {
+	if m.TableName == "" {
+		return &TableNameError{Name: m.TableName, Reason: "the name is empty"}
+	}
+	err := m.validateIdentifier(m.TableName, m.longestTableName())
+	if err != nil || m.SchemaName == "" {
+		return err
+	}
+	return m.validateIdentifier(m.SchemaName, m.SchemaName)
+}
+
+// longestTableName returns the longest name of the tables the Migrator
+// creates
+func (m Migrator) longestTableName() string {
+	longest := m.TableName
+	if m.BuildMetadata != "" {
+		longest = m.TableName + BuildsTableSuffix
+	}
+	if m.RecordScripts && len(m.TableName+ScriptsTableSuffix) > len(longest) {
+		longest = m.TableName + ScriptsTableSuffix
+	}
+	if m.RecordSetChecksum && len(m.TableName+SetTableSuffix) > len(longest) {
+		longest = m.TableName + SetTableSuffix
+	}
+	return longest
+}
+
+// validateIdentifier checks the characters of name, and the length of
+// longest, which is the longest identifier made from it
+func (m Migrator) validateIdentifier(name, longest string) error {
+	if strings.TrimSpace(name) == "" {
+		return &TableNameError{Name: name, Reason: "the name is blank"}
+	}
+	if !utf8.ValidString(name) {
+		return &TableNameError{Name: name, Reason: "the name is not valid UTF-8"}
+	}
+	for _, r := range name {
+		switch {
+		case r == '"' || r == '`' || r == '\'':
+			return &TableNameError{Name: name, Reason: fmt.Sprintf("the name contains the quote character %q", r)}
+		case unicode.IsControl(r):
+			return &TableNameError{Name: name, Reason: fmt.Sprintf("the name contains the control character %U", r)}
+		}
+	}
+	if limiter, ok := m.Dialect.(IdentifierLimiter); ok {
+		if max := limiter.MaxIdentifierLength(); max > 0 && len(longest) > max {
+			return &TableNameError{Name: name, Reason: fmt.Sprintf("%q is longer than %d, the most the database allows", longest, max)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package schema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateTableName(t *testing.T) {
+	valid := []Migrator{
+		NewMigrator(),
+		NewMigrator(WithTableName("order")),
+		NewMigrator(WithTableName("app", "migrations.v2")),
+		NewMigrator(WithDialect(NewSQLite()), WithTableName(strings.Repeat("m", 200))),
+		NewMigrator(WithTableName(strings.Repeat("m", 63))),
+	}
+	for _, m := range valid {
+		if err := m.ValidateTableName(); err != nil {
+			t.Errorf("Expected %s to be valid. Got %v", m.QuotedTableName(), err)
+		}
+	}
+
+	invalid := []Migrator{
+		NewMigrator(WithTableName("")),
+		NewMigrator(WithTableName("  ")),
+		NewMigrator(WithTableName(`migrations"; DROP TABLE users; --`)),
+		NewMigrator(WithDialect(MySQL), WithTableName("migrations`")),
+		NewMigrator(WithTableName("app\x00", "migrations")),
+		NewMigrator(WithTableName("migrations\n")),
+		NewMigrator(WithTableName("\xff")),
+		NewMigrator(WithTableName(strings.Repeat("m", 64))),
+		NewMigrator(WithTableName(strings.Repeat("m", 60)), WithBuildMetadata("abc123")),
+		NewMigrator(WithDialect(MySQL), WithTableName(strings.Repeat("m", 60)), WithScriptRecording()),
+		NewMigrator(WithTableName(strings.Repeat("m", 60)), WithSetChecksum()),
+	}
+	for _, m := range invalid {
+		err := m.ValidateTableName()
+		var nameErr *TableNameError
+		if !errors.As(err, &nameErr) || !errors.Is(err, ErrInvalidTableName) {
+			t.Errorf("Expected a TableNameError for %q.%q. Got %v", m.SchemaName, m.TableName, err)
+		}
+	}
+}
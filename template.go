@@ -0,0 +1,100 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// TemplateDatabase speeds up tests on Postgres by applying the migrations
+// once to a template database, and then creating each test's database as a
+// copy of it with CREATE DATABASE ... TEMPLATE, which takes milliseconds
+// however many migrations there are.
+//
+// Postgres refuses to copy a database which has open connections, so the
+// template is only connected to while it is being prepared.
+type TemplateDatabase struct {
+	// Migrator applies the migrations to the template
+	Migrator Migrator
+
+	// Admin is a connection to another database on the same server, such
+	// as "postgres", as a role which may create databases
+	Admin *sql.DB
+
+	// Name is the name of the template database. It is created if it
+	// doesn't exist, and migrated if it already does, so it can be kept
+	// between test runs.
+	Name string
+
+	// Open opens a connection to the named database on the same server,
+	// such as by substituting the name into a DSN
+	Open func(name string) (*sql.DB, error)
+
+	once sync.Once
+	err  error
+}
+
+// Prepare creates the template database if necessary and applies the
+// migrations to it. Only the first call does anything, so it is safe to
+// call from every test. The error of the first call is returned by every
+// call.
+func (t *TemplateDatabase) Prepare(ctx context.Context, migrations []*Migration) error {
+	t.once.Do(func() {
+		t.err = t.prepare(ctx, migrations)
+	})
+	return t.err
+}
+
+func (t *TemplateDatabase) prepare(ctx context.Context, migrations []*Migration) (err error) {
+	if t.Admin == nil {
+		return ErrNilDB
+	}
+	var exists bool
+	err = t.Admin.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)`, t.Name).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		_, err = t.Admin.ExecContext(ctx, fmt.Sprintf(`CREATE DATABASE %s`, Postgres.quotedIdent(t.Name)))
+		if err != nil {
+			return err
+		}
+	}
+
+	db, err := t.Open(t.Name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := db.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	return t.Migrator.ApplyContext(ctx, db, migrations)
+}
+
+// Clone creates the named database as a copy of the template, and opens it.
+// Prepare must have been called first. The database should be dropped with
+// Drop once the test has finished with it.
+func (t *TemplateDatabase) Clone(ctx context.Context, name string) (*sql.DB, error) {
+	if t.Admin == nil {
+		return nil, ErrNilDB
+	}
+	_, err := t.Admin.ExecContext(ctx, fmt.Sprintf(`CREATE DATABASE %s TEMPLATE %s`, Postgres.quotedIdent(name), Postgres.quotedIdent(t.Name)))
+	if err != nil {
+		return nil, fmt.Errorf("Cloning template database '%s' failed:\n%w", t.Name, err)
+	}
+	return t.Open(name)
+}
+
+// Drop drops the named database, such as one made by Clone. Connections to
+// it must be closed first.
+func (t *TemplateDatabase) Drop(ctx context.Context, name string) error {
+	if t.Admin == nil {
+		return ErrNilDB
+	}
+	_, err := t.Admin.ExecContext(ctx, fmt.Sprintf(`DROP DATABASE IF EXISTS %s`, Postgres.quotedIdent(name)))
+	return err
+}
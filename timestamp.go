@@ -0,0 +1,64 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timestampLayouts are the forms in which drivers return timestamps as text,
+// such as SQLite's DATETIME strings and MySQL's DATETIME without parseTime
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+// timestampScanner scans a timestamp column into a time.Time in UTC,
+// whichever form the driver returns it in
+type timestampScanner struct {
+	t *time.Time
+}
+
+// timestamp returns a sql.Scanner which stores a timestamp column in t
+func timestamp(t *time.Time) *timestampScanner {
+	return &timestampScanner{t: t}
+}
+
+// Scan implements sql.Scanner. Text without a time zone is taken to be UTC,
+// which is how timestamps are recorded.
+func (s *timestampScanner) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*s.t = time.Time{}
+		return nil
+	case time.Time:
+		*s.t = v.UTC()
+		return nil
+	case int64:
+		*s.t = time.Unix(v, 0).UTC()
+		return nil
+	case []byte:
+		return s.parse(string(v))
+	case string:
+		return s.parse(v)
+	}
+	return fmt.Errorf("cannot scan %T into a timestamp", value)
+}
+
+// parse stores the text timestamp, trying each of the timestampLayouts
+func (s *timestampScanner) parse(text string) error {
+	text = strings.TrimSpace(text)
+	for _, layout := range timestampLayouts {
+		t, err := time.Parse(layout, text)
+		if err == nil {
+			*s.t = t.UTC()
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot parse %q as a timestamp", text)
+}
@@ -0,0 +1,38 @@
+package schema
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimestampScanner(t *testing.T) {
+	expected := time.Date(2020, 1, 2, 3, 4, 5, 600000000, time.UTC)
+	values := []interface{}{
+		expected,
+		expected.In(time.FixedZone("EST", -5*60*60)),
+		"2020-01-02T03:04:05.6Z",
+		"2020-01-02 03:04:05.6+00:00",
+		"2020-01-02 03:04:05.6",
+		[]byte("2020-01-02 03:04:05.600000"),
+		"2020-01-01 22:04:05.6 -0500 EST",
+		"2020-01-02 05:04:05.6+02",
+	}
+	for _, value := range values {
+		var scanned time.Time
+		if err := timestamp(&scanned).Scan(value); err != nil {
+			t.Errorf("Unexpected error scanning %v: %v", value, err)
+			continue
+		}
+		if !scanned.Equal(expected) || scanned.Location() != time.UTC {
+			t.Errorf("Expected %v to scan as %s. Got %s", value, expected, scanned)
+		}
+	}
+
+	var scanned time.Time
+	if err := timestamp(&scanned).Scan("yesterday"); err == nil {
+		t.Errorf("Expected an error scanning an unparseable timestamp. Got %s", scanned)
+	}
+	if err := timestamp(&scanned).Scan(nil); err != nil || !scanned.IsZero() {
+		t.Errorf("Expected NULL to scan as the zero time. Got %s (%v)", scanned, err)
+	}
+}
@@ -0,0 +1,102 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotTransactional is returned by Apply when a migration which runs in a
+// transaction has a statement the dialect can't run in one
+var ErrNotTransactional = errors.New("statement can't run inside a transaction; set DisableTransaction on the migration")
+
+// checkTransactional fails the plan if a migration which runs in a
+// transaction has a statement which the dialect can't run in one, on
+// dialects which implement NonTransactionalDetector, so that it fails before
+// any migration runs rather than with a driver error part way through
+func (m Migrator) checkTransactional(plan []*Migration) error {
+	detector, ok := m.Dialect.(NonTransactionalDetector)
+	if !ok {
+		return nil
+	}
+	for _, migration := range plan {
+		if migration.DisableTransaction || migration.External || !m.appliesToDialect(migration) {
+			continue
+		}
+		script, err := m.renderScript(migration)
+		if err != nil {
+			return err
+		}
+		for _, statement := range m.statements(script) {
+			if detector.RequiresNoTransaction(statement, m.serverVersion) {
+				return fmt.Errorf("Migration '%s' Failed:\n%w: %s", migration.ID, ErrNotTransactional, m.redact(statement))
+			}
+		}
+	}
+	return nil
+}
+
+// runUntransactedMigration runs a migration with DisableTransaction. Its
+// conditions are checked in one transaction, its statements are then executed
+// one at a time on the connection, each committed as it runs, or its
+// ConcurrentIndex is built, and the migration is recorded in a final
+// transaction. It returns whether the script
+// was skipped because of its OnlyIf condition or precondition.
+func (m Migrator) runUntransactedMigration(ctx context.Context, db *sql.DB, conn *sql.Conn, migration *Migration, rerun bool) (skip bool, err error) {
+	startedAt := time.Now()
+	var reason string
+	err = m.transaction(ctx, conn, func(tx *sql.Tx) (err error) {
+		skip, reason, err = m.checkConditions(ctx, tx, migration)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if !skip && migration.ConcurrentIndex != nil {
+		err = m.buildConcurrentIndex(ctx, db, conn, migration)
+	} else if !skip {
+		err = m.execUntransacted(ctx, conn, migration)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return skip, m.transaction(ctx, conn, func(tx *sql.Tx) error {
+		err := m.setupTransaction(ctx, tx)
+		if err != nil {
+			return err
+		}
+		return m.completeMigration(ctx, tx, migration, rerun, skip, reason, startedAt)
+	})
+}
+
+// execUntransacted executes the statements of the migration's script one at a
+// time outside of a transaction. When a statement fails after others have
+// run, the error is a PartialMigrationError, since those are committed.
+func (m Migrator) execUntransacted(ctx context.Context, conn *sql.Conn, migration *Migration) error {
+	script, err := m.renderScript(migration)
+	if err != nil {
+		return err
+	}
+	statements := m.statements(script)
+	for i, statement := range statements {
+		_, err = m.exec(ctx, conn, statement)
+		if err != nil && i > 0 {
+			return &PartialMigrationError{
+				MigrationID: migration.ID,
+				Committed:   i,
+				Total:       len(statements),
+				Statement:   m.redact(statement),
+				AtomicDDL:   m.atomicDDL,
+				Err:         err,
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("Migration '%s' Failed at statement %d of %d:\n%w", migration.ID, i+1, len(statements), err)
+		}
+	}
+	return nil
+}
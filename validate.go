@@ -0,0 +1,130 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationRule names a static check made by Validate
+type ValidationRule string
+
+// The checks made by Validate
+const (
+	// ValidationDuplicateID flags migrations which share an ID, which Apply
+	// refuses to run
+	ValidationDuplicateID ValidationRule = "duplicate-id"
+	// ValidationEmptyID flags migrations with a blank ID
+	ValidationEmptyID ValidationRule = "empty-id"
+	// ValidationEmptyScript flags migrations with nothing to run, such as
+	// one loaded from an empty file
+	ValidationEmptyScript ValidationRule = "empty-script"
+	// ValidationNormalizedCollision flags distinct IDs which are the same
+	// once case and surrounding or repeated whitespace are ignored, which
+	// is how a case-insensitive collation (the MySQL default) compares them
+	// in the tracking table
+	ValidationNormalizedCollision ValidationRule = "normalized-id-collision"
+	// ValidationDownWithoutUp flags a down script, such as one loaded from
+	// "0002_users.down.sql", without a matching up migration. This package
+	// doesn't roll back, so the down script would be applied as if it were
+	// a migration.
+	ValidationDownWithoutUp ValidationRule = "down-without-up"
+)
+
+// ValidationFinding describes a migration which fails a static check
+type ValidationFinding struct {
+	MigrationID string
+	Rule        ValidationRule
+	Message     string
+}
+
+func (f *ValidationFinding) String() string {
+	return fmt.Sprintf("Migration '%s' fails check %s: %s", f.MigrationID, f.Rule, f.Message)
+}
+
+// ValidationError is returned by Validate, listing every finding
+type ValidationError struct {
+	Findings []*ValidationFinding
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Findings))
+	for i, finding := range e.Findings {
+		lines[i] = finding.String()
+	}
+	return fmt.Sprintf("%d migration validation findings:\n%s", len(e.Findings), strings.Join(lines, "\n"))
+}
+
+// Validate checks the migrations for mistakes which can be found without a
+// database, such as duplicate IDs and empty scripts, so that they can be
+// reported all at once when migrations are loaded (or in a unit test)
+// rather than one at a time by Apply. It returns a *ValidationError listing
+// the findings, in the order of the migrations, or nil if there are none.
+func Validate(migrations []*Migration) error {
+	findings := make([]*ValidationFinding, 0)
+	add := func(id string, rule ValidationRule, message string) {
+		findings = append(findings, &ValidationFinding{MigrationID: id, Rule: rule, Message: message})
+	}
+
+	ids := make(map[string]int, len(migrations))
+	normalized := make(map[string]string, len(migrations))
+	for _, migration := range migrations {
+		ids[migration.ID]++
+	}
+	for _, migration := range migrations {
+		id := migration.ID
+		if strings.TrimSpace(id) == "" {
+			add(id, ValidationEmptyID, "the ID is blank")
+			continue
+		}
+		if count := ids[id]; count > 1 {
+			add(id, ValidationDuplicateID, fmt.Sprintf("%d migrations have this ID", count))
+			// Report each duplicated ID once
+			ids[id] = 0
+		}
+
+		key := normalizeID(id)
+		if other, exists := normalized[key]; exists && other != id {
+			add(id, ValidationNormalizedCollision, fmt.Sprintf("the ID collides with '%s'", other))
+		} else if !exists {
+			normalized[key] = id
+		}
+
+		if migration.empty() {
+			add(id, ValidationEmptyScript, "the migration has no script")
+		}
+
+		if base, down := downBase(id); down {
+			_, hasBase := ids[base]
+			_, hasUp := ids[base+".up"]
+			if !hasBase && !hasUp {
+				add(id, ValidationDownWithoutUp, fmt.Sprintf("there is no '%s' or '%s.up' migration", base, base))
+			}
+		}
+	}
+
+	if len(findings) == 0 {
+		return nil
+	}
+	return &ValidationError{Findings: findings}
+}
+
+// normalizeID returns the ID without case and surrounding or repeated
+// whitespace
+func normalizeID(id string) string {
+	return strings.ToLower(strings.Join(strings.Fields(id), " "))
+}
+
+// downBase returns the ID without its ".down" suffix, and whether it had one
+func downBase(id string) (string, bool) {
+	const suffix = ".down"
+	if len(id) > len(suffix) && strings.EqualFold(id[len(id)-len(suffix):], suffix) {
+		return id[:len(id)-len(suffix)], true
+	}
+	return id, false
+}
+
+// empty returns whether the migration has nothing to run: no script (other
+// than comments), dialect variants, batch, copy or seed
+func (m *Migration) empty() bool {
+	return isCommentOnly(m.Script) && len(m.DialectScripts) == 0 && m.Batch == nil && m.Copy == nil && m.Seed == nil
+}
@@ -0,0 +1,49 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	if err := Validate([]*Migration{
+		{ID: "0001_users", Script: "CREATE TABLE users (id INTEGER)"},
+		{ID: "0002_posts.up", Script: "CREATE TABLE posts (id INTEGER)"},
+		{ID: "0002_posts.down", Script: "DROP TABLE posts"},
+		{ID: "0003_backfill", Batch: &Batch{Statement: "UPDATE users SET active = true WHERE id BETWEEN $1 AND $2"}},
+	}); err != nil {
+		t.Errorf("Expected no findings. Got %v", err)
+	}
+
+	err := Validate([]*Migration{
+		{ID: "0001_users", Script: "CREATE TABLE users (id INTEGER)"},
+		{ID: "0001_users", Script: "CREATE TABLE people (id INTEGER)"},
+		{ID: "0001_users", Script: "CREATE TABLE humans (id INTEGER)"},
+		{ID: "0001_Users ", Script: "CREATE TABLE folks (id INTEGER)"},
+		{ID: "0002_empty", Script: "-- TODO\n"},
+		{ID: "0003_orders.down", Script: "DROP TABLE orders"},
+		{ID: " ", Script: "SELECT 1"},
+	})
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a ValidationError. Got %v", err)
+	}
+	expected := []struct {
+		id   string
+		rule ValidationRule
+	}{
+		{"0001_users", ValidationDuplicateID},
+		{"0001_Users ", ValidationNormalizedCollision},
+		{"0002_empty", ValidationEmptyScript},
+		{"0003_orders.down", ValidationDownWithoutUp},
+		{" ", ValidationEmptyID},
+	}
+	if len(validationErr.Findings) != len(expected) {
+		t.Fatalf("Expected %d findings. Got %v", len(expected), err)
+	}
+	for i, finding := range validationErr.Findings {
+		if finding.MigrationID != expected[i].id || finding.Rule != expected[i].rule {
+			t.Errorf("Expected finding %d to be %s for %q. Got %s", i, expected[i].rule, expected[i].id, finding)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnknownMigrations is returned by Verify when the tracking table records
+// migrations which are missing from the supplied migrations
+var ErrUnknownMigrations = errors.New("schema: tracking table records unknown migrations")
+
+// Verify checks the database against the supplied migrations without
+// writing anything, so it is safe to run against replicas and with
+// read-only credentials. See VerifyContext.
+func (m Migrator) Verify(db *sql.DB, migrations []*Migration) (*Status, error) {
+	return m.VerifyContext(context.Background(), db, migrations)
+}
+
+// VerifyContext checks that the tracking table exists, that no applied
+// migration has changed since it was applied or was left partially applied,
+// and that the tracking table records no migrations missing from the
+// supplied migrations. It returns an error wrapping ErrTrackingTableMissing,
+// ErrChecksumMismatch, ErrPartiallyApplied or ErrUnknownMigrations when a
+// check fails. Pending migrations are not an
+// error, and are reported in the returned Status, which is nil only when
+// the tracking table can't be read. The tracking table is read in a
+// transaction begun with the Migrator's ReadTxOptions, which is always
+// rolled back, and no lock is taken.
+func (m Migrator) VerifyContext(ctx context.Context, db *sql.DB, migrations []*Migration) (*Status, error) {
+	if db == nil {
+		return nil, ErrNilDB
+	}
+	var status *Status
+	err := m.readTransaction(ctx, db, func(tx *sql.Tx) (err error) {
+		status, err = m.Status(contextQueryer{ctx: ctx, db: tx}, migrations)
+		return err
+	})
+	if isMissingTableError(err) {
+		return nil, m.redactError(fmt.Errorf("%w: %s: %v", ErrTrackingTableMissing, m.QuotedTableName(), err))
+	}
+	if err != nil {
+		return nil, m.redactError(err)
+	}
+	if len(status.Drifted) > 0 {
+		return status, fmt.Errorf("%w: %s", ErrChecksumMismatch, driftedIDs(status.Drifted))
+	}
+	if len(status.Partial) > 0 {
+		return status, fmt.Errorf("%w: %s", ErrPartiallyApplied, appliedIDs(status.Partial))
+	}
+	if len(status.Unknown) > 0 {
+		return status, fmt.Errorf("%w: %s", ErrUnknownMigrations, appliedIDs(status.Unknown))
+	}
+	return status, nil
+}
+
+// driftedIDs returns the comma-separated IDs of the drifted migrations
+func driftedIDs(drifted []*Drift) string {
+	ids := make([]string, 0, len(drifted))
+	for _, drift := range drifted {
+		ids = append(ids, drift.Applied.ID)
+	}
+	return strings.Join(ids, ", ")
+}
+
+// appliedIDs returns the comma-separated IDs of the applied migrations
+func appliedIDs(applied []*AppliedMigration) string {
+	ids := make([]string, 0, len(applied))
+	for _, migration := range applied {
+		ids = append(ids, migration.ID)
+	}
+	return strings.Join(ids, ", ")
+}
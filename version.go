@@ -0,0 +1,106 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// versionPattern matches the dotted numbers at the start of a version
+// string, ignoring suffixes such as " (Debian 11.5-1)" or "-MariaDB"
+var versionPattern = regexp.MustCompile(`^\s*v?(\d+(?:\.\d+)*)`)
+
+// checkServerVersion returns an error wrapping ErrServerVersion when the
+// server is older than the Migrator's or a planned migration's
+// MinServerVersion. The server version is only queried when one is required.
+func (m Migrator) checkServerVersion(ctx context.Context, tx *sql.Tx, plan []*Migration) error {
+	required := m.MinServerVersion != ""
+	for _, migration := range plan {
+		required = required || (migration.MinServerVersion != "" && m.appliesToDialect(migration))
+	}
+	if !required {
+		return nil
+	}
+
+	reporter, ok := m.Dialect.(VersionReporter)
+	if !ok {
+		return fmt.Errorf("dialect can't report the server version required by MinServerVersion")
+	}
+	value, _, err := m.queryFirstValue(ctx, tx, reporter.VersionSQL())
+	if err != nil {
+		return err
+	}
+	server := fmt.Sprintf("%s", value)
+
+	if m.MinServerVersion != "" {
+		older, err := versionOlder(server, m.MinServerVersion)
+		if err != nil {
+			return err
+		}
+		if older {
+			return fmt.Errorf("%w: %s is required, but the server is %s", ErrServerVersion, m.MinServerVersion, server)
+		}
+	}
+	for _, migration := range plan {
+		if migration.MinServerVersion == "" || !m.appliesToDialect(migration) {
+			continue
+		}
+		older, err := versionOlder(server, migration.MinServerVersion)
+		if err != nil {
+			return fmt.Errorf("Migration '%s' Failed:\n%w", migration.ID, err)
+		}
+		if older {
+			return fmt.Errorf("Migration '%s' Failed:\n%w: %s is required, but the server is %s",
+				migration.ID, ErrServerVersion, migration.MinServerVersion, server)
+		}
+	}
+	return nil
+}
+
+// versionOlder returns whether version is older than minimum. Versions are
+// compared by their leading dotted numbers, and missing components count
+// as zero, so "11" is not older than "11.0".
+func versionOlder(version, minimum string) (bool, error) {
+	v, err := parseVersion(version)
+	if err != nil {
+		return false, err
+	}
+	min, err := parseVersion(minimum)
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i < len(v) || i < len(min); i++ {
+		a, b := 0, 0
+		if i < len(v) {
+			a = v[i]
+		}
+		if i < len(min) {
+			b = min[i]
+		}
+		if a != b {
+			return a < b, nil
+		}
+	}
+	return false, nil
+}
+
+// parseVersion returns the leading dotted numbers of a version string
+func parseVersion(version string) ([]int, error) {
+	match := versionPattern.FindStringSubmatch(version)
+	if match == nil {
+		return nil, fmt.Errorf("can't parse version %q", version)
+	}
+	parts := strings.Split(match[1], ".")
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse version %q: %w", version, err)
+		}
+		numbers[i] = n
+	}
+	return numbers, nil
+}
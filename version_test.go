@@ -0,0 +1,30 @@
+package schema
+
+import "testing"
+
+func TestVersionOlder(t *testing.T) {
+	tests := []struct {
+		version, minimum string
+		older            bool
+	}{
+		{"11.5 (Debian 11.5-1.pgdg90+1)", "12", true},
+		{"12.1", "12", false},
+		{"11", "11.0", false},
+		{"8.0.12", "8.0.13", true},
+		{"10.5.8-MariaDB", "10.5", false},
+		{"3.39.2", "3.35.0", false},
+	}
+	for _, test := range tests {
+		older, err := versionOlder(test.version, test.minimum)
+		if err != nil {
+			t.Errorf("Unexpected error comparing %q with %q: %v", test.version, test.minimum, err)
+		}
+		if older != test.older {
+			t.Errorf("Expected versionOlder(%q, %q) to be %t", test.version, test.minimum, test.older)
+		}
+	}
+
+	if _, err := versionOlder("unknown", "12"); err == nil {
+		t.Error("Expected an error for an unparseable version")
+	}
+}
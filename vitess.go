@@ -0,0 +1,154 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrForeignKeysNotSupported is returned by Apply when a migration
+	// declares a foreign key for a database which doesn't support them, such
+	// as Vitess
+	ErrForeignKeysNotSupported = errors.New("foreign keys are not supported")
+
+	// ErrSchemaChangeFailed is returned by Apply when a deferred schema
+	// change, such as a Vitess online DDL migration, fails or is cancelled
+	ErrSchemaChangeFailed = errors.New("schema change failed")
+)
+
+// vitessMode is the configuration of a MySQL dialect for Vitess
+type vitessMode struct {
+	ddlStrategy  string
+	pollInterval time.Duration
+}
+
+// WithMySQLVitess adapts the MySQL dialect to Vitess and PlanetScale.
+// Migrations which declare foreign keys are rejected before any of them run.
+// The DDL strategy, such as "vitess" for online DDL, is set for the session;
+// when it is empty the keyspace's default is used. Schema changes submitted
+// as online DDL complete in the background, so Apply waits for each to
+// complete (polling every pollInterval) before recording its migration,
+// and fails with ErrSchemaChangeFailed if it doesn't.
+// Usage: NewMySQL(WithMySQLVitess("vitess", 5*time.Second))
+func WithMySQLVitess(ddlStrategy string, pollInterval time.Duration) func(m *mysqlDialect) {
+	return func(m *mysqlDialect) {
+		m.vitess = &vitessMode{ddlStrategy: ddlStrategy, pollInterval: pollInterval}
+	}
+}
+
+// SessionSQL sets the Vitess DDL strategy, if there is one
+func (m mysqlDialect) SessionSQL() []string {
+	if m.vitess == nil || m.vitess.ddlStrategy == "" {
+		return nil
+	}
+	return []string{"SET @@ddl_strategy = " + mysqlLiteral(m.vitess.ddlStrategy)}
+}
+
+// ValidateStatement rejects foreign key DDL under Vitess
+func (m mysqlDialect) ValidateStatement(statement string) error {
+	if m.vitess == nil {
+		return nil
+	}
+	words := strings.Fields(strings.ToUpper(stripLeadingComments(statement)))
+	if len(words) < 2 || (words[0] != "CREATE" && words[0] != "ALTER") {
+		return nil
+	}
+	for i, word := range words {
+		if strings.HasPrefix(word, "REFERENCES") || (word == "FOREIGN" && i+1 < len(words) && strings.HasPrefix(words[i+1], "KEY")) {
+			return ErrForeignKeysNotSupported
+		}
+	}
+	return nil
+}
+
+// vitessDeferredKeywords are the leading keywords of statements which
+// Vitess executes as online DDL
+var vitessDeferredKeywords = []string{
+	"CREATE TABLE", "ALTER TABLE", "DROP TABLE",
+	"CREATE VIEW", "CREATE OR REPLACE VIEW", "ALTER VIEW", "DROP VIEW",
+}
+
+// DefersSchemaChange returns whether Vitess may execute the statement as
+// online DDL, which returns the UUID of the migration it submitted
+func (m mysqlDialect) DefersSchemaChange(statement string) bool {
+	if m.vitess == nil || m.vitess.ddlStrategy == "" || m.vitess.ddlStrategy == "direct" {
+		return false
+	}
+	words := strings.Fields(strings.ToUpper(stripLeadingComments(statement)))
+	for _, keyword := range vitessDeferredKeywords {
+		keywords := strings.Fields(keyword)
+		if len(words) >= len(keywords) && strings.Join(words[:len(keywords)], " ") == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// WaitForSchemaChange polls SHOW VITESS_MIGRATIONS until the online DDL
+// migration with the UUID completes, fails or is cancelled
+func (m mysqlDialect) WaitForSchemaChange(ctx context.Context, db QueryerContext, id string) error {
+	pollInterval := defaultLockPollInterval
+	if m.vitess != nil && m.vitess.pollInterval > 0 {
+		pollInterval = m.vitess.pollInterval
+	}
+	for {
+		status, message, err := vitessMigrationStatus(ctx, db, id)
+		if err != nil {
+			return err
+		}
+		switch status {
+		case "complete":
+			return nil
+		case "failed", "cancelled":
+			return fmt.Errorf("%w: Vitess migration %s %s: %s", ErrSchemaChangeFailed, id, status, message)
+		case "":
+			return fmt.Errorf("%w: Vitess migration %s not found", ErrSchemaChangeFailed, id)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// vitessMigrationStatus reads the status and message of the online DDL
+// migration with the UUID, or an empty status if there is none.
+// SHOW VITESS_MIGRATIONS returns many columns, which vary between Vitess
+// versions, so they are found by name.
+func vitessMigrationStatus(ctx context.Context, db QueryerContext, id string) (status string, message string, err error) {
+	rows, err := db.QueryContext(ctx, "SHOW VITESS_MIGRATIONS LIKE "+mysqlLiteral(id))
+	if err != nil {
+		return "", "", err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", "", err
+	}
+	if !rows.Next() {
+		return "", "", rows.Err()
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	err = rows.Scan(dest...)
+	if err != nil {
+		return "", "", err
+	}
+	for i, column := range columns {
+		switch strings.ToLower(column) {
+		case "migration_status":
+			status = values[i].String
+		case "message":
+			message = values[i].String
+		}
+	}
+	return status, message, nil
+}
@@ -0,0 +1,155 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Watcher applies new migration files from a directory as they appear. It is
+// intended for local development, so that schema changes can be iterated on
+// without restarting the application for every new file. The directory is
+// polled rather than subscribed to, so that no platform-specific file
+// notification dependency is required.
+type Watcher struct {
+	Migrator Migrator
+	DB       *sql.DB
+	Dir      string
+
+	// Interval is how often the directory is scanned for changes
+	Interval time.Duration
+
+	// Debounce is how long the directory must remain unchanged before the
+	// migrations are applied, so that half-written files and bursts of saves
+	// from an editor result in a single run
+	Debounce time.Duration
+
+	// Preview, when set, receives the SQL for the pending migrations before
+	// they are applied, as rendered by GenerateSQL
+	Preview io.Writer
+
+	// DryRun previews the pending migrations without applying them
+	DryRun bool
+
+	// OnError is called when loading or applying migrations fails. Watching
+	// continues afterwards, so that the failing file can be fixed. When nil,
+	// errors are logged to the Migrator's Logger.
+	OnError func(err error)
+}
+
+// NewWatcher creates a Watcher for the .sql files in dir which scans every
+// second and debounces changes by half a second
+func NewWatcher(migrator Migrator, db *sql.DB, dir string) *Watcher {
+	return &Watcher{
+		Migrator: migrator,
+		DB:       db,
+		Dir:      dir,
+		Interval: time.Second,
+		Debounce: 500 * time.Millisecond,
+	}
+}
+
+// Watch applies the pending migrations in the directory, then keeps applying
+// new and changed files until the context is cancelled, at which point it
+// returns the context's error
+func (w *Watcher) Watch(ctx context.Context) error {
+	if w.DB == nil {
+		return ErrNilDB
+	}
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	synced := ""
+	seen := ""
+	var changedAt time.Time
+	for {
+		fingerprint, err := w.fingerprint()
+		if err != nil {
+			w.handleError(err)
+		} else if fingerprint != seen {
+			seen = fingerprint
+			changedAt = time.Now()
+		}
+
+		if seen != synced && time.Since(changedAt) >= w.Debounce {
+			synced = seen
+			err = w.sync(ctx)
+			if err != nil && ctx.Err() == nil {
+				w.handleError(err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync previews and, unless this is a dry run, applies the pending migrations
+func (w *Watcher) sync(ctx context.Context) error {
+	migrations, err := MigrationsFromDirectoryPath(w.Dir)
+	if err != nil {
+		return err
+	}
+
+	// The tracking table doesn't exist before the first run, in which case
+	// every migration is pending
+	pending := migrations
+	status, err := w.Migrator.Status(w.DB, migrations)
+	if err == nil {
+		pending = status.Pending
+		for _, drift := range status.Drifted {
+			w.Migrator.log(fmt.Sprintf("Migration '%s' has changed since it was applied and won't be re-run\n", drift.Migration.ID))
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if w.Preview != nil {
+		err = w.Migrator.GenerateSQL(w.Preview, pending)
+		if err != nil {
+			return err
+		}
+	}
+	if w.DryRun {
+		return nil
+	}
+	return w.Migrator.ApplyContext(ctx, w.DB, migrations)
+}
+
+// fingerprint summarizes the names, sizes and modification times of the
+// migration files, so that any change to the directory changes it
+func (w *Watcher) fingerprint() (string, error) {
+	filenames, err := filepath.Glob(filepath.Join(w.Dir, "*.sql"))
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(filenames)
+
+	var b strings.Builder
+	for _, filename := range filenames {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s:%d:%d\n", filename, info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String(), nil
+}
+
+func (w *Watcher) handleError(err error) {
+	if w.OnError != nil {
+		w.OnError(err)
+		return
+	}
+	w.Migrator.log(fmt.Sprintf("Watcher error: %s\n", err))
+}